@@ -7,6 +7,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/overhead"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -23,30 +24,57 @@ func makeRawReportHandler(rep Reporter) CtxHandlerFunc {
 }
 
 type probeDesc struct {
-	ID       string    `json:"id"`
-	Hostname string    `json:"hostname"`
-	Version  string    `json:"version"`
-	LastSeen time.Time `json:"lastSeen"`
+	ID            string    `json:"id"`
+	Hostname      string    `json:"hostname"`
+	Version       string    `json:"version"`
+	LastSeen      time.Time `json:"lastSeen"`
+	ConfigVersion string    `json:"configVersion,omitempty"`
+	ConfigDrift   bool      `json:"configDrift"`
+
+	// The probe's own overhead, from the latest samples.
+	CPUUsage    float64 `json:"cpuUsage,omitempty"`
+	MemoryUsage float64 `json:"memoryUsage,omitempty"`
+	ReportBytes float64 `json:"reportBytes,omitempty"`
+}
+
+func lastSample(n report.Node, key string) float64 {
+	if metric, ok := n.Metrics.Lookup(key); ok {
+		if sample := metric.LastSample(); sample != nil {
+			return sample.Value
+		}
+	}
+	return 0
 }
 
 // Probe handler
-func makeProbeHandler(rep Reporter) CtxHandlerFunc {
+func makeProbeHandler(rep Reporter, configs *ProbeConfigs) CtxHandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		rpt, err := rep.Report(ctx)
 		if err != nil {
 			respondWith(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		desired, haveDesired, err := configs.Get(ctx)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 		result := []probeDesc{}
 		for _, n := range rpt.Host.Nodes {
 			id, _ := n.Latest.Lookup(report.ControlProbeID)
 			hostname, _ := n.Latest.Lookup(host.HostName)
 			version, dt, _ := n.Latest.LookupEntry(host.ScopeVersion)
+			configVersion, _ := n.Latest.Lookup(host.ProbeConfigVersion)
 			result = append(result, probeDesc{
-				ID:       id,
-				Hostname: hostname,
-				Version:  version,
-				LastSeen: dt,
+				ID:            id,
+				Hostname:      hostname,
+				Version:       version,
+				LastSeen:      dt,
+				ConfigVersion: configVersion,
+				ConfigDrift:   haveDesired && desired.Drift(n),
+				CPUUsage:      lastSample(n, overhead.CPUUsage),
+				MemoryUsage:   lastSample(n, overhead.MemoryUsage),
+				ReportBytes:   lastSample(n, overhead.ReportBytes),
 			})
 		}
 		respondWith(w, http.StatusOK, result)
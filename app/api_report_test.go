@@ -3,11 +3,16 @@ package app_test
 import (
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/app/multitenant"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/probe/overhead"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -32,3 +37,40 @@ func TestAPIReport(t *testing.T) {
 		t.Fatalf("JSON parse error: %s", err)
 	}
 }
+
+func TestAPIProbes(t *testing.T) {
+	now := time.Now()
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID("host1"), map[string]string{
+		report.ControlProbeID: "probe1",
+		host.HostName:         "host1",
+	}).WithMetrics(report.Metrics{
+		overhead.CPUUsage:    report.MakeMetric().Add(now, 1.5),
+		overhead.MemoryUsage: report.MakeMetric().Add(now, 1024),
+	}))
+	collector := app.NewCollector(time.Minute)
+	if err := collector.Add(context.Background(), rpt); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter().SkipClean(true)
+	app.RegisterProbeRoutes(router, collector, app.NewProbeConfigs(collector, app.NewLocalControlRouter(), app.UserIDer(multitenant.NoopUserIDer)), app.ControlPolicy{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var probes []struct {
+		ID          string  `json:"id"`
+		Hostname    string  `json:"hostname"`
+		CPUUsage    float64 `json:"cpuUsage"`
+		MemoryUsage float64 `json:"memoryUsage"`
+	}
+	if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/probes"), &codec.JsonHandle{}).Decode(&probes); err != nil {
+		t.Fatal(err)
+	}
+	if len(probes) != 1 {
+		t.Fatalf("Expected 1 probe, got %v", probes)
+	}
+	equals(t, "probe1", probes[0].ID)
+	equals(t, "host1", probes[0].Hostname)
+	equals(t, 1.5, probes[0].CPUUsage)
+	equals(t, 1024.0, probes[0].MemoryUsage)
+}
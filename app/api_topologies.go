@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/gorilla/mux"
@@ -123,12 +124,33 @@ func init() {
 			Name:        "services",
 			HideIfEmpty: true,
 		},
+		APITopologyDesc{
+			id:          "namespaces",
+			parent:      "pods",
+			renderer:    render.NamespaceRenderer,
+			Name:        "namespaces",
+			HideIfEmpty: true,
+		},
+		APITopologyDesc{
+			id:          "kubernetes-nodes",
+			parent:      "pods",
+			renderer:    render.KubernetesNodeRenderer,
+			Name:        "nodes",
+			HideIfEmpty: true,
+		},
 		APITopologyDesc{
 			id:       "hosts",
 			renderer: render.HostRenderer,
 			Name:     "Hosts",
 			Rank:     4,
 		},
+		APITopologyDesc{
+			id:          "systemd-services",
+			parent:      "hosts",
+			renderer:    render.SystemdServiceRenderer,
+			Name:        "services",
+			HideIfEmpty: true,
+		},
 	)
 }
 
@@ -166,7 +188,7 @@ func updateFilters(rpt report.Report, topologies []APITopologyDesc) []APITopolog
 	}
 	sort.Strings(ns)
 	for i, t := range topologies {
-		if t.id == "pods" || t.id == "services" || t.id == "deployments" || t.id == "replica-sets" {
+		if t.id == "pods" || t.id == "services" || t.id == "deployments" || t.id == "replica-sets" || t.id == "namespaces" {
 			topologies[i] = updateTopologyFilters(t, []APITopologyOptionGroup{kubernetesFilters(ns...)})
 		}
 	}
@@ -327,7 +349,10 @@ func (r *registry) rendererForTopology(topologyID string, values url.Values, rpt
 	}
 	topology = updateFilters(rpt, []APITopologyDesc{topology})[0]
 
-	var filters []render.FilterFunc
+	var (
+		filters []render.FilterFunc
+		ids     []string
+	)
 	for _, group := range topology.Options {
 		value := values.Get(group.ID)
 		for _, opt := range group.Options {
@@ -336,14 +361,17 @@ func (r *registry) rendererForTopology(topologyID string, values url.Values, rpt
 			}
 			if (value == "" && group.Default == opt.Value) || (opt.Value != "" && opt.Value == value) {
 				filters = append(filters, opt.filter)
+				ids = append(ids, group.ID+"="+opt.Value)
 			}
 		}
 	}
 	var decorator render.Decorator
 	if len(filters) > 0 {
-		decorator = func(renderer render.Renderer) render.Renderer {
+		// The selected options identify the filter, so decorated renders
+		// can be cached.
+		decorator = render.MakeDecorator(strings.Join(ids, "&"), func(renderer render.Renderer) render.Renderer {
 			return render.MakeFilter(render.ComposeFilterFuncs(filters...), renderer)
-		}
+		})
 	}
 	return topology.renderer, decorator, nil
 }
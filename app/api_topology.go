@@ -1,7 +1,9 @@
 package app
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,6 +20,15 @@ const (
 	websocketLoop = 1 * time.Second
 )
 
+// pathTopologies are the topologies searched by the /api/path handler, in
+// order of preference, with the names nodes in the others know them by as
+// parents.
+var pathTopologies = []struct{ id, parent string }{
+	{"containers", report.Container},
+	{"pods", report.Pod},
+	{"hosts", report.Host},
+}
+
 // APITopology is returned by the /api/topology/{name} handler.
 type APITopology struct {
 	Nodes detailed.NodeSummaries `json:"nodes"`
@@ -28,11 +39,35 @@ type APINode struct {
 	Node detailed.Node `json:"node"`
 }
 
-// Full topology.
+// APIDependencies is returned by the /api/topology/{name}/{id}/dependencies
+// and /api/topology/{name}/{id}/dependents handlers. Depths maps the ID of
+// each node to the number of hops it is away from the requested node.
+type APIDependencies struct {
+	Nodes  detailed.NodeSummaries `json:"nodes"`
+	Depths map[string]int         `json:"depths"`
+}
+
+// APIPath is returned by the /api/path handler. Path holds the IDs of the
+// nodes on the path, in order, starting with from and ending with to, or
+// with the nodes they are in, e.g. their hosts, when they aren't in Topology.
+type APIPath struct {
+	Topology string                 `json:"topology"`
+	Path     []string               `json:"path"`
+	Nodes    detailed.NodeSummaries `json:"nodes"`
+}
+
+// Full topology. If a format is requested, the topology is exported in that
+// graph format instead; see exporters.
 func handleTopology(ctx context.Context, renderer render.Renderer, decorator render.Decorator, report report.Report, w http.ResponseWriter, r *http.Request) {
-	respondWith(w, http.StatusOK, APITopology{
-		Nodes: detailed.Summaries(report, renderer.Render(report, decorator)),
-	})
+	var (
+		rendered  = renderer.Render(report, decorator)
+		summaries = detailed.Summaries(report, rendered)
+	)
+	if format := r.Form.Get("format"); format != "" {
+		handleExport(format, mux.Vars(r)["topology"], summaries, rendered, w)
+		return
+	}
+	respondWith(w, http.StatusOK, APITopology{Nodes: summaries})
 }
 
 // Individual nodes.
@@ -51,6 +86,156 @@ func handleNode(ctx context.Context, renderer render.Renderer, _ render.Decorato
 	respondWith(w, http.StatusOK, APINode{Node: detailed.MakeNode(topologyID, report, rendered, node)})
 }
 
+// Downstream dependencies of individual nodes.
+func handleDependencies(ctx context.Context, renderer render.Renderer, _ render.Decorator, report report.Report, w http.ResponseWriter, r *http.Request) {
+	handleReachable(render.Dependencies, renderer, report, w, r)
+}
+
+// Upstream dependents, or blast radius, of individual nodes.
+func handleDependents(ctx context.Context, renderer render.Renderer, _ render.Decorator, report report.Report, w http.ResponseWriter, r *http.Request) {
+	handleReachable(render.Dependents, renderer, report, w, r)
+}
+
+func handleReachable(
+	reachable func(report.Nodes, string, int) map[string]int,
+	renderer render.Renderer,
+	report report.Report,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	depth := 0
+	if d := r.Form.Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil || depth < 0 {
+			respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid depth: %q", d))
+			return
+		}
+	}
+	var (
+		nodeID   = mux.Vars(r)["id"]
+		rendered = renderer.Render(report, nil)
+	)
+	if _, ok := rendered[nodeID]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	depths := reachable(rendered, nodeID, depth)
+	respondWith(w, http.StatusOK, APIDependencies{
+		Nodes:  detailed.Summaries(report, subset(rendered, depths)),
+		Depths: depths,
+	})
+}
+
+// Connection path between two nodes.
+func handlePath(ctx context.Context, rep Reporter, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWith(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to := r.Form.Get("from"), r.Form.Get("to")
+	if from == "" || to == "" {
+		respondWith(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	rpt, err := rep.Report(ctx)
+	if err != nil {
+		respondWith(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rendered := map[string]report.Nodes{}
+	for _, topology := range pathTopologies {
+		renderer, _, err := topologyRegistry.rendererForTopology(topology.id, r.Form, rpt)
+		if err != nil {
+			continue
+		}
+		rendered[topology.id] = renderer.Render(rpt, nil)
+	}
+	fromNode, ok := findPathNode(rendered, from)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	toNode, ok := findPathNode(rendered, to)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The ends can be in different topologies, so each topology is searched
+	// between the nodes standing for them there. Connections are followed the
+	// way they go, so there's no path between nodes which merely talk to the
+	// same server.
+	for _, topology := range pathTopologies {
+		nodes, ok := rendered[topology.id]
+		if !ok {
+			continue
+		}
+		src, ok := pathEnd(nodes, fromNode, topology.parent)
+		if !ok {
+			continue
+		}
+		dst, ok := pathEnd(nodes, toNode, topology.parent)
+		if !ok || (src == dst && from != to) {
+			continue
+		}
+		path, ok := render.ShortestPath(nodes, src, dst)
+		if !ok {
+			continue
+		}
+		onPath := map[string]int{}
+		for i, id := range path {
+			onPath[id] = i
+		}
+		respondWith(w, http.StatusOK, APIPath{
+			Topology: topology.id,
+			Path:     path,
+			Nodes:    detailed.Summaries(rpt, subset(nodes, onPath)),
+		})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func findPathNode(rendered map[string]report.Nodes, id string) (report.Node, bool) {
+	for _, topology := range pathTopologies {
+		if n, ok := rendered[topology.id][id]; ok {
+			return n, true
+		}
+	}
+	return report.Node{}, false
+}
+
+// pathEnd returns the ID of the node standing for n in nodes: n itself, or
+// its only parent there.
+func pathEnd(nodes report.Nodes, n report.Node, parent string) (string, bool) {
+	if _, ok := nodes[n.ID]; ok {
+		return n.ID, true
+	}
+	parents, ok := n.Parents.Lookup(parent)
+	if !ok || len(parents) != 1 {
+		return "", false
+	}
+	if _, ok := nodes[parents[0]]; !ok {
+		return "", false
+	}
+	return parents[0], true
+}
+
+func subset(nodes report.Nodes, ids map[string]int) report.Nodes {
+	result := report.Nodes{}
+	for id := range ids {
+		if n, ok := nodes[id]; ok {
+			result[id] = n
+		}
+	}
+	return result
+}
+
+// Render pipeline profile, slowest stages first.
+func handleRenderProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	respondWith(w, http.StatusOK, render.Profile())
+}
+
 // Websocket for the full topology.
 func handleWebsocket(
 	ctx context.Context,
@@ -0,0 +1,273 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/render/detailed"
+	"github.com/weaveworks/scope/report"
+)
+
+// exporter writes a rendered topology in some graph interchange format.
+type exporter struct {
+	contentType string
+	write       func(io.Writer, string, exportGraph) error
+}
+
+var exporters = map[string]exporter{
+	"dot":     {"text/vnd.graphviz", writeDOT},
+	"graphml": {"application/xml", writeGraphML},
+	"cyjs":    {"application/json", writeCytoscape},
+}
+
+// exportGraph is a rendered topology, in a stable order, with the edge
+// counters attached to each edge.
+type exportGraph struct {
+	nodes []detailed.NodeSummary
+	edges []exportEdge
+}
+
+type exportEdge struct {
+	source, target string
+	counters       map[string]uint64
+}
+
+func makeExportGraph(summaries detailed.NodeSummaries, rendered report.Nodes) exportGraph {
+	ids := []string{}
+	for id := range summaries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	g := exportGraph{}
+	for _, id := range ids {
+		summary := summaries[id]
+		g.nodes = append(g.nodes, summary)
+		for _, dst := range summary.Adjacency {
+			if _, ok := summaries[dst]; !ok {
+				continue
+			}
+			edge := exportEdge{source: id, target: dst, counters: map[string]uint64{}}
+			if md, ok := rendered[id].Edges.Lookup(dst); ok {
+				for key, value := range map[string]*uint64{
+					"egress_packet_count":  md.EgressPacketCount,
+					"ingress_packet_count": md.IngressPacketCount,
+					"egress_byte_count":    md.EgressByteCount,
+					"ingress_byte_count":   md.IngressByteCount,
+				} {
+					if value != nil {
+						edge.counters[key] = *value
+					}
+				}
+			}
+			g.edges = append(g.edges, edge)
+		}
+	}
+	return g
+}
+
+func handleExport(format, topologyID string, summaries detailed.NodeSummaries, rendered report.Nodes, w http.ResponseWriter) {
+	e, ok := exporters[format]
+	if !ok {
+		respondWith(w, http.StatusBadRequest, fmt.Sprintf("unknown format: %q", format))
+		return
+	}
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Add("Cache-Control", "no-cache")
+	if err := e.write(w, topologyID, makeExportGraph(summaries, rendered)); err != nil {
+		log.Errorf("Error exporting topology %s as %s: %v", topologyID, format, err)
+	}
+}
+
+// dotShapes maps our node shapes onto their nearest graphviz equivalent.
+var dotShapes = map[string]string{
+	report.Circle:   "circle",
+	report.Square:   "square",
+	report.Hexagon:  "hexagon",
+	report.Heptagon: "septagon",
+	report.Cloud:    "ellipse",
+}
+
+func writeDOT(w io.Writer, topologyID string, g exportGraph) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %q {\n", topologyID)
+	fmt.Fprintf(&b, "\toutputorder=edgesfirst;\n")
+	fmt.Fprintf(&b, "\toverlap=scale;\n")
+	fmt.Fprintf(&b, "\tnode [style=filled];\n")
+	for _, n := range g.nodes {
+		shape, ok := dotShapes[n.Shape]
+		if !ok {
+			shape = "ellipse"
+		}
+		tooltip := []string{}
+		for _, row := range n.Metadata {
+			tooltip = append(tooltip, fmt.Sprintf("%s: %s", row.Label, row.Value))
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q, shape=%s, tooltip=%q, label_minor=%q, scope_rank=%q, pseudo=%t];\n",
+			n.ID, n.Label, shape, strings.Join(tooltip, "\n"), n.LabelMinor, n.Rank, n.Pseudo)
+	}
+	for _, e := range g.edges {
+		attrs := []string{}
+		for _, key := range sortedCounterKeys(e.counters) {
+			attrs = append(attrs, fmt.Sprintf("%s=%d", key, e.counters[key]))
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, "\t%q -> %q [%s];\n", e.source, e.target, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", e.source, e.target)
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLNode `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID     string        `xml:"id,attr,omitempty"`
+	Source string        `xml:"source,attr,omitempty"`
+	Target string        `xml:"target,attr,omitempty"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, topologyID string, g exportGraph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{"label", "node", "label", "string"},
+			{"label_minor", "node", "label_minor", "string"},
+			{"rank", "node", "rank", "string"},
+			{"shape", "node", "shape", "string"},
+			{"pseudo", "node", "pseudo", "boolean"},
+		},
+		Graph: graphMLGraph{ID: topologyID, EdgeDefault: "directed"},
+	}
+
+	metadataKeys := map[string]struct{}{}
+	for _, n := range g.nodes {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{
+			{"label", n.Label},
+			{"label_minor", n.LabelMinor},
+			{"rank", n.Rank},
+			{"shape", n.Shape},
+			{"pseudo", strconv.FormatBool(n.Pseudo)},
+		}}
+		for _, row := range n.Metadata {
+			key := "metadata_" + row.ID
+			if _, ok := metadataKeys[key]; !ok {
+				metadataKeys[key] = struct{}{}
+				doc.Keys = append(doc.Keys, graphMLKey{key, "node", row.ID, "string"})
+			}
+			node.Data = append(node.Data, graphMLData{key, row.Value})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+
+	counterKeys := map[string]struct{}{}
+	for _, e := range g.edges {
+		edge := graphMLNode{Source: e.source, Target: e.target}
+		for _, key := range sortedCounterKeys(e.counters) {
+			if _, ok := counterKeys[key]; !ok {
+				counterKeys[key] = struct{}{}
+				doc.Keys = append(doc.Keys, graphMLKey{key, "edge", key, "long"})
+			}
+			edge.Data = append(edge.Data, graphMLData{key, strconv.FormatUint(e.counters[key], 10)})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+type cytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type cytoscapeGraph struct {
+	Data     map[string]interface{} `json:"data"`
+	Elements struct {
+		Nodes []cytoscapeElement `json:"nodes"`
+		Edges []cytoscapeElement `json:"edges"`
+	} `json:"elements"`
+}
+
+func writeCytoscape(w io.Writer, topologyID string, g exportGraph) error {
+	doc := cytoscapeGraph{Data: map[string]interface{}{"name": topologyID}}
+	doc.Elements.Nodes = []cytoscapeElement{}
+	doc.Elements.Edges = []cytoscapeElement{}
+	for _, n := range g.nodes {
+		metadata := map[string]string{}
+		for _, row := range n.Metadata {
+			metadata[row.ID] = row.Value
+		}
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{map[string]interface{}{
+			"id":          n.ID,
+			"label":       n.Label,
+			"label_minor": n.LabelMinor,
+			"rank":        n.Rank,
+			"shape":       n.Shape,
+			"pseudo":      n.Pseudo,
+			"metadata":    metadata,
+		}})
+	}
+	for _, e := range g.edges {
+		data := map[string]interface{}{
+			"id":     e.source + "->" + e.target,
+			"source": e.source,
+			"target": e.target,
+		}
+		for key, value := range e.counters {
+			data[key] = value
+		}
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{data})
+	}
+	return codec.NewEncoder(w, &codec.JsonHandle{}).Encode(doc)
+}
+
+func sortedCounterKeys(counters map[string]uint64) []string {
+	keys := []string{}
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package app_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestAPITopologyExportDOT(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	res, body := checkGet(t, ts, "/api/topology/containers?format=dot")
+	equals(t, 200, res.StatusCode)
+	equals(t, "text/vnd.graphviz", res.Header.Get("Content-Type"))
+	dot := string(body)
+	if !strings.HasPrefix(dot, `digraph "containers" {`) {
+		t.Errorf("Expected a digraph, got: %s", dot)
+	}
+	edge := fmt.Sprintf("%q -> %q", fixture.ClientContainerNodeID, fixture.ServerContainerNodeID)
+	if !strings.Contains(dot, edge) {
+		t.Errorf("Expected output to include edge %s, got: %s", edge, dot)
+	}
+}
+
+func TestAPITopologyExportGraphML(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	res, body := checkGet(t, ts, "/api/topology/containers?format=graphml")
+	equals(t, 200, res.StatusCode)
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, n := range doc.Graph.Nodes {
+		ids[n.ID] = true
+	}
+	if !ids[fixture.ClientContainerNodeID] || !ids[fixture.ServerContainerNodeID] {
+		t.Errorf("Expected output to include container nodes, got: %v", ids)
+	}
+	found := false
+	for _, e := range doc.Graph.Edges {
+		if e.Source == fixture.ClientContainerNodeID && e.Target == fixture.ServerContainerNodeID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected output to include client->server edge, got: %v", doc.Graph.Edges)
+	}
+}
+
+func TestAPITopologyExportCytoscape(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+
+	body := getRawJSON(t, ts, "/api/topology/containers?format=cyjs")
+	var doc struct {
+		Elements struct {
+			Nodes []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"nodes"`
+			Edges []struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Elements.Nodes) == 0 || len(doc.Elements.Edges) == 0 {
+		t.Errorf("Expected nodes and edges, got: %s", body)
+	}
+	for _, n := range doc.Elements.Nodes {
+		if n.Data["id"] == fixture.ClientContainerNodeID {
+			equals(t, "client", n.Data["label"])
+		}
+	}
+}
+
+func TestAPITopologyExportUnknownFormat(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	is400(t, ts, "/api/topology/containers?format=foo")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/detailed"
 	"github.com/weaveworks/scope/render/expected"
 	"github.com/weaveworks/scope/test/fixture"
@@ -117,6 +118,86 @@ func TestAPITopologyHosts(t *testing.T) {
 	}
 }
 
+func TestAPITopologyDependencies(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	is404(t, ts, "/api/topology/containers/foobar/dependencies")
+	is400(t, ts, "/api/topology/containers/"+url.QueryEscape(fixture.ClientContainerNodeID)+"/dependencies?depth=foo")
+
+	decode := func(path string) app.APIDependencies {
+		body := getRawJSON(t, ts, path)
+		var deps app.APIDependencies
+		decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+		if err := decoder.Decode(&deps); err != nil {
+			t.Fatal(err)
+		}
+		return deps
+	}
+	{
+		deps := decode("/api/topology/containers/" + url.QueryEscape(fixture.ClientContainerNodeID) + "/dependencies")
+		equals(t, 1, deps.Depths[fixture.ServerContainerNodeID])
+		if _, ok := deps.Nodes[fixture.ServerContainerNodeID]; !ok {
+			t.Errorf("Expected dependencies to include %s", fixture.ServerContainerNodeID)
+		}
+	}
+	{
+		deps := decode("/api/topology/containers/" + url.QueryEscape(fixture.ServerContainerNodeID) + "/dependents?depth=1")
+		equals(t, 1, deps.Depths[fixture.ClientContainerNodeID])
+		if _, ok := deps.Nodes[fixture.ClientContainerNodeID]; !ok {
+			t.Errorf("Expected dependents to include %s", fixture.ClientContainerNodeID)
+		}
+	}
+}
+
+func TestAPIPath(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	is400(t, ts, "/api/path?from=foo")
+	is404(t, ts, "/api/path?from=foo&to=bar")
+
+	body := getRawJSON(t, ts, fmt.Sprintf("/api/path?from=%s&to=%s",
+		url.QueryEscape(fixture.ClientContainerNodeID), url.QueryEscape(fixture.ServerContainerNodeID)))
+	var path app.APIPath
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&path); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "containers", path.Topology)
+	equals(t, []string{fixture.ClientContainerNodeID, fixture.ServerContainerNodeID}, path.Path)
+	equals(t, 2, len(path.Nodes))
+
+	// Connections only go one way
+	is404(t, ts, fmt.Sprintf("/api/path?from=%s&to=%s",
+		url.QueryEscape(fixture.ServerContainerNodeID), url.QueryEscape(fixture.ClientContainerNodeID)))
+
+	// The ends can be in different topologies
+	body = getRawJSON(t, ts, fmt.Sprintf("/api/path?from=%s&to=%s",
+		url.QueryEscape(fixture.ClientContainerNodeID), url.QueryEscape(fixture.ServerHostNodeID)))
+	path = app.APIPath{}
+	decoder = codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&path); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "hosts", path.Topology)
+	equals(t, []string{fixture.ClientHostNodeID, fixture.ServerHostNodeID}, path.Path)
+}
+
+func TestAPIRenderProfile(t *testing.T) {
+	ts := topologyServer()
+	defer ts.Close()
+	getRawJSON(t, ts, "/api/topology/containers")
+
+	body := getRawJSON(t, ts, "/api/debug/render")
+	var profile []render.StageProfile
+	decoder := codec.NewDecoderBytes(body, &codec.JsonHandle{})
+	if err := decoder.Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+	if len(profile) == 0 {
+		t.Errorf("Expected render stages to have been profiled")
+	}
+}
+
 // Basic websocket test
 func TestAPITopologyWebsocket(t *testing.T) {
 	ts := topologyServer()
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+)
+
+// Audit actions
+const (
+	AuditControl    = "control"
+	AuditPipeAttach = "pipe_attach"
+	AuditPipeDelete = "pipe_delete"
+)
+
+// Audit results
+const (
+	AuditOK     = "ok"
+	AuditDenied = "denied"
+	AuditError  = "error"
+)
+
+// AuditEntry records a single control or pipe invocation.
+type AuditEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	User      string            `json:"user,omitempty"`
+	Action    string            `json:"action"`
+	ProbeID   string            `json:"probe_id,omitempty"`
+	NodeID    string            `json:"node_id,omitempty"`
+	Control   string            `json:"control,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+	PipeID    string            `json:"pipe_id,omitempty"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// AuditQuery selects audit entries. Empty fields match everything.
+type AuditQuery struct {
+	User    string
+	Action  string
+	NodeID  string
+	Control string
+	Since   time.Time
+	Limit   int
+}
+
+func (q AuditQuery) matches(e AuditEntry) bool {
+	return (q.User == "" || q.User == e.User) &&
+		(q.Action == "" || q.Action == e.Action) &&
+		(q.NodeID == "" || q.NodeID == e.NodeID) &&
+		(q.Control == "" || q.Control == e.Control) &&
+		!e.Timestamp.Before(q.Since)
+}
+
+// AuditLog is an append-only log of control and pipe invocations.
+type AuditLog interface {
+	Record(context.Context, AuditEntry) error
+	// Entries returns the entries matching the query, newest first.
+	Entries(context.Context, AuditQuery) ([]AuditEntry, error)
+}
+
+// NewMemoryAuditLog makes an AuditLog which keeps the most recent capacity
+// entries in memory.
+func NewMemoryAuditLog(capacity int) AuditLog {
+	return &memoryAuditLog{capacity: capacity}
+}
+
+type memoryAuditLog struct {
+	sync.Mutex
+	capacity int
+	entries  []AuditEntry
+}
+
+func (m *memoryAuditLog) Record(_ context.Context, e AuditEntry) error {
+	m.Lock()
+	defer m.Unlock()
+	m.entries = append(m.entries, e)
+	if len(m.entries) > m.capacity {
+		m.entries = m.entries[len(m.entries)-m.capacity:]
+	}
+	return nil
+}
+
+func (m *memoryAuditLog) Entries(_ context.Context, q AuditQuery) ([]AuditEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+	return selectEntries(m.entries, q), nil
+}
+
+// NewFileAuditLog makes an AuditLog which appends entries to the given
+// file, one JSON object per line.
+func NewFileAuditLog(path string) (AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditLog{path: path, file: f}, nil
+}
+
+type fileAuditLog struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+func (f *fileAuditLog) Record(_ context.Context, e AuditEntry) error {
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(e); err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	_, err := f.file.Write(append(buf, '\n'))
+	return err
+}
+
+func (f *fileAuditLog) Entries(_ context.Context, q AuditQuery) ([]AuditEntry, error) {
+	f.Lock()
+	defer f.Unlock()
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := codec.NewDecoderBytes(scanner.Bytes(), &codec.JsonHandle{}).Decode(&e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return selectEntries(entries, q), nil
+}
+
+// selectEntries returns the entries matching q, newest first.
+func selectEntries(entries []AuditEntry, q AuditQuery) []AuditEntry {
+	result := []AuditEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+		if q.matches(entries[i]) {
+			result = append(result, entries[i])
+		}
+	}
+	return result
+}
+
+// RegisterAuditRoutes registers the audit log routes with a http mux.
+// Auditors, as the policy has it, see all entries; other users only see
+// their own.
+func RegisterAuditRoutes(router *mux.Router, log AuditLog, policy ControlPolicy, userIDer UserIDer) {
+	router.Methods("GET").Path("/api/audit").
+		HandlerFunc(requestContextDecorator(handleAudit(log, policy, userIDer)))
+}
+
+func handleAudit(log AuditLog, policy ControlPolicy, userIDer UserIDer) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		user, err := userIDer(ctx)
+		if err != nil {
+			respondWith(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		q := AuditQuery{
+			User:    r.Form.Get("user"),
+			Action:  r.Form.Get("action"),
+			NodeID:  r.Form.Get("node"),
+			Control: r.Form.Get("control"),
+		}
+		if since := r.Form.Get("since"); since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			q.Since = t
+		}
+		if limit := r.Form.Get("limit"); limit != "" {
+			l, err := strconv.Atoi(limit)
+			if err != nil {
+				respondWith(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			q.Limit = l
+		}
+		if !policy.Auditor(user) {
+			if user == "" {
+				respondWith(w, http.StatusForbidden, "not allowed to read the audit log")
+				return
+			}
+			q.User = user
+		}
+		entries, err := log.Entries(ctx, q)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWith(w, http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,128 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+)
+
+func TestFileAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := app.NewFileAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, user := range []string{"alice", "bob", "alice"} {
+		if err := log.Record(ctx, app.AuditEntry{
+			Timestamp: now.Add(time.Duration(i) * time.Minute),
+			User:      user,
+			Action:    app.AuditControl,
+			Result:    app.AuditOK,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := log.Entries(ctx, app.AuditQuery{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(entries))
+	equals(t, true, entries[0].Timestamp.Equal(now.Add(2*time.Minute)))
+
+	entries, err = log.Entries(ctx, app.AuditQuery{Since: now.Add(time.Minute), Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(entries))
+	equals(t, "alice", entries[0].User)
+}
+
+func TestAPIAudit(t *testing.T) {
+	log := app.NewMemoryAuditLog(2)
+	ctx := context.Background()
+	for _, control := range []string{"foo", "bar", "baz"} {
+		log.Record(ctx, app.AuditEntry{Action: app.AuditControl, Control: control, Result: app.AuditOK})
+	}
+
+	router := mux.NewRouter()
+	noUser := func(context.Context) (string, error) { return "", nil }
+	app.RegisterAuditRoutes(router, log, app.ControlPolicy{}, noUser)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	body := getRawJSON(t, ts, "/api/audit")
+	var entries []app.AuditEntry
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(entries))
+	equals(t, "baz", entries[0].Control)
+	equals(t, "bar", entries[1].Control)
+
+	is400(t, ts, "/api/audit?limit=foo")
+}
+
+func TestAPIAuditUsers(t *testing.T) {
+	log := app.NewMemoryAuditLog(10)
+	ctx := context.Background()
+	for _, user := range []string{"alice", "bob"} {
+		log.Record(ctx, app.AuditEntry{User: user, Action: app.AuditControl, Control: "exec", Result: app.AuditOK})
+	}
+
+	// Users only see their own entries, even if they ask for others',
+	// unless they're auditors.
+	for _, c := range []struct {
+		user, path string
+		want       []string
+	}{
+		{"alice", "/api/audit", []string{"alice"}},
+		{"alice", "/api/audit?user=bob", []string{"alice"}},
+		{"carol", "/api/audit", []string{}},
+		{"root", "/api/audit", []string{"bob", "alice"}},
+		{"root", "/api/audit?user=bob", []string{"bob"}},
+	} {
+		user := c.user
+		router := mux.NewRouter()
+		policy := app.ControlPolicy{Auditors: []string{"root"}}
+		app.RegisterAuditRoutes(router, log, policy, func(context.Context) (string, error) { return user, nil })
+		ts := httptest.NewServer(router)
+		body := getRawJSON(t, ts, c.path)
+		ts.Close()
+		var entries []app.AuditEntry
+		if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		have := []string{}
+		for _, e := range entries {
+			have = append(have, e.User)
+		}
+		equals(t, c.want, have)
+	}
+
+	// Without a user, or in read-only mode, only auditors may look
+	router := mux.NewRouter()
+	noUser := func(context.Context) (string, error) { return "", nil }
+	app.RegisterAuditRoutes(router, log, app.ControlPolicy{ReadOnly: true}, noUser)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	res, _ := checkRequest(t, ts, "GET", "/api/audit", nil)
+	equals(t, http.StatusForbidden, res.StatusCode)
+}
@@ -0,0 +1,252 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	defaultBulkConcurrency = 10
+	maxBulkConcurrency     = 100
+)
+
+// BulkControlRequest invokes a control on a selection of the nodes of a
+// rendered topology. Nodes are selected by ID, and/or by Selector, which
+// maps node metadata keys to glob patterns (see path.Match) that must all
+// match. Options are the topology options to render with, e.g. to include
+// stopped containers.
+type BulkControlRequest struct {
+	Topology    string                 `json:"topology"`
+	Options     map[string]string      `json:"options,omitempty"`
+	Nodes       []string               `json:"nodes,omitempty"`
+	Selector    map[string]string      `json:"selector,omitempty"`
+	Control     string                 `json:"control"`
+	Args        map[string]interface{} `json:"args,omitempty"`
+	Concurrency int                    `json:"concurrency,omitempty"`
+}
+
+// BulkControlResult is the outcome of the control on a single node.
+type BulkControlResult struct {
+	NodeID  string         `json:"node_id"`
+	ProbeID string         `json:"probe_id,omitempty"`
+	Result  *xfer.Response `json:"result,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// BulkControlResponse is the response to a BulkControlRequest.
+type BulkControlResponse struct {
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Results   []BulkControlResult `json:"results"`
+}
+
+// RegisterBulkControlRoutes registers the bulk control route with a http mux.
+func RegisterBulkControlRoutes(router *mux.Router, rep Reporter, cr ControlRouter) {
+	router.Methods("POST").Path("/api/control/bulk").
+		HandlerFunc(requestContextDecorator(handleBulkControl(rep, cr)))
+}
+
+func handleBulkControl(rep Reporter, cr ControlRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var req BulkControlRequest
+		if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&req); err != nil && err != io.EOF {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Control == "" {
+			respondWith(w, http.StatusBadRequest, "missing control")
+			return
+		}
+		if len(req.Nodes) == 0 && len(req.Selector) == 0 {
+			respondWith(w, http.StatusBadRequest, "must give nodes or a selector")
+			return
+		}
+		if _, ok := topologyRegistry.get(req.Topology); !ok {
+			respondWith(w, http.StatusNotFound, fmt.Sprintf("unknown topology: %q", req.Topology))
+			return
+		}
+
+		rpt, err := rep.Report(ctx)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		values := url.Values{}
+		for k, v := range req.Options {
+			values.Set(k, v)
+		}
+		renderer, decorator, err := topologyRegistry.rendererForTopology(req.Topology, values, rpt)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		nodes := renderer.Render(rpt, decorator)
+
+		args := controlArgStrings(req.Args)
+		results := bulkControl(ctx, cr, rpt, selectNodes(rpt, nodes, req.Nodes, req.Selector), req.Control, args, req.Concurrency)
+
+		res := BulkControlResponse{Results: results}
+		for _, result := range results {
+			if result.Error == "" {
+				res.Succeeded++
+			} else {
+				res.Failed++
+			}
+		}
+		respondWith(w, http.StatusOK, res)
+	}
+}
+
+// selectNodes returns the IDs of the nodes matching both ids (if any) and
+// selector (if any), sorted. Requested IDs which are not in nodes are looked
+// up in the report, and must match the selector too; if there's no selector,
+// they're kept even if they're not found, so they show up as errors.
+func selectNodes(rpt report.Report, nodes report.Nodes, ids []string, selector map[string]string) []string {
+	candidates := ids
+	if len(candidates) == 0 {
+		for id := range nodes {
+			candidates = append(candidates, id)
+		}
+	}
+	result := []string{}
+	for _, id := range candidates {
+		n, ok := nodes[id]
+		if !ok {
+			n, ok = reportNode(rpt, id)
+		}
+		if len(selector) > 0 && (!ok || !matchSelector(n, selector)) {
+			continue
+		}
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func reportNode(rpt report.Report, nodeID string) (report.Node, bool) {
+	for _, t := range rpt.Topologies() {
+		if n, ok := t.Nodes[nodeID]; ok {
+			return n, true
+		}
+	}
+	return report.Node{}, false
+}
+
+func matchSelector(n report.Node, selector map[string]string) bool {
+	for key, pattern := range selector {
+		value, ok := n.Latest.Lookup(key)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkControl invokes control on each node, via the probe which owns it, at
+// most concurrency at a time. Nodes on many hosts, such as images, have it
+// invoked on each, with a result for each.
+func bulkControl(ctx context.Context, cr ControlRouter, rpt report.Report, nodeIDs []string, control string, args map[string]string, concurrency int) []BulkControlResult {
+	results := []BulkControlResult{}
+	for _, nodeID := range nodeIDs {
+		probeIDs, err := controlProbeIDs(rpt, nodeID, control)
+		if err != nil {
+			results = append(results, BulkControlResult{NodeID: nodeID, Error: err.Error()})
+			continue
+		}
+		for _, probeID := range probeIDs {
+			results = append(results, BulkControlResult{NodeID: nodeID, ProbeID: probeID})
+		}
+	}
+	invokeControls(ctx, cr, results, control, args, concurrency)
+	return results
+}
+
+// invokeControls invokes control on the node and probe of each result which
+// doesn't already have an error, at most concurrency at a time, and fills in
+// the results.
+func invokeControls(ctx context.Context, cr ControlRouter, results []BulkControlResult, control string, args map[string]string, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	} else if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	var (
+		semaphore = make(chan struct{}, concurrency)
+		wg        sync.WaitGroup
+	)
+	for i := range results {
+		if results[i].Error != "" {
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(result *BulkControlResult) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			res, err := cr.Handle(ctx, result.ProbeID, xfer.Request{
+				NodeID:  result.NodeID,
+				Control: control,
+				Args:    args,
+			})
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case res.Error != "":
+				result.Error = res.Error
+			default:
+				if res.Job != "" {
+					res.Job = makeJobID(result.ProbeID, res.Job)
+				}
+				result.Result = &res
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// controlProbeIDs finds the probes which can invoke control on the node.
+func controlProbeIDs(rpt report.Report, nodeID, control string) ([]string, error) {
+	for _, t := range rpt.Topologies() {
+		node, ok := t.Nodes[nodeID]
+		if !ok {
+			continue
+		}
+		if _, ok := t.Controls[control]; !ok || !node.Controls.Controls.Contains(control) {
+			return nil, fmt.Errorf("control %q is not available on %q", control, nodeID)
+		}
+		if probes, ok := node.Sets.Lookup(report.ControlProbeIDs); ok && len(probes) > 0 {
+			probeIDs := []string{}
+			for _, probe := range probes {
+				if _, probeID, ok := report.ParseControlProbe(probe); ok {
+					probeIDs = append(probeIDs, probeID)
+				}
+			}
+			return probeIDs, nil
+		}
+		probeID, ok := node.Latest.Lookup(report.ControlProbeID)
+		if !ok {
+			return nil, fmt.Errorf("no probe controls %q", nodeID)
+		}
+		return []string{probeID}, nil
+	}
+	return nil, fmt.Errorf("node not found: %q", nodeID)
+}
@@ -0,0 +1,114 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/fixture"
+)
+
+func TestBulkControl(t *testing.T) {
+	// Only the client container has the control, and is owned by a probe.
+	rpt := fixture.Report.Copy()
+	rpt.Container.Controls.AddControl(report.Control{ID: docker.StopContainer})
+	rpt.Container.Nodes[fixture.ClientContainerNodeID] = rpt.Container.Nodes[fixture.ClientContainerNodeID].
+		WithLatests(map[string]string{report.ControlProbeID: "probe1"}).
+		WithControls(docker.StopContainer)
+
+	collector := app.NewCollector(time.Minute)
+	if err := collector.Add(context.Background(), rpt); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := app.NewLocalControlRouter()
+	if _, err := cr.Register(context.Background(), "probe1", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Value: req.NodeID + " " + req.Args["timeout"]}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	app.RegisterBulkControlRoutes(router, collector, cr)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(req app.BulkControlRequest) (int, app.BulkControlResponse) {
+		var body []byte
+		if err := codec.NewEncoderBytes(&body, &codec.JsonHandle{}).Encode(req); err != nil {
+			t.Fatal(err)
+		}
+		res, body := checkRequest(t, ts, "POST", "/api/control/bulk", body)
+		var result app.BulkControlResponse
+		if res.StatusCode == http.StatusOK {
+			if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, result
+	}
+
+	// Select by metadata
+	status, res := post(app.BulkControlRequest{
+		Topology: "containers",
+		Options:  map[string]string{"system": "both", "stopped": "both"},
+		Selector: map[string]string{docker.ImageName: "image/*"},
+		Control:  docker.StopContainer,
+		Args:     map[string]interface{}{"timeout": 10},
+	})
+	equals(t, http.StatusOK, status)
+	equals(t, 1, res.Succeeded)
+	equals(t, 1, res.Failed)
+	equals(t, 2, len(res.Results))
+	for _, result := range res.Results {
+		switch result.NodeID {
+		case fixture.ClientContainerNodeID:
+			equals(t, "probe1", result.ProbeID)
+			equals(t, fixture.ClientContainerNodeID+" 10", result.Result.Value)
+		case fixture.ServerContainerNodeID:
+			equals(t, `control "docker_stop_container" is not available on "`+fixture.ServerContainerNodeID+`"`, result.Error)
+		default:
+			t.Errorf("Unexpected result for %s", result.NodeID)
+		}
+	}
+
+	// Select by ID
+	status, res = post(app.BulkControlRequest{
+		Topology: "containers",
+		Nodes:    []string{fixture.ClientContainerNodeID, "nonexistent"},
+		Control:  docker.StopContainer,
+	})
+	equals(t, http.StatusOK, status)
+	equals(t, 1, res.Succeeded)
+	equals(t, []app.BulkControlResult{
+		{NodeID: fixture.ClientContainerNodeID, ProbeID: "probe1", Result: &xfer.Response{Value: fixture.ClientContainerNodeID + " "}},
+		{NodeID: "nonexistent", Error: `node not found: "nonexistent"`},
+	}, res.Results)
+
+	// Requested IDs must match the selector too, even when they're not in
+	// the topology
+	status, res = post(app.BulkControlRequest{
+		Topology: "containers",
+		Nodes:    []string{fixture.ClientContainerNodeID, fixture.ClientHostNodeID, "nonexistent"},
+		Selector: map[string]string{docker.ImageName: "image/*"},
+		Control:  docker.StopContainer,
+	})
+	equals(t, http.StatusOK, status)
+	equals(t, []app.BulkControlResult{
+		{NodeID: fixture.ClientContainerNodeID, ProbeID: "probe1", Result: &xfer.Response{Value: fixture.ClientContainerNodeID + " "}},
+	}, res.Results)
+
+	// Bad requests
+	status, _ = post(app.BulkControlRequest{Topology: "containers", Control: docker.StopContainer})
+	equals(t, http.StatusBadRequest, status)
+	status, _ = post(app.BulkControlRequest{Topology: "foo", Nodes: []string{"bar"}, Control: docker.StopContainer})
+	equals(t, http.StatusNotFound, status)
+}
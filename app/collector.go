@@ -83,11 +83,18 @@ func NewCollector(window time.Duration) Collector {
 }
 
 // Add adds a report to the collector's internal state. It implements Adder.
+// Reports the probe held back count from when they were made, so they are
+// kept in order of that.
 func (c *collector) Add(_ context.Context, rpt report.Report) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
-	c.reports = append(c.reports, rpt)
-	c.timestamps = append(c.timestamps, mtime.Now())
+	timestamp := mtime.Now().Add(-rpt.Delay)
+	i := len(c.timestamps)
+	for i > 0 && c.timestamps[i-1].After(timestamp) {
+		i--
+	}
+	c.reports = append(c.reports[:i], append([]report.Report{rpt}, c.reports[i:]...)...)
+	c.timestamps = append(c.timestamps[:i], append([]time.Time{timestamp}, c.timestamps[i:]...)...)
 
 	c.clean()
 	c.cached = nil
@@ -95,6 +95,52 @@ func TestCollectorExpire(t *testing.T) {
 	}
 }
 
+func TestCollectorDelay(t *testing.T) {
+	now := time.Now()
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	ctx := context.Background()
+	window := 10 * time.Second
+	c := app.NewCollector(window)
+
+	// A report held back by the probe expires that much sooner
+	r1 := report.MakeReport()
+	r1.Endpoint.AddNode(report.MakeNode("foo"))
+	r1.Delay = window - time.Second
+	c.Add(ctx, r1)
+	r2 := report.MakeReport()
+	r2.Endpoint.AddNode(report.MakeNode("bar"))
+	c.Add(ctx, r2)
+	have, err := c.Report(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if want, have := 2, len(have.Endpoint.Nodes); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	mtime.NowForce(now.Add(time.Second))
+	have, err = c.Report(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := have.Endpoint.Nodes["foo"]; ok || len(have.Endpoint.Nodes) != 1 {
+		t.Errorf("Expected only the current report, got %v", have.Endpoint.Nodes)
+	}
+
+	// One held back for longer than the window is never seen
+	r1.Delay = window
+	c.Add(ctx, r1)
+	have, err = c.Report(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := have.Endpoint.Nodes["foo"]; ok {
+		t.Errorf("Expected report to have expired, got %v", have.Endpoint.Nodes)
+	}
+}
+
 func TestCollectorWait(t *testing.T) {
 	ctx := context.Background()
 	window := time.Millisecond
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+const jobPollInterval = 1 * time.Second
+
+// Jobs are identified to the UI by the probe running them, and the ID the
+// probe gave them. Probe job IDs never contain a '-'.
+func makeJobID(probeID, jobID string) string {
+	return probeID + "-" + jobID
+}
+
+func parseJobID(id string) (string, string, bool) {
+	i := strings.LastIndex(id, "-")
+	if i <= 0 || i == len(id)-1 {
+		return "", "", false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// errJobNotFound is returned when the job ID is malformed, or the probe
+// doesn't know of the job.
+type errJobNotFound struct {
+	err string
+}
+
+func (e errJobNotFound) Error() string {
+	return e.err
+}
+
+// jobControl invokes one of the job controls (JobStatus or CancelJob) on
+// the probe running the job.
+func jobControl(ctx context.Context, cr ControlRouter, control, id string) (xfer.Job, error) {
+	probeID, jobID, ok := parseJobID(id)
+	if !ok {
+		return xfer.Job{}, errJobNotFound{fmt.Sprintf("Invalid job ID: %s", id)}
+	}
+	res, err := cr.Handle(ctx, probeID, xfer.Request{
+		Control: control,
+		Args:    map[string]string{controls.JobArg: jobID},
+	})
+	if err != nil {
+		return xfer.Job{}, err
+	}
+	if res.Error != "" {
+		return xfer.Job{}, errJobNotFound{res.Error}
+	}
+
+	// The job has been through JSON on its way from the probe, so has
+	// arrived as a map; turn it back into a job.
+	var (
+		buf []byte
+		job xfer.Job
+	)
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(res.Value); err != nil {
+		return xfer.Job{}, err
+	}
+	if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&job); err != nil {
+		return xfer.Job{}, err
+	}
+	job.ID = id
+	return job, nil
+}
+
+func handleJob(cr ControlRouter, control string) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		job, err := jobControl(ctx, cr, control, mux.Vars(r)["id"])
+		switch err.(type) {
+		case nil:
+			respondWith(w, http.StatusOK, job)
+		case errJobNotFound:
+			respondWith(w, http.StatusNotFound, err.Error())
+		case ErrControlDenied:
+			respondWith(w, http.StatusForbidden, err.Error())
+		default:
+			respondWith(w, http.StatusBadRequest, err.Error())
+		}
+	}
+}
+
+// handleJobWebsocket pushes the status of a job down a websocket whenever it
+// changes, until the job is done.
+func handleJobWebsocket(cr ControlRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		conn, err := xfer.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		quit := make(chan struct{})
+		go func(c xfer.Websocket) {
+			for { // just discard everything the browser sends
+				if _, _, err := c.ReadMessage(); err != nil {
+					if !xfer.IsExpectedWSCloseError(err) {
+						log.Println("err:", err)
+					}
+					close(quit)
+					break
+				}
+			}
+		}(conn)
+
+		var (
+			previous xfer.Job
+			tick     = time.Tick(jobPollInterval)
+		)
+		for {
+			job, err := jobControl(ctx, cr, controls.JobStatus, id)
+			if err != nil {
+				log.Errorf("Error getting status of job %s: %v", id, err)
+				return
+			}
+			if job.State != previous.State || job.Progress != previous.Progress || job.Message != previous.Message {
+				if err := conn.WriteJSON(job); err != nil {
+					if !xfer.IsExpectedWSCloseError(err) {
+						log.Errorf("cannot serialize job: %s", err)
+					}
+					return
+				}
+				previous = job
+			}
+			if job.Done() {
+				return
+			}
+
+			select {
+			case <-tick:
+			case <-quit:
+				return
+			}
+		}
+	}
+}
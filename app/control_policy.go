@@ -0,0 +1,327 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Policy rule effects
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// UserIDer identifies users given a request context.
+type UserIDer func(context.Context) (string, error)
+
+// ErrControlDenied is returned when the control policy forbids a control or
+// pipe invocation.
+type ErrControlDenied struct {
+	User    string
+	Control string
+	NodeID  string
+}
+
+func (e ErrControlDenied) Error() string {
+	if e.User == "" {
+		return fmt.Sprintf("control %q on %q is not allowed", e.Control, e.NodeID)
+	}
+	return fmt.Sprintf("user %q may not invoke control %q on %q", e.User, e.Control, e.NodeID)
+}
+
+// ControlRule allows or denies controls. Each list is a set of glob patterns
+// (see path.Match); an empty list matches everything. Topologies are
+// matched against the report topology the node is in, e.g. "container" or
+// "systemd_service"; see nodeTopology.
+type ControlRule struct {
+	Effect     string   `json:"effect"`
+	Users      []string `json:"users,omitempty"`
+	Controls   []string `json:"controls,omitempty"`
+	Topologies []string `json:"topologies,omitempty"`
+	Nodes      []string `json:"nodes,omitempty"`
+}
+
+func (r ControlRule) matches(user, control, topology, nodeID string) bool {
+	return matchAny(r.Users, user) &&
+		matchAny(r.Controls, control) &&
+		matchAny(r.Topologies, topology) &&
+		matchAny(r.Nodes, nodeID)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var policyTopologies = []string{
+	report.Container, report.Pod, report.Deployment, report.ReplicaSet,
+	report.Service, report.Host, report.SystemdService, report.Process,
+	report.ContainerImage, report.KubernetesNode, report.Namespace,
+	report.Endpoint, report.Overlay,
+}
+
+// nodeTopology returns the name of the report topology with the node a
+// control is for. Node IDs aren't unique across topologies, so topologies
+// which offer the control win. Nodes can be named in ways the report doesn't
+// know, e.g. docker takes container names and ID prefixes, so if the node
+// isn't in the report, the topology is the one which offers the control. If
+// that's ambiguous too, it returns "".
+func nodeTopology(rpt report.Report, control, nodeID string) string {
+	found := ""
+	for _, name := range policyTopologies {
+		t, _ := rpt.Topology(name)
+		if _, ok := t.Nodes[nodeID]; !ok {
+			continue
+		}
+		if _, ok := t.Controls[control]; ok {
+			return name
+		}
+		if found == "" {
+			found = name
+		}
+	}
+	if found != "" {
+		return found
+	}
+	for _, name := range policyTopologies {
+		t, _ := rpt.Topology(name)
+		if _, ok := t.Controls[control]; !ok {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = name
+	}
+	return found
+}
+
+// ControlPolicy decides who may invoke which controls. The first matching
+// rule wins; if none match, the control is allowed unless DefaultDeny is
+// set. In ReadOnly mode, all controls and pipe attachments are denied.
+// Auditors are glob patterns of the users who may see what everyone else
+// did; other users only see their own entries in the audit log, and their
+// own pipe recordings.
+type ControlPolicy struct {
+	ReadOnly    bool          `json:"read_only,omitempty"`
+	DefaultDeny bool          `json:"default_deny,omitempty"`
+	Rules       []ControlRule `json:"rules,omitempty"`
+	Auditors    []string      `json:"auditors,omitempty"`
+}
+
+// ReadControlPolicy reads a JSON-encoded ControlPolicy from a file.
+func ReadControlPolicy(filename string) (ControlPolicy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ControlPolicy{}, err
+	}
+	defer f.Close()
+	return DecodeControlPolicy(f)
+}
+
+// DecodeControlPolicy decodes a JSON-encoded ControlPolicy.
+func DecodeControlPolicy(r io.Reader) (ControlPolicy, error) {
+	var policy ControlPolicy
+	if err := codec.NewDecoder(r, &codec.JsonHandle{}).Decode(&policy); err != nil {
+		return ControlPolicy{}, err
+	}
+	for _, rule := range policy.Rules {
+		if rule.Effect != PolicyAllow && rule.Effect != PolicyDeny {
+			return ControlPolicy{}, fmt.Errorf("invalid rule effect %q", rule.Effect)
+		}
+	}
+	return policy, nil
+}
+
+// Allowed returns whether user may invoke control on the node, which is in
+// the named topology. If the topology isn't known, rules about topologies
+// can't be checked, so the control is denied if there are any, or if
+// DefaultDeny is set.
+func (p ControlPolicy) Allowed(user, control, topology, nodeID string) bool {
+	if p.ReadOnly {
+		return false
+	}
+	if topology == "" && (p.DefaultDeny || p.hasTopologyRules()) {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if rule.matches(user, control, topology, nodeID) {
+			return rule.Effect == PolicyAllow
+		}
+	}
+	return !p.DefaultDeny
+}
+
+// Auditor returns whether user may see everyone's entries in the audit log,
+// and everyone's pipe recordings.
+// Without any Auditors, that's anyone in apps which don't identify users,
+// unless they are read-only.
+func (p ControlPolicy) Auditor(user string) bool {
+	if len(p.Auditors) == 0 {
+		return user == "" && !p.ReadOnly
+	}
+	return matchAny(p.Auditors, user)
+}
+
+func (p ControlPolicy) hasTopologyRules() bool {
+	for _, rule := range p.Rules {
+		if len(rule.Topologies) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPolicyControlRouter wraps a ControlRouter such that control requests are
+// checked against the policy, and recorded in the audit log. Nodes'
+// topologies are looked up in the reporter's report.
+func NewPolicyControlRouter(cr ControlRouter, policy ControlPolicy, userIDer UserIDer, audit AuditLog, reporter Reporter) ControlRouter {
+	return &policyControlRouter{
+		ControlRouter: cr,
+		policy:        policy,
+		userIDer:      userIDer,
+		audit:         audit,
+		reporter:      reporter,
+	}
+}
+
+type policyControlRouter struct {
+	ControlRouter
+	policy   ControlPolicy
+	userIDer UserIDer
+	audit    AuditLog
+	reporter Reporter
+}
+
+func (p *policyControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	// The UI polls the status of jobs while they run. That doesn't control
+	// anything, so it's neither subject to the policy nor audited.
+	if req.Control == controls.JobStatus {
+		return p.ControlRouter.Handle(ctx, probeID, req)
+	}
+
+	entry := AuditEntry{
+		Timestamp: mtime.Now(),
+		Action:    AuditControl,
+		ProbeID:   probeID,
+		NodeID:    req.NodeID,
+		Control:   req.Control,
+		Args:      req.Args,
+	}
+	user, err := p.userIDer(ctx)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+	entry.User = user
+	req.User = user
+	rpt, err := p.reporter.Report(ctx)
+	if err != nil {
+		return xfer.Response{}, err
+	}
+
+	if !p.policy.Allowed(user, req.Control, nodeTopology(rpt, req.Control, req.NodeID), req.NodeID) {
+		err := ErrControlDenied{User: user, Control: req.Control, NodeID: req.NodeID}
+		entry.Result, entry.Error = AuditDenied, err.Error()
+		p.record(ctx, entry)
+		return xfer.Response{}, err
+	}
+
+	res, err := p.ControlRouter.Handle(ctx, probeID, req)
+	switch {
+	case err != nil:
+		entry.Result, entry.Error = AuditError, err.Error()
+	case res.Error != "":
+		entry.Result, entry.Error = AuditError, res.Error
+	default:
+		entry.Result, entry.PipeID = AuditOK, res.Pipe
+	}
+	p.record(ctx, entry)
+	return res, err
+}
+
+func (p *policyControlRouter) record(ctx context.Context, entry AuditEntry) {
+	if err := p.audit.Record(ctx, entry); err != nil {
+		log.Errorf("Error writing audit log: %v", err)
+	}
+}
+
+// NewPolicyPipeRouter wraps a PipeRouter such that UI attachments to, and
+// deletions of, pipes are recorded in the audit log. In read-only mode, UI
+// attachments are denied.
+func NewPolicyPipeRouter(pr PipeRouter, policy ControlPolicy, userIDer UserIDer, audit AuditLog) PipeRouter {
+	return &policyPipeRouter{
+		PipeRouter: pr,
+		policy:     policy,
+		userIDer:   userIDer,
+		audit:      audit,
+	}
+}
+
+type policyPipeRouter struct {
+	PipeRouter
+	policy   ControlPolicy
+	userIDer UserIDer
+	audit    AuditLog
+}
+
+func (p *policyPipeRouter) Get(ctx context.Context, id string, end End) (xfer.Pipe, io.ReadWriter, error) {
+	if end != UIEnd {
+		return p.PipeRouter.Get(ctx, id, end)
+	}
+	user, err := p.userIDer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := AuditEntry{Timestamp: mtime.Now(), User: user, Action: AuditPipeAttach, PipeID: id}
+	if p.policy.ReadOnly {
+		err := fmt.Errorf("pipes are not allowed in read-only mode")
+		entry.Result, entry.Error = AuditDenied, err.Error()
+		p.record(ctx, entry)
+		return nil, nil, err
+	}
+	pipe, rw, err := p.PipeRouter.Get(ctx, id, end)
+	entry.Result = AuditOK
+	if err != nil {
+		entry.Result, entry.Error = AuditError, err.Error()
+	}
+	p.record(ctx, entry)
+	return pipe, rw, err
+}
+
+func (p *policyPipeRouter) Delete(ctx context.Context, id string) error {
+	user, err := p.userIDer(ctx)
+	if err != nil {
+		return err
+	}
+	entry := AuditEntry{Timestamp: mtime.Now(), User: user, Action: AuditPipeDelete, PipeID: id, Result: AuditOK}
+	err = p.PipeRouter.Delete(ctx, id)
+	if err != nil {
+		entry.Result, entry.Error = AuditError, err.Error()
+	}
+	p.record(ctx, entry)
+	return err
+}
+
+func (p *policyPipeRouter) record(ctx context.Context, entry AuditEntry) {
+	if err := p.audit.Record(ctx, entry); err != nil {
+		log.Errorf("Error writing audit log: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestControlPolicy(t *testing.T) {
+	policy, err := app.DecodeControlPolicy(strings.NewReader(`{
+		"rules": [
+			{"effect": "allow", "users": ["admin"]},
+			{"effect": "deny", "controls": ["docker_remove_container", "*_exec_*"]},
+			{"effect": "deny", "topologies": ["host"]},
+			{"effect": "deny", "nodes": ["prod-*"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := report.MakeContainerNodeID("abc")
+	for _, c := range []struct {
+		user, control, topology, nodeID string
+		want                            bool
+	}{
+		{"admin", "docker_remove_container", report.Container, container, true},
+		{"bob", "docker_remove_container", report.Container, container, false},
+		{"bob", "docker_exec_container", report.Container, container, false},
+		{"bob", "docker_stop_container", report.Container, container, true},
+		{"bob", "host_exec", report.Host, report.MakeHostNodeID("foo"), false},
+		{"bob", "docker_stop_container", report.Container, report.MakeContainerNodeID("prod-abc"), false},
+	} {
+		if have := policy.Allowed(c.user, c.control, c.topology, c.nodeID); have != c.want {
+			t.Errorf("%s %s %s: want %v, have %v", c.user, c.control, c.nodeID, c.want, have)
+		}
+	}
+
+	policy.ReadOnly = true
+	if policy.Allowed("admin", "docker_stop_container", report.Container, container) {
+		t.Errorf("Expected read-only policy to deny everything")
+	}
+
+	if _, err := app.DecodeControlPolicy(strings.NewReader(`{"rules": [{"effect": "maybe"}]}`)); err == nil {
+		t.Errorf("Expected invalid effect to be rejected")
+	}
+}
+
+type mockControlRouter struct {
+	app.ControlRouter
+	response xfer.Response
+	requests *[]xfer.Request
+}
+
+func (m mockControlRouter) Handle(_ context.Context, _ string, req xfer.Request) (xfer.Response, error) {
+	if m.requests != nil {
+		*m.requests = append(*m.requests, req)
+	}
+	return m.response, nil
+}
+
+type reportReporter struct {
+	app.Reporter
+	rpt report.Report
+}
+
+func (r reportReporter) Report(context.Context) (report.Report, error) { return r.rpt, nil }
+
+func TestPolicyControlRouter(t *testing.T) {
+	var (
+		audit    = app.NewMemoryAuditLog(10)
+		userIDer = func(context.Context) (string, error) { return "bob", nil }
+		policy   = app.ControlPolicy{Rules: []app.ControlRule{{Effect: app.PolicyDeny, Controls: []string{"kill"}}}}
+		cr       = app.NewPolicyControlRouter(mockControlRouter{response: xfer.Response{Pipe: "pipe"}}, policy, userIDer, audit, reportReporter{rpt: report.MakeReport()})
+		ctx      = context.Background()
+	)
+
+	if _, err := cr.Handle(ctx, "probe", xfer.Request{NodeID: "node", Control: "kill"}); err == nil {
+		t.Errorf("Expected control to be denied")
+	} else if _, ok := err.(app.ErrControlDenied); !ok {
+		t.Errorf("Expected ErrControlDenied, got %v", err)
+	}
+	if _, err := cr.Handle(ctx, "probe", xfer.Request{NodeID: "node", Control: "exec", Args: map[string]string{"cmd": "sh"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := audit.Entries(ctx, app.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(entries))
+	equals(t, "exec", entries[0].Control)
+	equals(t, app.AuditOK, entries[0].Result)
+	equals(t, "pipe", entries[0].PipeID)
+	equals(t, map[string]string{"cmd": "sh"}, entries[0].Args)
+	equals(t, "kill", entries[1].Control)
+	equals(t, app.AuditDenied, entries[1].Result)
+	equals(t, "bob", entries[1].User)
+
+	entries, err = audit.Entries(ctx, app.AuditQuery{Control: "kill"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(entries))
+}
+
+func TestPolicyControlRouterTopologies(t *testing.T) {
+	// Systemd service and process node IDs look alike; the topology comes
+	// from the report, not the ID. Nodes which aren't in the report are in
+	// the topology which offers the control, and if that isn't known either,
+	// rules about topologies deny them.
+	rpt := report.MakeReport()
+	serviceID := report.MakeSystemdServiceNodeID("host1", "sshd.service")
+	rpt.SystemdService.AddNode(report.MakeNode(serviceID))
+	rpt.SystemdService.Controls.AddControl(report.Control{ID: "systemd_restart"})
+
+	var (
+		audit    = app.NewMemoryAuditLog(10)
+		userIDer = func(context.Context) (string, error) { return "bob", nil }
+		mock     = mockControlRouter{response: xfer.Response{Value: "ok"}}
+		ctx      = context.Background()
+	)
+	for _, c := range []struct {
+		topology string
+		control  string
+		nodeID   string
+		allowed  bool
+	}{
+		{report.Process, "systemd_restart", serviceID, true},
+		{report.SystemdService, "systemd_restart", serviceID, false},
+		{report.Process, "systemd_restart", "sshd", true},
+		{report.SystemdService, "systemd_restart", "sshd", false},
+		{report.Process, "unknown", "missing", false},
+	} {
+		policy := app.ControlPolicy{Rules: []app.ControlRule{{Effect: app.PolicyDeny, Topologies: []string{c.topology}}}}
+		cr := app.NewPolicyControlRouter(mock, policy, userIDer, audit, reportReporter{rpt: rpt})
+		_, err := cr.Handle(ctx, "probe", xfer.Request{NodeID: c.nodeID, Control: c.control})
+		if allowed := err == nil; allowed != c.allowed {
+			t.Errorf("deny %q, %s on %s: want allowed %v, got %v", c.topology, c.control, c.nodeID, c.allowed, err)
+		}
+	}
+
+	// With no rules about topologies, unknown ones are only denied by
+	// default.
+	for _, defaultDeny := range []bool{false, true} {
+		policy := app.ControlPolicy{DefaultDeny: defaultDeny}
+		cr := app.NewPolicyControlRouter(mock, policy, userIDer, audit, reportReporter{rpt: rpt})
+		_, err := cr.Handle(ctx, "probe", xfer.Request{NodeID: "missing", Control: "unknown"})
+		if allowed := err == nil; allowed == defaultDeny {
+			t.Errorf("default deny %v: got %v", defaultDeny, err)
+		}
+	}
+}
+
+func TestPolicyControlRouterJobs(t *testing.T) {
+	var (
+		audit    = app.NewMemoryAuditLog(10)
+		userIDer = func(context.Context) (string, error) { return "bob", nil }
+		requests = []xfer.Request{}
+		mock     = mockControlRouter{response: xfer.Response{Value: "ok"}, requests: &requests}
+		cr       = app.NewPolicyControlRouter(mock, app.ControlPolicy{ReadOnly: true}, userIDer, audit, reportReporter{rpt: report.MakeReport()})
+		ctx      = context.Background()
+		args     = map[string]string{controls.JobArg: "job"}
+	)
+
+	// Anyone can see how jobs are going, without filling the audit log
+	if _, err := cr.Handle(ctx, "probe", xfer.Request{Control: controls.JobStatus, Args: args}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.Handle(ctx, "probe", xfer.Request{Control: controls.CancelJob, Args: args}); err == nil {
+		t.Errorf("Expected cancelling to be denied")
+	}
+	entries, err := audit.Entries(ctx, app.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(entries))
+	equals(t, controls.CancelJob, entries[0].Control)
+
+	// Probes are told who invoked controls, so they can check who cancels
+	// jobs
+	cr = app.NewPolicyControlRouter(mock, app.ControlPolicy{}, userIDer, audit, reportReporter{rpt: report.MakeReport()})
+	if _, err := cr.Handle(ctx, "probe", xfer.Request{Control: controls.CancelJob, Args: args}); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(requests))
+	equals(t, "", requests[0].User)
+	equals(t, "bob", requests[1].User)
+}
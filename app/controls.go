@@ -1,15 +1,19 @@
 package app
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/rpc"
+	"strconv"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
 )
 
 // RegisterControlRoutes registers the various control routes with a http mux.
@@ -18,6 +22,48 @@ func RegisterControlRoutes(router *mux.Router, cr ControlRouter) {
 		HandlerFunc(requestContextDecorator(handleProbeWS(cr)))
 	router.Methods("POST").MatcherFunc(URLMatcher("/api/control/{probeID}/{nodeID}/{control}")).
 		HandlerFunc(requestContextDecorator(handleControl(cr)))
+	router.Methods("GET").Path("/api/control/jobs/{id}").
+		HandlerFunc(requestContextDecorator(handleJob(cr, controls.JobStatus)))
+	router.Methods("DELETE").Path("/api/control/jobs/{id}").
+		HandlerFunc(requestContextDecorator(handleJob(cr, controls.CancelJob)))
+	router.Methods("GET").Path("/api/control/jobs/{id}/ws").
+		HandlerFunc(requestContextDecorator(handleJobWebsocket(cr)))
+}
+
+// controlBody is the optional JSON body of a control request. Argument
+// values may be any JSON scalar; they are passed on to the probe as strings.
+type controlBody struct {
+	Args map[string]interface{} `json:"args"`
+}
+
+func controlArgs(r *http.Request) (map[string]string, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil, nil
+	}
+	var body controlBody
+	if err := codec.NewDecoder(r.Body, &codec.JsonHandle{}).Decode(&body); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if body.Args == nil {
+		return nil, nil
+	}
+	return controlArgStrings(body.Args), nil
+}
+
+// controlArgStrings converts JSON argument values to the strings probes take.
+// Numbers are written out in full, e.g. 1e6 as "1000000", so probes can parse
+// them as integers.
+func controlArgStrings(values map[string]interface{}) map[string]string {
+	args := map[string]string{}
+	for name, value := range values {
+		switch v := value.(type) {
+		case float64:
+			args[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			args[name] = fmt.Sprint(v)
+		}
+	}
+	return args
 }
 
 // handleControl routes control requests from the client to the appropriate
@@ -30,11 +76,21 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 			nodeID  = vars["nodeID"]
 			control = vars["control"]
 		)
+		args, err := controlArgs(r)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		result, err := cr.Handle(ctx, probeID, xfer.Request{
-			NodeID:  nodeID,
-			Control: control,
+			NodeID:      nodeID,
+			Control:     control,
+			Args:        args,
+			FramedPipes: true,
 		})
-		if err != nil {
+		if _, ok := err.(ErrControlDenied); ok {
+			respondWith(w, http.StatusForbidden, err.Error())
+			return
+		} else if err != nil {
 			respondWith(w, http.StatusBadRequest, err.Error())
 			return
 		}
@@ -42,6 +98,13 @@ func handleControl(cr ControlRouter) CtxHandlerFunc {
 			respondWith(w, http.StatusBadRequest, result.Error)
 			return
 		}
+		// The UI frames its end of the pipe as the app will
+		result.FramedPipe = xfer.IsFramedPipeID(result.Pipe)
+		if result.Job != "" {
+			result.Job = makeJobID(probeID, result.Job)
+			respondWith(w, http.StatusAccepted, result)
+			return
+		}
 		respondWith(w, http.StatusOK, result)
 	}
 }
@@ -63,24 +126,29 @@ func handleProbeWS(cr ControlRouter) CtxHandlerFunc {
 		}
 		defer conn.Close()
 
-		codec := xfer.NewJSONWebsocketCodec(conn)
-		client := rpc.NewClientWithCodec(codec)
-		defer client.Close()
-
-		id, err := cr.Register(ctx, probeID, func(req xfer.Request) xfer.Response {
-			var res xfer.Response
-			if err := client.Call("control.Handle", req, &res); err != nil {
-				return xfer.ResponseError(err)
-			}
-			return res
-		})
-		if err != nil {
-			respondWith(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		defer cr.Deregister(ctx, probeID, id)
-		if err := codec.WaitForReadError(); err != nil && err != io.EOF && !xfer.IsExpectedWSCloseError(err) {
+		if err := serveControls(ctx, cr, probeID, conn); err != nil && err != io.EOF && !xfer.IsExpectedWSCloseError(err) {
 			log.Errorf("Error on websocket: %v", err)
 		}
 	}
 }
+
+// serveControls registers a connection from the probe in the control router,
+// and blocks until the connection fails.
+func serveControls(ctx context.Context, cr ControlRouter, probeID string, conn xfer.Websocket) error {
+	codec := xfer.NewJSONWebsocketCodec(conn)
+	client := rpc.NewClientWithCodec(codec)
+	defer client.Close()
+
+	id, err := cr.Register(ctx, probeID, func(req xfer.Request) xfer.Response {
+		var res xfer.Response
+		if err := client.Call("control.Handle", req, &res); err != nil {
+			return xfer.ResponseError(err)
+		}
+		return res
+	})
+	if err != nil {
+		return err
+	}
+	defer cr.Deregister(ctx, probeID, id)
+	return codec.WaitForReadError()
+}
@@ -10,10 +10,13 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
 )
 
 func TestControl(t *testing.T) {
@@ -71,3 +74,138 @@ func TestControl(t *testing.T) {
 		t.Fatalf("'%s' != 'foo'", response.Value)
 	}
 }
+
+func TestControlArgs(t *testing.T) {
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, app.NewLocalControlRouter())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ip, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probeConfig := appclient.ProbeConfig{
+		ProbeID: "foo",
+	}
+	controlHandler := xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+		return xfer.Response{
+			Value: req.Args["replicas"] + "/" + req.Args["force"],
+		}
+	})
+	client, err := appclient.NewAppClient(probeConfig, ip+":"+port, ip+":"+port, controlHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ControlConnection()
+	defer client.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	httpClient := http.Client{
+		Timeout: 1 * time.Second,
+	}
+	body := strings.NewReader(`{"args": {"replicas": 1e6, "force": true}}`)
+	resp, err := httpClient.Post(server.URL+"/api/control/foo/nodeid/control", "application/json", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var response xfer.Response
+	decoder := codec.NewDecoder(resp.Body, &codec.JsonHandle{})
+	if err := decoder.Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Value != "1000000/true" {
+		t.Fatalf("'%s' != '1000000/true'", response.Value)
+	}
+}
+
+func TestControlJobs(t *testing.T) {
+	release := make(chan struct{})
+	controls.RegisterJob("test_job", nil, func(ctx context.Context, req xfer.Request, progress controls.ProgressFunc) xfer.Response {
+		progress(50, "halfway")
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return xfer.Response{Value: "done"}
+	})
+	defer controls.Rm("test_job")
+
+	cr := app.NewLocalControlRouter()
+	if _, err := cr.Register(context.Background(), "probe1", controls.HandleControlRequest); err != nil {
+		t.Fatal(err)
+	}
+	// Jobs can only be cancelled by the identified users who started them.
+	userIDer := func(context.Context) (string, error) { return "alice", nil }
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, app.NewPolicyControlRouter(cr, app.ControlPolicy{}, userIDer, app.NewMemoryAuditLog(10), reportReporter{rpt: report.MakeReport()}))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	getJob := func(method, id string) (int, xfer.Job) {
+		res, body := checkRequest(t, ts, method, "/api/control/jobs/"+id, nil)
+		var job xfer.Job
+		if res.StatusCode == http.StatusOK {
+			if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&job); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, job
+	}
+	startJob := func() string {
+		res, body := checkRequest(t, ts, "POST", "/api/control/probe1/nodeid/test_job", nil)
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d: %s", res.StatusCode, body)
+		}
+		var response xfer.Response
+		if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(response.Job, "probe1-") {
+			t.Fatalf("Unexpected job ID %q", response.Job)
+		}
+		return response.Job
+	}
+	waitFor := func(id, state string) xfer.Job {
+		var job xfer.Job
+		for start := time.Now(); job.State != state && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			_, job = getJob("GET", id)
+		}
+		if job.State != state {
+			t.Fatalf("Expected job %s to be %s, got %v", id, state, job)
+		}
+		return job
+	}
+
+	// Run a job to completion
+	id := startJob()
+	job := waitFor(id, xfer.JobRunning)
+	if job.ID != id || job.Progress != 50 || job.Message != "halfway" {
+		t.Errorf("Unexpected job: %v", job)
+	}
+	close(release)
+	job = waitFor(id, xfer.JobSucceeded)
+	if job.Progress != 100 || job.Result == nil || job.Result.Value != "done" {
+		t.Errorf("Unexpected job: %v", job)
+	}
+
+	// Cancel a job
+	release = make(chan struct{})
+	id = startJob()
+	if status, _ := getJob("DELETE", id); status != http.StatusOK {
+		t.Errorf("Expected 200 cancelling job, got %d", status)
+	}
+	waitFor(id, xfer.JobCancelled)
+
+	// Unknown jobs
+	for _, id := range []string{"probe1-123", "probe2-123", "nonsense"} {
+		if status, _ := getJob("GET", id); status == http.StatusOK {
+			t.Errorf("%s: expected error, got %d", id, status)
+		}
+	}
+}
@@ -180,7 +180,8 @@ func (c *dynamoDBCollector) Add(ctx context.Context, rep report.Report) error {
 	}
 	writer.Close()
 
-	now := time.Now()
+	// Reports the probe held back are stored as of when they were made
+	now := time.Now().Add(-rep.Delay)
 	rowKey := fmt.Sprintf("%s-%s", userid, strconv.FormatInt(now.UnixNano()/time.Hour.Nanoseconds(), 10))
 	_, err = c.db.PutItem(&dynamodb.PutItemInput{
 		TableName: aws.String(tableName),
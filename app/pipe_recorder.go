@@ -0,0 +1,549 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+const (
+	recordingExt      = ".cast"
+	retentionInterval = 1 * time.Hour
+	// Controls which opened a pipe are forgotten if the UI never attaches.
+	pendingTimeout = 1 * time.Hour
+
+	defaultTermWidth  = 80
+	defaultTermHeight = 24
+)
+
+var recordingID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Recording describes a recorded pipe session.
+type Recording struct {
+	ID       string    `json:"id"`
+	PipeID   string    `json:"pipe_id"`
+	User     string    `json:"user,omitempty"`
+	ProbeID  string    `json:"probe_id,omitempty"`
+	NodeID   string    `json:"node_id,omitempty"`
+	Topology string    `json:"topology,omitempty"`
+	Control  string    `json:"control,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+
+	framed bool // whether the probe frames the pipe's traffic
+}
+
+// castHeader is the first line of an asciicast (v2) file; the recording's
+// details go in an extra field, which players ignore.
+type castHeader struct {
+	Version   int       `json:"version"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Timestamp int64     `json:"timestamp"`
+	Title     string    `json:"title,omitempty"`
+	Scope     Recording `json:"scope"`
+}
+
+// PipeRecorder records pipe sessions to disk, one asciicast file per pipe,
+// with the output, input and terminal resizes, as seen by the app. Wrap the
+// app's control and pipe routers with it, so it knows who opened each pipe,
+// and on which node, and can see the data.
+type PipeRecorder struct {
+	sync.Mutex
+	dir      string
+	maxAge   time.Duration
+	maxBytes int64
+	userIDer UserIDer
+	reporter Reporter
+
+	pending    map[string]Recording
+	recordings map[string]*recording
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// NewPipeRecorder makes a PipeRecorder writing to dir. Recordings older than
+// maxAge, and the oldest recordings beyond maxBytes in total, are deleted;
+// zero means no limit. The reporter is used to find which topology the nodes
+// pipes are opened on are in.
+func NewPipeRecorder(dir string, maxAge time.Duration, maxBytes int64, userIDer UserIDer, reporter Reporter) (*PipeRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	r := &PipeRecorder{
+		dir:        dir,
+		maxAge:     maxAge,
+		maxBytes:   maxBytes,
+		userIDer:   userIDer,
+		reporter:   reporter,
+		pending:    map[string]Recording{},
+		recordings: map[string]*recording{},
+		quit:       make(chan struct{}),
+	}
+	r.wait.Add(1)
+	go r.retentionLoop()
+	return r, nil
+}
+
+// Stop stops the PipeRecorder enforcing retention.
+func (r *PipeRecorder) Stop() {
+	close(r.quit)
+	r.wait.Wait()
+}
+
+func (r *PipeRecorder) path(id string) string {
+	return filepath.Join(r.dir, id+recordingExt)
+}
+
+// ControlRouter wraps cr, noting the details of controls which open pipes.
+func (r *PipeRecorder) ControlRouter(cr ControlRouter) ControlRouter {
+	return &recordingControlRouter{ControlRouter: cr, recorder: r}
+}
+
+type recordingControlRouter struct {
+	ControlRouter
+	recorder *PipeRecorder
+}
+
+func (cr *recordingControlRouter) Handle(ctx context.Context, probeID string, req xfer.Request) (xfer.Response, error) {
+	res, err := cr.ControlRouter.Handle(ctx, probeID, req)
+	if err != nil || res.Pipe == "" {
+		return res, err
+	}
+	user, _ := cr.recorder.userIDer(ctx)
+	topology := ""
+	if rpt, err := cr.recorder.reporter.Report(ctx); err == nil {
+		topology = nodeTopology(rpt, req.Control, req.NodeID)
+	}
+	cr.recorder.Lock()
+	cr.recorder.pending[res.Pipe] = Recording{
+		PipeID:   res.Pipe,
+		User:     user,
+		ProbeID:  probeID,
+		NodeID:   req.NodeID,
+		Topology: topology,
+		Control:  req.Control,
+		Started:  mtime.Now(),
+		framed:   xfer.IsFramedPipeID(res.Pipe),
+	}
+	cr.recorder.Unlock()
+	return res, err
+}
+
+// PipeRouter wraps pr, recording the traffic of every UI attachment to a
+// pipe. If the recording can't be written, the attachment is refused.
+func (r *PipeRecorder) PipeRouter(pr PipeRouter) PipeRouter {
+	return &recordingPipeRouter{PipeRouter: pr, recorder: r}
+}
+
+type recordingPipeRouter struct {
+	PipeRouter
+	recorder *PipeRecorder
+}
+
+func (pr *recordingPipeRouter) Get(ctx context.Context, id string, e End) (xfer.Pipe, io.ReadWriter, error) {
+	if e != UIEnd {
+		return pr.PipeRouter.Get(ctx, id, e)
+	}
+	rec, err := pr.recorder.open(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot record pipe %s: %v", id, err)
+	}
+	pipe, endIO, err := pr.PipeRouter.Get(ctx, id, e)
+	if err != nil {
+		pr.recorder.release(id)
+		return nil, nil, err
+	}
+	end := &recordingEnd{ReadWriter: endIO, pipe: pipe, recording: rec}
+	if rec.framed {
+		end.in, end.out = &xfer.FrameDecoder{}, &xfer.FrameDecoder{}
+	}
+	return pipe, end, nil
+}
+
+func (pr *recordingPipeRouter) Release(ctx context.Context, id string, e End) error {
+	if e == UIEnd {
+		pr.recorder.release(id)
+	}
+	return pr.PipeRouter.Release(ctx, id, e)
+}
+
+// recording is an open recording file, shared by all the UI attachments to
+// a pipe.
+type recording struct {
+	sync.Mutex
+	refCount int
+	started  time.Time
+	framed   bool
+	file     *os.File
+}
+
+func (r *PipeRecorder) open(ctx context.Context, pipeID string) (*recording, error) {
+	if !recordingID.MatchString(pipeID) {
+		return nil, fmt.Errorf("invalid pipe ID")
+	}
+	r.Lock()
+	defer r.Unlock()
+	if rec, ok := r.recordings[pipeID]; ok {
+		rec.refCount++
+		return rec, nil
+	}
+
+	path := r.path(pipeID)
+	if header, err := readCastHeader(path); err == nil {
+		// The UI is re-attaching; carry on where we left off.
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		rec := &recording{refCount: 1, started: header.Scope.Started, framed: xfer.IsFramedPipeID(pipeID), file: file}
+		r.recordings[pipeID] = rec
+		return rec, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	details, ok := r.pending[pipeID]
+	if ok {
+		delete(r.pending, pipeID)
+	} else {
+		details = Recording{PipeID: pipeID, Started: mtime.Now(), framed: xfer.IsFramedPipeID(pipeID)}
+		details.User, _ = r.userIDer(ctx)
+	}
+	details.ID = pipeID
+	header := castHeader{
+		Version:   2,
+		Width:     defaultTermWidth,
+		Height:    defaultTermHeight,
+		Timestamp: details.Started.Unix(),
+		Title:     strings.TrimSpace(fmt.Sprintf("%s %s %s", details.User, details.Control, details.NodeID)),
+		Scope:     details,
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, &codec.JsonHandle{}).Encode(header); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(append(buf, '\n')); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Infof("Recording pipe %s to %s", pipeID, path)
+	rec := &recording{refCount: 1, started: details.Started, framed: details.framed, file: file}
+	r.recordings[pipeID] = rec
+	return rec, nil
+}
+
+func (r *PipeRecorder) release(pipeID string) {
+	r.Lock()
+	defer r.Unlock()
+	rec, ok := r.recordings[pipeID]
+	if !ok {
+		return
+	}
+	rec.refCount--
+	if rec.refCount > 0 {
+		return
+	}
+	delete(r.recordings, pipeID)
+	rec.Lock()
+	defer rec.Unlock()
+	if err := rec.file.Close(); err != nil {
+		log.Errorf("Error closing recording of pipe %s: %v", pipeID, err)
+	}
+	rec.file = nil
+}
+
+// record writes the frames in buf as asciicast events of the given kind
+// ("o" for output, "i" for input). Pipes from older probes aren't framed;
+// for them, decoder is nil and buf is all data.
+func (rec *recording) record(decoder *xfer.FrameDecoder, kind string, buf []byte) error {
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.file == nil {
+		// The UI has detached, but the copying hasn't finished yet.
+		return nil
+	}
+	if decoder == nil {
+		decoder = &xfer.FrameDecoder{}
+		buf = xfer.Frame{Type: xfer.FrameData, Data: buf}.Bytes()
+	}
+	decoder.Write(buf)
+	for {
+		f, ok, err := decoder.Next()
+		if err != nil {
+			return fmt.Errorf("cannot decode pipe for recording: %v", err)
+		} else if !ok {
+			return nil
+		}
+
+		var event []interface{}
+		elapsed := mtime.Now().Sub(rec.started).Seconds()
+		switch f.Type {
+		case xfer.FrameData:
+			event = []interface{}{elapsed, kind, string(f.Data)}
+		case xfer.FrameResize:
+			width, height, _ := f.Size()
+			event = []interface{}{elapsed, "r", fmt.Sprintf("%dx%d", width, height)}
+		default:
+			continue
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("cannot encode recording event: %v", err)
+		}
+		if _, err := rec.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("cannot write recording: %v", err)
+		}
+	}
+}
+
+// recordingEnd tees the traffic through the UI end of a pipe into a
+// recording. The decoders are nil if the pipe isn't framed. If the traffic
+// can't be recorded, the pipe is closed, rather than carrying on unrecorded.
+type recordingEnd struct {
+	io.ReadWriter
+	pipe      xfer.Pipe
+	recording *recording
+	in, out   *xfer.FrameDecoder
+}
+
+func (e *recordingEnd) Read(p []byte) (int, error) {
+	n, err := e.ReadWriter.Read(p)
+	if n > 0 {
+		if rerr := e.recording.record(e.out, "o", p[:n]); rerr != nil {
+			return 0, e.fail(rerr)
+		}
+	}
+	return n, err
+}
+
+func (e *recordingEnd) Write(p []byte) (int, error) {
+	n, err := e.ReadWriter.Write(p)
+	if n > 0 {
+		if rerr := e.recording.record(e.in, "i", p[:n]); rerr != nil {
+			return n, e.fail(rerr)
+		}
+	}
+	return n, err
+}
+
+func (e *recordingEnd) fail(err error) error {
+	log.Errorf("Closing pipe: %v", err)
+	e.pipe.Close()
+	return err
+}
+
+func readCastHeader(path string) (castHeader, error) {
+	var header castHeader
+	file, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return header, err
+	}
+	err = codec.NewDecoderBytes(line, &codec.JsonHandle{}).Decode(&header)
+	return header, err
+}
+
+// Recordings lists the recordings, most recently updated first.
+func (r *PipeRecorder) Recordings() ([]Recording, error) {
+	infos, err := r.files()
+	if err != nil {
+		return nil, err
+	}
+	result := []Recording{}
+	for _, info := range infos {
+		header, err := readCastHeader(filepath.Join(r.dir, info.Name()))
+		if err != nil {
+			log.Warningf("Skipping unreadable recording %s: %v", info.Name(), err)
+			continue
+		}
+		rec := header.Scope
+		rec.ID = strings.TrimSuffix(info.Name(), recordingExt)
+		rec.Updated = info.ModTime()
+		rec.Size = info.Size()
+		result = append(result, rec)
+	}
+	return result, nil
+}
+
+// files returns the recording files, most recently modified first.
+func (r *PipeRecorder) files() ([]os.FileInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*"+recordingExt))
+	if err != nil {
+		return nil, err
+	}
+	infos := []os.FileInfo{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Sort(byModTime(infos))
+	return infos, nil
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byModTime) Less(i, j int) bool { return b[i].ModTime().After(b[j].ModTime()) }
+
+func (r *PipeRecorder) retentionLoop() {
+	defer r.wait.Done()
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		r.enforceRetention()
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceRetention deletes recordings which are too old, or which take the
+// total size of recordings over the limit, oldest first. Recordings still
+// being written are never deleted.
+func (r *PipeRecorder) enforceRetention() {
+	infos, err := r.files()
+	if err != nil {
+		log.Errorf("Error listing recordings: %v", err)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	now := mtime.Now()
+	for pipeID, details := range r.pending {
+		if now.Sub(details.Started) > pendingTimeout {
+			delete(r.pending, pipeID)
+		}
+	}
+
+	var total int64
+	for _, info := range infos {
+		id := strings.TrimSuffix(info.Name(), recordingExt)
+		if _, ok := r.recordings[id]; ok {
+			total += info.Size()
+			continue
+		}
+		if (r.maxAge > 0 && now.Sub(info.ModTime()) > r.maxAge) ||
+			(r.maxBytes > 0 && total+info.Size() > r.maxBytes) {
+			log.Infof("Deleting recording %s", id)
+			if err := os.Remove(filepath.Join(r.dir, info.Name())); err != nil {
+				log.Errorf("Error deleting recording %s: %v", id, err)
+			}
+			continue
+		}
+		total += info.Size()
+	}
+}
+
+// RegisterRecordingRoutes registers the routes for listing and replaying
+// pipe recordings. Users only see their own recordings, unless the policy
+// makes them auditors; to everyone else, in multitenant apps other tenants,
+// the rest don't exist.
+func RegisterRecordingRoutes(router *mux.Router, r *PipeRecorder, policy ControlPolicy) {
+	router.Methods("GET").Path("/api/recordings").
+		HandlerFunc(requestContextDecorator(handleListRecordings(r, policy)))
+	router.Methods("GET").Path("/api/recordings/{id}").
+		HandlerFunc(requestContextDecorator(handleGetRecording(r, policy)))
+}
+
+func canView(policy ControlPolicy, user string, rec Recording) bool {
+	return (user != "" && rec.User == user) || policy.Auditor(user)
+}
+
+func handleListRecordings(r *PipeRecorder, policy ControlPolicy) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, _ *http.Request) {
+		user, err := r.userIDer(ctx)
+		if err != nil {
+			respondWith(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		recordings, err := r.Recordings()
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		visible := []Recording{}
+		for _, rec := range recordings {
+			if canView(policy, user, rec) {
+				visible = append(visible, rec)
+			}
+		}
+		respondWith(w, http.StatusOK, visible)
+	}
+}
+
+// handleGetRecording serves the asciicast file, for playing with any
+// asciicast player.
+func handleGetRecording(r *PipeRecorder, policy ControlPolicy) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+		id := mux.Vars(req)["id"]
+		if !recordingID.MatchString(id) {
+			http.NotFound(w, req)
+			return
+		}
+		user, err := r.userIDer(ctx)
+		if err != nil {
+			respondWith(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		header, err := readCastHeader(r.path(id))
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !canView(policy, user, header.Scope) {
+			http.NotFound(w, req)
+			return
+		}
+		file, err := os.Open(r.path(id))
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer file.Close()
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		if _, err := io.Copy(w, file); err != nil {
+			log.Errorf("Error serving recording %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package app_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestPipeRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipe-recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Unix(1000, 0)
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	// The user comes from a header when there's a request, as in
+	// multitenant apps.
+	userIDer := func(ctx context.Context) (string, error) {
+		if r, ok := ctx.Value(app.RequestCtxKey).(*http.Request); ok && r.Header.Get("X-User") != "" {
+			return r.Header.Get("X-User"), nil
+		}
+		return "alice", nil
+	}
+	reporter := reportReporter{rpt: report.MakeReport()}
+	pipeID := xfer.FramedPipeID("pipe-1")
+	recorder, err := app.NewPipeRecorder(dir, 0, 0, userIDer, reporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Stop() // we don't want the retention loop running in the background
+
+	cr := app.NewLocalControlRouter()
+	if _, err := cr.Register(context.Background(), "probe1", func(req xfer.Request) xfer.Response {
+		return xfer.Response{Pipe: pipeID, FramedPipe: true}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	controlRouter := recorder.ControlRouter(cr)
+	pipeRouter := recorder.PipeRouter(app.NewLocalPipeRouter())
+	defer pipeRouter.Stop()
+
+	ctx := context.Background()
+	if _, err := controlRouter.Handle(ctx, "probe1", xfer.Request{NodeID: "host1;<host>", Control: "host_exec"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, ui, err := pipeRouter.Get(ctx, pipeID, app.UIEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, probe, err := pipeRouter.Get(ctx, pipeID, app.ProbeEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pass frames each way through the pipe, as the websocket copying would.
+	transfer := func(from io.Writer, to io.Reader, frames ...xfer.Frame) {
+		for _, f := range frames {
+			done := make(chan struct{})
+			go func() {
+				from.Write(f.Bytes())
+				close(done)
+			}()
+			buf := make([]byte, len(f.Bytes()))
+			if _, err := io.ReadFull(to, buf); err != nil {
+				t.Fatal(err)
+			}
+			<-done
+		}
+	}
+	mtime.NowForce(start.Add(500 * time.Millisecond))
+	transfer(probe, ui, xfer.Frame{Type: xfer.FrameData, Data: []byte("$ ")})
+	mtime.NowForce(start.Add(1 * time.Second))
+	transfer(ui, probe, xfer.ResizeFrame(120, 40), xfer.Frame{Type: xfer.FrameData, Data: []byte("id\r")})
+	mtime.NowForce(start.Add(2 * time.Second))
+	transfer(probe, ui, xfer.Frame{Type: xfer.FramePing}, xfer.Frame{Type: xfer.FrameData, Data: []byte("uid=0(root)\r\n")})
+	if err := pipeRouter.Release(ctx, pipeID, app.UIEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	recordings, err := recorder.Recordings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 1 {
+		t.Fatalf("Expected 1 recording, got %v", recordings)
+	}
+	want := app.Recording{
+		ID:      pipeID,
+		PipeID:  pipeID,
+		User:    "alice",
+		ProbeID: "probe1",
+		NodeID:  "host1;<host>",
+		Control: "host_exec",
+		Started: start,
+	}
+	have := recordings[0]
+	have.Started, have.Updated, have.Size = have.Started.UTC(), time.Time{}, 0
+	want.Started = want.Started.UTC()
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("diff: %s", test.Diff(want, have))
+	}
+
+	// Replay the recording through the API
+	router := mux.NewRouter()
+	app.RegisterRecordingRoutes(router, recorder, app.ControlPolicy{Auditors: []string{"root"}})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, body := checkRequest(t, ts, "GET", "/api/recordings/"+pipeID, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.StatusCode)
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 5 {
+		t.Fatalf("Expected header and 4 events, got %q", lines)
+	}
+	var header map[string]interface{}
+	if err := codec.NewDecoderBytes([]byte(lines[0]), &codec.JsonHandle{}).Decode(&header); err != nil {
+		t.Fatal(err)
+	}
+	if header["version"] != uint64(2) || header["title"] != "alice host_exec host1;<host>" {
+		t.Errorf("Unexpected header: %v", header)
+	}
+	for i, want := range []string{
+		`[0.5,"o","$ "]`,
+		`[1,"r","120x40"]`,
+		`[1,"i","id\r"]`,
+		`[2,"o","uid=0(root)\r\n"]`,
+	} {
+		if lines[i+1] != want {
+			t.Errorf("event %d: want %s, have %s", i, want, lines[i+1])
+		}
+	}
+
+	res, _ = checkRequest(t, ts, "GET", "/api/recordings/nonexistent", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", res.StatusCode)
+	}
+	res, body = checkRequest(t, ts, "GET", "/api/recordings", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"control":"host_exec"`) {
+		t.Errorf("Unexpected listing: %d %s", res.StatusCode, body)
+	}
+
+	// Other users can't see others' recordings, even of controls they may
+	// run, unless they're auditors
+	getAs := func(user, path string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-User", user)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+	res, body = getAs("bob", "/api/recordings")
+	if res.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "[]" {
+		t.Errorf("Unexpected listing for bob: %d %s", res.StatusCode, body)
+	}
+	res, _ = getAs("bob", "/api/recordings/"+pipeID)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for bob, got %d", res.StatusCode)
+	}
+	res, body = getAs("root", "/api/recordings")
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"control":"host_exec"`) {
+		t.Errorf("Unexpected listing for root: %d %s", res.StatusCode, body)
+	}
+	res, _ = getAs("root", "/api/recordings/"+pipeID)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for root, got %d", res.StatusCode)
+	}
+
+	// Old recordings are deleted
+	mtime.NowReset()
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, pipeID+".cast"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := app.NewPipeRecorder(dir, 24*time.Hour, 0, userIDer, reporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expiring.Stop()
+	test.Poll(t, time.Second, 0, func() interface{} {
+		recordings, _ := expiring.Recordings()
+		return len(recordings)
+	})
+}
@@ -60,6 +60,9 @@ func handlePipeWs(pr PipeRouter, end End) CtxHandlerFunc {
 			return
 		}
 		defer conn.Close()
+		if end == UIEnd && xfer.IsFramedPipeID(id) {
+			conn = xfer.NewUIWebsocket(conn)
+		}
 
 		log.Infof("Success got pipe %s:%s", id, end)
 		if err := pipe.CopyToWebsocket(endIO, conn); err != nil && !xfer.IsExpectedWSCloseError(err) {
@@ -3,6 +3,7 @@ package app
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
 	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/mtime"
@@ -90,7 +92,7 @@ func TestPipeClose(t *testing.T) {
 	defer client.Stop()
 
 	// this is the probe end of the pipe
-	pipeID, pipe, err := controls.NewPipe(adapter{client}, "appid")
+	pipeID, pipe, err := controls.NewPipe(adapter{client}, xfer.Request{AppID: "appid"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,3 +141,227 @@ func TestPipeClose(t *testing.T) {
 		return pipe.Closed()
 	})
 }
+
+func TestPipeControl(t *testing.T) {
+	router := mux.NewRouter()
+	pr := NewLocalPipeRouter()
+	RegisterPipeRoutes(router, pr)
+	defer pr.Stop()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ip, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := appclient.NewAppClient(appclient.ProbeConfig{ProbeID: "foo"}, ip+":"+port, ip+":"+port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	pipeID, pipe, err := controls.NewPipe(adapter{client}, xfer.Request{AppID: "appid", FramedPipes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+	resized := make(chan [2]uint16, 1)
+	pipe.OnResize(func(width, height uint16) {
+		resized <- [2]uint16{width, height}
+	})
+
+	pipeURL := fmt.Sprintf("ws://%s:%s/api/pipe/%s", ip, port, pipeID)
+	conn, _, err := websocket.DefaultDialer.Dial(pipeURL, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Older UIs send data as text
+	local, _ := pipe.Ends()
+	msg := []byte("ls\r")
+	if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	if n, err := local.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(msg, buf[:n]) {
+		t.Fatalf("%v != %v", buf[:n], msg)
+	}
+
+	// Resizes go to the probe out-of-band
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "resize", "width": 120, "height": 40}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case size := <-resized:
+		if size != [2]uint16{120, 40} {
+			t.Fatalf("Unexpected size: %v", size)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pipe was not resized")
+	}
+
+	// EOF half-closes the probe's end
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "eof"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Read(buf); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+
+	// ...but the probe can still write
+	msg = []byte("total 0\r\n")
+	if _, err := local.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if messageType, buf, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	} else if messageType != websocket.BinaryMessage || !bytes.Equal(buf, msg) {
+		t.Fatalf("%d %v != %v", messageType, buf, msg)
+	}
+}
+
+func TestPipeFraming(t *testing.T) {
+	// Apps and probes which frame pipes must still work with older ones
+	// which don't: only when both do is the pipe framed.
+	for _, tc := range []struct {
+		name                   string
+		appFrames, probeFrames bool
+	}{
+		{"new app, new probe", true, true},
+		{"new app, old probe", true, false},
+		{"old app, new probe", false, true},
+	} {
+		testPipeFraming(t, tc.name, tc.appFrames, tc.probeFrames)
+	}
+}
+
+func testPipeFraming(t *testing.T, name string, appFrames, probeFrames bool) {
+	cr := NewLocalControlRouter()
+	pr := NewLocalPipeRouter()
+	defer pr.Stop()
+	router := mux.NewRouter()
+	RegisterControlRoutes(router, cr)
+	RegisterPipeRoutes(router, pr)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	ip, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		client appclient.AppClient
+		pipes  = make(chan xfer.Pipe, 1)
+	)
+	controls.Register("test_pipe", func(req xfer.Request) xfer.Response {
+		id, pipe, err := controls.NewPipe(adapter{client}, req)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+		pipes <- pipe
+		return xfer.Response{Pipe: id}
+	})
+	defer controls.Rm("test_pipe")
+	client, err = appclient.NewAppClient(appclient.ProbeConfig{ProbeID: "foo"}, ip+":"+port, ip+":"+port,
+		xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+			if !probeFrames {
+				// Older probes know nothing of framing.
+				req.FramedPipes = false
+				res := controls.HandleControlRequest(req)
+				res.FramedPipe = false
+				return res
+			}
+			return controls.HandleControlRequest(req)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	client.ControlConnection()
+	test.Poll(t, 2*time.Second, true, func() interface{} {
+		_, err := cr.Handle(context.Background(), "foo", xfer.Request{Control: "nonexistent"})
+		return err == nil
+	})
+
+	var res xfer.Response
+	if appFrames {
+		resp, err := http.Post(server.URL+"/api/control/foo/node/test_pipe", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if err := codec.NewDecoder(resp.Body, &codec.JsonHandle{}).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+	} else if res, err = cr.Handle(context.Background(), "foo", xfer.Request{NodeID: "node", Control: "test_pipe"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := appFrames && probeFrames; res.FramedPipe != want {
+		t.Errorf("%s: expected framed %v, got %v", name, want, res.FramedPipe)
+	}
+	pipe := <-pipes
+	defer pipe.Close()
+	resized := make(chan struct{}, 1)
+	pipe.OnResize(func(width, height uint16) { resized <- struct{}{} })
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s:%s/api/pipe/%s", ip, port, res.Pipe), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Data goes through untouched either way
+	local, _ := pipe.Ends()
+	msg := []byte("hello world")
+	if _, err := local.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, buf, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, msg) {
+		t.Errorf("%s: %q != %q", name, buf, msg)
+	}
+	msg = []byte("ls\r")
+	if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	if n, err := local.Read(buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf[:n], msg) {
+		t.Errorf("%s: %q != %q", name, buf[:n], msg)
+	}
+
+	// Resizes only get through framed pipes; others drop them, rather than
+	// typing them in.
+	if want := appFrames && probeFrames; xfer.IsFramedPipeID(res.Pipe) != want {
+		t.Errorf("%s: expected framed pipe ID %v, got %s", name, want, res.Pipe)
+	}
+	if !res.FramedPipe {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "resize", "width": 120, "height": 40}`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := local.Read(buf); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf[:n], msg) {
+			t.Errorf("%s: %q != %q", name, buf[:n], msg)
+		}
+		return
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "resize", "width": 120, "height": 40}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-resized:
+	case <-time.After(5 * time.Second):
+		t.Errorf("%s: pipe was not resized", name)
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/weaveworks/scope/common/middleware"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// ProbeIdentity returns the identity of the probe which made the request,
+// from its verified client certificate, if it has one.
+func ProbeIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	id, err := xfer.CertIdentity(r.TLS.VerifiedChains[0][0])
+	return id, err == nil
+}
+
+// isProbeRequest says whether a request is one only probes make: publishing
+// reports, and connecting controls and pipes.
+func isProbeRequest(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case r.Method == "POST" && path == "/api/report":
+		return true
+	case path == "/api/control/ws" || path == "/api/probe/ws":
+		return true
+	case strings.HasPrefix(path, "/api/pipe/") && strings.HasSuffix(path, "/probe"):
+		return true
+	}
+	return false
+}
+
+// AuthenticateProbes is middleware for apps doing mutual TLS with probes.
+// Requests only probes make must come with a verified client certificate,
+// and give the probe ID in it. Other requests, e.g. from the UI, don't need
+// a certificate.
+var AuthenticateProbes = middleware.Func(func(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isProbeRequest(r) {
+			id, ok := ProbeIdentity(r)
+			if !ok {
+				respondWith(w, http.StatusUnauthorized, "a client certificate is required")
+				return
+			}
+			if probeID := r.Header.Get(xfer.ScopeProbeIDHeader); probeID != id {
+				respondWith(w, http.StatusForbidden, fmt.Sprintf("probe ID %q does not match certificate", probeID))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+})
+
+// checkReportProbeID checks a report from an authenticated probe only has
+// that probe's nodes. Nodes which say which probe they are from must say it
+// is this one, and nodes on a host, going by their IDs or parents, must be
+// on the probe's own host: the one whose host node it reports.
+func checkReportProbeID(rpt report.Report, probeID string) error {
+	hosts := map[string]bool{}
+	for nodeID, n := range rpt.Host.Nodes {
+		if id, ok := n.Latest.Lookup(report.ControlProbeID); ok && id == probeID {
+			if hostID, ok := report.ParseHostNodeID(nodeID); ok {
+				hosts[hostID] = true
+			}
+		}
+	}
+	for nodeID := range rpt.Host.Nodes {
+		if hostID, _ := report.ParseHostNodeID(nodeID); !hosts[hostID] {
+			return fmt.Errorf("report from probe %s has host %s", probeID, nodeID)
+		}
+	}
+	for _, t := range rpt.Topologies() {
+		for nodeID, n := range t.Nodes {
+			if id, ok := n.Latest.Lookup(report.ControlProbeID); ok && id != probeID {
+				return fmt.Errorf("report from probe %s has nodes from probe %s", probeID, id)
+			}
+			probes, _ := n.Sets.Lookup(report.ControlProbeIDs)
+			for _, probe := range probes {
+				if hostID, id, _ := report.ParseControlProbe(probe); id != probeID || !hosts[hostID] {
+					return fmt.Errorf("report from probe %s has node %s controlled by %s", probeID, nodeID, probe)
+				}
+			}
+			parents, _ := n.Parents.Lookup(report.Host)
+			for _, hostNodeID := range parents {
+				if hostID, _ := report.ParseHostNodeID(hostNodeID); !hosts[hostID] {
+					return fmt.Errorf("report from probe %s has node %s on host %s", probeID, nodeID, hostNodeID)
+				}
+			}
+		}
+	}
+	// These IDs start with the host's ID, if they are local to it.
+	for _, t := range []report.Topology{rpt.Endpoint, rpt.Process, rpt.SystemdService} {
+		for nodeID := range t.Nodes {
+			if hostID, _, ok := report.ParseNodeID(nodeID); ok && hostID != "" && !hosts[hostID] {
+				return fmt.Errorf("report from probe %s has node %s on host %s", probeID, nodeID, hostID)
+			}
+		}
+	}
+	return nil
+}
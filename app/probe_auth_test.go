@@ -0,0 +1,199 @@
+package app_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestAuthenticateProbes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := test.NewCA(t)
+	caFile := ca.WriteCert(t, dir)
+	serverCert, serverKey := ca.Issue(t, dir, "app", "app")
+	probeCert, probeKey := ca.Issue(t, dir, "probe", "probe1")
+
+	var (
+		collector = app.NewCollector(time.Minute)
+		cr        = app.NewLocalControlRouter()
+		router    = mux.NewRouter()
+	)
+	app.RegisterReportPostHandler(collector, router)
+	app.RegisterControlRoutes(router, cr)
+	app.RegisterTopologyRoutes(router, collector)
+	server := httptest.NewUnstartedServer(app.AuthenticateProbes.Wrap(router))
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas, err := xfer.NewCAReloader(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := cas.Pool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert, err := xfer.NewCertReloader(probeCert, probeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(probeID string) appclient.AppClient {
+		client, err := appclient.NewAppClient(appclient.ProbeConfig{
+			ProbeID:    probeID,
+			ClientCert: clientCert,
+			CAFile:     caFile,
+		}, u.Host, server.URL, xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+			return xfer.Response{Value: req.NodeID}
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	// The probe with the ID in its certificate can connect controls, and
+	// publish reports of its own nodes.
+	client := newClient("probe1")
+	defer client.Stop()
+	client.ControlConnection()
+	pollControl := func(probeID string) interface{} {
+		res, err := cr.Handle(context.Background(), probeID, xfer.Request{NodeID: "nodeid"})
+		if err != nil {
+			return err.Error()
+		}
+		return res.Value
+	}
+	test.Poll(t, 2*time.Second, "nodeid", func() interface{} { return pollControl("probe1") })
+
+	hostReport := func(probeID string) report.Report {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith(probeID+";<host>", map[string]string{report.ControlProbeID: probeID}))
+		return rpt
+	}
+	if err := appclient.NewReportPublisher(client).Publish(hostReport("probe1")); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 2*time.Second, 1, func() interface{} {
+		rpt, _ := collector.Report(context.Background())
+		return len(rpt.Host.Nodes)
+	})
+
+	// Probes can't claim other IDs, or send other probes' nodes
+	impostor := newClient("probe2")
+	defer impostor.Stop()
+	impostor.ControlConnection()
+	if err := appclient.NewReportPublisher(client).Publish(hostReport("probe2")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if have := pollControl("probe2"); have == "nodeid" {
+		t.Error("Control connection with the wrong probe ID was accepted")
+	}
+	rpt, _ := collector.Report(context.Background())
+	if len(rpt.Host.Nodes) != 1 {
+		t.Errorf("Report with another probe's nodes was accepted: %v", rpt.Host.Nodes)
+	}
+
+	// ...even if they don't say which probe they're from, but are on
+	// another's host. Clients keep retrying reports they were refused, so
+	// each needs its own.
+	processReport := func(processID, hostNodeID string) report.Report {
+		rpt := hostReport("probe1")
+		rpt.Process.AddNode(report.MakeNode(processID).WithParents(report.EmptySets.Add(report.Host, report.MakeStringSet(hostNodeID))))
+		return rpt
+	}
+	otherHost := report.MakeReport()
+	otherHost.Host.AddNode(report.MakeNode(report.MakeHostNodeID("probe2")))
+	otherProbeImage := hostReport("probe1")
+	otherProbeImage.ContainerImage.AddNode(report.MakeNode(report.MakeContainerImageNodeID("image")).
+		WithSet(report.ControlProbeIDs, report.MakeStringSet(report.MakeControlProbe("probe1", "probe2"))))
+	for _, forged := range []report.Report{
+		otherHost,
+		otherProbeImage,
+		processReport(report.MakeProcessNodeID("probe2", "1"), report.MakeHostNodeID("probe1")),
+		processReport(report.MakeProcessNodeID("probe1", "2"), report.MakeHostNodeID("probe2")),
+	} {
+		forger := newClient("probe1")
+		defer forger.Stop()
+		if err := appclient.NewReportPublisher(forger).Publish(forged); err != nil {
+			t.Fatal(err)
+		}
+	}
+	forger := newClient("probe1")
+	defer forger.Stop()
+	if err := appclient.NewReportPublisher(forger).Publish(processReport(report.MakeProcessNodeID("probe1", "3"), report.MakeHostNodeID("probe1"))); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 2*time.Second, 1, func() interface{} {
+		rpt, _ := collector.Report(context.Background())
+		return len(rpt.Process.Nodes)
+	})
+	time.Sleep(100 * time.Millisecond)
+	rpt, _ = collector.Report(context.Background())
+	if len(rpt.Host.Nodes) != 1 || len(rpt.Process.Nodes) != 1 || len(rpt.ContainerImage.Nodes) != 0 {
+		t.Errorf("Report with another host's nodes was accepted: %v, %v, %v", rpt.Host.Nodes, rpt.Process.Nodes, rpt.ContainerImage.Nodes)
+	}
+
+	// Without a certificate, probes are turned away but the UI isn't
+	roots := x509.NewCertPool()
+	caBuf, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots.AppendCertsFromPEM(caBuf)
+	anon := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	req, err := http.NewRequest("POST", server.URL+"/api/report", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(xfer.ScopeProbeIDHeader, "probe1")
+	res, err := anon.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+	res, err = anon.Get(server.URL + "/api/topology")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
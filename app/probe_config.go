@@ -0,0 +1,247 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/probe/config"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+// maxProbeConfigSize limits the size of probe configs PUT to the app.
+const maxProbeConfigSize = 1 << 20
+
+// ProbeConfig is the config an app pushes to its probes, along with its
+// version. Probes report the version they are using in their host node.
+type ProbeConfig struct {
+	Version string
+	Config  config.Remote
+}
+
+// ProbeConfigPush is the outcome of pushing a ProbeConfig to probes.
+type ProbeConfigPush struct {
+	Version string              `json:"version"`
+	Results []BulkControlResult `json:"results"`
+}
+
+// ProbeConfigs keeps the config each user wants their probes to have, and
+// pushes it to probes over their control connections.
+type ProbeConfigs struct {
+	reporter Reporter
+	cr       ControlRouter
+	userIDer UserIDer
+	quit     chan struct{}
+	done     sync.WaitGroup
+
+	mtx     sync.Mutex
+	desired map[string]ProbeConfig
+}
+
+// NewProbeConfigs makes a new ProbeConfigs.
+func NewProbeConfigs(rep Reporter, cr ControlRouter, userIDer UserIDer) *ProbeConfigs {
+	return &ProbeConfigs{
+		reporter: rep,
+		cr:       cr,
+		userIDer: userIDer,
+		quit:     make(chan struct{}),
+		desired:  map[string]ProbeConfig{},
+	}
+}
+
+// Get returns the config the user wants their probes to have, if any.
+func (pc *ProbeConfigs) Get(ctx context.Context) (ProbeConfig, bool, error) {
+	user, err := pc.userIDer(ctx)
+	if err != nil {
+		return ProbeConfig{}, false, err
+	}
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+	desired, ok := pc.desired[user]
+	return desired, ok, nil
+}
+
+// Set sets the config the user wants their probes to have. It is pushed to
+// them by Push.
+func (pc *ProbeConfigs) Set(ctx context.Context, remote config.Remote) (ProbeConfig, error) {
+	user, err := pc.userIDer(ctx)
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+	desired := ProbeConfig{Version: remote.Version(), Config: remote}
+	pc.mtx.Lock()
+	defer pc.mtx.Unlock()
+	pc.desired[user] = desired
+	return desired, nil
+}
+
+// Push pushes the user's config to each of their probes which doesn't
+// report having it already.
+func (pc *ProbeConfigs) Push(ctx context.Context) (ProbeConfigPush, error) {
+	desired, ok, err := pc.Get(ctx)
+	if err != nil || !ok {
+		return ProbeConfigPush{Results: []BulkControlResult{}}, err
+	}
+	buf, err := json.Marshal(desired.Config)
+	if err != nil {
+		return ProbeConfigPush{}, err
+	}
+	rpt, err := pc.reporter.Report(ctx)
+	if err != nil {
+		return ProbeConfigPush{}, err
+	}
+
+	results := []BulkControlResult{}
+	for nodeID, n := range rpt.Host.Nodes {
+		probeID, ok := n.Latest.Lookup(report.ControlProbeID)
+		if !ok {
+			continue
+		}
+		if version, _ := n.Latest.Lookup(host.ProbeConfigVersion); version == desired.Version {
+			continue
+		}
+		results = append(results, BulkControlResult{NodeID: nodeID, ProbeID: probeID})
+	}
+	invokeControls(ctx, pc.cr, results, config.RemoteControl, map[string]string{
+		config.RemoteVersionArg: desired.Version,
+		config.RemoteConfigArg:  string(buf),
+	}, defaultBulkConcurrency)
+	return ProbeConfigPush{Version: desired.Version, Results: results}, nil
+}
+
+// Loop pushes the config to probes which don't have it every interval, e.g.
+// because they have restarted, until Stop is called. It is only for
+// single-tenant apps, where requests don't need to identify a user.
+func (pc *ProbeConfigs) Loop(interval time.Duration) {
+	pc.done.Add(1)
+	go func() {
+		defer pc.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				push, err := pc.Push(context.Background())
+				if err != nil {
+					log.Errorf("Error pushing probe config: %v", err)
+				}
+				for _, result := range push.Results {
+					if result.Error != "" {
+						log.Warnf("Error pushing probe config version %s to probe %s: %s", push.Version, result.ProbeID, result.Error)
+					}
+				}
+			case <-pc.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the loop started by Loop.
+func (pc *ProbeConfigs) Stop() {
+	close(pc.quit)
+	pc.done.Wait()
+}
+
+// Drift returns whether a probe's host node shows it is not using the
+// desired config.
+func (desired ProbeConfig) Drift(n report.Node) bool {
+	version, _ := n.Latest.Lookup(host.ProbeConfigVersion)
+	return version != desired.Version
+}
+
+// probeConfigView is how ProbeConfigs are shown in the API. Configs are
+// passed through encoding/json, as they use its Marshaler interface.
+type probeConfigView struct {
+	Version string      `json:"version"`
+	Config  interface{} `json:"config"`
+}
+
+func (desired ProbeConfig) view() (probeConfigView, error) {
+	buf, err := json.Marshal(desired.Config)
+	if err != nil {
+		return probeConfigView{}, err
+	}
+	var cfg interface{}
+	if err := json.Unmarshal(buf, &cfg); err != nil {
+		return probeConfigView{}, err
+	}
+	return probeConfigView{Version: desired.Version, Config: cfg}, nil
+}
+
+// RegisterProbeRoutes registers the routes for listing probes, and setting
+// their config, with a http mux. Setting the config is subject to the
+// policy, as the probe config control on hosts.
+func RegisterProbeRoutes(router *mux.Router, rep Reporter, configs *ProbeConfigs, policy ControlPolicy) {
+	router.Methods("GET").Path("/api/probes").
+		HandlerFunc(gzipHandler(requestContextDecorator(makeProbeHandler(rep, configs))))
+	router.Methods("GET").Path("/api/probes/config").
+		HandlerFunc(requestContextDecorator(handleGetProbeConfig(configs)))
+	router.Methods("PUT").Path("/api/probes/config").
+		HandlerFunc(requestContextDecorator(handlePutProbeConfig(configs, policy)))
+}
+
+func handleGetProbeConfig(configs *ProbeConfigs) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		desired, ok, err := configs.Get(ctx)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			respondWith(w, http.StatusNotFound, "no probe config has been set")
+			return
+		}
+		view, err := desired.view()
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWith(w, http.StatusOK, view)
+	}
+}
+
+// handlePutProbeConfig takes a YAML or JSON config.Remote, and pushes it to
+// the probes. Probes which can't be reached now get it later, if the app is
+// running Loop, so the user must be allowed to push it before it is kept.
+func handlePutProbeConfig(configs *ProbeConfigs, policy ControlPolicy) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		user, err := configs.userIDer(ctx)
+		if err != nil {
+			respondWith(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !policy.Allowed(user, config.RemoteControl, report.Host, "") {
+			respondWith(w, http.StatusForbidden, ErrControlDenied{User: user, Control: config.RemoteControl}.Error())
+			return
+		}
+		buf, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxProbeConfigSize))
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		remote, err := config.ParseRemote(buf)
+		if err != nil {
+			respondWith(w, http.StatusBadRequest, fmt.Sprintf("invalid probe config: %v", err))
+			return
+		}
+		if _, err := configs.Set(ctx, remote); err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		push, err := configs.Push(ctx)
+		if err != nil {
+			respondWith(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWith(w, http.StatusOK, push)
+	}
+}
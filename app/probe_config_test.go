@@ -0,0 +1,138 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/app/multitenant"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/config"
+	"github.com/weaveworks/scope/probe/host"
+	"github.com/weaveworks/scope/report"
+)
+
+type probeDesc struct {
+	ID            string `json:"id"`
+	ConfigVersion string `json:"configVersion"`
+	ConfigDrift   bool   `json:"configDrift"`
+}
+
+func TestProbeConfig(t *testing.T) {
+	hostReport := func(probeID, configVersion string) report.Report {
+		latest := map[string]string{report.ControlProbeID: probeID}
+		if configVersion != "" {
+			latest[host.ProbeConfigVersion] = configVersion
+		}
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNodeWith(report.MakeHostNodeID(probeID), latest))
+		return rpt
+	}
+	collector := app.NewCollector(time.Minute)
+	for _, probeID := range []string{"probe1", "probe2"} {
+		if err := collector.Add(context.Background(), hostReport(probeID, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only probe1 is connected
+	requests := make(chan xfer.Request, 10)
+	cr := app.NewLocalControlRouter()
+	if _, err := cr.Register(context.Background(), "probe1", func(req xfer.Request) xfer.Response {
+		requests <- req
+		return xfer.Response{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	configs := app.NewProbeConfigs(collector, cr, app.UserIDer(multitenant.NoopUserIDer))
+	app.RegisterProbeRoutes(router, collector, configs, app.ControlPolicy{})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	probes := func() map[string]probeDesc {
+		var descs []probeDesc
+		if err := codec.NewDecoderBytes(getRawJSON(t, ts, "/api/probes"), &codec.JsonHandle{}).Decode(&descs); err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]probeDesc{}
+		for _, desc := range descs {
+			result[desc.ID] = desc
+		}
+		return result
+	}
+
+	// Without a desired config, there is no drift
+	is404(t, ts, "/api/probes/config")
+	equals(t, probeDesc{ID: "probe1"}, probes()["probe1"])
+
+	res, _ := checkRequest(t, ts, "PUT", "/api/probes/config", []byte("reporters: {dockre: true}\n"))
+	equals(t, http.StatusBadRequest, res.StatusCode)
+
+	res, body := checkRequest(t, ts, "PUT", "/api/probes/config", []byte("spy_interval: 2s\nreporters: {docker: true}\n"))
+	equals(t, http.StatusOK, res.StatusCode)
+	var push app.ProbeConfigPush
+	if err := codec.NewDecoderBytes(body, &codec.JsonHandle{}).Decode(&push); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(push.Results))
+	for _, result := range push.Results {
+		switch result.ProbeID {
+		case "probe1":
+			equals(t, "", result.Error)
+		case "probe2":
+			equals(t, "Probe probe2 is not connected right now...", result.Error)
+		default:
+			t.Errorf("Unexpected result for %s", result.ProbeID)
+		}
+	}
+
+	// probe1 got the config
+	req := <-requests
+	equals(t, config.RemoteControl, req.Control)
+	equals(t, report.MakeHostNodeID("probe1"), req.NodeID)
+	equals(t, push.Version, req.Args[config.RemoteVersionArg])
+	remote, err := config.ParseRemote([]byte(req.Args[config.RemoteConfigArg]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, push.Version, remote.Version())
+
+	// Until probe1 reports having it, both have drifted
+	equals(t, probeDesc{ID: "probe1", ConfigDrift: true}, probes()["probe1"])
+	if err := collector.Add(context.Background(), hostReport("probe1", push.Version)); err != nil {
+		t.Fatal(err)
+	}
+	have := probes()
+	equals(t, probeDesc{ID: "probe1", ConfigVersion: push.Version}, have["probe1"])
+	equals(t, probeDesc{ID: "probe2", ConfigDrift: true}, have["probe2"])
+
+	// Pushing again only goes to probes which have drifted
+	pushed, err := configs.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 1, len(pushed.Results))
+	equals(t, "probe2", pushed.Results[0].ProbeID)
+
+	// Users the policy doesn't allow to push configs can't set them either
+	router = mux.NewRouter()
+	policy := app.ControlPolicy{Rules: []app.ControlRule{{Effect: app.PolicyDeny, Controls: []string{config.RemoteControl}}}}
+	app.RegisterProbeRoutes(router, collector, configs, policy)
+	denied := httptest.NewServer(router)
+	defer denied.Close()
+	res, _ = checkRequest(t, denied, "PUT", "/api/probes/config", []byte("spy_interval: 5s\n"))
+	equals(t, http.StatusForbidden, res.StatusCode)
+	desired, _, err := configs.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, push.Version, desired.Version)
+}
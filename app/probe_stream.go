@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// RegisterProbeStreamRoute registers the route for probes which send their
+// reports, and carry their controls and pipes, over a single websocket.
+func RegisterProbeStreamRoute(router *mux.Router, a Adder, cr ControlRouter, pr PipeRouter) {
+	router.Methods("GET").Path("/api/probe/ws").
+		HandlerFunc(requestContextDecorator(handleProbeStream(a, cr, pr)))
+}
+
+// handleProbeStream accepts a multiplexed connection from a probe, and
+// serves each stream the probe opens as if it were a connection of its own.
+func handleProbeStream(a Adder, cr ControlRouter, pr PipeRouter) CtxHandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		probeID := r.Header.Get(xfer.ScopeProbeIDHeader)
+		if probeID == "" {
+			respondWith(w, http.StatusBadRequest, xfer.ScopeProbeIDHeader)
+			return
+		}
+
+		conn, err := xfer.Upgrade(w, r, nil)
+		if err != nil {
+			log.Errorf("Error upgrading probe %s stream websocket: %v", probeID, err)
+			return
+		}
+
+		m := xfer.NewMux(conn, false, func(name string, s *xfer.MuxStream) {
+			defer s.Close()
+			var err error
+			switch {
+			case name == xfer.ControlStream:
+				err = serveControls(ctx, cr, probeID, s)
+			case name == xfer.ReportStream:
+				identity, _ := ProbeIdentity(r)
+				err = serveReports(ctx, a, s, identity)
+			case strings.HasPrefix(name, xfer.PipeStream):
+				err = servePipe(ctx, pr, strings.TrimPrefix(name, xfer.PipeStream), s)
+			default:
+				s.CloseWithReason(xfer.StreamNotFound)
+			}
+			if err != nil && err != io.EOF && err != io.ErrClosedPipe && !xfer.IsExpectedWSCloseError(err) {
+				log.Errorf("Error on probe %s %s stream: %v", probeID, name, err)
+			}
+		})
+		defer m.Close()
+		if err := m.Wait(); err != nil && !xfer.IsExpectedWSCloseError(err) {
+			log.Errorf("Error on probe %s stream websocket: %v", probeID, err)
+		}
+	}
+}
+
+// serveReports reads gzipped, msgpack-encoded reports from the probe and
+// acknowledges each once it has been added. If the probe has authenticated
+// with a certificate, its reports may only have its own nodes.
+func serveReports(ctx context.Context, a Adder, s *xfer.MuxStream, identity string) error {
+	for {
+		_, buf, err := s.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := s.WriteJSON(addStreamedReport(ctx, a, buf, identity)); err != nil {
+			return err
+		}
+	}
+}
+
+func addStreamedReport(ctx context.Context, a Adder, buf []byte, identity string) xfer.ReportAck {
+	rpt, err := decodeStreamedReport(buf)
+	if err != nil {
+		return xfer.ReportAck{Code: http.StatusBadRequest, Error: err.Error()}
+	}
+	if identity != "" {
+		if err := checkReportProbeID(rpt, identity); err != nil {
+			return xfer.ReportAck{Code: http.StatusForbidden, Error: err.Error()}
+		}
+	}
+	if err := a.Add(ctx, rpt); err != nil {
+		return xfer.ReportAck{Code: http.StatusInternalServerError, Error: err.Error()}
+	}
+	return xfer.ReportAck{Code: http.StatusOK}
+}
+
+func decodeStreamedReport(buf []byte) (report.Report, error) {
+	var rpt report.Report
+	reader, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return rpt, err
+	}
+	err = codec.NewDecoder(reader, &codec.MsgpackHandle{}).Decode(&rpt)
+	return rpt, err
+}
+
+// servePipe connects the probe end of a pipe to the stream, closing the
+// stream with StreamNotFound if the pipe has gone.
+func servePipe(ctx context.Context, pr PipeRouter, id string, s *xfer.MuxStream) error {
+	pipe, endIO, err := pr.Get(ctx, id, ProbeEnd)
+	if err != nil {
+		log.Errorf("Error getting pipe %s: %v", id, err)
+		return s.CloseWithReason(xfer.StreamNotFound)
+	}
+	defer pr.Release(ctx, id, ProbeEnd)
+
+	log.Infof("Success got pipe %s:%d", id, ProbeEnd)
+	return pipe.CopyToWebsocket(endIO, s)
+}
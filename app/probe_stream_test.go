@@ -0,0 +1,139 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/app"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
+)
+
+type pipeClient struct {
+	c appclient.AppClient
+}
+
+func (p pipeClient) PipeConnection(_, pipeID string, pipe xfer.Pipe) error {
+	p.c.PipeConnection(pipeID, pipe)
+	return nil
+}
+
+func (p pipeClient) PipeClose(_, pipeID string) error {
+	return p.c.PipeClose(pipeID)
+}
+
+func newStreamClient(t *testing.T, server *httptest.Server) appclient.AppClient {
+	ip, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probeConfig := appclient.ProbeConfig{
+		ProbeID: "foo",
+		Stream:  true,
+	}
+	controlHandler := xfer.ControlHandlerFunc(func(req xfer.Request) xfer.Response {
+		return xfer.Response{Value: req.NodeID}
+	})
+	client, err := appclient.NewAppClient(probeConfig, ip+":"+port, ip+":"+port, controlHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ControlConnection()
+	return client
+}
+
+func pollControl(t *testing.T, cr app.ControlRouter) {
+	test.Poll(t, 2*time.Second, "nodeid", func() interface{} {
+		res, err := cr.Handle(context.Background(), "foo", xfer.Request{NodeID: "nodeid", Control: "control"})
+		if err != nil {
+			return err.Error()
+		}
+		return res.Value
+	})
+}
+
+func TestProbeStream(t *testing.T) {
+	var (
+		collector = app.NewCollector(time.Minute)
+		cr        = app.NewLocalControlRouter()
+		pr        = app.NewLocalPipeRouter()
+		router    = mux.NewRouter()
+	)
+	defer pr.Stop()
+	app.RegisterProbeStreamRoute(router, collector, cr, pr)
+	app.RegisterPipeRoutes(router, pr)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := newStreamClient(t, server)
+	defer client.Stop()
+
+	// Controls
+	pollControl(t, cr)
+
+	// Reports
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("a"))
+	if err := appclient.NewReportPublisher(client).Publish(rpt); err != nil {
+		t.Fatal(err)
+	}
+	test.Poll(t, 2*time.Second, true, func() interface{} {
+		have, err := collector.Report(context.Background())
+		if err != nil {
+			return err.Error()
+		}
+		_, ok := have.Host.Nodes["a"]
+		return ok
+	})
+
+	// Pipes
+	pipeID, pipe, err := controls.NewPipe(pipeClient{client}, xfer.Request{AppID: "appid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+	pipeURL := fmt.Sprintf("%s/api/pipe/%s", strings.Replace(server.URL, "http://", "ws://", 1), pipeID)
+	conn, _, err := websocket.DefaultDialer.Dial(pipeURL, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	local, _ := pipe.Ends()
+	msg := []byte("hello world")
+	if _, err := local.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, buf, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, msg) {
+		t.Fatalf("%v != %v", buf, msg)
+	}
+}
+
+func TestProbeStreamFallback(t *testing.T) {
+	// Older apps don't have the stream route, so probes use the control
+	// websocket instead.
+	cr := app.NewLocalControlRouter()
+	router := mux.NewRouter()
+	app.RegisterControlRoutes(router, cr)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := newStreamClient(t, server)
+	defer client.Stop()
+
+	pollControl(t, cr)
+}
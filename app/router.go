@@ -96,10 +96,16 @@ func RegisterTopologyRoutes(router *mux.Router, r Reporter) {
 		requestContextDecorator(captureReporter(r, handleWebsocket))) // NB not gzip!
 	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}")).HandlerFunc(
 		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleNode))))
+	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/dependencies")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleDependencies))))
+	get.MatcherFunc(URLMatcher("/api/topology/{topology}/{id}/dependents")).HandlerFunc(
+		gzipHandler(requestContextDecorator(topologyRegistry.captureRenderer(r, handleDependents))))
+	get.HandleFunc("/api/path",
+		gzipHandler(requestContextDecorator(captureReporter(r, handlePath))))
 	get.HandleFunc("/api/report",
 		gzipHandler(requestContextDecorator(makeRawReportHandler(r))))
-	get.HandleFunc("/api/probes",
-		gzipHandler(requestContextDecorator(makeProbeHandler(r))))
+	get.HandleFunc("/api/debug/render",
+		gzipHandler(requestContextDecorator(handleRenderProfile)))
 }
 
 type byteCounter struct {
@@ -153,6 +159,12 @@ func RegisterReportPostHandler(a Adder, router *mux.Router) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if probeID, ok := ProbeIdentity(r); ok {
+			if err := checkReportProbeID(rpt, probeID); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
 		log.Debugf(
 			"Received report sizes: compressed %d bytes, uncompressed %d bytes (%.2f%%)",
 			compressedSize,
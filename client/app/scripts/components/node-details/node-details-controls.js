@@ -19,7 +19,7 @@ export default function NodeDetailsControls({controls, error, nodeId, pending})
       </div>}
       <span className="node-details-controls-buttons">
         {_.sortBy(controls, 'rank').map(control => <NodeDetailsControlButton
-          nodeId={nodeId} control={control} pending={pending} key={control.id} />)}
+          nodeId={nodeId} control={control} pending={pending} key={`${control.probeId}-${control.id}`} />)}
       </span>
       {controls && <span title="Applying..." className={spinnerClassName}></span>}
     </div>
@@ -11,7 +11,8 @@ class TerminalApp extends React.Component {
 
     const paramString = window.location.hash.split('/').pop();
     const params = JSON.parse(decodeURIComponent(paramString));
-    this.props.receiveControlPipeFromParams(params.pipe.id, null, params.pipe.raw, false);
+    this.props.receiveControlPipeFromParams(params.pipe.id, params.pipe.raw,
+      params.pipe.framed);
 
     this.state = {
       title: params.title,
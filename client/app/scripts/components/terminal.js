@@ -31,6 +31,15 @@ function ab2str(buf) {
   return decodedString;
 }
 
+function str2ab(str) {
+  const encodedString = unescape(encodeURIComponent(str));
+  const buf = new Uint8Array(encodedString.length);
+  for (let i = 0; i < encodedString.length; i++) {
+    buf[i] = encodedString.charCodeAt(i);
+  }
+  return buf.buffer;
+}
+
 function terminalCellSize(wrapperNode, rows, cols) {
   const height = wrapperNode.clientHeight;
 
@@ -103,6 +112,7 @@ class Terminal extends React.Component {
       clearTimeout(this.reconnectTimeout);
       log('socket open to', wsUrl);
       this.setState({connected: true});
+      this.sendResize();
     };
 
     socket.onclose = () => {
@@ -125,7 +135,12 @@ class Terminal extends React.Component {
     };
 
     socket.onmessage = (event) => {
-      log('pipe data', event.data.size);
+      // Text messages are out-of-band control messages (eof, ping).
+      if (typeof event.data === 'string') {
+        log('pipe control', event.data);
+        return;
+      }
+      log('pipe data', event.data.byteLength);
       const input = ab2str(event.data);
       term.write(input);
     };
@@ -146,7 +161,7 @@ class Terminal extends React.Component {
     this.term.open(innerNode);
     this.term.on('data', (data) => {
       if (this.socket) {
-        this.socket.send(data);
+        this.socket.send(str2ab(data));
       }
     });
 
@@ -202,12 +217,28 @@ class Terminal extends React.Component {
     );
     if (sizeChanged) {
       this.term.resize(this.state.cols, this.state.rows);
+      this.sendResize();
     }
     if (!this.isEmbedded()) {
       setDocumentTitle(this.getTitle());
     }
   }
 
+  sendResize() {
+    // Only framed pipes take control messages; others would pass them
+    // straight through to the terminal.
+    if (!this.props.pipe.get('framed')) {
+      return;
+    }
+    if (this.socket && this.socket.readyState === WebSocket.OPEN) {
+      this.socket.send(JSON.stringify({
+        type: 'resize',
+        width: this.state.cols,
+        height: this.state.rows
+      }));
+    }
+  }
+
   handleCloseClick(ev) {
     ev.preventDefault();
     if (this.isEmbedded()) {
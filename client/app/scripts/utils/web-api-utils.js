@@ -208,7 +208,7 @@ export function doControlRequest(nodeId, control, dispatch) {
       dispatch(receiveControlSuccess(nodeId));
       if (res) {
         if (res.pipe) {
-          dispatch(receiveControlPipe(res.pipe, nodeId, res.raw_tty, true));
+          dispatch(receiveControlPipe(res.pipe, nodeId, res.raw_tty, res.framed_pipe));
         }
         if (res.removedNode) {
           dispatch(receiveControlNodeRemoved(nodeId));
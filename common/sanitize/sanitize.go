@@ -36,6 +36,15 @@ func URL(defaultScheme string, defaultPort int, defaultPath string) func(string)
 				u.Scheme = "https"
 			}
 		}
+		// Websocket URLs for http(s) addresses keep the same security.
+		if strings.HasPrefix(defaultScheme, "ws") {
+			switch u.Scheme {
+			case "http":
+				u.Scheme = "ws"
+			case "https":
+				u.Scheme = "wss"
+			}
+		}
 		if defaultPath != "" && u.Path != defaultPath {
 			u.Path = defaultPath
 		}
@@ -22,6 +22,8 @@ func TestSanitizeURL(t *testing.T) {
 		{"https://", 0, "", "foo", "https://foo"},
 		{"https://", 80, "", "foo", "https://foo:80"},
 		{"https://", 0, "some/path", "foo", "https://foo/some/path"},
+		{"ws://", 0, "", "http://foo:4040", "ws://foo:4040"},
+		{"ws://", 0, "", "https://foo:4040", "wss://foo:4040"},
 		{"https://", 0, "", "http://foo", "http://foo"},  // specified scheme beats default...
 		{"", 0, "", "https://foo", "https://foo"},        // https can be a specified scheme without default...
 		{"http://", 0, "", "https://foo", "https://foo"}, // https can be a specified scheme with default...
@@ -12,8 +12,14 @@ var ErrInvalidMessage = fmt.Errorf("Invalid Message")
 // Request is the UI -> App -> Probe message type for control RPCs
 type Request struct {
 	AppID   string // filled in by the probe on receiving this request
+	User    string // filled in by the app, if it knows who sent this request
 	NodeID  string
 	Control string
+	Args    map[string]string // validated against the control's schema by the probe
+
+	// Set by apps which can frame the UI end of pipes (see pipe_frames.go),
+	// so probes can frame the pipes made for this request.
+	FramedPipes bool
 }
 
 // Response is the Probe -> App -> UI message type for the control RPCs.
@@ -22,11 +28,15 @@ type Response struct {
 	Error string      `json:"error,omitempty"`
 
 	// Pipe specific fields
-	Pipe   string `json:"pipe,omitempty"`
-	RawTTY bool   `json:"raw_tty,omitempty"`
+	Pipe       string `json:"pipe,omitempty"`
+	RawTTY     bool   `json:"raw_tty,omitempty"`
+	FramedPipe bool   `json:"framed_pipe,omitempty"` // Set if the probe frames the pipe
 
 	// Remove specific fields
 	RemovedNode string `json:"removedNode,omitempty"` // Set if node was removed
+
+	// Job specific fields
+	Job string `json:"job,omitempty"` // Set if the control is running asynchronously
 }
 
 // Message is the unions of Request, Response and arbitrary Value.
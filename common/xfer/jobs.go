@@ -0,0 +1,31 @@
+package xfer
+
+import (
+	"time"
+)
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is the status of a control running asynchronously in the probe.
+type Job struct {
+	ID       string    `json:"id"`
+	Control  string    `json:"control"`
+	NodeID   string    `json:"node_id"`
+	State    string    `json:"state"`
+	Progress int       `json:"progress"` // percent
+	Message  string    `json:"message,omitempty"`
+	Result   *Response `json:"result,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// Done returns whether the job has finished, one way or another.
+func (j Job) Done() bool {
+	return j.State != JobRunning
+}
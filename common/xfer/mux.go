@@ -0,0 +1,494 @@
+package xfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// A Mux carries many streams of messages over a single websocket, so a probe
+// can publish reports, serve controls and carry pipes over one connection to
+// an app. Each websocket message is one mux frame: a one byte type, a four
+// byte big-endian stream id, and then the payload.
+//
+// Messages are split into chunks, and the chunks of different streams are
+// interleaved, so a large report doesn't hold up a terminal session. Each
+// stream has a window of bytes which may be in flight before the far end
+// reads them, so a stream which isn't being read can't use up the far end's
+// memory, or hold up the other streams.
+const (
+	muxOpen   byte = iota // payload is the stream name
+	muxData               // payload is a flags byte, then a chunk of a message
+	muxWindow             // payload is a four byte big-endian window increment
+	muxClose              // payload is the reason, if any
+)
+
+const (
+	muxHeaderLen = 5
+	muxChunkLen  = 32 * 1024
+	muxWindowLen = 256 * 1024
+
+	// Flags on data frames
+	muxFinal  byte = 1 << 0 // the last chunk of a message
+	muxBinary byte = 1 << 1 // the message is binary rather than text
+)
+
+// Names of the streams probes open to apps. Pipes are named PipeStream plus
+// the pipe id.
+const (
+	ControlStream = "control"
+	ReportStream  = "report"
+	PipeStream    = "pipe/"
+)
+
+// StreamNotFound is the reason given when closing a stream for something,
+// e.g. a pipe, which doesn't exist.
+const StreamNotFound = "not found"
+
+// MuxMaxMessageLen is the longest message a stream carries. The chunks of a
+// message are held until it is complete, so without a limit the far end
+// could use up all our memory with one endless message. Streams are closed,
+// with StreamMessageTooLarge as the reason, if they receive anything longer.
+const MuxMaxMessageLen = 64 * 1024 * 1024
+
+// StreamMessageTooLarge is the reason given when closing a stream which
+// received a message longer than MuxMaxMessageLen.
+const StreamMessageTooLarge = "message too large"
+
+// ErrMessageTooLarge is returned when writing a message longer than
+// MuxMaxMessageLen.
+var ErrMessageTooLarge = fmt.Errorf("message longer than %d bytes", MuxMaxMessageLen)
+
+// StreamClosedError is returned when reading from or writing to a stream the
+// far end has closed, giving a reason.
+type StreamClosedError struct {
+	Reason string
+}
+
+func (e StreamClosedError) Error() string {
+	return fmt.Sprintf("stream closed: %s", e.Reason)
+}
+
+// ReportAck is the app's reply to each report sent over a ReportStream. Code
+// is a HTTP status code, as if the report had been POSTed.
+type ReportAck struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// Mux multiplexes streams over a websocket.
+type Mux struct {
+	conn   Websocket
+	accept func(name string, s *MuxStream)
+	done   chan struct{}
+
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	streams map[uint32]*MuxStream
+	nextID  uint32
+	control [][]byte     // window frames, sent before any data
+	ready   []*MuxStream // streams with frames to send, in turn
+	err     error
+	closed  bool
+}
+
+// MuxStream is a stream of messages on a Mux. It implements Websocket, so it
+// can carry anything which would otherwise have a websocket of its own.
+type MuxStream struct {
+	mux  *Mux
+	id   uint32
+	name string
+
+	// Guarded by mux.mtx
+	out          [][]byte
+	window       int
+	in           []muxMessage
+	partial      muxMessage
+	localClosed  bool
+	remoteClosed bool
+	reason       string
+}
+
+type muxMessage struct {
+	binary bool
+	data   []byte
+	credit int // window not yet returned to the sender
+}
+
+// NewMux starts multiplexing streams over conn. The two ends of a connection
+// must disagree on client. accept is called, in its own goroutine, for each
+// stream opened by the far end; it should close the stream when done. If
+// accept is nil, the far end can't open streams.
+func NewMux(conn Websocket, client bool, accept func(name string, s *MuxStream)) *Mux {
+	m := &Mux{
+		conn:    conn,
+		accept:  accept,
+		done:    make(chan struct{}),
+		streams: map[uint32]*MuxStream{},
+		nextID:  2,
+	}
+	if client {
+		m.nextID = 1
+	}
+	m.cond = sync.NewCond(&m.mtx)
+	go m.readLoop()
+	go m.writeLoop()
+	return m
+}
+
+func muxFrame(typ byte, id uint32, payload ...[]byte) []byte {
+	n := muxHeaderLen
+	for _, p := range payload {
+		n += len(p)
+	}
+	buf := make([]byte, muxHeaderLen, n)
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:], id)
+	for _, p := range payload {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+// Open opens a new stream to the far end, which will use name to decide what
+// the stream is for.
+func (m *Mux) Open(name string) (*MuxStream, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	s := m.newStream(m.nextID, name)
+	m.nextID += 2
+	s.send(muxFrame(muxOpen, s.id, []byte(name)))
+	return s, nil
+}
+
+// Wait blocks until the mux stops, and returns why. It returns nil if the
+// mux was stopped by Close.
+func (m *Mux) Wait() error {
+	<-m.done
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.closed {
+		return nil
+	}
+	return m.err
+}
+
+// Close stops the mux, closing the websocket and all the streams on it.
+func (m *Mux) Close() error {
+	m.mtx.Lock()
+	m.closed = true
+	m.mtx.Unlock()
+	return m.conn.Close()
+}
+
+// Call with mtx held.
+func (m *Mux) newStream(id uint32, name string) *MuxStream {
+	s := &MuxStream{
+		mux:    m,
+		id:     id,
+		name:   name,
+		window: muxWindowLen,
+	}
+	m.streams[id] = s
+	return s
+}
+
+// Call with mtx held.
+func (m *Mux) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+	m.cond.Broadcast()
+}
+
+func (m *Mux) readLoop() {
+	defer close(m.done)
+	defer m.conn.Close()
+	for {
+		_, buf, err := m.conn.ReadMessage()
+		if err == nil {
+			err = m.handleFrame(buf)
+		}
+		if err != nil {
+			m.mtx.Lock()
+			m.fail(err)
+			m.mtx.Unlock()
+			return
+		}
+	}
+}
+
+func (m *Mux) handleFrame(buf []byte) error {
+	if len(buf) < muxHeaderLen {
+		return fmt.Errorf("mux frame too short: %d bytes", len(buf))
+	}
+	typ, id, payload := buf[0], binary.BigEndian.Uint32(buf[1:]), buf[muxHeaderLen:]
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	s, ok := m.streams[id]
+	switch typ {
+	case muxOpen:
+		if ok || id%2 == m.nextID%2 {
+			return fmt.Errorf("mux stream %d opened twice", id)
+		}
+		s = m.newStream(id, string(payload))
+		if m.accept == nil {
+			s.closeWithReason(StreamNotFound)
+			return nil
+		}
+		go m.accept(s.name, s)
+
+	case muxData:
+		if !ok {
+			// Stream has been closed locally; drop anything in flight.
+			return nil
+		}
+		if len(payload) < 1 {
+			return fmt.Errorf("mux data frame too short on stream %d", id)
+		}
+		s.receive(payload[0], payload[1:], len(buf))
+
+	case muxWindow:
+		if !ok {
+			return nil
+		}
+		if len(payload) != 4 {
+			return fmt.Errorf("invalid mux window frame on stream %d", id)
+		}
+		s.window += int(binary.BigEndian.Uint32(payload))
+		m.cond.Broadcast()
+
+	case muxClose:
+		if !ok {
+			return nil
+		}
+		s.remoteClosed, s.reason = true, string(payload)
+		delete(m.streams, id)
+		m.cond.Broadcast()
+
+	default:
+		return fmt.Errorf("unknown mux frame type %d", typ)
+	}
+	return nil
+}
+
+func (m *Mux) writeLoop() {
+	for {
+		m.mtx.Lock()
+		for len(m.control) == 0 && len(m.ready) == 0 && m.err == nil {
+			m.cond.Wait()
+		}
+		if m.err != nil {
+			m.mtx.Unlock()
+			return
+		}
+		var frame []byte
+		if len(m.control) > 0 {
+			frame, m.control = m.control[0], m.control[1:]
+		} else {
+			// Take turns, so no stream holds up the others.
+			s := m.ready[0]
+			m.ready = m.ready[1:]
+			frame, s.out = s.out[0], s.out[1:]
+			if len(s.out) > 0 {
+				m.ready = append(m.ready, s)
+			}
+		}
+		m.mtx.Unlock()
+
+		if err := m.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			m.mtx.Lock()
+			m.fail(err)
+			m.mtx.Unlock()
+			m.conn.Close()
+			return
+		}
+	}
+}
+
+// Call with mux.mtx held.
+func (s *MuxStream) send(frame []byte) {
+	if len(s.out) == 0 {
+		s.mux.ready = append(s.mux.ready, s)
+	}
+	s.out = append(s.out, frame)
+	s.mux.cond.Broadcast()
+}
+
+// Call with mux.mtx held.
+func (s *MuxStream) credit(n int) {
+	if n <= 0 || s.localClosed || s.remoteClosed {
+		return
+	}
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(n))
+	s.mux.control = append(s.mux.control, muxFrame(muxWindow, s.id, payload))
+	s.mux.cond.Broadcast()
+}
+
+// receive adds a chunk of a message, which cost the sender n bytes of window.
+// Call with mux.mtx held.
+func (s *MuxStream) receive(flags byte, chunk []byte, n int) {
+	if len(s.partial.data)+len(chunk) > MuxMaxMessageLen {
+		s.partial = muxMessage{}
+		s.closeWithReason(StreamMessageTooLarge)
+		return
+	}
+	s.partial.binary = flags&muxBinary != 0
+	s.partial.data = append(s.partial.data, chunk...)
+	if flags&muxFinal == 0 && len(s.in) == 0 {
+		// Nothing is waiting to be read, so let the sender carry on with
+		// this message; otherwise we'd never get it all if it were bigger
+		// than the window.
+		s.credit(n)
+	} else {
+		s.partial.credit += n
+	}
+	if flags&muxFinal != 0 {
+		s.in = append(s.in, s.partial)
+		s.partial = muxMessage{}
+		s.mux.cond.Broadcast()
+	}
+}
+
+// Call with mux.mtx held.
+func (s *MuxStream) closedError() error {
+	switch {
+	case s.localClosed:
+		return io.ErrClosedPipe
+	case s.remoteClosed && s.reason != "":
+		return StreamClosedError{s.reason}
+	case s.remoteClosed:
+		return io.EOF
+	default:
+		return s.mux.err
+	}
+}
+
+// Name returns the name the stream was opened with.
+func (s *MuxStream) Name() string {
+	return s.name
+}
+
+// ReadMessage returns the next message on the stream.
+func (s *MuxStream) ReadMessage() (int, []byte, error) {
+	m := s.mux
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for len(s.in) == 0 && !s.localClosed && !s.remoteClosed && m.err == nil {
+		m.cond.Wait()
+	}
+	if len(s.in) == 0 || s.localClosed {
+		return 0, nil, s.closedError()
+	}
+	msg := s.in[0]
+	s.in = s.in[1:]
+	credit := msg.credit
+	if len(s.in) == 0 {
+		credit += s.partial.credit
+		s.partial.credit = 0
+	}
+	s.credit(credit)
+
+	messageType := websocket.TextMessage
+	if msg.binary {
+		messageType = websocket.BinaryMessage
+	}
+	return messageType, msg.data, nil
+}
+
+// WriteMessage sends a message on the stream. It returns once the message is
+// queued to be sent, blocking while the stream's window is used up.
+func (s *MuxStream) WriteMessage(messageType int, data []byte) error {
+	flags := byte(0)
+	if messageType == websocket.BinaryMessage {
+		flags = muxBinary
+	}
+	if len(data) > MuxMaxMessageLen {
+		return ErrMessageTooLarge
+	}
+	m := s.mux
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for {
+		chunk := data
+		if len(chunk) > muxChunkLen {
+			chunk = chunk[:muxChunkLen]
+		}
+		cost := muxHeaderLen + 1 + len(chunk)
+		for s.window < cost && !s.localClosed && !s.remoteClosed && m.err == nil {
+			m.cond.Wait()
+		}
+		if s.localClosed || s.remoteClosed || m.err != nil {
+			if err := s.closedError(); err != io.EOF {
+				return err
+			}
+			return io.ErrClosedPipe
+		}
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			flags |= muxFinal
+		}
+		s.window -= cost
+		s.send(muxFrame(muxData, s.id, []byte{flags}, chunk))
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// ReadJSON reads the next message on the stream, as JSON, into v.
+func (s *MuxStream) ReadJSON(v interface{}) error {
+	_, buf, err := s.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(v)
+}
+
+// WriteJSON sends v on the stream as JSON.
+func (s *MuxStream) WriteJSON(v interface{}) error {
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, &codec.JsonHandle{}).Encode(v); err != nil {
+		return err
+	}
+	return s.WriteMessage(websocket.TextMessage, buf.Bytes())
+}
+
+// Close closes the stream. Messages already written are still sent.
+func (s *MuxStream) Close() error {
+	s.mux.mtx.Lock()
+	defer s.mux.mtx.Unlock()
+	s.closeWithReason("")
+	return nil
+}
+
+// CloseWithReason closes the stream, telling the far end why.
+func (s *MuxStream) CloseWithReason(reason string) error {
+	s.mux.mtx.Lock()
+	defer s.mux.mtx.Unlock()
+	s.closeWithReason(reason)
+	return nil
+}
+
+// Call with mux.mtx held.
+func (s *MuxStream) closeWithReason(reason string) {
+	if s.localClosed {
+		return
+	}
+	s.localClosed = true
+	if !s.remoteClosed {
+		s.send(muxFrame(muxClose, s.id, []byte(reason)))
+		delete(s.mux.streams, s.id)
+	}
+	s.mux.cond.Broadcast()
+}
@@ -0,0 +1,242 @@
+package xfer_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+// muxPair connects a client Mux to a server Mux, which calls accept for each
+// stream the client opens.
+func muxPair(t *testing.T, accept func(string, *xfer.MuxStream)) (*xfer.Mux, func()) {
+	server := make(chan *xfer.Mux, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := xfer.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		m := xfer.NewMux(conn, false, accept)
+		server <- m
+		m.Wait()
+	}))
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	conn, _, err := xfer.DialWS(&websocket.Dialer{}, url, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := xfer.NewMux(conn, true, nil)
+	serverMux := <-server
+	return client, func() {
+		client.Close()
+		serverMux.Close()
+		ts.Close()
+	}
+}
+
+func echo(name string, s *xfer.MuxStream) {
+	defer s.Close()
+	if name != "echo" {
+		s.CloseWithReason(xfer.StreamNotFound)
+		return
+	}
+	for {
+		messageType, buf, err := s.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := s.WriteMessage(messageType, buf); err != nil {
+			return
+		}
+	}
+}
+
+func TestMuxRoundTrip(t *testing.T) {
+	client, stop := muxPair(t, echo)
+	defer stop()
+
+	s, err := client.Open("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte("0123456789"), 100*1024)
+	for _, want := range []struct {
+		messageType int
+		data        []byte
+	}{
+		{websocket.TextMessage, []byte("hello")},
+		{websocket.BinaryMessage, []byte{}},
+		{websocket.BinaryMessage, big},
+	} {
+		if err := s.WriteMessage(want.messageType, want.data); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := s.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != want.messageType || !bytes.Equal(data, want.data) {
+			t.Errorf("Got %d message of %d bytes, expected %d message of %d bytes", messageType, len(data), want.messageType, len(want.data))
+		}
+	}
+
+	if err := s.WriteJSON(map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := s.ReadJSON(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["foo"] != "bar" {
+		t.Errorf("Got %v", got)
+	}
+
+	// Closing our end closes the echo's end, so ours sees the stream closed
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ReadMessage(); err != io.ErrClosedPipe {
+		t.Errorf("Expected %v, got %v", io.ErrClosedPipe, err)
+	}
+}
+
+func TestMuxCloseReason(t *testing.T) {
+	client, stop := muxPair(t, echo)
+	defer stop()
+
+	s, err := client.Open("nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := xfer.StreamClosedError{Reason: xfer.StreamNotFound}
+	if _, _, err := s.ReadMessage(); err != want {
+		t.Errorf("Expected %v, got %v", want, err)
+	}
+	if err := s.WriteMessage(websocket.TextMessage, []byte("hello")); err != want {
+		t.Errorf("Expected %v, got %v", want, err)
+	}
+}
+
+func TestMuxFlowControl(t *testing.T) {
+	release := make(chan struct{})
+	client, stop := muxPair(t, func(name string, s *xfer.MuxStream) {
+		if name == "sink" {
+			// Don't read anything until told to
+			<-release
+			for {
+				if _, _, err := s.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		echo(name, s)
+	})
+	defer stop()
+
+	sink, err := client.Open("sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error)
+	go func() {
+		msg := bytes.Repeat([]byte("x"), 1024)
+		for i := 0; i < 1024; i++ {
+			if err := sink.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+
+	// The sink isn't being read, so its writer is blocked, but other streams
+	// carry on
+	s, err := client.Open("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := s.ReadMessage(); err != nil || string(data) != "hello" {
+		t.Fatalf("Got %q, %v", data, err)
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("Writes to the sink finished (%v) before it was read", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Writes to the sink didn't finish")
+	}
+}
+
+func TestMuxMessageTooLarge(t *testing.T) {
+	client, stop := muxPair(t, echo)
+	defer stop()
+	s, err := client.Open("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteMessage(websocket.BinaryMessage, make([]byte, xfer.MuxMaxMessageLen+1)); err != xfer.ErrMessageTooLarge {
+		t.Errorf("Expected %v, got %v", xfer.ErrMessageTooLarge, err)
+	}
+
+	// A far end which ignores the limit, and its window, has its stream
+	// closed rather than having the message held.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := xfer.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		xfer.NewMux(conn, false, echo).Wait()
+	}))
+	defer ts.Close()
+	conn, _, err := xfer.DialWS(&websocket.Dialer{}, "ws"+strings.TrimPrefix(ts.URL, "http"), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	frame := func(typ byte, payload []byte) []byte {
+		return append([]byte{typ, 0, 0, 0, 1}, payload...)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, frame(0, []byte("echo"))); err != nil {
+		t.Fatal(err)
+	}
+	chunk := frame(1, make([]byte, 1+32*1024))
+	go func() {
+		for i := 0; i <= xfer.MuxMaxMessageLen/(32*1024); i++ {
+			if err := conn.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] == 3 {
+			if reason := string(buf[5:]); reason != xfer.StreamMessageTooLarge {
+				t.Errorf("Expected %q, got %q", xfer.StreamMessageTooLarge, reason)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package xfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Pipes between the probe and the app carry a stream of frames, so that
+// alongside the data we can signal terminal resizes, half-closes and
+// keepalives. Each frame is a one byte type, a four byte big-endian length,
+// and then the payload.
+const (
+	FrameData byte = iota
+	FrameResize
+	FrameEOF
+	FramePing
+)
+
+const (
+	frameHeaderLen = 5
+	maxFrameLen    = 1 << 20
+
+	// framedPipeIDPrefix starts the IDs of framed pipes, so whichever app
+	// the UI attaches through, and however long after the control, it can
+	// tell to frame the UI end.
+	framedPipeIDPrefix = "framed-"
+)
+
+// FramedPipeID makes the ID for a framed pipe.
+func FramedPipeID(id string) string {
+	return framedPipeIDPrefix + id
+}
+
+// IsFramedPipeID returns whether the pipe with the given ID is framed.
+func IsFramedPipeID(id string) bool {
+	return strings.HasPrefix(id, framedPipeIDPrefix)
+}
+
+// Frame is a single message on a pipe.
+type Frame struct {
+	Type byte
+	Data []byte
+}
+
+// ResizeFrame makes a frame telling the far end of the pipe the terminal is
+// now width columns by height rows.
+func ResizeFrame(width, height uint16) Frame {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:], width)
+	binary.BigEndian.PutUint16(data[2:], height)
+	return Frame{Type: FrameResize, Data: data}
+}
+
+// Size returns the terminal size carried by a resize frame.
+func (f Frame) Size() (width, height uint16, ok bool) {
+	if f.Type != FrameResize || len(f.Data) != 4 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(f.Data[0:]), binary.BigEndian.Uint16(f.Data[2:]), true
+}
+
+// Bytes encodes the frame for the wire.
+func (f Frame) Bytes() []byte {
+	buf := make([]byte, frameHeaderLen+len(f.Data))
+	buf[0] = f.Type
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(f.Data)))
+	copy(buf[frameHeaderLen:], f.Data)
+	return buf
+}
+
+// FrameDecoder reassembles frames from a stream of bytes, which may be split
+// arbitrarily.
+type FrameDecoder struct {
+	buf bytes.Buffer
+}
+
+// Write adds bytes from the stream to the decoder.
+func (d *FrameDecoder) Write(p []byte) (int, error) {
+	return d.buf.Write(p)
+}
+
+// Next returns the next complete frame, if there is one.
+func (d *FrameDecoder) Next() (Frame, bool, error) {
+	b := d.buf.Bytes()
+	if len(b) < frameHeaderLen {
+		return Frame{}, false, nil
+	}
+	length := binary.BigEndian.Uint32(b[1:])
+	if length > maxFrameLen {
+		return Frame{}, false, fmt.Errorf("pipe frame too long: %d bytes", length)
+	}
+	if uint32(len(b)-frameHeaderLen) < length {
+		return Frame{}, false, nil
+	}
+	f := Frame{Type: b[0], Data: make([]byte, length)}
+	copy(f.Data, b[frameHeaderLen:])
+	d.buf.Next(frameHeaderLen + int(length))
+	return f, true, nil
+}
+
+// PipeControl is the form control frames take between the UI and the app.
+// Data is sent as binary websocket messages, and control messages as text
+// messages containing JSON.
+type PipeControl struct {
+	Type   string `json:"type"`
+	Width  uint16 `json:"width,omitempty"`
+	Height uint16 `json:"height,omitempty"`
+}
+
+var controlTypes = map[string]byte{
+	"resize": FrameResize,
+	"eof":    FrameEOF,
+	"ping":   FramePing,
+}
+
+// uiWebsocket adapts a websocket to the UI, so it can be used with
+// CopyToWebsocket on the app side of a pipe: messages from the UI are turned
+// into frames, and frames are turned back into messages for the UI.
+type uiWebsocket struct {
+	Websocket
+	decoder FrameDecoder
+}
+
+// NewUIWebsocket wraps the websocket connection to the UI for a pipe.
+func NewUIWebsocket(conn Websocket) Websocket {
+	return &uiWebsocket{Websocket: conn}
+}
+
+func (u *uiWebsocket) ReadMessage() (int, []byte, error) {
+	messageType, buf, err := u.Websocket.ReadMessage()
+	if err != nil {
+		return messageType, buf, err
+	}
+	if messageType == websocket.TextMessage {
+		var control PipeControl
+		if err := codec.NewDecoderBytes(buf, &codec.JsonHandle{}).Decode(&control); err == nil {
+			if frameType, ok := controlTypes[control.Type]; ok {
+				f := Frame{Type: frameType}
+				if frameType == FrameResize {
+					f = ResizeFrame(control.Width, control.Height)
+				}
+				return websocket.BinaryMessage, f.Bytes(), nil
+			}
+		}
+		// Older UIs send data as text messages.
+	}
+	return websocket.BinaryMessage, Frame{Type: FrameData, Data: buf}.Bytes(), nil
+}
+
+func (u *uiWebsocket) WriteMessage(_ int, buf []byte) error {
+	u.decoder.Write(buf)
+	for {
+		f, ok, err := u.decoder.Next()
+		if err != nil || !ok {
+			return err
+		}
+		switch f.Type {
+		case FrameData:
+			err = u.Websocket.WriteMessage(websocket.BinaryMessage, f.Data)
+		case FrameResize:
+			width, height, _ := f.Size()
+			err = u.Websocket.WriteJSON(PipeControl{Type: "resize", Width: width, Height: height})
+		case FrameEOF:
+			err = u.Websocket.WriteJSON(PipeControl{Type: "eof"})
+		case FramePing:
+			err = u.Websocket.WriteJSON(PipeControl{Type: "ping"})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
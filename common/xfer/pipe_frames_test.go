@@ -0,0 +1,56 @@
+package xfer_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/common/xfer"
+)
+
+func TestFrameDecoder(t *testing.T) {
+	frames := []xfer.Frame{
+		{Type: xfer.FrameData, Data: []byte("hello")},
+		xfer.ResizeFrame(80, 24),
+		{Type: xfer.FramePing, Data: []byte{}},
+		{Type: xfer.FrameData, Data: []byte(" world")},
+		{Type: xfer.FrameEOF, Data: []byte{}},
+	}
+	var stream bytes.Buffer
+	for _, f := range frames {
+		stream.Write(f.Bytes())
+	}
+
+	// Feed the stream in a byte at a time, to check frames are reassembled.
+	var (
+		decoder xfer.FrameDecoder
+		have    []xfer.Frame
+	)
+	for _, b := range stream.Bytes() {
+		decoder.Write([]byte{b})
+		for {
+			f, ok, err := decoder.Next()
+			if err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				break
+			}
+			have = append(have, f)
+		}
+	}
+	if !reflect.DeepEqual(frames, have) {
+		t.Fatalf("%v != %v", frames, have)
+	}
+
+	if width, height, ok := have[1].Size(); !ok || width != 80 || height != 24 {
+		t.Errorf("Unexpected size: %d %d %v", width, height, ok)
+	}
+	if _, _, ok := have[0].Size(); ok {
+		t.Errorf("Data frame has no size")
+	}
+
+	decoder.Write([]byte{xfer.FrameData, 0xff, 0xff, 0xff, 0xff})
+	if _, _, err := decoder.Next(); err == nil {
+		t.Errorf("Expected error for oversized frame")
+	}
+}
@@ -3,6 +3,7 @@ package xfer
 import (
 	"io"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -16,6 +17,7 @@ type Pipe interface {
 	Close() error
 	Closed() bool
 	OnClose(func())
+	OnResize(func(width, height uint16))
 }
 
 type pipe struct {
@@ -26,6 +28,26 @@ type pipe struct {
 	quit            chan struct{}
 	closed          bool
 	onClose         func()
+	onResize        func(width, height uint16)
+
+	// framed pipes terminate the pipe protocol: the websocket carries frames,
+	// and the end carries only the data.
+	framed bool
+}
+
+// halfCloser is implemented by pipe ends which can be closed for writing
+// while still being read from.
+type halfCloser interface {
+	CloseWrite() error
+}
+
+type pipeEnd struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func (e pipeEnd) CloseWrite() error {
+	return e.WriteCloser.Close()
 }
 
 // NewPipeFromEnds makes a new pipe specifying its ends
@@ -42,18 +64,8 @@ func NewPipe() Pipe {
 	r1, w1 := io.Pipe()
 	r2, w2 := io.Pipe()
 	return &pipe{
-		port: struct {
-			io.Reader
-			io.Writer
-		}{
-			r1, w2,
-		},
-		starboard: struct {
-			io.Reader
-			io.Writer
-		}{
-			r2, w1,
-		},
+		port:      pipeEnd{r1, w2},
+		starboard: pipeEnd{r2, w1},
 		closers: []io.Closer{
 			r1, r2, w1, w2,
 		},
@@ -61,6 +73,22 @@ func NewPipe() Pipe {
 	}
 }
 
+// NewFramedPipe makes a new pipe for the probe side, where the pipe protocol
+// is terminated.
+func NewFramedPipe() Pipe {
+	p := NewPipe().(*pipe)
+	p.framed = true
+	return p
+}
+
+// NewFramedPipeFromEnds makes a new pipe for the probe side specifying its
+// ends.
+func NewFramedPipeFromEnds(local io.ReadWriter, remote io.ReadWriter) Pipe {
+	p := NewPipeFromEnds(local, remote).(*pipe)
+	p.framed = true
+	return p
+}
+
 func (p *pipe) Ends() (io.ReadWriter, io.ReadWriter) {
 	return p.port, p.starboard
 }
@@ -98,6 +126,22 @@ func (p *pipe) OnClose(f func()) {
 	p.onClose = f
 }
 
+// OnResize sets the function called when the UI's terminal is resized.
+func (p *pipe) OnResize(f func(width, height uint16)) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.onResize = f
+}
+
+func (p *pipe) resize(width, height uint16) {
+	p.mtx.Lock()
+	onResize := p.onResize
+	p.mtx.Unlock()
+	if onResize != nil {
+		onResize(width, height)
+	}
+}
+
 // CopyToWebsocket copies pipe data to/from a websocket.  It blocks.
 func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 	p.mtx.Lock()
@@ -109,6 +153,10 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 	p.mtx.Unlock()
 	defer p.wg.Done()
 
+	if p.framed {
+		return p.copyFramed(end, conn)
+	}
+
 	// The goroutines below both post their errors to the channel, but if you close()
 	// the pipe before any errors then the pipe may not get read from. Therefore it
 	// needs up to 2 slots free.
@@ -117,7 +165,7 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 	// Read-from-UI loop
 	go func() {
 		for {
-			_, buf, err := conn.ReadMessage() // TODO type should be binary message
+			messageType, buf, err := conn.ReadMessage()
 			if err != nil {
 				errors <- err
 				return
@@ -127,6 +175,12 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 				return
 			}
 
+			// Text messages are the UI's control messages for framed pipes;
+			// passed through, they would be typed into the terminal.
+			if messageType == websocket.TextMessage {
+				continue
+			}
+
 			if _, err := end.Write(buf); err != nil {
 				errors <- err
 				return
@@ -164,3 +218,110 @@ func (p *pipe) CopyToWebsocket(end io.ReadWriter, conn Websocket) error {
 		return nil
 	}
 }
+
+// copyFramed is CopyToWebsocket for framed pipes. Data read from the end is
+// framed before being sent down the websocket, and frames received from the
+// websocket are decoded: data is written to the end, and the rest acted upon.
+func (p *pipe) copyFramed(end io.ReadWriter, conn Websocket) error {
+	errors := make(chan error, 3)
+	done := make(chan struct{})
+	defer close(done)
+
+	// Read-from-UI loop
+	go func() {
+		var decoder FrameDecoder
+		for {
+			_, buf, err := conn.ReadMessage()
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			if p.Closed() {
+				return
+			}
+
+			decoder.Write(buf)
+			for {
+				f, ok, err := decoder.Next()
+				if err != nil {
+					errors <- err
+					return
+				} else if !ok {
+					break
+				}
+				if err := p.handleFrame(end, f); err != nil {
+					errors <- err
+					return
+				}
+			}
+		}
+	}()
+
+	// Write-to-UI loop
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := end.Read(buf)
+			if p.Closed() {
+				return
+			}
+
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, Frame{Type: FrameData, Data: buf[:n]}.Bytes()); err != nil {
+					errors <- err
+					return
+				}
+			}
+			if err == io.EOF {
+				// Tell the UI there's no more to come, best effort.
+				conn.WriteMessage(websocket.BinaryMessage, Frame{Type: FrameEOF}.Bytes())
+			}
+			if err != nil {
+				errors <- err
+				return
+			}
+		}
+	}()
+
+	// Keepalive loop, so idle pipes aren't timed out by proxies in between.
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteMessage(websocket.BinaryMessage, Frame{Type: FramePing}.Bytes()); err != nil {
+					errors <- err
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errors:
+		return err
+	case <-p.quit:
+		return nil
+	}
+}
+
+func (p *pipe) handleFrame(end io.ReadWriter, f Frame) error {
+	switch f.Type {
+	case FrameData:
+		_, err := end.Write(f.Data)
+		return err
+	case FrameResize:
+		if width, height, ok := f.Size(); ok {
+			p.resize(width, height)
+		}
+	case FrameEOF:
+		if c, ok := end.(halfCloser); ok {
+			return c.CloseWrite()
+		}
+	}
+	return nil
+}
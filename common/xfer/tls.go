@@ -0,0 +1,172 @@
+package xfer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// CertReloader keeps a certificate and key loaded from files, reloading them
+// when the files change, so certificates can be rotated without restarting.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mtx     sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads a certificate and key from files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.get(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *CertReloader) get() (*tls.Certificate, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err == nil && !modTime.Equal(r.modTime) {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile); err == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err == nil {
+				r.cert, r.modTime = &cert, modTime
+			}
+		}
+	}
+	if err != nil {
+		if r.cert == nil {
+			return nil, err
+		}
+		// Half-written files are expected during rotation; carry on with
+		// the old certificate until they're complete.
+		log.Warnf("Error reloading certificate %s, using the old one: %v", r.certFile, err)
+	}
+	return r.cert, nil
+}
+
+// Certificate returns the current certificate.
+func (r *CertReloader) Certificate() (*tls.Certificate, error) {
+	return r.get()
+}
+
+// GetCertificate is for tls.Config.GetCertificate, on servers.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.get()
+}
+
+// Identity returns the identity in the current certificate.
+func (r *CertReloader) Identity() (string, error) {
+	cert, err := r.get()
+	if err != nil {
+		return "", err
+	}
+	return CertIdentity(cert.Leaf)
+}
+
+// CertIdentity returns the identity of a probe with a certificate: its
+// common name, which the probe uses as its ID. Rotated certificates must keep
+// the same common name.
+func CertIdentity(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName == "" {
+		return "", fmt.Errorf("certificate has no common name")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// CAReloader keeps a pool of CA certificates loaded from a PEM file,
+// reloading it when the file changes.
+type CAReloader struct {
+	file string
+
+	mtx     sync.Mutex
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// NewCAReloader loads CA certificates from a PEM file.
+func NewCAReloader(file string) (*CAReloader, error) {
+	r := &CAReloader{file: file}
+	if _, err := r.Pool(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pool returns the current pool of CA certificates.
+func (r *CAReloader) Pool() (*x509.CertPool, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	modTime, err := latestModTime(r.file)
+	if err == nil && !modTime.Equal(r.modTime) {
+		var buf []byte
+		if buf, err = ioutil.ReadFile(r.file); err == nil {
+			pool := x509.NewCertPool()
+			if pool.AppendCertsFromPEM(buf) {
+				r.pool, r.modTime = pool, modTime
+			} else {
+				err = fmt.Errorf("no certificates found")
+			}
+		}
+	}
+	if err != nil {
+		if r.pool == nil {
+			return nil, fmt.Errorf("loading CA certificates from %s: %v", r.file, err)
+		}
+		log.Warnf("Error reloading CA certificates %s, using the old ones: %v", r.file, err)
+	}
+	return r.pool, nil
+}
+
+// NewTLSListener wraps a listener such that connections are served over TLS,
+// with a config made for each connection. Servers use it so rotated client
+// CAs are picked up, which tls.Config can't do by itself in the Go we build
+// with.
+func NewTLSListener(inner net.Listener, config func() (*tls.Config, error)) net.Listener {
+	return &tlsListener{Listener: inner, config: config}
+}
+
+type tlsListener struct {
+	net.Listener
+	config func() (*tls.Config, error)
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		config, err := l.config()
+		if err != nil {
+			log.Errorf("Error making TLS config, dropping connection from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		return tls.Server(conn, config), nil
+	}
+}
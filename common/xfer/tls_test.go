@@ -0,0 +1,147 @@
+package xfer_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/test"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := test.NewCA(t)
+	certFile, keyFile := ca.Issue(t, dir, "probe", "probe1")
+	r, err := xfer.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := r.Identity(); err != nil || id != "probe1" {
+		t.Fatalf("Expected probe1, got %q, %v", id, err)
+	}
+
+	// Rotate the certificate
+	next, nextKey := ca.Issue(t, dir, "next", "probe1")
+	later := time.Now().Add(time.Minute)
+	for src, dst := range map[string]string{next: certFile, nextKey: keyFile} {
+		if err := os.Rename(src, dst); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dst, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := r.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.SerialNumber.Int64() != 3 {
+		t.Errorf("Expected the rotated certificate, got serial %v", cert.Leaf.SerialNumber)
+	}
+
+	// A broken certificate doesn't replace a good one
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err := r.Certificate(); err != nil || cert.Leaf.SerialNumber.Int64() != 3 {
+		t.Errorf("Expected the old certificate, got %v", err)
+	}
+
+	if _, err := xfer.NewCertReloader(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Error("Expected error loading missing certificate")
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scope-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "next"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, next := test.NewCA(t), test.NewCA(t)
+	caFile := ca.WriteCert(t, dir)
+	serverCert, serverKey := ca.Issue(t, dir, "app", "app")
+	probeCert, probeKey := next.Issue(t, dir, "probe", "probe1")
+	cert, err := xfer.NewCertReloader(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas, err := xfer.NewCAReloader(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := xfer.NewTLSListener(inner, func() (*tls.Config, error) {
+		pool, err := cas.Pool()
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			GetCertificate: cert.GetCertificate,
+			ClientAuth:     tls.VerifyClientCertIfGiven,
+			ClientCAs:      pool,
+		}, nil
+	})
+	defer listener.Close()
+
+	probe, err := xfer.NewCertReloader(probeCert, probeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := probe.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshake := func() error {
+		go func() {
+			conn, err := tls.Dial("tcp", inner.Addr().String(), &tls.Config{
+				Certificates:       []tls.Certificate{*clientCert},
+				InsecureSkipVerify: true,
+			})
+			if err == nil {
+				conn.Read(make([]byte, 1))
+				conn.Close()
+			}
+		}()
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.(*tls.Conn).Handshake()
+	}
+
+	// The probe's certificate is from a CA the app doesn't know yet...
+	if err := handshake(); err == nil {
+		t.Error("Expected the probe's certificate to be rejected")
+	}
+
+	// ...until the app's CAs are rotated.
+	later := time.Now().Add(time.Minute)
+	if err := os.Rename(next.WriteCert(t, filepath.Join(dir, "next")), caFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(caFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(); err != nil {
+		t.Errorf("Expected the probe's certificate to be accepted, got %v", err)
+	}
+}
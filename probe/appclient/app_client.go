@@ -1,15 +1,20 @@
 package appclient
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/rpc"
+	"net/url"
+	"path/filepath"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/armon/go-metrics"
 	"github.com/gorilla/websocket"
 	"github.com/ugorji/go/codec"
 
@@ -20,8 +25,39 @@ import (
 const (
 	initialBackoff = 1 * time.Second
 	maxBackoff     = 60 * time.Second
+
+	// Reports held back for less than this are published as they are;
+	// it isn't worth decoding them to tell the app.
+	minReportDelay = 5 * time.Second
 )
 
+var errNoStream = errors.New("no stream connection to app")
+
+// queueDirs are the directories of clients' queues, so that those left
+// behind, by clients for apps which have gone or by a previous run, can be
+// told apart and taken over.
+var queueDirs = struct {
+	sync.Mutex
+	claimed map[string]bool
+}{claimed: map[string]bool{}}
+
+// claimQueueDir returns false if the directory is already some client's.
+func claimQueueDir(dir string) bool {
+	queueDirs.Lock()
+	defer queueDirs.Unlock()
+	if queueDirs.claimed[dir] {
+		return false
+	}
+	queueDirs.claimed[dir] = true
+	return true
+}
+
+func releaseQueueDir(dir string) {
+	queueDirs.Lock()
+	defer queueDirs.Unlock()
+	delete(queueDirs.claimed, dir)
+}
+
 // AppClient is a client to an app for dealing with controls.
 type AppClient interface {
 	Details() (xfer.Details, error)
@@ -38,9 +74,10 @@ type appClient struct {
 
 	quit     chan struct{}
 	mtx      sync.Mutex
+	hostname string
 	target   string
 	client   http.Client
-	wsDialer websocket.Dialer
+	wsDialer xfer.WSDialer
 	appID    string
 
 	// Track all the background goroutines, ensure they all stop
@@ -51,15 +88,25 @@ type appClient struct {
 
 	// For publish
 	publishLoop sync.Once
-	readers     chan io.Reader
+	queue       *reportQueue
+	queueDir    string // guarded by mtx
 
 	// For controls
 	control xfer.ControlHandler
+
+	// For stream connections; guarded by mtx
+	mux      *xfer.Mux
+	reports  *xfer.MuxStream
+	noStream bool
 }
 
 // NewAppClient makes a new appClient.
 func NewAppClient(pc ProbeConfig, hostname, target string, control xfer.ControlHandler) (AppClient, error) {
-	httpTransport, err := pc.getHTTPTransport(hostname)
+	tlsConfig, err := pc.getTLSConfig(hostname)
+	if err != nil {
+		return nil, err
+	}
+	httpTransport, err := getHTTPTransport(tlsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -67,16 +114,15 @@ func NewAppClient(pc ProbeConfig, hostname, target string, control xfer.ControlH
 	return &appClient{
 		ProbeConfig: pc,
 		quit:        make(chan struct{}),
+		hostname:    hostname,
 		target:      target,
 		client: http.Client{
 			Transport: httpTransport,
 		},
-		wsDialer: websocket.Dialer{
-			TLSClientConfig: httpTransport.TLSClientConfig,
-		},
-		conns:   map[string]xfer.Websocket{},
-		readers: make(chan io.Reader, 2),
-		control: control,
+		wsDialer: wsDialer(tlsConfig),
+		conns:    map[string]xfer.Websocket{},
+		queue:    newReportQueue(pc.QueueLength, pc.QueueBytes, ""),
+		control:  control,
 	}, nil
 }
 
@@ -126,7 +172,10 @@ func (c *appClient) releaseGoroutine() {
 // Stop stops the appClient.
 func (c *appClient) Stop() {
 	c.mtx.Lock()
-	close(c.readers)
+	c.queue.close()
+	if c.queueDir != "" {
+		releaseQueueDir(c.queueDir)
+	}
 	close(c.quit)
 	for _, conn := range c.conns {
 		conn.Close()
@@ -155,6 +204,22 @@ func (c *appClient) Details() (xfer.Details, error) {
 		return result, err
 	}
 	c.appID = result.ID
+	// The queue is kept by hostname and app ID, rather than by address,
+	// which changes when the app is rescheduled. Queues left for other apps
+	// of the hostname are taken over once publishing starts.
+	if c.QueueDir != "" {
+		dir := filepath.Join(c.QueueDir, url.QueryEscape(c.hostname), url.QueryEscape(result.ID))
+		if !claimQueueDir(dir) {
+			return result, nil
+		}
+		if !c.queue.setDir(dir) {
+			releaseQueueDir(dir)
+			return result, nil
+		}
+		c.mtx.Lock()
+		c.queueDir = dir
+		c.mtx.Unlock()
+	}
 	return result, nil
 }
 
@@ -189,26 +254,26 @@ func (c *appClient) doWithBackoff(msg string, f func() (bool, error)) {
 	}
 }
 
+func (c *appClient) doControl(req xfer.Request) xfer.Response {
+	req.AppID = c.appID
+	var res xfer.Response
+	c.control.Handle(req, &res)
+	return res
+}
+
 func (c *appClient) controlConnection() (bool, error) {
 	headers := http.Header{}
 	c.ProbeConfig.authorizeHeaders(headers)
 	url := sanitize.URL("ws://", 0, "/api/control/ws")(c.target)
-	conn, _, err := xfer.DialWS(&c.wsDialer, url, headers)
+	conn, _, err := xfer.DialWS(c.wsDialer, url, headers)
 	if err != nil {
 		return false, err
 	}
 	defer conn.Close()
 
-	doControl := func(req xfer.Request) xfer.Response {
-		req.AppID = c.appID
-		var res xfer.Response
-		c.control.Handle(req, &res)
-		return res
-	}
-
 	codec := xfer.NewJSONWebsocketCodec(conn)
 	server := rpc.NewServer()
-	if err := server.RegisterName("control", xfer.ControlHandlerFunc(doControl)); err != nil {
+	if err := server.RegisterName("control", xfer.ControlHandlerFunc(c.doControl)); err != nil {
 		return false, err
 	}
 
@@ -223,6 +288,14 @@ func (c *appClient) controlConnection() (bool, error) {
 }
 
 func (c *appClient) ControlConnection() {
+	if c.useStream() {
+		go func() {
+			log.Infof("Stream connection to %s starting", c.target)
+			defer log.Infof("Stream connection to %s exiting", c.target)
+			c.doWithBackoff("stream", c.streamConnection)
+		}()
+		return
+	}
 	go func() {
 		log.Infof("Control connection to %s starting", c.target)
 		defer log.Infof("Control connection to %s exiting", c.target)
@@ -230,6 +303,111 @@ func (c *appClient) ControlConnection() {
 	}()
 }
 
+func (c *appClient) useStream() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.Stream && !c.noStream
+}
+
+func (c *appClient) setMux(m *xfer.Mux) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.mux, c.reports = m, nil
+}
+
+func (c *appClient) getMux() (*xfer.Mux, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.mux == nil {
+		return nil, errNoStream
+	}
+	return c.mux, nil
+}
+
+// streamConnection keeps a single websocket to the app, over which the
+// control connection, reports and pipes each get a stream of their own.
+func (c *appClient) streamConnection() (bool, error) {
+	headers := http.Header{}
+	c.ProbeConfig.authorizeHeaders(headers)
+	url := sanitize.URL("ws://", 0, "/api/probe/ws")(c.target)
+	conn, resp, err := xfer.DialWS(c.wsDialer, url, headers)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// Older apps don't have stream connections, so use a connection
+		// for each thing instead.
+		log.Warnf("App %s doesn't support stream connections, falling back to separate connections", c.target)
+		c.mtx.Lock()
+		c.noStream = true
+		c.mtx.Unlock()
+		go c.doWithBackoff("controls", c.controlConnection)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Will return false if we are exiting
+	if !c.registerConn("stream", conn) {
+		return true, nil
+	}
+	defer c.closeConn("stream")
+
+	m := xfer.NewMux(conn, true, nil)
+	defer m.Close()
+	control, err := m.Open(xfer.ControlStream)
+	if err != nil {
+		return false, err
+	}
+	c.setMux(m)
+	defer c.setMux(nil)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("control", xfer.ControlHandlerFunc(c.doControl)); err != nil {
+		return false, err
+	}
+	server.ServeCodec(xfer.NewJSONWebsocketCodec(control))
+	return false, nil
+}
+
+// publishStream sends a report over the stream connection, and waits for
+// the app to acknowledge it.
+func (c *appClient) publishStream(buf []byte) error {
+	m, err := c.getMux()
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	if c.mux == m && c.reports == nil {
+		c.reports, err = m.Open(xfer.ReportStream)
+	}
+	s := c.reports
+	c.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errNoStream
+	}
+
+	var ack xfer.ReportAck
+	if err = s.WriteMessage(websocket.BinaryMessage, buf); err == nil {
+		err = s.ReadJSON(&ack)
+	}
+	if err != nil {
+		// We don't know where we are in the stream now, so start another.
+		s.Close()
+		c.mtx.Lock()
+		if c.reports == s {
+			c.reports = nil
+		}
+		c.mtx.Unlock()
+		return err
+	}
+	if ack.Code != http.StatusOK {
+		return publishError{ack.Code, fmt.Sprintf("%d: %s", ack.Code, ack.Error)}
+	}
+	return nil
+}
+
 func (c *appClient) publish(r io.Reader) error {
 	url := sanitize.URL("", 0, "/api/report")(c.target)
 	req, err := c.ProbeConfig.authorizedRequest("POST", url, r)
@@ -247,42 +425,123 @@ func (c *appClient) publish(r io.Reader) error {
 
 	if resp.StatusCode != http.StatusOK {
 		text, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf(resp.Status + ": " + string(text))
+		return publishError{resp.StatusCode, resp.Status + ": " + string(text)}
 	}
 	return nil
 }
 
+// publishError is returned when the app responds to a report with an error.
+type publishError struct {
+	code int
+	text string
+}
+
+func (e publishError) Error() string {
+	return e.text
+}
+
+// rejected is true if the app will never accept the report, so there's no
+// point retrying it.
+func (e publishError) rejected() bool {
+	return e.code == http.StatusBadRequest || e.code == http.StatusRequestEntityTooLarge
+}
+
 func (c *appClient) startPublishing() {
+	if err := c.queue.load(); err != nil {
+		log.Errorf("Error loading queued reports for %s: %v", c.target, err)
+	}
+	c.adoptOrphanedQueues()
 	go func() {
 		log.Infof("Publish loop for %s starting", c.target)
 		defer log.Infof("Publish loop for %s exiting", c.target)
 		c.doWithBackoff("publish", func() (bool, error) {
-			r := <-c.readers
-			if r == nil {
+			e, ok := c.queue.peek()
+			if !ok {
 				return true, nil
 			}
-			return false, c.publish(r)
+			var (
+				t   = time.Now()
+				buf = e.buf
+				err error
+			)
+			if delay := t.Sub(e.queued); delay > minReportDelay {
+				if buf, err = withDelay(buf, delay); err != nil {
+					log.Errorf("Error decoding queued report, dropping it: %v", err)
+					metrics.IncrCounter(queueDroppedKey, 1)
+					c.queue.pop(e)
+					return false, nil
+				}
+			}
+			if c.useStream() {
+				err = c.publishStream(buf)
+			} else {
+				err = c.publish(bytes.NewReader(buf))
+			}
+			if err == nil {
+				recordPublishLatency(time.Since(t))
+			}
+			if perr, ok := err.(publishError); ok && perr.rejected() {
+				log.Errorf("Report rejected by %s, dropping it: %v", c.target, err)
+				metrics.IncrCounter(queueDroppedKey, 1)
+				err = nil
+			}
+			if err != nil {
+				c.queue.release()
+				return false, err
+			}
+			c.queue.pop(e)
+			return false, nil
 		})
 	}()
 }
 
-// Publish implements Publisher
+// adoptOrphanedQueues takes over the reports queued for this hostname in
+// directories no client has, e.g. for apps which were replaced while the
+// probe wasn't running.
+func (c *appClient) adoptOrphanedQueues() {
+	c.mtx.Lock()
+	dir := c.queueDir
+	c.mtx.Unlock()
+	if dir == "" {
+		return
+	}
+	parent := filepath.Dir(dir)
+	files, err := ioutil.ReadDir(parent)
+	if err != nil {
+		log.Errorf("Error looking for queued reports for %s: %v", c.target, err)
+		return
+	}
+	for _, file := range files {
+		orphan := filepath.Join(parent, file.Name())
+		if !file.IsDir() || !claimQueueDir(orphan) {
+			continue
+		}
+		c.queue.adopt(newReportQueue(c.QueueLength, c.QueueBytes, orphan))
+		releaseQueueDir(orphan)
+	}
+}
+
+// Publish implements Publisher. Reports are queued, and published in the
+// background; while the app is unreachable they stay queued.
 func (c *appClient) Publish(r io.Reader) error {
 	// Lazily start the background publishing loop.
 	c.publishLoop.Do(c.startPublishing)
-	select {
-	case c.readers <- r:
-	default:
-		log.Errorf("Dropping report to %s", c.target)
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
 	}
+	c.queue.push(buf)
 	return nil
 }
 
 func (c *appClient) pipeConnection(id string, pipe xfer.Pipe) (bool, error) {
+	if c.useStream() {
+		return c.pipeStream(id, pipe)
+	}
 	headers := http.Header{}
 	c.ProbeConfig.authorizeHeaders(headers)
 	url := sanitize.URL("ws://", 0, fmt.Sprintf("/api/pipe/%s/probe", id))(c.target)
-	conn, resp, err := xfer.DialWS(&c.wsDialer, url, headers)
+	conn, resp, err := xfer.DialWS(c.wsDialer, url, headers)
 	if resp != nil && resp.StatusCode == http.StatusNotFound {
 		// Special handling - 404 means the app/user has closed the pipe
 		pipe.Close()
@@ -302,6 +561,33 @@ func (c *appClient) pipeConnection(id string, pipe xfer.Pipe) (bool, error) {
 	return false, pipe.CopyToWebsocket(remote, conn)
 }
 
+// pipeStream is pipeConnection over the stream connection.
+func (c *appClient) pipeStream(id string, pipe xfer.Pipe) (bool, error) {
+	m, err := c.getMux()
+	if err != nil {
+		return false, err
+	}
+	s, err := m.Open(xfer.PipeStream + id)
+	if err != nil {
+		return false, err
+	}
+
+	// Will return false if we are exiting
+	if !c.registerConn(id, s) {
+		return true, nil
+	}
+	defer c.closeConn(id)
+
+	_, remote := pipe.Ends()
+	err = pipe.CopyToWebsocket(remote, s)
+	if err == (xfer.StreamClosedError{Reason: xfer.StreamNotFound}) {
+		// The app/user has closed the pipe
+		pipe.Close()
+		return true, nil
+	}
+	return pipe.Closed(), err
+}
+
 func (c *appClient) PipeConnection(id string, pipe xfer.Pipe) {
 	go func() {
 		log.Infof("Pipe %s connection to %s starting", id, c.target)
@@ -3,11 +3,15 @@ package appclient
 import (
 	"compress/gzip"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -76,6 +80,9 @@ func TestAppClientPublish(t *testing.T) {
 	rpt.Service = report.MakeTopology()
 	rpt.Deployment = report.MakeTopology()
 	rpt.ReplicaSet = report.MakeTopology()
+	rpt.KubernetesNode = report.MakeTopology()
+	rpt.Namespace = report.MakeTopology()
+	rpt.SystemdService = report.MakeTopology()
 	rpt.Host = report.MakeTopology()
 	rpt.Overlay = report.MakeTopology()
 	rpt.Endpoint.Controls = nil
@@ -86,6 +93,9 @@ func TestAppClientPublish(t *testing.T) {
 	rpt.Service.Controls = nil
 	rpt.Deployment.Controls = nil
 	rpt.ReplicaSet.Controls = nil
+	rpt.KubernetesNode.Controls = nil
+	rpt.Namespace.Controls = nil
+	rpt.SystemdService.Controls = nil
 	rpt.Host.Controls = nil
 	rpt.Overlay.Controls = nil
 
@@ -167,3 +177,147 @@ func TestAppClientDetails(t *testing.T) {
 		return
 	}
 }
+
+func TestAppClientQueuesWhileUnreachable(t *testing.T) {
+	var (
+		mtx       sync.Mutex
+		reachable bool
+		received  = make(chan string, 10)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if !reachable {
+			http.Error(w, "upgrading", http.StatusServiceUnavailable)
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var rpt report.Report
+		if err := codec.NewDecoder(reader, &codec.MsgpackHandle{}).Decode(&rpt); err != nil {
+			t.Error(err)
+			return
+		}
+		for id := range rpt.Host.Nodes {
+			received <- id
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAppClient(ProbeConfig{}, u.Host, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	rp := NewReportPublisher(p)
+	for _, id := range []string{"a", "b", "c"} {
+		rpt := report.MakeReport()
+		rpt.Host.AddNode(report.MakeNode(id))
+		if err := rp.Publish(rpt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mtx.Lock()
+	reachable = true
+	mtx.Unlock()
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case have := <-received:
+			if have != want {
+				t.Errorf("want %s, have %s", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+}
+
+func TestAppClientAdoptsOrphanedQueues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "app-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	received := make(chan report.Report, 10)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			codec.NewEncoder(w, &codec.JsonHandle{}).Encode(xfer.Details{ID: "new"})
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var rpt report.Report
+		if err := codec.NewDecoder(reader, &codec.MsgpackHandle{}).Decode(&rpt); err != nil {
+			t.Error(err)
+			return
+		}
+		received <- rpt
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reports left queued, a while ago, for an app which has since been
+	// replaced
+	orphan := filepath.Join(dir, url.QueryEscape(u.Host), "old")
+	q := newReportQueue(0, 0, orphan)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	q.push(queuedReport(t, "a", 0))
+	q.close()
+	then := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(q.filename(1), then, then); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewAppClient(ProbeConfig{QueueDir: dir}, u.Host, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if _, err := p.Details(); err != nil {
+		t.Fatal(err)
+	}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("b"))
+	if err := NewReportPublisher(p).Publish(rpt); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a", "b"} {
+		select {
+		case have := <-received:
+			if _, ok := have.Host.Nodes[want]; !ok {
+				t.Errorf("Expected %s, got %v", want, have.Host.Nodes)
+			}
+			// The app is told how long the old report was held back
+			if delayed := have.Delay >= time.Minute; delayed != (want == "a") {
+				t.Errorf("%s: unexpected delay %v", want, have.Delay)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("Expected the orphaned queue to be removed, got %v", err)
+	}
+}
@@ -97,8 +97,11 @@ func (c *multiClient) Set(hostname string, endpoints []string) {
 	defer c.mtx.Unlock()
 
 	// Start any new apps, and replace the list of app ids for this hostname
+	oldIDs := c.ids[hostname]
 	hostIDs := report.MakeIDList()
+	reached := 0
 	for tuple := range clients {
+		reached++
 		hostIDs = hostIDs.Add(tuple.ID)
 
 		_, ok := c.clients[tuple.ID]
@@ -107,6 +110,12 @@ func (c *multiClient) Set(hostname string, endpoints []string) {
 			tuple.AppClient.ControlConnection()
 		}
 	}
+	// Until every endpoint has been reached, the apps we had may only be
+	// unreachable for now, e.g. during an outage or while they're being
+	// replaced, so they are kept, and reports are queued for them.
+	if len(endpoints) == 0 || reached < len(endpoints) {
+		hostIDs = hostIDs.Add(oldIDs...)
+	}
 	c.ids[hostname] = hostIDs
 
 	// Remove apps that are no longer referenced (by id) from any hostname
@@ -117,11 +126,25 @@ func (c *multiClient) Set(hostname string, endpoints []string) {
 	for id, client := range c.clients {
 		if !allReferencedIDs.Contains(id) {
 			client.Stop()
+			// An app which has been replaced, e.g. by upgrading it, gets
+			// the reports queued for it.
+			if oldIDs.Contains(id) && len(hostIDs) > 0 {
+				handOverQueue(client, c.clients[hostIDs[0]])
+			}
 			delete(c.clients, id)
 		}
 	}
 }
 
+// handOverQueue moves the reports queued by a stopped client to another.
+func handOverQueue(from, to AppClient) {
+	f, ok1 := from.(*appClient)
+	t, ok2 := to.(*appClient)
+	if ok1 && ok2 {
+		t.queue.adopt(f.queue)
+	}
+}
+
 func (c *multiClient) withClient(appID string, f func(AppClient) error) error {
 	c.mtx.Lock()
 	client, ok := c.clients[appID]
@@ -2,6 +2,7 @@ package appclient_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"runtime"
 	"testing"
@@ -15,10 +16,11 @@ type mockClient struct {
 	count   int
 	stopped int
 	publish int
+	err     error
 }
 
 func (c *mockClient) Details() (xfer.Details, error) {
-	return xfer.Details{ID: c.id}, nil
+	return xfer.Details{ID: c.id}, c.err
 }
 
 func (c *mockClient) ControlConnection() {
@@ -42,6 +44,8 @@ var (
 	a2      = &mockClient{id: "2"} // hostname a, app id 2
 	b2      = &mockClient{id: "2"} // hostname b, app id 2 (duplicate)
 	b3      = &mockClient{id: "3"} // hostname b, app id 3
+	b4      = &mockClient{id: "4"} // hostname b, app id 4
+	bx      = &mockClient{err: errors.New("unreachable")}
 	factory = func(hostname, target string) (appclient.AppClient, error) {
 		switch target {
 		case "a1":
@@ -52,6 +56,10 @@ var (
 			return b2, nil
 		case "b3":
 			return b3, nil
+		case "b4":
+			return b4, nil
+		case "bx":
+			return bx, nil
 		}
 		panic(target)
 	}
@@ -83,9 +91,17 @@ func TestMultiClient(t *testing.T) {
 	expect(a2.count+b2.count, 1)
 	expect(b3.count, 1)
 
-	// Now check we remove apps
+	// Apps are kept while they can't be reached, or no apps are found
 	mp.Set("b", []string{})
+	mp.Set("b", []string{"bx"})
+	mp.Set("b", []string{"bx", "b4"})
+	expect(b3.stopped, 0)
+	expect(b4.count, 1)
+
+	// Now check we remove apps, once their replacements have been reached
+	mp.Set("b", []string{"b4"})
 	expect(b3.stopped, 1)
+	expect(b4.stopped, 0)
 }
 
 func TestMultiClientPublish(t *testing.T) {
@@ -5,10 +5,12 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 
 	"github.com/certifi/gocertifi"
+	"github.com/gorilla/websocket"
 	"github.com/weaveworks/scope/common/xfer"
 )
 
@@ -27,6 +29,26 @@ type ProbeConfig struct {
 	Token    string
 	ProbeID  string
 	Insecure bool
+
+	// Reports are queued while an app is unreachable. Once QueueLength
+	// reports are queued the oldest are merged together, and once they take
+	// up QueueBytes the oldest are dropped. If QueueDir is set the queue is
+	// kept on disk there, in a directory per app hostname and ID, so it
+	// survives restarts; queues left for apps which have since been
+	// replaced are published to their replacements.
+	QueueLength int
+	QueueBytes  int
+	QueueDir    string
+
+	// If Stream is set, reports, controls and pipes all go over a single
+	// websocket to the app, unless the app is too old to support it.
+	Stream bool
+
+	// If ClientCert is set, the probe presents it to apps, for mutual TLS.
+	// If CAFile is set, apps' certificates are verified against the CAs in
+	// it, rather than the usual public CAs.
+	ClientCert *xfer.CertReloader
+	CAFile     string
 }
 
 func (pc ProbeConfig) authorizeHeaders(headers http.Header) {
@@ -42,22 +64,73 @@ func (pc ProbeConfig) authorizedRequest(method string, urlStr string, body io.Re
 	return req, err
 }
 
-func (pc ProbeConfig) getHTTPTransport(hostname string) (*http.Transport, error) {
-	if pc.Insecure {
-		return &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}, nil
+// getTLSConfig returns a function making TLS configs for connections to the
+// app. Each connection gets a new config with the client certificate as it
+// is then, so rotated certificates are picked up.
+func (pc ProbeConfig) getTLSConfig(hostname string) (func() (*tls.Config, error), error) {
+	var (
+		rootCAs    *x509.CertPool
+		serverName string
+	)
+	if !pc.Insecure {
+		host, _, err := net.SplitHostPort(hostname)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs, serverName = certPool, host
+		if pc.CAFile != "" {
+			buf, err := ioutil.ReadFile(pc.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			rootCAs = x509.NewCertPool()
+			if !rootCAs.AppendCertsFromPEM(buf) {
+				return nil, fmt.Errorf("no certificates found in %s", pc.CAFile)
+			}
+		}
 	}
+	return func() (*tls.Config, error) {
+		tlsConfig := &tls.Config{
+			RootCAs:            rootCAs,
+			ServerName:         serverName,
+			InsecureSkipVerify: pc.Insecure,
+		}
+		if pc.ClientCert != nil {
+			cert, err := pc.ClientCert.Certificate()
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		return tlsConfig, nil
+	}, nil
+}
 
-	host, _, err := net.SplitHostPort(hostname)
+func getHTTPTransport(tlsConfig func() (*tls.Config, error)) (*http.Transport, error) {
+	config, err := tlsConfig()
 	if err != nil {
 		return nil, err
 	}
-
 	return &http.Transport{
-		TLSClientConfig: &tls.Config{
-			RootCAs:    certPool,
-			ServerName: host,
+		TLSClientConfig: config,
+		DialTLS: func(network, addr string) (net.Conn, error) {
+			config, err := tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			return tls.Dial(network, addr, config)
 		},
 	}, nil
 }
+
+// wsDialer dials websockets with a new TLS config for each connection.
+type wsDialer func() (*tls.Config, error)
+
+func (d wsDialer) Dial(urlStr string, requestHeader http.Header) (*websocket.Conn, *http.Response, error) {
+	config, err := d()
+	if err != nil {
+		return nil, nil, err
+	}
+	dialer := websocket.Dialer{TLSClientConfig: config}
+	return dialer.Dial(urlStr, requestHeader)
+}
@@ -2,14 +2,11 @@ package appclient
 
 import (
 	"bytes"
-	"compress/gzip"
-	"github.com/ugorji/go/codec"
 
 	"github.com/weaveworks/scope/report"
 )
 
-// A ReportPublisher uses a buffer pool to serialise reports, which it
-// then passes to a publisher
+// A ReportPublisher serialises reports, which it then passes to a publisher
 type ReportPublisher struct {
 	publisher Publisher
 }
@@ -23,12 +20,10 @@ func NewReportPublisher(publisher Publisher) *ReportPublisher {
 
 // Publish serialises and compresses a report, then passes it to a publisher
 func (p *ReportPublisher) Publish(r report.Report) error {
-	buf := &bytes.Buffer{}
-	gzwriter := gzip.NewWriter(buf)
-	if err := codec.NewEncoder(gzwriter, &codec.MsgpackHandle{}).Encode(r); err != nil {
+	buf, err := encodeReport(r)
+	if err != nil {
 		return err
 	}
-	gzwriter.Close() // otherwise the content won't get flushed to the output stream
-
-	return p.publisher.Publish(buf)
+	recordReportBytes(len(buf))
+	return p.publisher.Publish(bytes.NewReader(buf))
 }
@@ -0,0 +1,445 @@
+package appclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/armon/go-metrics"
+	"github.com/ugorji/go/codec"
+
+	"github.com/weaveworks/scope/report"
+)
+
+const (
+	defaultQueueLength = 20
+	defaultQueueBytes  = 50 * 1024 * 1024
+
+	queueFileSuffix = ".report"
+)
+
+var (
+	queueDepthKey     = []string{"appclient", "queue", "depth"}
+	queueBytesKey     = []string{"appclient", "queue", "bytes"}
+	queueCoalescedKey = []string{"appclient", "queue", "coalesced"}
+	queueDroppedKey   = []string{"appclient", "queue", "dropped"}
+)
+
+// encodeReport serialises and compresses a report, as it is sent to the app.
+func encodeReport(r report.Report) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gzwriter := gzip.NewWriter(buf)
+	if err := codec.NewEncoder(gzwriter, &codec.MsgpackHandle{}).Encode(r); err != nil {
+		return nil, err
+	}
+	gzwriter.Close() // otherwise the content won't get flushed to the output stream
+	return buf.Bytes(), nil
+}
+
+func decodeReport(buf []byte) (report.Report, error) {
+	var r report.Report
+	gzreader, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return r, err
+	}
+	defer gzreader.Close()
+	err = codec.NewDecoder(gzreader, &codec.MsgpackHandle{}).Decode(&r)
+	return r, err
+}
+
+// coalesce merges two serialised reports, older first, into one. Merge adds
+// the windows, which is right as queued reports cover consecutive periods;
+// shortcut reports are published with no window, as they overlap the
+// periodic ones. By the time they are replayed, the reports are no longer
+// worth shortcutting to the UI.
+func coalesce(older, newer []byte) ([]byte, error) {
+	a, err := decodeReport(older)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeReport(newer)
+	if err != nil {
+		return nil, err
+	}
+	merged := a.Merge(b)
+	merged.Shortcut = false
+	return encodeReport(merged)
+}
+
+// withDelay sets how long a serialised report was held back before being
+// published, so the app can tell it isn't current.
+func withDelay(buf []byte, delay time.Duration) ([]byte, error) {
+	r, err := decodeReport(buf)
+	if err != nil {
+		return nil, err
+	}
+	r.Delay = delay
+	return encodeReport(r)
+}
+
+type queueEntry struct {
+	seq    uint64
+	buf    []byte
+	queued time.Time // kept as the file's modification time on disk
+}
+
+// reportQueue holds serialised reports waiting to be published to an app, so
+// they are not lost while the app is unreachable. Once it holds maxLength
+// reports, the oldest two are merged together; once it holds maxBytes, the
+// oldest are dropped. If dir is set, the queue is kept there as well, so it
+// survives the probe restarting.
+type reportQueue struct {
+	maxLength int
+	maxBytes  int
+
+	mtx      sync.Mutex
+	cond     *sync.Cond
+	dir      string
+	entries  []queueEntry
+	size     int
+	nextSeq  uint64
+	inflight uint64 // seq of the entry being published, if any
+	loaded   bool
+	merging  bool
+	closed   bool
+}
+
+func newReportQueue(maxLength, maxBytes int, dir string) *reportQueue {
+	if maxLength < 2 {
+		maxLength = defaultQueueLength
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultQueueBytes
+	}
+	q := &reportQueue{
+		maxLength: maxLength,
+		maxBytes:  maxBytes,
+		dir:       dir,
+		nextSeq:   1,
+	}
+	q.cond = sync.NewCond(&q.mtx)
+	return q
+}
+
+// setDir sets where the queue is kept, if it hasn't been loaded yet, and
+// returns whether it did.
+func (q *reportQueue) setDir(dir string) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.loaded {
+		return false
+	}
+	q.dir = dir
+	return true
+}
+
+// load reads any reports left queued in dir by a previous run. Only the
+// first call does anything.
+func (q *reportQueue) load() error {
+	q.mtx.Lock()
+	dir, loaded := q.dir, q.loaded
+	q.loaded = true
+	q.mtx.Unlock()
+	if dir == "" || loaded {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	seqs := []uint64{}
+	queued := map[uint64]time.Time{}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, queueFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+		queued[seq] = file.ModTime()
+	}
+	sort.Sort(uint64s(seqs))
+
+	entries := []queueEntry{}
+	for _, seq := range seqs {
+		buf, err := ioutil.ReadFile(q.filename(seq))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, queueEntry{seq: seq, buf: buf, queued: queued[seq]})
+	}
+	if len(entries) > 0 {
+		log.Infof("Loaded %d queued reports from %s", len(entries), dir)
+	}
+
+	// Reports loaded from disk are older than any queued since, so go first,
+	// and the sequence carries on from them.
+	q.mtx.Lock()
+	for _, e := range q.entries {
+		q.remove(e)
+	}
+	q.entries = append(entries, q.entries...)
+	q.renumber(len(entries))
+	for _, e := range entries {
+		q.size += len(e.buf)
+	}
+	q.cond.Broadcast()
+	q.mtx.Unlock()
+	q.trim()
+	return nil
+}
+
+// adopt takes over the reports queued by another, stopped, queue, such as
+// that of a client for an app which has been replaced. They are older than
+// this queue's own, so go ahead of them, behind any report being published.
+func (q *reportQueue) adopt(old *reportQueue) {
+	if err := old.load(); err != nil {
+		log.Errorf("Error loading queued reports to hand over: %v", err)
+	}
+	if err := q.load(); err != nil {
+		log.Errorf("Error loading queued reports: %v", err)
+	}
+
+	old.mtx.Lock()
+	entries := old.entries
+	for _, e := range entries {
+		old.remove(e)
+	}
+	old.entries, old.size = nil, 0
+	if old.dir != "" {
+		os.Remove(old.dir) // only if it's empty
+	}
+	old.mtx.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	q.mtx.Lock()
+	i := q.oldest()
+	for _, e := range q.entries[i:] {
+		q.remove(e)
+	}
+	q.entries = append(q.entries[:i], append(entries, q.entries[i:]...)...)
+	q.renumber(i)
+	for _, e := range entries {
+		q.size += len(e.buf)
+	}
+	q.cond.Broadcast()
+	q.mtx.Unlock()
+	q.trim()
+}
+
+// renumber gives the entries from i on new sequence numbers, after all those
+// in use, and writes them out again. Must be called with mtx held, once their
+// old files have been removed.
+func (q *reportQueue) renumber(i int) {
+	for _, e := range q.entries {
+		if e.seq >= q.nextSeq {
+			q.nextSeq = e.seq + 1
+		}
+	}
+	for ; i < len(q.entries); i++ {
+		q.entries[i].seq = q.nextSeq
+		q.nextSeq++
+		q.write(q.entries[i])
+	}
+}
+
+func (q *reportQueue) filename(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueFileSuffix))
+}
+
+func (q *reportQueue) write(e queueEntry) {
+	if q.dir == "" {
+		return
+	}
+	name := q.filename(e.seq)
+	if err := ioutil.WriteFile(name, e.buf, 0600); err != nil {
+		log.Errorf("Error writing queued report: %v", err)
+		return
+	}
+	if err := os.Chtimes(name, e.queued, e.queued); err != nil {
+		log.Errorf("Error writing queued report: %v", err)
+	}
+}
+
+func (q *reportQueue) remove(e queueEntry) {
+	if q.dir == "" {
+		return
+	}
+	if err := os.Remove(q.filename(e.seq)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Error removing queued report: %v", err)
+	}
+}
+
+// push adds a serialised report to the back of the queue.
+func (q *reportQueue) push(buf []byte) {
+	q.mtx.Lock()
+	if q.closed {
+		q.mtx.Unlock()
+		return
+	}
+	e := queueEntry{seq: q.nextSeq, buf: buf, queued: time.Now()}
+	q.nextSeq++
+	q.entries = append(q.entries, e)
+	q.size += len(buf)
+	q.write(e)
+	q.cond.Broadcast()
+	q.mtx.Unlock()
+	q.trim()
+}
+
+// trim coalesces and drops reports until the queue is within its bounds.
+// The report being published is left alone. Merging reports is slow, so it
+// is done without holding mtx, one pair at a time; if the pair changes in the
+// meantime, the merge is thrown away.
+func (q *reportQueue) trim() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.merging {
+		// Whoever is merging trims whatever is pushed meanwhile.
+		return
+	}
+	q.merging = true
+	defer func() {
+		q.merging = false
+		metrics.SetGauge(queueDepthKey, float32(len(q.entries)))
+		metrics.SetGauge(queueBytesKey, float32(q.size))
+	}()
+
+	for len(q.entries) > q.maxLength {
+		i := q.oldest()
+		if i+1 >= len(q.entries) {
+			break
+		}
+		older, newer := q.entries[i], q.entries[i+1]
+		q.mtx.Unlock()
+		buf, err := coalesce(older.buf, newer.buf)
+		q.mtx.Lock()
+		if i = q.index(older.seq); i < 0 || i != q.oldest() || i+1 >= len(q.entries) || q.entries[i+1].seq != newer.seq {
+			continue
+		}
+		if err != nil {
+			log.Errorf("Error merging queued reports, dropping one: %v", err)
+			q.drop(i)
+			continue
+		}
+		q.size += len(buf) - len(older.buf) - len(newer.buf)
+		q.entries[i+1].buf = buf // still queued when the newer one was
+		q.entries = append(q.entries[:i], q.entries[i+1:]...)
+		q.remove(older)
+		q.write(q.entries[i])
+		metrics.IncrCounter(queueCoalescedKey, 1)
+	}
+
+	for q.size > q.maxBytes {
+		i := q.oldest()
+		if i+1 >= len(q.entries) {
+			// Always keep the newest report
+			return
+		}
+		q.drop(i)
+	}
+}
+
+// index returns the index of the entry with the given seq, or -1. Must be
+// called with mtx held.
+func (q *reportQueue) index(seq uint64) int {
+	for i, e := range q.entries {
+		if e.seq == seq {
+			return i
+		}
+	}
+	return -1
+}
+
+// oldest returns the index of the oldest entry that isn't being published.
+func (q *reportQueue) oldest() int {
+	if len(q.entries) > 0 && q.entries[0].seq == q.inflight {
+		return 1
+	}
+	return 0
+}
+
+func (q *reportQueue) drop(i int) {
+	e := q.entries[i]
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	q.size -= len(e.buf)
+	q.remove(e)
+	metrics.IncrCounter(queueDroppedKey, 1)
+	log.Warnf("Dropped queued report (%d bytes)", len(e.buf))
+}
+
+// peek waits for the report at the front of the queue, and marks it as being
+// published. It returns false once the queue is closed.
+func (q *reportQueue) peek() (queueEntry, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for len(q.entries) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return queueEntry{}, false
+	}
+	q.inflight = q.entries[0].seq
+	return q.entries[0], true
+}
+
+// pop removes a report returned by peek once it has been published (or
+// rejected outright).
+func (q *reportQueue) pop(e queueEntry) {
+	q.mtx.Lock()
+	q.inflight = 0
+	if len(q.entries) > 0 && q.entries[0].seq == e.seq {
+		q.entries = q.entries[1:]
+		q.size -= len(e.buf)
+		q.remove(e)
+	}
+	q.mtx.Unlock()
+	q.trim()
+}
+
+// release marks a report returned by peek as no longer being published,
+// leaving it at the front of the queue.
+func (q *reportQueue) release() {
+	q.mtx.Lock()
+	q.inflight = 0
+	q.mtx.Unlock()
+	q.trim()
+}
+
+func (q *reportQueue) len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.entries)
+}
+
+// close wakes up anyone waiting in peek. Queued reports stay on disk.
+func (q *reportQueue) close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,211 @@
+package appclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/report"
+)
+
+func queuedReport(t *testing.T, nodeID string, window time.Duration) []byte {
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(nodeID))
+	rpt.Window = window
+	buf, err := encodeReport(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func peekReport(t *testing.T, q *reportQueue) (queueEntry, report.Report) {
+	e, ok := q.peek()
+	if !ok {
+		t.Fatal("queue closed")
+	}
+	rpt, err := decodeReport(e.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, rpt
+}
+
+func TestReportQueueCoalesces(t *testing.T) {
+	q := newReportQueue(3, 0, "")
+	for _, id := range []string{"a", "b", "c", "d"} {
+		q.push(queuedReport(t, id, time.Second))
+	}
+	if q.len() != 3 {
+		t.Fatalf("Expected 3 queued reports, got %d", q.len())
+	}
+
+	// The two oldest have been merged, windows and all.
+	e, rpt := peekReport(t, q)
+	if len(rpt.Host.Nodes) != 2 || rpt.Window != 2*time.Second {
+		t.Errorf("Expected a and b merged over 2s, got %v over %v", rpt.Host.Nodes, rpt.Window)
+	}
+
+	// The report being published isn't merged into, even when the queue
+	// fills up again.
+	q.push(queuedReport(t, "e", time.Second))
+	if q.len() != 3 {
+		t.Fatalf("Expected 3 queued reports, got %d", q.len())
+	}
+	q.pop(e)
+	_, rpt = peekReport(t, q)
+	if _, ok := rpt.Host.Nodes["c"]; !ok || len(rpt.Host.Nodes) != 2 || rpt.Window != 2*time.Second {
+		t.Errorf("Expected c and d merged over 2s, got %v over %v", rpt.Host.Nodes, rpt.Window)
+	}
+}
+
+func TestReportQueueDrops(t *testing.T) {
+	size := len(queuedReport(t, "a", 0))
+	q := newReportQueue(10, 2*size+size/2, "")
+	for _, id := range []string{"a", "b", "c"} {
+		q.push(queuedReport(t, id, 0))
+	}
+	if q.len() != 2 {
+		t.Fatalf("Expected 2 queued reports, got %d", q.len())
+	}
+	_, rpt := peekReport(t, q)
+	if _, ok := rpt.Host.Nodes["b"]; !ok {
+		t.Errorf("Expected the oldest report to be dropped, got %v", rpt.Host.Nodes)
+	}
+
+	// A failed publish leaves the report queued
+	q.release()
+	if q.len() != 2 {
+		t.Errorf("Expected 2 queued reports, got %d", q.len())
+	}
+}
+
+func TestReportQueueOnDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := newReportQueue(10, 0, dir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		q.push(queuedReport(t, id, 0))
+	}
+	e, _ := peekReport(t, q)
+	q.pop(e)
+	q.close()
+
+	// A new queue picks up where the old one left off
+	q = newReportQueue(10, 0, dir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	q.push(queuedReport(t, "d", 0))
+	for _, want := range []string{"b", "c", "d"} {
+		e, rpt := peekReport(t, q)
+		if _, ok := rpt.Host.Nodes[want]; !ok {
+			t.Errorf("Expected %s, got %v", want, rpt.Host.Nodes)
+		}
+		q.pop(e)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected published reports to be removed, got %d files", len(files))
+	}
+}
+
+func TestReportQueueAdopt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+
+	old := newReportQueue(10, 0, oldDir)
+	if err := old.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		old.push(queuedReport(t, id, 0))
+	}
+	old.close()
+
+	// The old reports go behind the one being published, but ahead of the
+	// rest.
+	q := newReportQueue(10, 0, newDir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c", "d"} {
+		q.push(queuedReport(t, id, 0))
+	}
+	e, _ := peekReport(t, q)
+	q.adopt(old)
+	q.pop(e)
+	if _, err := os.Stat(oldDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the old queue's directory to be removed, got %v", err)
+	}
+
+	// ...and on disk, in the same order
+	q.close()
+	q = newReportQueue(10, 0, newDir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "b", "d"} {
+		e, rpt := peekReport(t, q)
+		if _, ok := rpt.Host.Nodes[want]; !ok {
+			t.Errorf("Expected %s, got %v", want, rpt.Host.Nodes)
+		}
+		q.pop(e)
+	}
+}
+
+func TestReportQueueKeepsQueuedTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := newReportQueue(2, 0, dir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		q.push(queuedReport(t, id, 0))
+	}
+	e, _ := peekReport(t, q)
+	q.close()
+
+	// Reports loaded again count as queued when they first were, so the
+	// app can be told how long they've waited.
+	q = newReportQueue(2, 0, dir)
+	if err := q.load(); err != nil {
+		t.Fatal(err)
+	}
+	have, _ := peekReport(t, q)
+	if !have.queued.Equal(e.queued) {
+		t.Errorf("want %v, have %v", e.queued, have.queued)
+	}
+	buf, err := withDelay(have.buf, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpt, err := decodeReport(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpt.Delay != time.Minute {
+		t.Errorf("want %v, have %v", time.Minute, rpt.Delay)
+	}
+}
@@ -1,7 +1,9 @@
 package appclient
 
 import (
+	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +16,18 @@ import (
 
 const (
 	dnsPollInterval = 10 * time.Second
+
+	// SRVPrefix marks targets which are DNS SRV record names, e.g.
+	// dnssrv+_app._tcp.scope.example.com. Apps are found at the port, and
+	// with the priority and weight, in the records.
+	SRVPrefix = "dnssrv+"
+
+	// KubernetesPrefix marks targets which are Kubernetes services, as
+	// kubernetes+namespace/service[:port]. Apps are the service's
+	// endpoints, which are watched so probes follow apps being added and
+	// removed right away. The port is a name or number, and may be left
+	// out if the service has only one.
+	KubernetesPrefix = "kubernetes+"
 )
 
 var (
@@ -27,34 +41,93 @@ type Resolver interface {
 	Stop()
 }
 
-type staticResolver struct {
-	setters []setter
-	targets []target
-	quit    chan struct{}
-	lookup  LookupIP
-}
-
 // LookupIP type is used for looking up IPs.
 type LookupIP func(host string) (ips []net.IP, err error)
 
-type target struct{ host, port string }
+// LookupSRV type is used for looking up SRV records by their full name.
+type LookupSRV func(name string) (addrs []*net.SRV, err error)
+
+// WatchEndpoints type is used for watching the endpoints ("ip:port") of a
+// Kubernetes service. It calls f with the endpoints whenever they change,
+// until stop is called.
+type WatchEndpoints func(namespace, service, port string, f func(endpoints []string)) (stop func(), err error)
+
+// ResolverConfig is the config for a resolver.
+type ResolverConfig struct {
+	Targets []string
+	Lookup  LookupIP
+	// LookupSRV defaults to the system resolver.
+	LookupSRV LookupSRV
+	// Kubernetes targets are ignored without WatchEndpoints.
+	WatchEndpoints WatchEndpoints
+	Set            setter
+}
+
+type staticResolver struct {
+	ResolverConfig
+	targets  []target
+	services []service
+	quit     chan struct{}
+	updates  chan update
+	stops    []func()
+
+	// hostnames last set from SRV records, so we can unset them when the
+	// records go away; only touched by the loop.
+	srvHostnames map[string]struct{}
+}
+
+type target struct {
+	host, port string
+	srv        bool // host is the name of SRV records giving the port
+}
 
 func (t target) String() string { return net.JoinHostPort(t.host, t.port) }
 
+// service is a Kubernetes service whose endpoints are apps.
+type service struct{ namespace, name, port string }
+
+// hostname is the service's DNS name, and its port if given, or the usual
+// app port if not. Probes check apps' certificates against it.
+func (s service) hostname() string {
+	port := s.port
+	if _, err := strconv.Atoi(port); err != nil {
+		port = strconv.Itoa(xfer.AppPort)
+	}
+	return net.JoinHostPort(s.name+"."+s.namespace+".svc", port)
+}
+
+type update struct {
+	hostname  string
+	endpoints []string
+}
+
 // NewResolver periodically resolves the targets, and calls the set
 // function with all the resolved IPs. It explictiy supports targets which
 // resolve to multiple IPs.  It uses the supplied DNS server name.
-func NewResolver(targets []string, lookup LookupIP, setters ...setter) Resolver {
-	r := staticResolver{
-		targets: prepare(targets),
-		setters: setters,
-		quit:    make(chan struct{}),
-		lookup:  lookup,
+// Kubernetes services are watched instead, and set as soon as they change.
+func NewResolver(config ResolverConfig) Resolver {
+	if config.LookupSRV == nil {
+		config.LookupSRV = lookupSRV
+	}
+	targets, services := prepare(config.Targets)
+	r := &staticResolver{
+		ResolverConfig: config,
+		targets:        targets,
+		services:       services,
+		quit:           make(chan struct{}),
+		updates:        make(chan update),
+		srvHostnames:   map[string]struct{}{},
 	}
+	r.watch()
 	go r.loop()
 	return r
 }
 
+func lookupSRV(name string) ([]*net.SRV, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	return addrs, err
+}
+
 // LookupUsing produces a LookupIP function for the given DNS server.
 func LookupUsing(dnsServer string) func(host string) (ips []net.IP, err error) {
 	client := dns.Client{
@@ -77,26 +150,95 @@ func LookupUsing(dnsServer string) func(host string) (ips []net.IP, err error) {
 	}
 }
 
-func (r staticResolver) loop() {
+// LookupSRVUsing produces a LookupSRV function for the given DNS server.
+func LookupSRVUsing(dnsServer string) LookupSRV {
+	client := dns.Client{
+		Net: "tcp",
+	}
+	return func(name string) ([]*net.SRV, error) {
+		m := &dns.Msg{}
+		m.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
+		in, _, err := client.Exchange(m, dnsServer)
+		if err != nil {
+			return nil, err
+		}
+		result := []*net.SRV{}
+		for _, answer := range in.Answer {
+			if srv, ok := answer.(*dns.SRV); ok {
+				result = append(result, &net.SRV{
+					Target:   srv.Target,
+					Port:     srv.Port,
+					Priority: srv.Priority,
+					Weight:   srv.Weight,
+				})
+			}
+		}
+		return result, nil
+	}
+}
+
+func (r *staticResolver) watch() {
+	for _, s := range r.services {
+		if r.WatchEndpoints == nil {
+			log.Errorf("Can't watch Kubernetes service %s/%s: Kubernetes is not available", s.namespace, s.name)
+			continue
+		}
+		hostname := s.hostname()
+		stop, err := r.WatchEndpoints(s.namespace, s.name, s.port, func(endpoints []string) {
+			select {
+			case r.updates <- update{hostname, endpoints}:
+			case <-r.quit:
+			}
+		})
+		if err != nil {
+			log.Errorf("Error watching Kubernetes service %s/%s: %v", s.namespace, s.name, err)
+			continue
+		}
+		r.stops = append(r.stops, stop)
+	}
+}
+
+func (r *staticResolver) loop() {
 	r.resolve()
 	t := tick(dnsPollInterval)
 	for {
 		select {
 		case <-t:
 			r.resolve()
+		case u := <-r.updates:
+			r.Set(u.hostname, u.endpoints)
 		case <-r.quit:
 			return
 		}
 	}
 }
 
-func (r staticResolver) Stop() {
+func (r *staticResolver) Stop() {
+	for _, stop := range r.stops {
+		stop()
+	}
 	close(r.quit)
 }
 
-func prepare(strs []string) []target {
-	var targets []target
+func prepare(strs []string) ([]target, []service) {
+	var (
+		targets  []target
+		services []service
+	)
 	for _, s := range strs {
+		switch {
+		case strings.HasPrefix(s, SRVPrefix):
+			targets = append(targets, target{host: strings.TrimPrefix(s, SRVPrefix), srv: true})
+			continue
+		case strings.HasPrefix(s, KubernetesPrefix):
+			svc, err := parseService(strings.TrimPrefix(s, KubernetesPrefix))
+			if err != nil {
+				log.Errorf("invalid Kubernetes service %s: %v", s, err)
+				continue
+			}
+			services = append(services, svc)
+			continue
+		}
 		var host, port string
 		if strings.Contains(s, ":") {
 			var err error
@@ -108,34 +250,107 @@ func prepare(strs []string) []target {
 		} else {
 			host, port = s, strconv.Itoa(xfer.AppPort)
 		}
-		targets = append(targets, target{host, port})
+		targets = append(targets, target{host: host, port: port})
+	}
+	return targets, services
+}
+
+func parseService(s string) (service, error) {
+	var result service
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return result, fmt.Errorf("expected namespace/service[:port]")
+	}
+	result.namespace, result.name = parts[0], parts[1]
+	if i := strings.Index(result.name, ":"); i >= 0 {
+		result.name, result.port = result.name[:i], result.name[i+1:]
+	}
+	return result, nil
+}
+
+func (r *staticResolver) resolve() {
+	srvHostnames := map[string]struct{}{}
+	for _, t := range r.targets {
+		if !t.srv {
+			r.Set(t.String(), r.resolveOne(t))
+			continue
+		}
+		for hostname, endpoints := range r.resolveSRV(t.host) {
+			r.Set(hostname, endpoints)
+			srvHostnames[hostname] = struct{}{}
+		}
 	}
-	return targets
+	for hostname := range r.srvHostnames {
+		if _, ok := srvHostnames[hostname]; !ok {
+			r.Set(hostname, []string{})
+		}
+	}
+	r.srvHostnames = srvHostnames
 }
 
-func (r staticResolver) resolve() {
-	for t, endpoints := range r.resolveMany(r.targets) {
-		for _, setter := range r.setters {
-			setter(t.String(), endpoints)
+// resolveSRV resolves SRV records to endpoints, by the hostname of each
+// record. Probes publish to every app, so only the records with the lowest
+// priority which resolve are used, and weights only matter in that records
+// with zero weight are left out if others have some.
+func (r *staticResolver) resolveSRV(name string) map[string][]string {
+	records, err := r.LookupSRV(name)
+	if err != nil {
+		log.Debugf("Error resolving SRV records %s: %v", name, err)
+		return nil
+	}
+	sort.Sort(byPriority(records))
+	for i := 0; i < len(records); {
+		j := i + 1
+		for j < len(records) && records[j].Priority == records[i].Priority {
+			j++
 		}
+		result := map[string][]string{}
+		for _, record := range weighted(records[i:j]) {
+			// A target of "." means the service isn't available
+			host := strings.TrimSuffix(record.Target, ".")
+			if host == "" {
+				continue
+			}
+			t := target{host: host, port: strconv.Itoa(int(record.Port))}
+			if endpoints := r.resolveOne(t); len(endpoints) > 0 {
+				result[t.String()] = endpoints
+			}
+		}
+		if len(result) > 0 {
+			return result
+		}
+		i = j
 	}
+	return nil
 }
 
-func (r staticResolver) resolveMany(targets []target) map[target][]string {
-	result := map[target][]string{}
-	for _, t := range targets {
-		result[t] = r.resolveOne(t)
+type byPriority []*net.SRV
+
+func (s byPriority) Len() int           { return len(s) }
+func (s byPriority) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPriority) Less(i, j int) bool { return s[i].Priority < s[j].Priority }
+
+// weighted leaves out records with zero weight, unless they all have it.
+func weighted(records []*net.SRV) []*net.SRV {
+	var result []*net.SRV
+	for _, record := range records {
+		if record.Weight > 0 {
+			result = append(result, record)
+		}
+	}
+	if len(result) == 0 {
+		return records
 	}
 	return result
 }
 
-func (r staticResolver) resolveOne(t target) []string {
+func (r *staticResolver) resolveOne(t target) []string {
 	var addrs []net.IP
 	if addr := net.ParseIP(t.host); addr != nil {
 		addrs = []net.IP{addr}
 	} else {
 		var err error
-		addrs, err = r.lookup(t.host)
+		addrs, err = r.Lookup(t.host)
 		if err != nil {
 			log.Debugf("Error resolving %s: %v", t.host, err)
 			return []string{}
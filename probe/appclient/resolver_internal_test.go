@@ -3,6 +3,7 @@ package appclient
 import (
 	"fmt"
 	"net"
+	"reflect"
 	"runtime"
 	"sync"
 	"testing"
@@ -44,7 +45,11 @@ func TestResolver(t *testing.T) {
 		}
 	}
 
-	r := NewResolver([]string{"symbolic.name" + port, "namewithnoport", ip1 + port, ip2}, lookupIP, set)
+	r := NewResolver(ResolverConfig{
+		Targets: []string{"symbolic.name" + port, "namewithnoport", ip1 + port, ip2},
+		Lookup:  lookupIP,
+		Set:     set,
+	})
 
 	assertAdd := func(want ...string) {
 		remaining := map[string]struct{}{}
@@ -94,6 +99,138 @@ func TestResolver(t *testing.T) {
 	}
 }
 
+func TestResolverSRV(t *testing.T) {
+	oldTick := tick
+	defer func() { tick = oldTick }()
+	c := make(chan time.Time)
+	tick = func(_ time.Duration) <-chan time.Time { return c }
+
+	ips := map[string][]net.IP{
+		"app1.example.com": makeIPs("10.0.0.1"),
+		"app2.example.com": makeIPs("10.0.0.2"),
+		"app3.example.com": makeIPs("10.0.0.3"),
+	}
+	lookupIP := func(host string) ([]net.IP, error) {
+		addrs, ok := ips[host]
+		if !ok {
+			return nil, fmt.Errorf("Not found")
+		}
+		return addrs, nil
+	}
+	var (
+		recordsLock sync.Mutex
+		records     []*net.SRV
+	)
+	lookupSRV := func(name string) ([]*net.SRV, error) {
+		recordsLock.Lock()
+		defer recordsLock.Unlock()
+		if name != "_app._tcp.example.com" {
+			return nil, fmt.Errorf("Not found")
+		}
+		return records, nil
+	}
+	setRecords := func(srvs ...*net.SRV) {
+		recordsLock.Lock()
+		defer recordsLock.Unlock()
+		records = srvs
+	}
+	type set struct {
+		hostname  string
+		endpoints []string
+	}
+	sets := make(chan set)
+	assertSets := func(want map[string][]string) {
+		_, _, line, _ := runtime.Caller(1)
+		for len(want) > 0 {
+			select {
+			case s := <-sets:
+				if !reflect.DeepEqual(want[s.hostname], s.endpoints) {
+					t.Errorf("line %d: %s: want %v, got %v", line, s.hostname, want[s.hostname], s.endpoints)
+				}
+				delete(want, s.hostname)
+			case <-time.After(100 * time.Millisecond):
+				t.Fatalf("line %d: didn't get the sets in time: %v", line, want)
+			}
+		}
+	}
+
+	// Only the lowest priority, and records with weight, are used
+	setRecords(
+		&net.SRV{Target: "app1.example.com.", Port: 4041, Priority: 10, Weight: 5},
+		&net.SRV{Target: "app3.example.com.", Port: 4043, Priority: 20, Weight: 5},
+		&net.SRV{Target: "app2.example.com.", Port: 4042, Priority: 10, Weight: 0},
+	)
+	r := NewResolver(ResolverConfig{
+		Targets:   []string{SRVPrefix + "_app._tcp.example.com"},
+		Lookup:    lookupIP,
+		LookupSRV: lookupSRV,
+		Set: func(hostname string, endpoints []string) {
+			sets <- set{hostname, endpoints}
+		},
+	})
+	defer r.Stop()
+	assertSets(map[string][]string{"app1.example.com:4041": {"10.0.0.1:4041"}})
+
+	// Higher priorities are fallen back on if the lowest don't resolve, and
+	// records which have gone are unset
+	setRecords(
+		&net.SRV{Target: "missing.example.com.", Port: 4040, Priority: 10, Weight: 5},
+		&net.SRV{Target: "app3.example.com.", Port: 4043, Priority: 20, Weight: 5},
+	)
+	c <- time.Now()
+	assertSets(map[string][]string{
+		"app3.example.com:4043": {"10.0.0.3:4043"},
+		"app1.example.com:4041": {},
+	})
+}
+
+func TestResolverKubernetes(t *testing.T) {
+	var (
+		watched string
+		update  func([]string)
+		stopped bool
+	)
+	watch := func(namespace, service, port string, f func([]string)) (func(), error) {
+		watched, update = namespace+"/"+service+":"+port, f
+		return func() { stopped = true }, nil
+	}
+	sets := make(chan []string)
+	r := NewResolver(ResolverConfig{
+		Targets:        []string{KubernetesPrefix + "weave/weave-scope-app:app", KubernetesPrefix + "invalid"},
+		WatchEndpoints: watch,
+		Set: func(hostname string, endpoints []string) {
+			if hostname != "weave-scope-app.weave.svc:4040" {
+				t.Errorf("Unexpected hostname %s", hostname)
+			}
+			sets <- endpoints
+		},
+	})
+	if watched != "weave/weave-scope-app:app" {
+		t.Fatalf("Expected to watch weave/weave-scope-app:app, got %q", watched)
+	}
+
+	// Changes are set right away, without waiting for a tick
+	for _, want := range [][]string{
+		{"10.32.0.1:4040", "10.32.0.2:4040"},
+		{"10.32.0.2:4040"},
+	} {
+		go update(want)
+		select {
+		case have := <-sets:
+			if !reflect.DeepEqual(want, have) {
+				t.Errorf("Want %v, got %v", want, have)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("Didn't get the endpoints in time")
+		}
+	}
+
+	r.Stop()
+	if !stopped {
+		t.Error("Expected watch to be stopped")
+	}
+}
+
 func makeIPs(addrs ...string) []net.IP {
 	var ips []net.IP
 	for _, addr := range addrs {
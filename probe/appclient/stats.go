@@ -0,0 +1,41 @@
+package appclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats describe the reports the probe has published recently, so it can
+// report on its own overhead.
+type Stats struct {
+	// ReportBytes is the size of the last report published, compressed.
+	ReportBytes int
+
+	// PublishLatency is how long the last successful publish to an app
+	// took.
+	PublishLatency time.Duration
+}
+
+var (
+	statsMtx sync.Mutex
+	stats    Stats
+)
+
+// GetStats returns the latest Stats.
+func GetStats() Stats {
+	statsMtx.Lock()
+	defer statsMtx.Unlock()
+	return stats
+}
+
+func recordReportBytes(n int) {
+	statsMtx.Lock()
+	defer statsMtx.Unlock()
+	stats.ReportBytes = n
+}
+
+func recordPublishLatency(d time.Duration) {
+	statsMtx.Lock()
+	defer statsMtx.Unlock()
+	stats.PublishLatency = d
+}
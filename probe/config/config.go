@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+
+	"github.com/weaveworks/scope/probe/redact"
+)
+
+// Config is the configuration of a probe. It mirrors the probe's command line
+// flags, which give the defaults for anything not set in a config file.
+type Config struct {
+	Token           string   `json:"token,omitempty"`
+	HTTPListen      string   `json:"http_listen,omitempty"`
+	SpyInterval     Duration `json:"spy_interval"`
+	PublishInterval Duration `json:"publish_interval"`
+	Processes       bool     `json:"processes"`
+	ProcRoot        string   `json:"proc_root"`
+	Conntrack       bool     `json:"conntrack"`
+	Insecure        bool     `json:"insecure"`
+	Resolver        string   `json:"resolver,omitempty"`
+	Stream          bool     `json:"stream"`
+
+	Log        LogConfig        `json:"log"`
+	Queue      QueueConfig      `json:"queue"`
+	TLS        TLSConfig        `json:"tls"`
+	Redact     RedactConfig     `json:"redact"`
+	Plugins    PluginsConfig    `json:"plugins"`
+	Docker     DockerConfig     `json:"docker"`
+	Kubernetes KubernetesConfig `json:"kubernetes"`
+	Systemd    SystemdConfig    `json:"systemd"`
+	Weave      WeaveConfig      `json:"weave"`
+
+	// Schedules say how often reporters run, and how long they may take,
+	// by reporter name, e.g. "Kubernetes". Other reporters run every
+	// spy_interval.
+	Schedules map[string]ScheduleConfig `json:"schedules,omitempty"`
+}
+
+// LogConfig configures the probe's logging.
+type LogConfig struct {
+	Level  string `json:"level"`
+	Prefix string `json:"prefix"`
+}
+
+// QueueConfig configures how reports are queued while apps are unreachable.
+type QueueConfig struct {
+	Length int    `json:"length"`
+	Bytes  int    `json:"bytes"`
+	Dir    string `json:"dir,omitempty"`
+}
+
+// TLSConfig configures mutual TLS with apps. If Cert is set, the probe
+// presents it to apps, and uses its common name as the probe ID; the files
+// are reloaded when they change, so certificates can be rotated. If CA is
+// set, apps' certificates are verified against it.
+type TLSConfig struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	CA   string `json:"ca,omitempty"`
+}
+
+// RedactConfig configures how sensitive data, such as passwords in
+// environment variables and command lines, is redacted from reports before
+// they are published. Keys and Values add to the default rules; see
+// redact.Rules.
+type RedactConfig struct {
+	Enabled    bool                            `json:"enabled"`
+	Keys       []string                        `json:"keys,omitempty"`
+	Values     []string                        `json:"values,omitempty"`
+	Tokens     bool                            `json:"tokens"`
+	Topologies map[string]RedactTopologyConfig `json:"topologies,omitempty"`
+}
+
+// RedactTopologyConfig lists the keys in a topology which are never (Allow)
+// or always (Deny) redacted.
+type RedactTopologyConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Rules returns the redaction rules. If redaction isn't enabled, nothing is
+// redacted.
+func (c RedactConfig) Rules() redact.Rules {
+	if !c.Enabled {
+		return redact.Rules{}
+	}
+	rules := redact.Rules{
+		Defaults:   true,
+		Keys:       c.Keys,
+		Values:     c.Values,
+		Tokens:     c.Tokens,
+		Topologies: map[string]redact.TopologyRules{},
+	}
+	for name, t := range c.Topologies {
+		rules.Topologies[name] = redact.TopologyRules{Allow: t.Allow, Deny: t.Deny}
+	}
+	return rules
+}
+
+// PluginsConfig configures where the probe looks for plugins, and which it
+// loads. If Allow is nil, all plugins are loaded.
+type PluginsConfig struct {
+	Enabled bool     `json:"enabled"`
+	Root    string   `json:"root"`
+	Allow   []string `json:"allow,omitempty"`
+}
+
+// DockerConfig configures the Docker integration.
+type DockerConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Interval Duration `json:"interval"`
+	Bridge   string   `json:"bridge"`
+}
+
+// KubernetesConfig configures the Kubernetes integration. With
+// LeaderElection, it can be enabled on every probe: they elect one, using
+// the Endpoints object named by LeaderLock as [namespace/]name, to report
+// the cluster-wide topologies.
+type KubernetesConfig struct {
+	Enabled        bool     `json:"enabled"`
+	API            string   `json:"api,omitempty"`
+	Interval       Duration `json:"interval"`
+	LeaderElection bool     `json:"leader_election"`
+	LeaderLock     string   `json:"leader_lock,omitempty"`
+}
+
+// SystemdConfig configures the systemd integration.
+type SystemdConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CgroupRoot string `json:"cgroup_root"`
+}
+
+// WeaveConfig configures the Weave Net integration. It is disabled if Addr
+// is empty.
+type WeaveConfig struct {
+	Addr     string `json:"addr"`
+	Hostname string `json:"hostname"`
+}
+
+// ScheduleConfig configures how often a reporter runs, and how long it may
+// take before the probe uses its last good report instead. Unset values
+// default to the spy interval, and the reporter's interval, respectively.
+type ScheduleConfig struct {
+	Interval Duration `json:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"`
+}
+
+// Duration is a time.Duration written as a string, e.g. "10s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"10s\", not %s", b)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Load reads a YAML or JSON config file. Anything not in the file is taken
+// from defaults.
+func Load(path string, defaults Config) (Config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(buf, defaults)
+}
+
+// Parse parses a YAML or JSON config. Anything not in it is taken from
+// defaults.
+func Parse(buf []byte, defaults Config) (Config, error) {
+	cfg := defaults
+	if len(bytes.TrimSpace(buf)) > 0 {
+		j, err := yaml.YAMLToJSON(buf)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := checkFields(j, &cfg); err != nil {
+			return Config{}, err
+		}
+		if err := json.Unmarshal(j, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the config makes sense.
+func (c Config) Validate() error {
+	errs := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.SpyInterval > 0, "spy_interval must be positive")
+	check(c.PublishInterval > 0, "publish_interval must be positive")
+	check(c.ProcRoot != "", "proc_root must be set")
+	_, err := log.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: %v", err)
+	check(c.Queue.Length >= 0, "queue.length must not be negative")
+	check(c.Queue.Bytes >= 0, "queue.bytes must not be negative")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key must be set together")
+	err = c.Redact.Rules().Validate()
+	check(err == nil, "redact: %v", err)
+	check(!c.Plugins.Enabled || c.Plugins.Root != "", "plugins.root must be set")
+	check(!c.Docker.Enabled || c.Docker.Interval > 0, "docker.interval must be positive")
+	check(!c.Kubernetes.Enabled || c.Kubernetes.Interval > 0, "kubernetes.interval must be positive")
+	check(!c.Kubernetes.LeaderElection || c.Kubernetes.LeaderLock != "", "kubernetes.leader_lock must be set")
+	check(!c.Systemd.Enabled || c.Systemd.CgroupRoot != "", "systemd.cgroup_root must be set")
+	for _, name := range sortedScheduleNames(c.Schedules) {
+		s := c.Schedules[name]
+		check(s.Interval >= 0, "schedules.%s.interval must not be negative", name)
+		check(s.Timeout >= 0, "schedules.%s.timeout must not be negative", name)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sortedScheduleNames(schedules map[string]ScheduleConfig) []string {
+	names := []string{}
+	for name := range schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NeedsRestart lists the settings which differ in next, but which can't be
+// changed without restarting the probe.
+func (c Config) NeedsRestart(next Config) []string {
+	result := []string{}
+	for _, setting := range []struct {
+		name       string
+		have, want interface{}
+	}{
+		{"token", c.Token, next.Token},
+		{"http_listen", c.HTTPListen, next.HTTPListen},
+		{"processes", c.Processes, next.Processes},
+		{"proc_root", c.ProcRoot, next.ProcRoot},
+		{"conntrack", c.Conntrack, next.Conntrack},
+		{"insecure", c.Insecure, next.Insecure},
+		{"resolver", c.Resolver, next.Resolver},
+		{"stream", c.Stream, next.Stream},
+		{"log.prefix", c.Log.Prefix, next.Log.Prefix},
+		{"queue", c.Queue, next.Queue},
+		{"tls", c.TLS, next.TLS},
+	} {
+		if !reflect.DeepEqual(setting.have, setting.want) {
+			result = append(result, setting.name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,241 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/config"
+	"github.com/weaveworks/scope/test"
+)
+
+var defaults = config.Config{
+	SpyInterval:     config.Duration(time.Second),
+	PublishInterval: config.Duration(3 * time.Second),
+	Processes:       true,
+	ProcRoot:        "/proc",
+	Log:             config.LogConfig{Level: "info", Prefix: "<probe>"},
+	Plugins:         config.PluginsConfig{Enabled: true, Root: "/var/run/scope/plugins"},
+	Docker:          config.DockerConfig{Interval: config.Duration(10 * time.Second), Bridge: "docker0"},
+	Kubernetes:      config.KubernetesConfig{Interval: config.Duration(10 * time.Second)},
+}
+
+func TestParse(t *testing.T) {
+	have, err := config.Parse([]byte(`
+publish_interval: 5s
+log:
+  level: debug
+docker:
+  enabled: true
+  interval: 30s
+schedules:
+  Kubernetes:
+    interval: 30s
+    timeout: 5s
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaults
+	want.PublishInterval = config.Duration(5 * time.Second)
+	want.Log.Level = "debug"
+	want.Docker.Enabled = true
+	want.Docker.Interval = config.Duration(30 * time.Second)
+	want.Schedules = map[string]config.ScheduleConfig{
+		"Kubernetes": {Interval: config.Duration(30 * time.Second), Timeout: config.Duration(5 * time.Second)},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// JSON is YAML too
+	have, err = config.Parse([]byte(`{"systemd": {"enabled": true, "cgroup_root": "/sys/fs/cgroup"}}`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have.Systemd.Enabled || have.Systemd.CgroupRoot != "/sys/fs/cgroup" {
+		t.Errorf("Unexpected systemd config: %+v", have.Systemd)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct{ config, err string }{
+		{"dokcer:\n  enabled: true\n", `unknown field "dokcer"`},
+		{"docker:\n  intreval: 5s\n", `unknown field "docker.intreval"`},
+		{"schedules:\n  Kubernetes: {timeuot: 1s}\n", `unknown field "schedules.Kubernetes.timeuot"`},
+		{"spy_interval: 10\n", "durations must be strings"},
+		{"spy_interval: 0s\n", "spy_interval must be positive"},
+		{"log:\n  level: loud\n", "log.level"},
+		{"systemd:\n  enabled: true\n", "systemd.cgroup_root must be set"},
+		{"schedules:\n  Kubernetes: {timeout: -1s}\n", "schedules.Kubernetes.timeout"},
+		{"redact:\n  enabled: true\n  keys: [\"(\"]\n", "redact: error parsing regexp"},
+		{"redact:\n  enabled: true\n  topologies: {containers: {deny: [foo]}}\n", "unknown topology"},
+		{"kubernetes:\n  leader_election: true\n", "kubernetes.leader_lock must be set"},
+	} {
+		_, err := config.Parse([]byte(tc.config), defaults)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.config, tc.err, err)
+		}
+	}
+}
+
+func TestNeedsRestart(t *testing.T) {
+	next := defaults
+	next.Docker.Enabled = true
+	next.Token = "abc"
+	next.Queue.Length = 10
+	if have, want := defaults.NeedsRestart(next), []string{"token", "queue"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "probe-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "probe.yaml")
+	if err := ioutil.WriteFile(path, []byte("publish_interval: 5s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	current, err := config.Load(path, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan config.Config, 10)
+	w := config.NewWatcher(path, defaults, current, 10*time.Millisecond, func(c config.Config) {
+		changes <- c
+	})
+	defer w.Stop()
+
+	// Changing the file is noticed
+	if err := ioutil.WriteFile(path, []byte("publish_interval: 5s\ndocker:\n  enabled: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if !c.Docker.Enabled || c.PublishInterval != config.Duration(5*time.Second) {
+			t.Errorf("Unexpected config: %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+
+	// Invalid configs, and ones which don't change anything, are ignored
+	if err := ioutil.WriteFile(path, []byte("publish_interval: never\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.Reload()
+	if err := ioutil.WriteFile(path, []byte("docker: {enabled: true}\npublish_interval: 5s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.Reload()
+	select {
+	case c := <-changes:
+		t.Errorf("Unexpected change: %+v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !w.Current().Docker.Enabled {
+		t.Errorf("Expected current config to be kept, got %+v", w.Current())
+	}
+}
+
+func TestRemote(t *testing.T) {
+	remote, err := config.ParseRemote([]byte(`
+publish_interval: 10s
+reporters:
+  docker: true
+  plugins: false
+plugins: []
+redact:
+  enabled: true
+  keys: [".*_PIN"]
+  topologies:
+    container:
+      deny: [docker_env_TOKEN_URL]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := remote.Apply(defaults)
+	want := defaults
+	want.PublishInterval = config.Duration(10 * time.Second)
+	want.Docker.Enabled = true
+	want.Plugins.Enabled = false
+	want.Plugins.Allow = []string{}
+	want.Redact = config.RedactConfig{
+		Enabled: true,
+		Keys:    []string{".*_PIN"},
+		Topologies: map[string]config.RedactTopologyConfig{
+			"container": {Deny: []string{"docker_env_TOKEN_URL"}},
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Error(test.Diff(want, have))
+	}
+
+	// Redaction rules are added to the probe's own, which stay in place
+	local := defaults
+	local.Redact = config.RedactConfig{
+		Enabled: true,
+		Keys:    []string{".*_SECRET", ".*_PIN"},
+		Tokens:  true,
+		Topologies: map[string]config.RedactTopologyConfig{
+			"container": {Allow: []string{"docker_env_TOKEN_URL"}},
+		},
+	}
+	want.Redact = config.RedactConfig{
+		Enabled: true,
+		Keys:    []string{".*_SECRET", ".*_PIN"},
+		Tokens:  true,
+		Topologies: map[string]config.RedactTopologyConfig{
+			"container": {Allow: []string{"docker_env_TOKEN_URL"}, Deny: []string{"docker_env_TOKEN_URL"}},
+		},
+	}
+	if have := remote.Apply(local); !reflect.DeepEqual(want.Redact, have.Redact) {
+		t.Error(test.Diff(want.Redact, have.Redact))
+	}
+
+	// The effective config is a remote config too, and applying it changes
+	// nothing.
+	effective := config.Effective(have)
+	if !reflect.DeepEqual(have, effective.Apply(have)) {
+		t.Error(test.Diff(have, effective.Apply(have)))
+	}
+
+	// Versions only depend on the content
+	same, err := config.ParseRemote([]byte(`{"plugins": [], "reporters": {"plugins": false, "docker": true}, "publish_interval": "10s",
+		"redact": {"topologies": {"container": {"deny": ["docker_env_TOKEN_URL"]}}, "keys": [".*_PIN"], "enabled": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Version() != same.Version() {
+		t.Errorf("Expected the same version, got %s and %s", remote.Version(), same.Version())
+	}
+	if remote.Version() == effective.Version() {
+		t.Errorf("Expected different versions, got %s", remote.Version())
+	}
+
+	for _, tc := range []struct{ config, err string }{
+		{"spy_interval: -1s\n", "spy_interval must be at least 100ms"},
+		{"publish_interval: 1ns\n", "publish_interval must be at least 1s"},
+		{"reporters: {dockre: true}\n", `unknown reporter "dockre"`},
+		{"token: abc\n", `unknown field "token"`},
+		{"redact: {enabled: true, topologies: {container: {dney: [x]}}}\n", `unknown field "redact.topologies.container.dney"`},
+		{"redact: {enabled: true, keys: [\"(\"]}\n", "redact: error parsing regexp"},
+		{"redact: {enabled: true, topologies: {contianer: {deny: [x]}}}\n", `redact: unknown topology "contianer"`},
+		{"redact: {enabled: false}\n", "redact: redaction can't be switched off remotely"},
+		{"redact: {enabled: true, topologies: {container: {allow: [x]}}}\n", "redact: topologies: container: keys can't be allowed remotely"},
+	} {
+		_, err := config.ParseRemote([]byte(tc.config))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.config, tc.err, err)
+		}
+	}
+}
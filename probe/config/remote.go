@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// The control apps use to push a Remote config to probes, and its arguments.
+const (
+	RemoteControl    = "probe_config"
+	RemoteVersionArg = "version"
+	RemoteConfigArg  = "config"
+)
+
+// Reporters which can be switched on and off remotely.
+const (
+	DockerReporter     = "docker"
+	KubernetesReporter = "kubernetes"
+	SystemdReporter    = "systemd"
+	PluginsReporter    = "plugins"
+)
+
+var remoteReporters = []string{DockerReporter, KubernetesReporter, SystemdReporter, PluginsReporter}
+
+// The shortest intervals apps may set, so they can't make probes spin.
+const (
+	minRemoteSpyInterval     = 100 * time.Millisecond
+	minRemotePublishInterval = time.Second
+)
+
+// Remote is the part of a probe's config which apps can change while it
+// runs. Anything left out is taken from the probe's own config.
+type Remote struct {
+	SpyInterval     *Duration       `json:"spy_interval,omitempty"`
+	PublishInterval *Duration       `json:"publish_interval,omitempty"`
+	Reporters       map[string]bool `json:"reporters,omitempty"`
+
+	// Plugins is the list of plugin IDs the probe may load. null leaves the
+	// probe's own allow-list in place; [] allows no plugins.
+	Plugins []string `json:"plugins"`
+
+	// Redact adds to the probe's redaction rules, and switches redaction
+	// on. Apps can only tighten what leaves probes: they can't switch
+	// redaction off, or allow keys through.
+	Redact *RedactConfig `json:"redact,omitempty"`
+}
+
+// ParseRemote parses a YAML or JSON remote config.
+func ParseRemote(buf []byte) (Remote, error) {
+	var r Remote
+	if len(bytes.TrimSpace(buf)) > 0 {
+		j, err := yaml.YAMLToJSON(buf)
+		if err != nil {
+			return Remote{}, err
+		}
+		if err := checkFields(j, &r); err != nil {
+			return Remote{}, err
+		}
+		if err := json.Unmarshal(j, &r); err != nil {
+			return Remote{}, err
+		}
+	}
+	if err := r.Validate(); err != nil {
+		return Remote{}, err
+	}
+	return r, nil
+}
+
+// Validate checks the remote config makes sense.
+func (r Remote) Validate() error {
+	errs := []string{}
+	if r.SpyInterval != nil && *r.SpyInterval < Duration(minRemoteSpyInterval) {
+		errs = append(errs, fmt.Sprintf("spy_interval must be at least %v", minRemoteSpyInterval))
+	}
+	if r.PublishInterval != nil && *r.PublishInterval < Duration(minRemotePublishInterval) {
+		errs = append(errs, fmt.Sprintf("publish_interval must be at least %v", minRemotePublishInterval))
+	}
+	for _, name := range sortedKeys(r.Reporters) {
+		if !contains(remoteReporters, name) {
+			errs = append(errs, fmt.Sprintf("reporters: unknown reporter %q (must be one of %s)", name, strings.Join(remoteReporters, ", ")))
+		}
+	}
+	if r.Redact != nil {
+		if !r.Redact.Enabled {
+			errs = append(errs, "redact: redaction can't be switched off remotely")
+		}
+		topologies := []string{}
+		for name := range r.Redact.Topologies {
+			topologies = append(topologies, name)
+		}
+		sort.Strings(topologies)
+		for _, name := range topologies {
+			if len(r.Redact.Topologies[name].Allow) > 0 {
+				errs = append(errs, fmt.Sprintf("redact: topologies: %s: keys can't be allowed remotely", name))
+			}
+		}
+		// Check the rules whether or not redaction is on, so all the errors
+		// show up at once
+		redact := *r.Redact
+		redact.Enabled = true
+		if err := redact.Rules().Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("redact: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Version identifies the remote config, so apps can tell which probes have
+// it.
+func (r Remote) Version() string {
+	// Maps are marshalled in key order, so this is canonical.
+	buf, _ := json.Marshal(r)
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Apply returns c with the remote config applied to it.
+func (r Remote) Apply(c Config) Config {
+	if r.SpyInterval != nil {
+		c.SpyInterval = *r.SpyInterval
+	}
+	if r.PublishInterval != nil {
+		c.PublishInterval = *r.PublishInterval
+	}
+	for name, enabled := range r.Reporters {
+		switch name {
+		case DockerReporter:
+			c.Docker.Enabled = enabled
+		case KubernetesReporter:
+			c.Kubernetes.Enabled = enabled
+		case SystemdReporter:
+			c.Systemd.Enabled = enabled
+		case PluginsReporter:
+			c.Plugins.Enabled = enabled
+		}
+	}
+	if r.Plugins != nil {
+		c.Plugins.Allow = append([]string{}, r.Plugins...)
+	}
+	if r.Redact != nil {
+		c.Redact = r.Redact.tighten(c.Redact)
+	}
+	return c
+}
+
+// tighten adds remote redaction rules to the local ones. Only deny lists
+// are taken from the remote rules, so nothing local is loosened.
+func (r RedactConfig) tighten(local RedactConfig) RedactConfig {
+	result := RedactConfig{
+		Enabled: true,
+		Keys:    union(local.Keys, r.Keys),
+		Values:  union(local.Values, r.Values),
+		Tokens:  local.Tokens || r.Tokens,
+	}
+	for name, t := range local.Topologies {
+		if result.Topologies == nil {
+			result.Topologies = map[string]RedactTopologyConfig{}
+		}
+		result.Topologies[name] = t
+	}
+	for name, t := range r.Topologies {
+		if result.Topologies == nil {
+			result.Topologies = map[string]RedactTopologyConfig{}
+		}
+		lt := result.Topologies[name]
+		lt.Deny = union(lt.Deny, t.Deny)
+		result.Topologies[name] = lt
+	}
+	return result
+}
+
+// Effective returns the remotely configurable part of c, for probes to
+// report back to apps.
+func Effective(c Config) Remote {
+	spy, publish, redact := c.SpyInterval, c.PublishInterval, c.Redact
+	return Remote{
+		SpyInterval:     &spy,
+		PublishInterval: &publish,
+		Reporters: map[string]bool{
+			DockerReporter:     c.Docker.Enabled,
+			KubernetesReporter: c.Kubernetes.Enabled,
+			SystemdReporter:    c.Systemd.Enabled,
+			PluginsReporter:    c.Plugins.Enabled,
+		},
+		Plugins: c.Plugins.Allow,
+		Redact:  &redact,
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// union returns the strings in either list, in order, without duplicates.
+func union(a, b []string) []string {
+	var result []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
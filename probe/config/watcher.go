@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Watcher re-reads a config file when the probe gets a SIGHUP, or when the
+// file changes, and passes each new valid config to a callback. Invalid
+// configs are logged and ignored, leaving the current one in place.
+type Watcher struct {
+	path     string
+	defaults Config
+	onChange func(Config)
+	quit     chan struct{}
+	done     sync.WaitGroup
+
+	mtx     sync.Mutex
+	current Config
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher makes a Watcher of the file at path, currently configured with
+// current, which checks for changes every period.
+func NewWatcher(path string, defaults, current Config, period time.Duration, onChange func(Config)) *Watcher {
+	w := &Watcher{
+		path:     path,
+		defaults: defaults,
+		current:  current,
+		onChange: onChange,
+		quit:     make(chan struct{}),
+	}
+	w.modTime, w.size = w.stat()
+	w.done.Add(1)
+	go w.loop(period)
+	return w
+}
+
+// Stop stops watching the file.
+func (w *Watcher) Stop() {
+	close(w.quit)
+	w.done.Wait()
+}
+
+// Current returns the config currently in effect.
+func (w *Watcher) Current() Config {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.current
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+func (w *Watcher) loop(period time.Duration) {
+	defer w.done.Done()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-hup:
+			log.Infof("Received SIGHUP, reloading %s", w.path)
+			w.Reload()
+		case <-tick.C:
+			w.mtx.Lock()
+			modTime, size := w.stat()
+			changed := !modTime.Equal(w.modTime) || size != w.size
+			w.mtx.Unlock()
+			if changed {
+				log.Infof("%s changed, reloading", w.path)
+				w.Reload()
+			}
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// Reload re-reads the file, and calls the callback if the config in it is
+// valid and differs from the current one.
+func (w *Watcher) Reload() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.modTime, w.size = w.stat()
+	cfg, err := Load(w.path, w.defaults)
+	if err != nil {
+		log.Errorf("Error reloading %s, keeping the current config: %v", w.path, err)
+		return
+	}
+	if reflect.DeepEqual(cfg, w.current) {
+		return
+	}
+	w.current = cfg
+	w.onChange(cfg)
+}
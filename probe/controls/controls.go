@@ -4,30 +4,52 @@ import (
 	"sync"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
 )
 
 var (
 	mtx      = sync.Mutex{}
 	handlers = map[string]xfer.ControlHandlerFunc{}
+	schemas  = map[string]report.ControlArgs{}
 )
 
-// HandleControlRequest performs a control request.
+// HandleControlRequest performs a control request. The request's arguments
+// are validated against the control's schema, and defaults filled in, before
+// it is passed on to the handler.
 func HandleControlRequest(req xfer.Request) xfer.Response {
 	mtx.Lock()
 	handler, ok := handlers[req.Control]
+	schema := schemas[req.Control]
 	mtx.Unlock()
 	if !ok {
 		return xfer.ResponseErrorf("Control %q not recognised", req.Control)
 	}
 
-	return handler(req)
+	args, err := schema.Validate(req.Args)
+	if err != nil {
+		return xfer.ResponseErrorf("Control %q: %v", req.Control, err)
+	}
+	req.Args = args
+	res := handler(req)
+
+	// Pipes are framed if the app asked for them to be (see NewPipe); tell
+	// it they are, so it frames the UI end too.
+	res.FramedPipe = xfer.IsFramedPipeID(res.Pipe)
+	return res
 }
 
 // Register a new control handler under a given id.
 func Register(control string, f xfer.ControlHandlerFunc) {
+	RegisterWithArgs(control, nil, f)
+}
+
+// RegisterWithArgs registers a new control handler under a given id, which
+// takes the arguments described by args.
+func RegisterWithArgs(control string, args report.ControlArgs, f xfer.ControlHandlerFunc) {
 	mtx.Lock()
 	defer mtx.Unlock()
 	handlers[control] = f
+	schemas[control] = args
 }
 
 // Rm deletes the handler for a given name
@@ -35,4 +57,5 @@ func Rm(control string) {
 	mtx.Lock()
 	defer mtx.Unlock()
 	delete(handlers, control)
+	delete(schemas, control)
 }
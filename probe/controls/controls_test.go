@@ -6,6 +6,7 @@ import (
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
 )
 
@@ -39,3 +40,58 @@ func TestControlsNotFound(t *testing.T) {
 		t.Fatal(test.Diff(want, have))
 	}
 }
+
+func TestControlsArgs(t *testing.T) {
+	min := 0
+	controls.RegisterWithArgs("foo", report.ControlArgs{
+		{Name: "replicas", Type: report.ControlArgInt, Required: true, Min: &min},
+		{Name: "signal", Type: report.ControlArgEnum, Options: []string{"HUP", "TERM"}, Default: "TERM"},
+	}, func(req xfer.Request) xfer.Response {
+		return xfer.Response{
+			Value: req.Args,
+		}
+	})
+	defer controls.Rm("foo")
+
+	for _, c := range []struct {
+		args map[string]string
+		want xfer.Response
+	}{
+		{
+			map[string]string{"replicas": "5"},
+			xfer.Response{Value: map[string]string{"replicas": "5", "signal": "TERM"}},
+		},
+		{
+			map[string]string{"replicas": "5", "signal": "HUP"},
+			xfer.Response{Value: map[string]string{"replicas": "5", "signal": "HUP"}},
+		},
+		{
+			map[string]string{},
+			xfer.Response{Error: "Control \"foo\": missing argument \"replicas\""},
+		},
+		{
+			map[string]string{"replicas": "-1"},
+			xfer.Response{Error: "Control \"foo\": argument \"replicas\" must be at least 0, got -1"},
+		},
+		{
+			map[string]string{"replicas": "five"},
+			xfer.Response{Error: "Control \"foo\": argument \"replicas\" must be an integer, got \"five\""},
+		},
+		{
+			map[string]string{"replicas": "5", "signal": "KILL"},
+			xfer.Response{Error: "Control \"foo\": argument \"signal\" must be one of [HUP TERM], got \"KILL\""},
+		},
+		{
+			map[string]string{"replicas": "5", "bar": "baz"},
+			xfer.Response{Error: "Control \"foo\": unknown argument \"bar\""},
+		},
+	} {
+		have := controls.HandleControlRequest(xfer.Request{
+			Control: "foo",
+			Args:    c.args,
+		})
+		if !reflect.DeepEqual(c.want, have) {
+			t.Error(test.Diff(c.want, have))
+		}
+	}
+}
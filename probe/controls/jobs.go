@@ -0,0 +1,170 @@
+package controls
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/report"
+)
+
+// Controls for querying and cancelling jobs, available in every probe.
+const (
+	JobStatus = "job_status"
+	CancelJob = "job_cancel"
+
+	// JobArg is the argument to JobStatus and CancelJob.
+	JobArg = "job"
+
+	// How long finished jobs can still be queried for.
+	jobRetention = 10 * time.Minute
+)
+
+// ProgressFunc is used by jobs to report their progress, as a percentage,
+// along with a human-readable message.
+type ProgressFunc func(progress int, message string)
+
+// JobFunc is the type of long-running controls. It should return promptly
+// once ctx is cancelled.
+type JobFunc func(ctx context.Context, req xfer.Request, progress ProgressFunc) xfer.Response
+
+type job struct {
+	sync.Mutex
+	status xfer.Job
+	owner  string
+	cancel context.CancelFunc
+}
+
+var (
+	jobsMtx = sync.Mutex{}
+	jobs    = map[string]*job{}
+
+	jobArgs = report.ControlArgs{
+		{Name: JobArg, Human: "Job", Type: report.ControlArgString, Required: true},
+	}
+)
+
+func init() {
+	RegisterWithArgs(JobStatus, jobArgs, jobStatus)
+	RegisterWithArgs(CancelJob, jobArgs, cancelJob)
+}
+
+// RegisterJob registers a control which runs asynchronously. Invoking it
+// returns the ID of the job straight away; the job's progress and result can
+// be queried with the JobStatus control, and it can be cancelled with the
+// CancelJob control, by the user who started it. Jobs started by unidentified
+// users can't be cancelled, as there's no telling who started them.
+func RegisterJob(control string, args report.ControlArgs, f JobFunc) {
+	RegisterWithArgs(control, args, func(req xfer.Request) xfer.Response {
+		return startJob(req, f)
+	})
+}
+
+func startJob(req xfer.Request, f JobFunc) xfer.Response {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: xfer.Job{
+			ID:      fmt.Sprintf("%x", rand.Int63()),
+			Control: req.Control,
+			NodeID:  req.NodeID,
+			State:   xfer.JobRunning,
+			Started: mtime.Now(),
+		},
+		owner:  req.User,
+		cancel: cancel,
+	}
+	id := j.status.ID
+
+	jobsMtx.Lock()
+	jobs[id] = j
+	jobsMtx.Unlock()
+
+	go func() {
+		res := f(ctx, req, j.progress)
+		j.finish(res, ctx.Err() != nil)
+		cancel()
+		time.AfterFunc(jobRetention, func() { forgetJob(id) })
+	}()
+	return xfer.Response{
+		Job: id,
+	}
+}
+
+func forgetJob(id string) {
+	jobsMtx.Lock()
+	defer jobsMtx.Unlock()
+	delete(jobs, id)
+}
+
+func (j *job) progress(progress int, message string) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 100 {
+		progress = 100
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.status.Done() {
+		return
+	}
+	j.status.Progress = progress
+	j.status.Message = message
+}
+
+func (j *job) finish(res xfer.Response, cancelled bool) {
+	j.Lock()
+	defer j.Unlock()
+	switch {
+	case cancelled:
+		j.status.State = xfer.JobCancelled
+	case res.Error != "":
+		j.status.State = xfer.JobFailed
+	default:
+		j.status.State = xfer.JobSucceeded
+		j.status.Progress = 100
+	}
+	j.status.Result = &res
+	j.status.Finished = mtime.Now()
+}
+
+func (j *job) Status() xfer.Job {
+	j.Lock()
+	defer j.Unlock()
+	return j.status
+}
+
+func lookupJob(id string) (*job, bool) {
+	jobsMtx.Lock()
+	defer jobsMtx.Unlock()
+	j, ok := jobs[id]
+	return j, ok
+}
+
+func jobStatus(req xfer.Request) xfer.Response {
+	j, ok := lookupJob(req.Args[JobArg])
+	if !ok {
+		return xfer.ResponseErrorf("Job not found: %s", req.Args[JobArg])
+	}
+	return xfer.Response{
+		Value: j.Status(),
+	}
+}
+
+func cancelJob(req xfer.Request) xfer.Response {
+	j, ok := lookupJob(req.Args[JobArg])
+	if !ok {
+		return xfer.ResponseErrorf("Job not found: %s", req.Args[JobArg])
+	}
+	if req.User == "" || j.owner != req.User {
+		return xfer.ResponseErrorf("Job %s was started by another user", req.Args[JobArg])
+	}
+	j.cancel()
+	return xfer.Response{
+		Value: j.Status(),
+	}
+}
@@ -0,0 +1,96 @@
+package controls_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/test"
+)
+
+func jobStatus(t *testing.T, id string) xfer.Job {
+	res := controls.HandleControlRequest(xfer.Request{
+		Control: controls.JobStatus,
+		Args:    map[string]string{controls.JobArg: id},
+	})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	return res.Value.(xfer.Job)
+}
+
+func TestJobs(t *testing.T) {
+	step := make(chan struct{})
+	controls.RegisterJob("foo", nil, func(ctx context.Context, req xfer.Request, progress controls.ProgressFunc) xfer.Response {
+		progress(50, "halfway")
+		select {
+		case <-step:
+		case <-ctx.Done():
+			return xfer.ResponseError(ctx.Err())
+		}
+		return xfer.Response{Value: "bar"}
+	})
+	defer controls.Rm("foo")
+
+	// It runs to completion
+	res := controls.HandleControlRequest(xfer.Request{Control: "foo", NodeID: "node"})
+	if res.Job == "" {
+		t.Fatalf("Expected a job, got %v", res)
+	}
+	test.Poll(t, 100*time.Millisecond, "halfway", func() interface{} {
+		return jobStatus(t, res.Job).Message
+	})
+	if status := jobStatus(t, res.Job); status.State != xfer.JobRunning || status.Progress != 50 || status.NodeID != "node" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	step <- struct{}{}
+	test.Poll(t, 100*time.Millisecond, xfer.JobSucceeded, func() interface{} {
+		return jobStatus(t, res.Job).State
+	})
+	if status := jobStatus(t, res.Job); status.Progress != 100 || status.Result.Value != "bar" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	// It can be cancelled, only by whoever started it
+	res = controls.HandleControlRequest(xfer.Request{Control: "foo", User: "alice"})
+	cancel := controls.HandleControlRequest(xfer.Request{
+		Control: controls.CancelJob,
+		User:    "bob",
+		Args:    map[string]string{controls.JobArg: res.Job},
+	})
+	if want := "Job " + res.Job + " was started by another user"; cancel.Error != want {
+		t.Errorf("Expected %q, got %q", want, cancel.Error)
+	}
+	anon := controls.HandleControlRequest(xfer.Request{Control: "foo"})
+	cancel = controls.HandleControlRequest(xfer.Request{
+		Control: controls.CancelJob,
+		Args:    map[string]string{controls.JobArg: anon.Job},
+	})
+	if cancel.Error == "" {
+		t.Errorf("Expected unidentified users not to be able to cancel jobs")
+	}
+	cancel = controls.HandleControlRequest(xfer.Request{
+		Control: controls.CancelJob,
+		User:    "alice",
+		Args:    map[string]string{controls.JobArg: res.Job},
+	})
+	if cancel.Error != "" {
+		t.Fatal(cancel.Error)
+	}
+	test.Poll(t, 100*time.Millisecond, xfer.JobCancelled, func() interface{} {
+		return jobStatus(t, res.Job).State
+	})
+	step <- struct{}{}
+
+	// Unknown jobs are errors
+	res = controls.HandleControlRequest(xfer.Request{
+		Control: controls.JobStatus,
+		Args:    map[string]string{controls.JobArg: "nonexistent"},
+	})
+	if want := "Job not found: nonexistent"; res.Error != want {
+		t.Errorf("Expected %q, got %q", want, res.Error)
+	}
+}
@@ -22,8 +22,11 @@ type pipe struct {
 	client    PipeClient
 }
 
-func newPipe(p xfer.Pipe, c PipeClient, appID string) (string, xfer.Pipe, error) {
+func newPipe(p xfer.Pipe, framed bool, c PipeClient, appID string) (string, xfer.Pipe, error) {
 	pipeID := fmt.Sprintf("pipe-%d", rand.Int63())
+	if framed {
+		pipeID = xfer.FramedPipeID(pipeID)
+	}
 	pipe := &pipe{
 		Pipe:   p,
 		appID:  appID,
@@ -36,14 +39,23 @@ func newPipe(p xfer.Pipe, c PipeClient, appID string) (string, xfer.Pipe, error)
 	return pipeID, pipe, nil
 }
 
-// NewPipe creates a new pipe and connects it to the app.
-var NewPipe = func(c PipeClient, appID string) (string, xfer.Pipe, error) {
-	return newPipe(xfer.NewPipe(), c, appID)
+// NewPipe creates a new pipe for a request and connects it to the app which
+// sent it. The pipe is framed if the app can frame the UI end too, and its
+// ID says so; older apps pass the pipe's bytes straight through.
+var NewPipe = func(c PipeClient, req xfer.Request) (string, xfer.Pipe, error) {
+	if req.FramedPipes {
+		return newPipe(xfer.NewFramedPipe(), true, c, req.AppID)
+	}
+	return newPipe(xfer.NewPipe(), false, c, req.AppID)
 }
 
-// NewPipeFromEnds creates a new pipe from its ends and connects it to the app.
-func NewPipeFromEnds(local, remote io.ReadWriter, c PipeClient, appID string) (string, xfer.Pipe, error) {
-	return newPipe(xfer.NewPipeFromEnds(local, remote), c, appID)
+// NewPipeFromEnds creates a new pipe for a request from its ends and
+// connects it to the app, framed as for NewPipe.
+func NewPipeFromEnds(local, remote io.ReadWriter, c PipeClient, req xfer.Request) (string, xfer.Pipe, error) {
+	if req.FramedPipes {
+		return newPipe(xfer.NewFramedPipeFromEnds(local, remote), true, c, req.AppID)
+	}
+	return newPipe(xfer.NewPipeFromEnds(local, remote), false, c, req.AppID)
 }
 
 func (p *pipe) Close() error {
@@ -408,7 +408,7 @@ func (c *container) GetNode() report.Node {
 	controls := []string{}
 
 	if c.container.State.Paused {
-		controls = append(controls, UnpauseContainer)
+		controls = append(controls, UnpauseContainer, LogsContainer)
 	} else if c.container.State.Running {
 		uptime := (mtime.Now().Sub(c.container.State.StartedAt) / time.Second) * time.Second
 		networkMode := ""
@@ -419,9 +419,9 @@ func (c *container) GetNode() report.Node {
 		latest[ContainerUptime] = uptime.String()
 		latest[ContainerRestartCount] = strconv.Itoa(c.container.RestartCount)
 		latest[ContainerNetworkMode] = networkMode
-		controls = append(controls, RestartContainer, StopContainer, PauseContainer, AttachContainer, ExecContainer)
+		controls = append(controls, RestartContainer, StopContainer, PauseContainer, AttachContainer, ExecContainer, LogsContainer)
 	} else {
-		controls = append(controls, StartContainer, RemoveContainer)
+		controls = append(controls, StartContainer, RemoveContainer, LogsContainer)
 	}
 
 	result := c.baseNode.WithLatests(latest)
@@ -1,9 +1,19 @@
 package docker
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	docker_client "github.com/fsouza/go-dockerclient"
 
 	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -20,13 +30,47 @@ const (
 	RemoveContainer  = "docker_remove_container"
 	AttachContainer  = "docker_attach_container"
 	ExecContainer    = "docker_exec_container"
+	LogsContainer    = "docker_logs"
+
+	PullImage       = "docker_pull_image"
+	RemoveImage     = "docker_remove_image"
+	ImageContainers = "docker_image_containers"
+
+	// Arguments to LogsContainer
+	LogsFollowArg = "follow"
+	LogsTailArg   = "tail"
+	LogsSinceArg  = "since"
+	LogsStreamArg = "stream"
+
+	// Values of LogsStreamArg
+	LogsStreamAll    = "all"
+	LogsStreamStdout = "stdout"
+	LogsStreamStderr = "stderr"
 
 	waitTime = 10
+
+	// How much followed output to hold back while old logs are sent
+	maxGatedBytes = 1024 * 1024
 )
 
-func (r *registry) stopContainer(containerID string, _ xfer.Request) xfer.Response {
+var (
+	minTail  = 0
+	logsArgs = report.ControlArgs{
+		{Name: LogsFollowArg, Human: "Follow", Type: report.ControlArgBool, Default: "true"},
+		{Name: LogsTailArg, Human: "Lines", Type: report.ControlArgInt, Min: &minTail},
+		{Name: LogsSinceArg, Human: "Since (e.g. 10m)", Type: report.ControlArgString},
+		{Name: LogsStreamArg, Human: "Stream", Type: report.ControlArgEnum, Default: LogsStreamAll,
+			Options: []string{LogsStreamAll, LogsStreamStdout, LogsStreamStderr}},
+	}
+)
+
+// stopContainer stops a container gracefully, as a job: docker sends it
+// SIGTERM, and only kills it if it hasn't exited after waitTime seconds.
+func (r *registry) stopContainer(ctx context.Context, containerID string, _ xfer.Request, progress controls.ProgressFunc) xfer.Response {
 	log.Infof("Stopping container %s", containerID)
-	return xfer.ResponseError(r.client.StopContainer(containerID, waitTime))
+	return waitForStop(ctx, containerID, progress, func() error {
+		return r.client.StopContainer(containerID, waitTime)
+	})
 }
 
 func (r *registry) startContainer(containerID string, _ xfer.Request) xfer.Response {
@@ -34,9 +78,39 @@ func (r *registry) startContainer(containerID string, _ xfer.Request) xfer.Respo
 	return xfer.ResponseError(r.client.StartContainer(containerID, nil))
 }
 
-func (r *registry) restartContainer(containerID string, _ xfer.Request) xfer.Response {
+// restartContainer restarts a container, stopping it gracefully as
+// stopContainer does, as a job.
+func (r *registry) restartContainer(ctx context.Context, containerID string, _ xfer.Request, progress controls.ProgressFunc) xfer.Response {
 	log.Infof("Restarting container %s", containerID)
-	return xfer.ResponseError(r.client.RestartContainer(containerID, waitTime))
+	return waitForStop(ctx, containerID, progress, func() error {
+		return r.client.RestartContainer(containerID, waitTime)
+	})
+}
+
+// waitForStop calls stop, which stops the container within waitTime seconds,
+// reporting how far through that it is. Docker can't be told to give up on a
+// stop, so cancelling the job only stops waiting for it.
+func waitForStop(ctx context.Context, containerID string, progress controls.ProgressFunc, stop func() error) xfer.Response {
+	done := make(chan error, 1)
+	go func() {
+		done <- stop()
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for elapsed := 0; ; elapsed++ {
+		if elapsed < waitTime {
+			progress(100*elapsed/waitTime, fmt.Sprintf("Waiting up to %ds for %s to exit", waitTime-elapsed, containerID))
+		} else {
+			progress(100, fmt.Sprintf("Killing %s", containerID))
+		}
+		select {
+		case err := <-done:
+			return xfer.ResponseError(err)
+		case <-ctx.Done():
+			return xfer.ResponseErrorf("Stopped waiting for %s, which docker is still stopping", containerID)
+		case <-ticker.C:
+		}
+	}
 }
 
 func (r *registry) pauseContainer(containerID string, _ xfer.Request) xfer.Response {
@@ -68,7 +142,7 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 	}
 
 	hasTTY := c.HasTTY()
-	id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+	id, pipe, err := controls.NewPipe(r.pipes, req)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
@@ -87,6 +161,13 @@ func (r *registry) attachContainer(containerID string, req xfer.Request) xfer.Re
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
+	if hasTTY {
+		pipe.OnResize(func(width, height uint16) {
+			if err := r.client.ResizeContainerTTY(containerID, int(height), int(width)); err != nil {
+				log.Errorf("Error resizing container %s TTY: %v", containerID, err)
+			}
+		})
+	}
 	pipe.OnClose(func() {
 		if err := cw.Close(); err != nil {
 			log.Errorf("Error closing attachment: %v", err)
@@ -119,7 +200,7 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 		return xfer.ResponseError(err)
 	}
 
-	id, pipe, err := controls.NewPipe(r.pipes, req.AppID)
+	id, pipe, err := controls.NewPipe(r.pipes, req)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
@@ -134,6 +215,11 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
+	pipe.OnResize(func(width, height uint16) {
+		if err := r.client.ResizeExecTTY(exec.ID, int(height), int(width)); err != nil {
+			log.Errorf("Error resizing exec %s TTY: %v", exec.ID, err)
+		}
+	})
 	pipe.OnClose(func() {
 		if err := cw.Close(); err != nil {
 			log.Errorf("Error closing exec: %v", err)
@@ -153,6 +239,315 @@ func (r *registry) execContainer(containerID string, req xfer.Request) xfer.Resp
 	}
 }
 
+// logsContainer streams the container's logs down a pipe. Unless the
+// container has a TTY, stdout and stderr are demultiplexed, and stderr is
+// shown in red.
+func (r *registry) logsContainer(containerID string, req xfer.Request) xfer.Response {
+	c, ok := r.GetContainer(containerID)
+	if !ok {
+		return xfer.ResponseErrorf("Not found: %s", containerID)
+	}
+	follow, _ := strconv.ParseBool(req.Args[LogsFollowArg])
+	opts := docker_client.LogsOptions{
+		Container:   containerID,
+		Follow:      follow,
+		Tail:        req.Args[LogsTailArg],
+		Stdout:      req.Args[LogsStreamArg] != LogsStreamStderr,
+		Stderr:      req.Args[LogsStreamArg] != LogsStreamStdout,
+		RawTerminal: c.HasTTY(),
+	}
+	if since := req.Args[LogsSinceArg]; since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return xfer.ResponseErrorf("Invalid since: %v", err)
+		}
+		opts.Since = time.Now().Add(-d).Unix()
+	}
+
+	id, pipe, err := controls.NewPipe(r.pipes, req)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	local, _ := pipe.Ends()
+	opts.OutputStream = local
+	opts.ErrorStream = local
+	if !opts.RawTerminal && opts.Stdout {
+		opts.ErrorStream = stderrWriter{local}
+	}
+
+	// The client offers no way to cancel Logs, so when following, it would
+	// outlive the pipe until the container next logged something. Instead,
+	// follow new output by attaching to the container, which is closed with
+	// the pipe. Attaching first, and holding its output back until the old
+	// logs are sent, means nothing is missed, though anything logged in
+	// between may be shown twice.
+	var (
+		gate *gatedWriter
+		cw   docker_client.CloseWaiter
+	)
+	if follow && c.StateString() == StateRunning {
+		gate = &gatedWriter{w: local}
+		var errorStream io.Writer = gate
+		if !opts.RawTerminal && opts.Stdout {
+			errorStream = stderrWriter{gate}
+		}
+		cw, err = r.client.AttachToContainerNonBlocking(docker_client.AttachToContainerOptions{
+			Container:    containerID,
+			RawTerminal:  opts.RawTerminal,
+			Stream:       true,
+			Stdout:       opts.Stdout,
+			Stderr:       opts.Stderr,
+			OutputStream: gate,
+			ErrorStream:  errorStream,
+		})
+		if err != nil {
+			pipe.Close()
+			return xfer.ResponseError(err)
+		}
+		pipe.OnClose(func() {
+			if err := cw.Close(); err != nil {
+				log.Errorf("Error closing logs for container %s: %v", containerID, err)
+			}
+		})
+	}
+	opts.Follow = false
+
+	go func() {
+		defer pipe.Close()
+		if err := r.client.Logs(opts); err != nil {
+			if !pipe.Closed() {
+				log.Errorf("Error streaming logs for container %s: %v", containerID, err)
+			}
+			return
+		}
+		if cw == nil {
+			return
+		}
+		if err := gate.Open(); err != nil {
+			return
+		}
+		if err := cw.Wait(); err != nil && !pipe.Closed() {
+			log.Errorf("Error following logs for container %s: %v", containerID, err)
+		}
+	}()
+	return xfer.Response{
+		Pipe:   id,
+		RawTTY: opts.RawTerminal,
+	}
+}
+
+// gatedWriter holds everything written to it back until it's opened, up to
+// maxGatedBytes. Writes beyond that are dropped, so a chatty container can't
+// fill the probe's memory while its old logs are slow to send.
+type gatedWriter struct {
+	mtx     sync.Mutex
+	w       io.Writer
+	buf     bytes.Buffer
+	dropped int
+	open    bool
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.open {
+		return g.w.Write(p)
+	}
+	if g.buf.Len()+len(p) > maxGatedBytes {
+		g.dropped += len(p)
+		return len(p), nil
+	}
+	return g.buf.Write(p)
+}
+
+// Open writes out everything held back, and lets further writes through.
+func (g *gatedWriter) Open() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.open = true
+	if _, err := g.buf.WriteTo(g.w); err != nil {
+		return err
+	}
+	if g.dropped > 0 {
+		_, err := fmt.Fprintf(g.w, "\r\n[%d bytes of logs dropped]\r\n", g.dropped)
+		return err
+	}
+	return nil
+}
+
+// stderrWriter colours everything written to it red.
+type stderrWriter struct {
+	io.Writer
+}
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	if _, err := fmt.Fprintf(w.Writer, "\x1b[31m%s\x1b[0m", p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// pullImage pulls the latest tag of the image's repository, as a job,
+// reporting the progress of the layers being pulled.
+func (r *registry) pullImage(ctx context.Context, req xfer.Request, progress controls.ProgressFunc) xfer.Response {
+	imageID, ok := report.ParseContainerImageNodeID(req.NodeID)
+	if !ok {
+		return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+	}
+	image, ok := r.getImage(imageID)
+	if !ok {
+		return xfer.ResponseErrorf("Not found: %s", imageID)
+	}
+	if len(image.RepoTags) == 0 {
+		return xfer.ResponseErrorf("Image %s has no repository", imageID)
+	}
+	repository := imageRepository(image.RepoTags[0])
+
+	log.Infof("Pulling image %s:latest", repository)
+	progress(0, fmt.Sprintf("Pulling %s:latest", repository))
+	err := r.client.PullImage(docker_client.PullImageOptions{
+		Repository:    repository,
+		Tag:           "latest",
+		OutputStream:  &pullProgressWriter{ctx: ctx, progress: progress, layers: map[string]bool{}},
+		RawJSONStream: true,
+	}, docker_client.AuthConfiguration{})
+	if ctx.Err() != nil {
+		return xfer.ResponseErrorf("Pull of %s:latest cancelled", repository)
+	} else if err != nil {
+		return xfer.ResponseErrorf("Error pulling %s:latest: %v", repository, err)
+	}
+	return xfer.Response{
+		Value: fmt.Sprintf("Pulled %s:latest", repository),
+	}
+}
+
+// pullProgressWriter turns the JSON messages docker streams during a pull
+// into job progress. Progress is the fraction of the layers seen so far which
+// are complete; it never reaches 100% until the pull has finished. Writes fail
+// once the job is cancelled, which aborts the pull.
+type pullProgressWriter struct {
+	ctx      context.Context
+	progress controls.ProgressFunc
+	buf      bytes.Buffer
+	layers   map[string]bool
+}
+
+type pullMessage struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+func (w *pullProgressWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Incomplete line; keep it for the next write.
+			w.buf.WriteString(line)
+			return len(p), nil
+		}
+		w.update(strings.TrimSpace(line))
+	}
+}
+
+func (w *pullProgressWriter) update(line string) {
+	if line == "" {
+		return
+	}
+	var msg pullMessage
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		w.progress(w.percent(), line)
+		return
+	}
+	if msg.Error != "" {
+		w.progress(w.percent(), msg.Error)
+		return
+	}
+	// Docker reports the tag being pulled with an ID too; only count layers.
+	if msg.ID != "" && !strings.HasPrefix(msg.Status, "Pulling from") {
+		done := msg.Status == "Pull complete" || msg.Status == "Already exists"
+		w.layers[msg.ID] = w.layers[msg.ID] || done
+		w.progress(w.percent(), fmt.Sprintf("%s: %s", msg.ID, msg.Status))
+		return
+	}
+	w.progress(w.percent(), msg.Status)
+}
+
+func (w *pullProgressWriter) percent() int {
+	if len(w.layers) == 0 {
+		return 0
+	}
+	complete := 0
+	for _, done := range w.layers {
+		if done {
+			complete++
+		}
+	}
+	if percent := 100 * complete / len(w.layers); percent < 99 {
+		return percent
+	}
+	return 99
+}
+
+// removeImage removes the image, if no containers are using it.
+func (r *registry) removeImage(imageID string, req xfer.Request) xfer.Response {
+	if containers := r.imageContainers(imageID); len(containers) > 0 {
+		names := []string{}
+		for _, c := range containers {
+			names = append(names, c.Name)
+		}
+		return xfer.ResponseErrorf("Image %s is in use by %s", imageID, strings.Join(names, ", "))
+	}
+	log.Infof("Removing image %s", imageID)
+	if err := r.client.RemoveImage(imageID); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{
+		RemovedNode: req.NodeID,
+	}
+}
+
+// ImageContainer is a container using an image, as returned by the
+// ImageContainers control.
+type ImageContainer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+func (r *registry) listImageContainers(imageID string, _ xfer.Request) xfer.Response {
+	return xfer.Response{
+		Value: r.imageContainers(imageID),
+	}
+}
+
+func (r *registry) imageContainers(imageID string) []ImageContainer {
+	result := []ImageContainer{}
+	r.WalkContainers(func(c Container) {
+		if c.Image() != imageID {
+			return
+		}
+		name := c.ID()
+		if dc := c.Container(); dc != nil && dc.Name != "" {
+			name = strings.TrimPrefix(dc.Name, "/")
+		}
+		result = append(result, ImageContainer{ID: c.ID(), Name: name, State: c.StateString()})
+	})
+	return result
+}
+
+// imageRepository strips the tag, if any, from an image name.
+func imageRepository(name string) string {
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i]
+	}
+	return name
+}
+
 func captureContainerID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
 	return func(req xfer.Request) xfer.Response {
 		containerID, ok := report.ParseContainerNodeID(req.NodeID)
@@ -163,15 +558,39 @@ func captureContainerID(f func(string, xfer.Request) xfer.Response) func(xfer.Re
 	}
 }
 
+func captureContainerIDJob(f func(context.Context, string, xfer.Request, controls.ProgressFunc) xfer.Response) controls.JobFunc {
+	return func(ctx context.Context, req xfer.Request, progress controls.ProgressFunc) xfer.Response {
+		containerID, ok := report.ParseContainerNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		return f(ctx, containerID, req, progress)
+	}
+}
+
+func captureImageID(f func(string, xfer.Request) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		imageID, ok := report.ParseContainerImageNodeID(req.NodeID)
+		if !ok {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		return f(imageID, req)
+	}
+}
+
 func (r *registry) registerControls() {
-	controls.Register(StopContainer, captureContainerID(r.stopContainer))
+	controls.RegisterJob(StopContainer, nil, captureContainerIDJob(r.stopContainer))
 	controls.Register(StartContainer, captureContainerID(r.startContainer))
-	controls.Register(RestartContainer, captureContainerID(r.restartContainer))
+	controls.RegisterJob(RestartContainer, nil, captureContainerIDJob(r.restartContainer))
 	controls.Register(PauseContainer, captureContainerID(r.pauseContainer))
 	controls.Register(UnpauseContainer, captureContainerID(r.unpauseContainer))
 	controls.Register(RemoveContainer, captureContainerID(r.removeContainer))
 	controls.Register(AttachContainer, captureContainerID(r.attachContainer))
 	controls.Register(ExecContainer, captureContainerID(r.execContainer))
+	controls.RegisterWithArgs(LogsContainer, logsArgs, captureContainerID(r.logsContainer))
+	controls.RegisterJob(PullImage, nil, r.pullImage)
+	controls.Register(RemoveImage, captureImageID(r.removeImage))
+	controls.Register(ImageContainers, captureImageID(r.listImageContainers))
 }
 
 func (r *registry) deregisterControls() {
@@ -183,4 +602,8 @@ func (r *registry) deregisterControls() {
 	controls.Rm(RemoveContainer)
 	controls.Rm(AttachContainer)
 	controls.Rm(ExecContainer)
+	controls.Rm(LogsContainer)
+	controls.Rm(PullImage)
+	controls.Rm(RemoveImage)
+	controls.Rm(ImageContainers)
 }
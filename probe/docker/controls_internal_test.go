@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGatedWriter(t *testing.T) {
+	var out bytes.Buffer
+	g := &gatedWriter{w: &out}
+	g.Write([]byte("held"))
+	if out.Len() != 0 {
+		t.Fatalf("Expected writes to be held back, got %q", out.String())
+	}
+
+	// Only so much is held back
+	g.Write(make([]byte, maxGatedBytes))
+	if err := g.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if have := out.String(); !strings.HasPrefix(have, "held") || !strings.Contains(have, "1048576 bytes of logs dropped") {
+		t.Errorf("Unexpected output: %q", have)
+	}
+
+	out.Reset()
+	g.Write([]byte("through"))
+	if have := out.String(); have != "through" {
+		t.Errorf("Expected writes to go through once open, got %q", have)
+	}
+}
@@ -2,6 +2,7 @@ package docker_test
 
 import (
 	"io"
+	"io/ioutil"
 	"reflect"
 	"testing"
 	"time"
@@ -30,6 +31,14 @@ func TestControls(t *testing.T) {
 				Control: tc.command,
 				NodeID:  report.MakeContainerNodeID("a1b2c3d4e5"),
 			})
+			// Graceful stops are jobs, as they can take a while
+			if result.Job != "" {
+				job := waitForJob(t, result.Job)
+				if job.Result == nil {
+					t.Fatalf("%s: unexpected job %v", tc.command, job)
+				}
+				result = *job.Result
+			}
 			if !reflect.DeepEqual(result, xfer.Response{
 				Error: tc.result,
 			}) {
@@ -39,6 +48,18 @@ func TestControls(t *testing.T) {
 	})
 }
 
+func waitForJob(t *testing.T, id string) xfer.Job {
+	job := xfer.Job{State: xfer.JobRunning}
+	for start := time.Now(); !job.Done() && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		status := controls.HandleControlRequest(xfer.Request{
+			Control: controls.JobStatus,
+			Args:    map[string]string{controls.JobArg: id},
+		})
+		job = status.Value.(xfer.Job)
+	}
+	return job
+}
+
 type mockPipe struct{}
 
 func (mockPipe) Ends() (io.ReadWriter, io.ReadWriter)                { return nil, nil }
@@ -46,11 +67,12 @@ func (mockPipe) CopyToWebsocket(io.ReadWriter, xfer.Websocket) error { return ni
 func (mockPipe) Close() error                                        { return nil }
 func (mockPipe) Closed() bool                                        { return false }
 func (mockPipe) OnClose(func())                                      {}
+func (mockPipe) OnResize(f func(uint16, uint16))                     { f(120, 40) }
 
 func TestPipes(t *testing.T) {
 	oldNewPipe := controls.NewPipe
 	defer func() { controls.NewPipe = oldNewPipe }()
-	controls.NewPipe = func(_ controls.PipeClient, _ string) (string, xfer.Pipe, error) {
+	controls.NewPipe = func(_ controls.PipeClient, _ xfer.Request) (string, xfer.Pipe, error) {
 		return "pipeid", mockPipe{}, nil
 	}
 
@@ -80,5 +102,119 @@ func TestPipes(t *testing.T) {
 				t.Errorf("diff %s: %s", tc, test.Diff(want, result))
 			}
 		}
+
+		want := []string{"container ping 120x40", "exec id 120x40"}
+		mdc.RLock()
+		defer mdc.RUnlock()
+		if !reflect.DeepEqual(mdc.resized, want) {
+			t.Errorf("diff: %s", test.Diff(want, mdc.resized))
+		}
+	})
+}
+
+func TestLogsAndImageControls(t *testing.T) {
+	oldNewPipe := controls.NewPipe
+	defer func() { controls.NewPipe = oldNewPipe }()
+	var (
+		pipe   xfer.Pipe
+		remote io.ReadWriter
+	)
+	controls.NewPipe = func(_ controls.PipeClient, _ xfer.Request) (string, xfer.Pipe, error) {
+		pipe = xfer.NewPipe()
+		_, remote = pipe.Ends()
+		return "pipeid", pipe, nil
+	}
+	readPipe := func() string {
+		buf, _ := ioutil.ReadAll(remote)
+		return string(buf)
+	}
+
+	mdc := newMockClient()
+	setupStubs(mdc, func() {
+		registry, _ := docker.NewRegistry(10*time.Second, nil, false, "")
+		defer registry.Stop()
+
+		test.Poll(t, 100*time.Millisecond, true, func() interface{} {
+			_, ok := registry.GetContainer("ping")
+			return ok && len(allImages(registry)) > 0
+		})
+
+		for args, want := range map[string]string{
+			docker.LogsStreamAll:    "stdout\nstderr\n",
+			docker.LogsStreamStderr: "stderr\n",
+		} {
+			result := controls.HandleControlRequest(xfer.Request{
+				Control: docker.LogsContainer,
+				NodeID:  report.MakeContainerNodeID("ping"),
+				Args:    map[string]string{docker.LogsStreamArg: args, docker.LogsTailArg: "10", docker.LogsFollowArg: "false"},
+			})
+			if result.Pipe != "pipeid" || result.Error != "" {
+				t.Fatalf("logs: %v", result)
+			}
+			if have := readPipe(); have != want {
+				t.Errorf("logs %s: want %q, have %q", args, want, have)
+			}
+		}
+
+		// Following shows the old logs, then the new, until the pipe is
+		// closed.
+		result := controls.HandleControlRequest(xfer.Request{
+			Control: docker.LogsContainer,
+			NodeID:  report.MakeContainerNodeID("ping"),
+			Args:    map[string]string{docker.LogsFollowArg: "true"},
+		})
+		if result.Pipe != "pipeid" || result.Error != "" {
+			t.Fatalf("logs: %v", result)
+		}
+		followed := "stdout\nstderr\nfollowing\n"
+		buf := make([]byte, len(followed))
+		if _, err := io.ReadFull(remote, buf); err != nil {
+			t.Fatal(err)
+		} else if have := string(buf); have != followed {
+			t.Errorf("logs follow: want %q, have %q", followed, have)
+		}
+		pipe.Close()
+		test.Poll(t, 100*time.Millisecond, true, func() interface{} {
+			mdc.RLock()
+			defer mdc.RUnlock()
+			if len(mdc.following) != 1 {
+				return false
+			}
+			select {
+			case <-mdc.following[0].closed:
+				return true
+			default:
+				return false
+			}
+		})
+
+		result = controls.HandleControlRequest(xfer.Request{
+			Control: docker.LogsContainer,
+			NodeID:  report.MakeContainerNodeID("ping"),
+			Args:    map[string]string{docker.LogsSinceArg: "yesterday"},
+		})
+		if result.Error == "" {
+			t.Errorf("Expected error for invalid since")
+		}
+
+		imageNodeID := report.MakeContainerImageNodeID("baz")
+		result = controls.HandleControlRequest(xfer.Request{Control: docker.PullImage, NodeID: imageNodeID})
+		if result.Job == "" || result.Error != "" {
+			t.Fatalf("pull: %v", result)
+		}
+		if job := waitForJob(t, result.Job); job.State != xfer.JobSucceeded || job.Result.Value != "Pulled bang:latest" {
+			t.Errorf("pull: unexpected job %v", job)
+		}
+
+		result = controls.HandleControlRequest(xfer.Request{Control: docker.ImageContainers, NodeID: imageNodeID})
+		want := xfer.Response{Value: []docker.ImageContainer{{ID: "ping", Name: "pong", State: docker.StateRunning}}}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("diff: %s", test.Diff(want, result))
+		}
+
+		result = controls.HandleControlRequest(xfer.Request{Control: docker.RemoveImage, NodeID: imageNodeID})
+		if want := "Image baz is in use by pong"; result.Error != want {
+			t.Errorf("remove: want %q, have %q", want, result.Error)
+		}
 	})
 }
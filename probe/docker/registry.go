@@ -78,6 +78,11 @@ type Client interface {
 	AttachToContainerNonBlocking(docker_client.AttachToContainerOptions) (docker_client.CloseWaiter, error)
 	CreateExec(docker_client.CreateExecOptions) (*docker_client.Exec, error)
 	StartExecNonBlocking(string, docker_client.StartExecOptions) (docker_client.CloseWaiter, error)
+	ResizeExecTTY(id string, height, width int) error
+	ResizeContainerTTY(id string, height, width int) error
+	Logs(docker_client.LogsOptions) error
+	PullImage(docker_client.PullImageOptions, docker_client.AuthConfiguration) error
+	RemoveImage(string) error
 }
 
 func newDockerClient(endpoint string) (Client, error) {
@@ -404,6 +409,13 @@ func (r *registry) WalkImages(f func(*docker_client.APIImages)) {
 	})
 }
 
+func (r *registry) getImage(imageID string) (*docker_client.APIImages, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	image, ok := r.images[imageID]
+	return image, ok
+}
+
 // ImageNameWithoutVersion splits the image name apart, returning the name
 // without the version, if possible
 func ImageNameWithoutVersion(name string) string {
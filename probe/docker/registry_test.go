@@ -83,6 +83,8 @@ type mockDockerClient struct {
 	containers    map[string]*client.Container
 	apiImages     []client.APIImages
 	events        []chan<- *client.APIEvents
+	resized       []string
+	following     []*followCloseWaiter
 }
 
 func (m *mockDockerClient) ListContainers(client.ListContainersOptions) ([]client.APIContainers, error) {
@@ -154,8 +156,32 @@ type mockCloseWaiter struct{}
 func (mockCloseWaiter) Close() error { return nil }
 func (mockCloseWaiter) Wait() error  { return nil }
 
-func (m *mockDockerClient) AttachToContainerNonBlocking(_ client.AttachToContainerOptions) (client.CloseWaiter, error) {
-	return mockCloseWaiter{}, nil
+// followCloseWaiter streams until it's closed, like following logs.
+type followCloseWaiter struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (f *followCloseWaiter) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *followCloseWaiter) Wait() error {
+	<-f.closed
+	return nil
+}
+
+func (m *mockDockerClient) AttachToContainerNonBlocking(opts client.AttachToContainerOptions) (client.CloseWaiter, error) {
+	if opts.Stdin {
+		return mockCloseWaiter{}, nil
+	}
+	fmt.Fprintf(opts.OutputStream, "following\n")
+	f := &followCloseWaiter{closed: make(chan struct{})}
+	m.Lock()
+	m.following = append(m.following, f)
+	m.Unlock()
+	return f, nil
 }
 
 func (m *mockDockerClient) CreateExec(client.CreateExecOptions) (*client.Exec, error) {
@@ -166,6 +192,41 @@ func (m *mockDockerClient) StartExecNonBlocking(string, client.StartExecOptions)
 	return mockCloseWaiter{}, nil
 }
 
+func (m *mockDockerClient) ResizeExecTTY(id string, height, width int) error {
+	m.Lock()
+	defer m.Unlock()
+	m.resized = append(m.resized, fmt.Sprintf("exec %s %dx%d", id, width, height))
+	return nil
+}
+
+func (m *mockDockerClient) ResizeContainerTTY(id string, height, width int) error {
+	m.Lock()
+	defer m.Unlock()
+	m.resized = append(m.resized, fmt.Sprintf("container %s %dx%d", id, width, height))
+	return nil
+}
+
+func (m *mockDockerClient) Logs(opts client.LogsOptions) error {
+	if opts.Stdout {
+		fmt.Fprintf(opts.OutputStream, "stdout\n")
+	}
+	if opts.Stderr {
+		fmt.Fprintf(opts.ErrorStream, "stderr\n")
+	}
+	return nil
+}
+
+func (m *mockDockerClient) PullImage(opts client.PullImageOptions, _ client.AuthConfiguration) error {
+	fmt.Fprintf(opts.OutputStream, "{\"status\":\"Pulling from %s\",\"id\":\"%s\"}\n", opts.Repository, opts.Tag)
+	fmt.Fprintf(opts.OutputStream, "{\"status\":\"Downloading\",\"id\":\"layer1\"}\n")
+	fmt.Fprintf(opts.OutputStream, "{\"status\":\"Pull complete\",\"id\":\"layer1\"}\n")
+	return nil
+}
+
+func (m *mockDockerClient) RemoveImage(string) error {
+	return fmt.Errorf("removed")
+}
+
 func (m *mockDockerClient) send(event *client.APIEvents) {
 	m.RLock()
 	defer m.RUnlock()
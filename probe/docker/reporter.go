@@ -63,41 +63,69 @@ var (
 			Icon:  "fa-terminal",
 			Rank:  2,
 		},
+		{
+			ID:    LogsContainer,
+			Human: "Logs",
+			Icon:  "fa-list-alt",
+			Rank:  3,
+			Args:  logsArgs,
+		},
 		{
 			ID:    StartContainer,
 			Human: "Start",
 			Icon:  "fa-play",
-			Rank:  3,
+			Rank:  4,
 		},
 		{
 			ID:    RestartContainer,
 			Human: "Restart",
 			Icon:  "fa-repeat",
-			Rank:  4,
+			Rank:  5,
 		},
 		{
 			ID:    PauseContainer,
 			Human: "Pause",
 			Icon:  "fa-pause",
-			Rank:  5,
+			Rank:  6,
 		},
 		{
 			ID:    UnpauseContainer,
 			Human: "Unpause",
 			Icon:  "fa-play",
-			Rank:  6,
+			Rank:  7,
 		},
 		{
 			ID:    StopContainer,
 			Human: "Stop",
 			Icon:  "fa-stop",
-			Rank:  7,
+			Rank:  8,
 		},
 		{
 			ID:    RemoveContainer,
 			Human: "Remove",
 			Icon:  "fa-trash-o",
-			Rank:  8,
+			Rank:  9,
+		},
+	}
+
+	ContainerImageControls = []report.Control{
+		{
+			ID:    ImageContainers,
+			Human: "List containers",
+			Icon:  "fa-list",
+			Rank:  1,
+		},
+		{
+			ID:    PullImage,
+			Human: "Pull latest",
+			Icon:  "fa-cloud-download",
+			Rank:  2,
+		},
+		{
+			ID:    RemoveImage,
+			Human: "Remove",
+			Icon:  "fa-trash-o",
+			Rank:  3,
 		},
 	}
 )
@@ -221,13 +249,17 @@ func (r *Reporter) containerImageTopology() report.Topology {
 	result := report.MakeTopology().
 		WithMetadataTemplates(ContainerImageMetadataTemplates).
 		WithTableTemplates(ContainerImageTableTemplates)
+	result.Controls.AddControls(ContainerImageControls)
 
 	r.registry.WalkImages(func(image *docker_client.APIImages) {
 		imageID := trimImageID(image.ID)
 		nodeID := report.MakeContainerImageNodeID(imageID)
+		// Images are on many hosts, under the same ID, and their controls act
+		// on the copy on one host, so they're offered for each.
 		node := report.MakeNodeWith(nodeID, map[string]string{
 			ImageID: imageID,
-		})
+		}).WithSet(report.ControlProbeIDs, report.MakeStringSet(report.MakeControlProbe(r.hostID, r.probeID))).
+			WithControls(ImageContainers, PullImage, RemoveImage)
 		node = node.AddTable(ImageLabelPrefix, image.Labels)
 
 		if len(image.RepoTags) > 0 {
@@ -108,9 +108,13 @@ func TestReporter(t *testing.T) {
 			}
 		}
 
-		// container image should have no controls
-		if len(rpt.ContainerImage.Controls) != 0 {
-			t.Errorf("Container images should not have any controls")
+		// container image should have controls, for this host
+		if len(rpt.ContainerImage.Controls) == 0 {
+			t.Errorf("Container images should have some controls")
+		}
+		want := report.MakeControlProbe("host1", controlProbeID)
+		if have, _ := node.Sets.Lookup(report.ControlProbeIDs); len(have) != 1 || !have.Contains(want) {
+			t.Errorf("Expected container image %s to be controlled by %q, got %v", containerImageNodeID, want, have)
 		}
 	}
 }
@@ -0,0 +1,166 @@
+package election
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultLease is how long a leader holds the lock without renewing it.
+// Leaders renew it three times per lease, and step down if they can't renew
+// it for two thirds of one, so others can take over a few seconds after a
+// leader goes away.
+const DefaultLease = 6 * time.Second
+
+// Lock is something probes take turns to hold.
+type Lock interface {
+	// TryAcquire takes the lock for holder for the lease, or renews it if
+	// holder already has it. It returns whoever holds the lock afterwards.
+	TryAcquire(holder string, lease time.Duration) (string, error)
+
+	// Release gives up the lock, if holder has it, so another can take it
+	// straight away.
+	Release(holder string) error
+}
+
+// Leader says whether this probe is the leader.
+type Leader interface {
+	IsLeader() bool
+}
+
+type always struct{}
+
+func (always) IsLeader() bool { return true }
+
+// Always is the leader; it's for when there's no election.
+var Always Leader = always{}
+
+// Elector takes part in an election for a lock, with an identity, usually
+// the probe ID.
+type Elector struct {
+	lock     Lock
+	identity string
+	lease    time.Duration
+	quit     chan struct{}
+	done     chan struct{}
+
+	mtx     sync.Mutex
+	leader  string
+	renewed time.Time
+}
+
+// NewElector starts taking part in an election. Don't forget to Stop it.
+func NewElector(lock Lock, identity string, lease time.Duration) *Elector {
+	e := &Elector{
+		lock:     lock,
+		identity: identity,
+		lease:    lease,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+func (e *Elector) loop() {
+	defer close(e.done)
+	e.tryAcquire()
+	t := time.NewTicker(e.lease / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			e.tryAcquire()
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+func (e *Elector) tryAcquire() {
+	wasLeader := e.IsLeader()
+	leader, err := e.lock.TryAcquire(e.identity, e.lease)
+	if err != nil {
+		log.Warnf("Leader election: %v", err)
+	}
+
+	e.mtx.Lock()
+	if err == nil {
+		e.leader = leader
+		if leader == e.identity {
+			e.renewed = time.Now()
+		}
+	}
+	e.mtx.Unlock()
+
+	switch isLeader := e.IsLeader(); {
+	case isLeader && !wasLeader:
+		log.Infof("Leader election: %s is now the leader", e.identity)
+	case !isLeader && wasLeader:
+		log.Infof("Leader election: %s is no longer the leader", e.identity)
+	}
+}
+
+// IsLeader says whether we are the leader. Leaders which haven't been able
+// to renew the lock step down before it runs out, so there's never more than
+// one.
+func (e *Elector) IsLeader() bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.leader == e.identity && time.Since(e.renewed) < e.lease*2/3
+}
+
+// Leader returns who we last saw holding the lock.
+func (e *Elector) Leader() string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.leader
+}
+
+// Stop taking part in the election, stepping down if we are the leader.
+func (e *Elector) Stop() {
+	close(e.quit)
+	<-e.done
+	if e.IsLeader() {
+		if err := e.lock.Release(e.identity); err != nil {
+			log.Warnf("Leader election: error releasing lock: %v", err)
+		}
+	}
+	e.mtx.Lock()
+	e.leader = ""
+	e.mtx.Unlock()
+}
+
+// LocalLock is a Lock for probes in the same process, e.g. in tests.
+type LocalLock struct {
+	mtx     sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+// NewLocalLock makes a new LocalLock.
+func NewLocalLock() *LocalLock {
+	return &LocalLock{}
+}
+
+// TryAcquire implements Lock.
+func (l *LocalLock) TryAcquire(holder string, lease time.Duration) (string, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	if l.holder == "" || l.holder == holder || now.After(l.expires) {
+		l.holder, l.expires = holder, now.Add(lease)
+	}
+	return l.holder, nil
+}
+
+// Release implements Lock.
+func (l *LocalLock) Release(holder string) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
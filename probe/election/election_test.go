@@ -0,0 +1,96 @@
+package election_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/probe/election"
+	"github.com/weaveworks/scope/test"
+)
+
+const lease = 150 * time.Millisecond
+
+func leaders(electors ...*election.Elector) []int {
+	result := []int{}
+	for i, e := range electors {
+		if e.IsLeader() {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func TestElection(t *testing.T) {
+	lock := election.NewLocalLock()
+	electors := []*election.Elector{}
+	for i := 0; i < 3; i++ {
+		electors = append(electors, election.NewElector(lock, fmt.Sprintf("probe%d", i), lease))
+	}
+
+	// One gets it, and keeps it
+	test.Poll(t, lease, 1, func() interface{} { return len(leaders(electors...)) })
+	first := leaders(electors...)[0]
+	time.Sleep(2 * lease)
+	if have := leaders(electors...); len(have) != 1 || have[0] != first {
+		t.Fatalf("Expected probe%d to keep the lead, got %v", first, have)
+	}
+	for _, e := range electors {
+		if want := fmt.Sprintf("probe%d", first); e.Leader() != want {
+			t.Errorf("Expected %s to be seen as the leader, got %q", want, e.Leader())
+		}
+	}
+
+	// Stepping down hands over to another
+	electors[first].Stop()
+	electors = append(electors[:first], electors[first+1:]...)
+	defer func() {
+		for _, e := range electors {
+			e.Stop()
+		}
+	}()
+	test.Poll(t, lease, 1, func() interface{} { return len(leaders(electors...)) })
+}
+
+type brokenLock struct {
+	*election.LocalLock
+	mtx    sync.Mutex
+	broken bool
+}
+
+func (l *brokenLock) TryAcquire(holder string, lease time.Duration) (string, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.broken {
+		return "", fmt.Errorf("broken")
+	}
+	return l.LocalLock.TryAcquire(holder, lease)
+}
+
+func (l *brokenLock) Break() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.broken = true
+}
+
+func TestElectionFailover(t *testing.T) {
+	lock := election.NewLocalLock()
+	isolated := &brokenLock{LocalLock: lock}
+	leader := election.NewElector(isolated, "probe0", lease)
+	defer leader.Stop()
+	test.Poll(t, lease, true, func() interface{} { return leader.IsLeader() })
+	follower := election.NewElector(lock, "probe1", lease)
+	defer follower.Stop()
+
+	// A leader which can't renew the lock steps down before anyone else
+	// can take it
+	isolated.Break()
+	test.Poll(t, 2*lease, []int{1}, func() interface{} {
+		have := leaders(leader, follower)
+		if len(have) > 1 {
+			t.Fatalf("More than one leader")
+		}
+		return have
+	})
+}
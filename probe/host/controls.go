@@ -1,7 +1,10 @@
 package host
 
 import (
+	"os"
 	"os/exec"
+	"syscall"
+	"unsafe"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/kr/pty"
@@ -31,10 +34,15 @@ func (r *Reporter) execHost(req xfer.Request) xfer.Response {
 		return xfer.ResponseError(err)
 	}
 
-	id, pipe, err := controls.NewPipeFromEnds(nil, ptyPipe, r.pipes, req.AppID)
+	id, pipe, err := controls.NewPipeFromEnds(nil, ptyPipe, r.pipes, req)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
+	pipe.OnResize(func(width, height uint16) {
+		if err := setWinsize(ptyPipe, width, height); err != nil {
+			log.Errorf("Error resizing host shell's pty: %v", err)
+		}
+	})
 	pipe.OnClose(func() {
 		if err := cmd.Process.Kill(); err != nil {
 			log.Errorf("Error stopping host shell: %v", err)
@@ -56,3 +64,15 @@ func (r *Reporter) execHost(req xfer.Request) xfer.Response {
 		RawTTY: true,
 	}
 }
+
+// setWinsize sets the size of the pty's terminal, which signals the shell.
+func setWinsize(f *os.File, width, height uint16) error {
+	ws := struct {
+		rows, cols, x, y uint16
+	}{height, width, 0, 0}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCSWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package host
 import (
 	"net"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/weaveworks/scope/common/mtime"
@@ -22,6 +23,11 @@ const (
 	CPUUsage      = "host_cpu_usage_percent"
 	MemoryUsage   = "host_mem_usage_bytes"
 	ScopeVersion  = "host_scope_version"
+
+	ProbeConfigVersion = "host_probe_config_version"
+	ProbeConfig        = "host_probe_config"
+
+	ReporterHealthPrefix = "host_probe_reporter_"
 )
 
 // Exposed for testing.
@@ -41,6 +47,12 @@ var (
 		OS:            {ID: OS, Label: "OS", From: report.FromLatest, Priority: 12},
 		LocalNetworks: {ID: LocalNetworks, Label: "Local Networks", From: report.FromSets, Priority: 13},
 		ScopeVersion:  {ID: ScopeVersion, Label: "Scope Version", From: report.FromLatest, Priority: 14},
+
+		ProbeConfigVersion: {ID: ProbeConfigVersion, Label: "Probe Config", From: report.FromLatest, Priority: 15},
+	}
+
+	TableTemplates = report.TableTemplates{
+		ReporterHealthPrefix: {ID: ReporterHealthPrefix, Label: "Probe Reporters", Prefix: ReporterHealthPrefix},
 	}
 
 	MetricTemplates = report.MetricTemplates{
@@ -58,6 +70,11 @@ type Reporter struct {
 	version      string
 	pipes        controls.PipeClient
 	hostShellCmd []string
+
+	mtx            sync.Mutex
+	configVersion  string
+	config         string
+	reporterHealth func() map[string]string
 }
 
 // NewReporter returns a Reporter which produces a report containing host
@@ -76,7 +93,15 @@ func NewReporter(hostID, hostName, probeID, version string, pipes controls.PipeC
 }
 
 // Name of this reporter, for metrics gathering
-func (Reporter) Name() string { return "Host" }
+func (*Reporter) Name() string { return "Host" }
+
+// SetProbeConfig sets the version of the config pushed to the probe by apps,
+// if any, and the JSON-encoded config the probe is using as a result.
+func (r *Reporter) SetProbeConfig(version, config string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.configVersion, r.config = version, config
+}
 
 // GetLocalNetworks is exported for mocking
 var GetLocalNetworks = func() ([]*net.IPNet, error) {
@@ -94,6 +119,14 @@ var GetLocalNetworks = func() ([]*net.IPNet, error) {
 	return localNets, nil
 }
 
+// SetReporterHealth sets where the reporter gets the health of the probe's
+// reporters from, by reporter name.
+func (r *Reporter) SetReporterHealth(f func() map[string]string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.reporterHealth = f
+}
+
 // Report implements Reporter.
 func (r *Reporter) Report() (report.Report, error) {
 	var (
@@ -129,22 +162,36 @@ func (r *Reporter) Report() (report.Report, error) {
 	memoryUsage, max := GetMemoryUsageBytes()
 	metrics[MemoryUsage] = report.MakeMetric().Add(now, memoryUsage).WithMax(max)
 
-	rep.Host.AddNode(
-		report.MakeNodeWith(report.MakeHostNodeID(r.hostID), map[string]string{
-			report.ControlProbeID: r.probeID,
-			Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
-			HostName:              r.hostName,
-			OS:                    runtime.GOOS,
-			KernelVersion:         kernel,
-			Uptime:                uptime.String(),
-			ScopeVersion:          r.version,
-		}).
-			WithSets(report.EmptySets.
-				Add(LocalNetworks, report.MakeStringSet(localCIDRs...)),
-			).
-			WithMetrics(metrics).
-			WithControls(ExecHost),
-	)
+	latest := map[string]string{
+		report.ControlProbeID: r.probeID,
+		Timestamp:             mtime.Now().UTC().Format(time.RFC3339Nano),
+		HostName:              r.hostName,
+		OS:                    runtime.GOOS,
+		KernelVersion:         kernel,
+		Uptime:                uptime.String(),
+		ScopeVersion:          r.version,
+	}
+	r.mtx.Lock()
+	if r.configVersion != "" {
+		latest[ProbeConfigVersion] = r.configVersion
+	}
+	if r.config != "" {
+		latest[ProbeConfig] = r.config
+	}
+	reporterHealth := r.reporterHealth
+	r.mtx.Unlock()
+
+	node := report.MakeNodeWith(report.MakeHostNodeID(r.hostID), latest).
+		WithSets(report.EmptySets.
+			Add(LocalNetworks, report.MakeStringSet(localCIDRs...)),
+		).
+		WithMetrics(metrics).
+		WithControls(ExecHost)
+	if reporterHealth != nil {
+		node = node.AddTable(ReporterHealthPrefix, reporterHealth())
+		rep.Host = rep.Host.WithTableTemplates(TableTemplates)
+	}
+	rep.Host.AddNode(node)
 
 	rep.Host.Controls.AddControl(report.Control{
 		ID:    ExecHost,
@@ -55,7 +55,11 @@ func TestReporter(t *testing.T) {
 	host.GetMemoryUsageBytes = func() (float64, float64) { return 60.0, 100.0 }
 	host.GetLocalNetworks = func() ([]*net.IPNet, error) { return []*net.IPNet{ipnet}, nil }
 
-	rpt, err := host.NewReporter(hostID, hostname, "", "", nil).Report()
+	r := host.NewReporter(hostID, hostname, "", "", nil)
+	defer r.Stop()
+	r.SetProbeConfig("abc123", `{"spy_interval":"1s"}`)
+	r.SetReporterHealth(func() map[string]string { return map[string]string{"Docker": "ok"} })
+	rpt, err := r.Report()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,6 +79,9 @@ func TestReporter(t *testing.T) {
 		{host.OS, runtime.GOOS},
 		{host.Uptime, uptime},
 		{host.KernelVersion, kernel},
+		{host.ProbeConfigVersion, "abc123"},
+		{host.ProbeConfig, `{"spy_interval":"1s"}`},
+		{host.ReporterHealthPrefix + "Docker", "ok"},
 	} {
 		if have, ok := node.Latest.Lookup(tuple.key); !ok || have != tuple.want {
 			t.Errorf("Expected %s %q, got %q", tuple.key, tuple.want, have)
@@ -94,7 +101,7 @@ func TestReporter(t *testing.T) {
 		} else if sample := metric.LastSample(); sample == nil {
 			t.Errorf("Expected %s metric to have a sample, but there were none", key)
 		} else if sample.Value != wantSample.Value {
-			t.Errorf("Expected %s metric sample %f, got %f", key, wantSample, sample.Value)
+			t.Errorf("Expected %s metric sample %f, got %f", key, wantSample.Value, sample.Value)
 		}
 	}
 }
@@ -31,7 +31,7 @@ func (t Tagger) Tag(r report.Report) (report.Report, error) {
 
 	// Explicitly don't tag Endpoints and Addresses - These topologies include pseudo nodes,
 	// and as such do their own host tagging
-	for _, topology := range []report.Topology{r.Process, r.Container, r.ContainerImage, r.Host, r.Overlay, r.Pod} {
+	for _, topology := range []report.Topology{r.Process, r.Container, r.ContainerImage, r.SystemdService, r.Host, r.Overlay, r.Pod} {
 		for _, node := range topology.Nodes {
 			topology.AddNode(node.WithLatests(metadata).WithParents(parents))
 		}
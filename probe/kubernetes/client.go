@@ -29,19 +29,28 @@ type Client interface {
 
 	WatchPods(f func(Event, Pod))
 
-	GetLogs(namespaceID, podID string) (io.ReadCloser, error)
+	GetLogs(namespaceID, podID string, opts api.PodLogOptions) (io.ReadCloser, error)
+	Exec(namespaceID, podID, container string, command []string) (io.ReadWriteCloser, error)
 	DeletePod(namespaceID, podID string) error
 	ScaleUp(resource, namespaceID, id string) error
 	ScaleDown(resource, namespaceID, id string) error
+	Scale(resource, namespaceID, id string, replicas int) error
+	RestartDeployment(namespaceID, id string) error
+	PauseDeployment(namespaceID, id string) error
+	ResumeDeployment(namespaceID, id string) error
+	RollbackDeployment(namespaceID, id string, revision int64) error
+	RolloutStatus(namespaceID, id string) (updated, desired int, done bool, err error)
 }
 
 type client struct {
 	quit                       chan struct{}
 	resyncPeriod               time.Duration
+	config                     *restclient.Config
 	client                     *unversioned.Client
 	extensionsClient           *unversioned.ExtensionsClient
 	podStore                   *cache.StoreToPodLister
 	serviceStore               *cache.StoreToServiceLister
+	endpointsStore             *cache.StoreToEndpointsLister
 	deploymentStore            *cache.StoreToDeploymentLister
 	replicaSetStore            *cache.StoreToReplicaSetLister
 	replicationControllerStore *cache.StoreToReplicationControllerLister
@@ -62,20 +71,22 @@ func runReflectorUntil(r *cache.Reflector, resyncPeriod time.Duration, stopCh <-
 	go wait.Until(loggingListAndWatch, resyncPeriod, stopCh)
 }
 
+func clientConfig(addr string) (*restclient.Config, error) {
+	if addr != "" {
+		return &restclient.Config{Host: addr}, nil
+	}
+	// If no API server address was provided, assume we are running
+	// inside a pod. Try to connect to the API server through its
+	// Service environment variables, using the default Service
+	// Account Token.
+	return restclient.InClusterConfig()
+}
+
 // NewClient returns a usable Client. Don't forget to Stop it.
 func NewClient(addr string, resyncPeriod time.Duration) (Client, error) {
-	var config *restclient.Config
-	if addr != "" {
-		config = &restclient.Config{Host: addr}
-	} else {
-		// If no API server address was provided, assume we are running
-		// inside a pod. Try to connect to the API server through its
-		// Service environment variables, using the default Service
-		// Account Token.
-		var err error
-		if config, err = restclient.InClusterConfig(); err != nil {
-			return nil, err
-		}
+	config, err := clientConfig(addr)
+	if err != nil {
+		return nil, err
 	}
 
 	c, err := unversioned.New(config)
@@ -91,12 +102,14 @@ func NewClient(addr string, resyncPeriod time.Duration) (Client, error) {
 	result := &client{
 		quit:             make(chan struct{}),
 		resyncPeriod:     resyncPeriod,
+		config:           config,
 		client:           c,
 		extensionsClient: ec,
 	}
 
 	result.podStore = &cache.StoreToPodLister{Store: result.setupStore(c, "pods", &api.Pod{})}
 	result.serviceStore = &cache.StoreToServiceLister{Store: result.setupStore(c, "services", &api.Service{})}
+	result.endpointsStore = &cache.StoreToEndpointsLister{Store: result.setupStore(c, "endpoints", &api.Endpoints{})}
 	result.replicationControllerStore = &cache.StoreToReplicationControllerLister{Store: result.setupStore(c, "replicationcontrollers", &api.ReplicationController{})}
 	result.nodeStore = &cache.StoreToNodeLister{Store: result.setupStore(c, "nodes", &api.Node{})}
 
@@ -153,13 +166,28 @@ func (c *client) WalkServices(f func(Service) error) error {
 		return err
 	}
 	for i := range list.Items {
-		if err := f(NewService(&(list.Items[i]))); err != nil {
+		service := &(list.Items[i])
+		if err := f(NewService(service, c.serviceEndpoints(service))); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// serviceEndpoints returns the endpoints of a service, or nil if they are not
+// in the store.
+func (c *client) serviceEndpoints(service *api.Service) *api.Endpoints {
+	key, err := cache.MetaNamespaceKeyFunc(service)
+	if err != nil {
+		return nil
+	}
+	obj, ok, err := c.endpointsStore.GetByKey(key)
+	if err != nil || !ok {
+		return nil
+	}
+	return obj.(*api.Endpoints)
+}
+
 func (c *client) WalkDeployments(f func(Deployment) error) error {
 	if c.deploymentStore == nil {
 		return nil
@@ -221,16 +249,22 @@ func (c *client) WalkNodes(f func(*api.Node) error) error {
 	return nil
 }
 
-func (c *client) GetLogs(namespaceID, podID string) (io.ReadCloser, error) {
-	return c.client.RESTClient.Get().
+func (c *client) GetLogs(namespaceID, podID string, opts api.PodLogOptions) (io.ReadCloser, error) {
+	req := c.client.RESTClient.Get().
 		Namespace(namespaceID).
 		Name(podID).
 		Resource("pods").
 		SubResource("log").
-		Param("follow", strconv.FormatBool(true)).
-		Param("previous", strconv.FormatBool(false)).
-		Param("timestamps", strconv.FormatBool(true)).
-		Stream()
+		Param("follow", strconv.FormatBool(opts.Follow)).
+		Param("previous", strconv.FormatBool(opts.Previous)).
+		Param("timestamps", strconv.FormatBool(true))
+	if opts.Container != "" {
+		req = req.Param("container", opts.Container)
+	}
+	if opts.TailLines != nil {
+		req = req.Param("tailLines", strconv.FormatInt(*opts.TailLines, 10))
+	}
+	return req.Stream()
 }
 
 func (c *client) DeletePod(namespaceID, podID string) error {
@@ -252,6 +286,68 @@ func (c *client) ScaleDown(resource, namespaceID, id string) error {
 	})
 }
 
+func (c *client) Scale(resource, namespaceID, id string, replicas int) error {
+	return c.modifyScale(resource, namespaceID, id, func(scale *extensions.Scale) {
+		scale.Spec.Replicas = replicas
+	})
+}
+
+func (c *client) RestartDeployment(namespaceID, id string) error {
+	return c.modifyDeployment(namespaceID, id, func(d *extensions.Deployment) {
+		// Changing the pod template triggers a new rollout.
+		if d.Spec.Template.ObjectMeta.Annotations == nil {
+			d.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+		}
+		d.Spec.Template.ObjectMeta.Annotations[restartedAtAnnotation] = time.Now().Format(time.RFC3339)
+	})
+}
+
+func (c *client) PauseDeployment(namespaceID, id string) error {
+	return c.modifyDeployment(namespaceID, id, func(d *extensions.Deployment) {
+		d.Spec.Paused = true
+	})
+}
+
+func (c *client) ResumeDeployment(namespaceID, id string) error {
+	return c.modifyDeployment(namespaceID, id, func(d *extensions.Deployment) {
+		d.Spec.Paused = false
+	})
+}
+
+func (c *client) RollbackDeployment(namespaceID, id string, revision int64) error {
+	return c.extensionsClient.Deployments(namespaceID).Rollback(&extensions.DeploymentRollback{
+		Name:       id,
+		RollbackTo: extensions.RollbackConfig{Revision: revision},
+	})
+}
+
+// RolloutStatus returns how many of a deployment's replicas have been
+// updated, out of how many are wanted, and whether its rollout is complete.
+func (c *client) RolloutStatus(namespaceID, id string) (int, int, bool, error) {
+	d, err := c.extensionsClient.Deployments(namespaceID).Get(id)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	desired := d.Spec.Replicas
+	done := d.Status.ObservedGeneration >= d.Generation &&
+		d.Spec.RollbackTo == nil &&
+		d.Status.UpdatedReplicas == desired &&
+		d.Status.Replicas == desired &&
+		d.Status.AvailableReplicas == desired
+	return d.Status.UpdatedReplicas, desired, done, nil
+}
+
+func (c *client) modifyDeployment(namespace, id string, f func(*extensions.Deployment)) error {
+	deployments := c.extensionsClient.Deployments(namespace)
+	d, err := deployments.Get(id)
+	if err != nil {
+		return err
+	}
+	f(d)
+	_, err = deployments.Update(d)
+	return err
+}
+
 func (c *client) modifyScale(resource, namespace, id string, f func(*extensions.Scale)) error {
 	scaler := c.extensionsClient.Scales(namespace)
 	scale, err := scaler.Get(resource, id)
@@ -1,8 +1,14 @@
 package kubernetes
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/api"
 
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe/controls"
@@ -12,14 +18,51 @@ import (
 // Control IDs used by the kubernetes integration.
 const (
 	GetLogs   = "kubernetes_get_logs"
+	ExecPod   = "kubernetes_exec"
 	DeletePod = "kubernetes_delete_pod"
 	ScaleUp   = "kubernetes_scale_up"
 	ScaleDown = "kubernetes_scale_down"
+	Scale     = "kubernetes_scale"
+
+	RestartDeployment  = "kubernetes_restart_deployment"
+	PauseDeployment    = "kubernetes_pause_deployment"
+	ResumeDeployment   = "kubernetes_resume_deployment"
+	RollbackDeployment = "kubernetes_rollback_deployment"
+
+	// ReplicasArg is the argument to Scale.
+	ReplicasArg = "replicas"
+
+	// ContainerArg selects the container of a pod for GetLogs and ExecPod.
+	// If empty, the pod's first container is used.
+	ContainerArg = "container"
+
+	// Arguments to GetLogs
+	FollowArg   = "follow"
+	PreviousArg = "previous"
+	TailArg     = "tail"
+
+	// RevisionArg is the argument to RollbackDeployment. Zero means the
+	// previous revision.
+	RevisionArg = "revision"
+
+	restartedAtAnnotation = "scope.weave.works/restartedAt"
+
+	rolloutPollInterval = 2 * time.Second
 )
 
+var execCommand = []string{"/bin/sh", "-c", "TERM=xterm exec $( (type getent > /dev/null 2>&1  && getent passwd root | cut -d: -f7 2>/dev/null) || echo /bin/sh)"}
+
 // GetLogs is the control to get the logs for a kubernetes pod
 func (r *Reporter) GetLogs(req xfer.Request, namespaceID, podID string) xfer.Response {
-	readCloser, err := r.client.GetLogs(namespaceID, podID)
+	opts := api.PodLogOptions{
+		Container: r.podContainer(req, namespaceID, podID),
+	}
+	opts.Follow, _ = strconv.ParseBool(req.Args[FollowArg])
+	opts.Previous, _ = strconv.ParseBool(req.Args[PreviousArg])
+	if tail, err := strconv.ParseInt(req.Args[TailArg], 10, 64); err == nil {
+		opts.TailLines = &tail
+	}
+	readCloser, err := r.client.GetLogs(namespaceID, podID, opts)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
@@ -31,7 +74,7 @@ func (r *Reporter) GetLogs(req xfer.Request, namespaceID, podID string) xfer.Res
 		readCloser,
 		ioutil.Discard,
 	}
-	id, pipe, err := controls.NewPipeFromEnds(nil, readWriter, r.pipes, req.AppID)
+	id, pipe, err := controls.NewPipeFromEnds(nil, readWriter, r.pipes, req)
 	if err != nil {
 		return xfer.ResponseError(err)
 	}
@@ -43,6 +86,45 @@ func (r *Reporter) GetLogs(req xfer.Request, namespaceID, podID string) xfer.Res
 	}
 }
 
+// ExecPod is the control to run a shell in a container of a kubernetes pod
+func (r *Reporter) ExecPod(req xfer.Request, namespaceID, podID string) xfer.Response {
+	container := r.podContainer(req, namespaceID, podID)
+	stream, err := r.client.Exec(namespaceID, podID, container, execCommand)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	id, pipe, err := controls.NewPipeFromEnds(nil, stream, r.pipes, req)
+	if err != nil {
+		stream.Close()
+		return xfer.ResponseError(err)
+	}
+	pipe.OnClose(func() {
+		stream.Close()
+	})
+	return xfer.Response{
+		Pipe:   id,
+		RawTTY: true,
+	}
+}
+
+// podContainer returns the container named in the request, or the pod's
+// first container if there isn't one.
+func (r *Reporter) podContainer(req xfer.Request, namespaceID, podID string) string {
+	if container := req.Args[ContainerArg]; container != "" {
+		return container
+	}
+	container := ""
+	r.client.WalkPods(func(p Pod) error {
+		if p.Namespace() == namespaceID && p.Name() == podID {
+			if names := p.ContainerNames(); len(names) > 0 {
+				container = names[0]
+			}
+		}
+		return nil
+	})
+	return container
+}
+
 func (r *Reporter) deletePod(req xfer.Request, namespaceID, podID string) xfer.Response {
 	if err := r.client.DeletePod(namespaceID, podID); err != nil {
 		return xfer.ResponseError(err)
@@ -143,16 +225,115 @@ func (r *Reporter) ScaleDown(req xfer.Request, resource, namespace, id string) x
 	return xfer.ResponseError(r.client.ScaleDown(resource, namespace, id))
 }
 
+// Scale is the control to scale a deployment to a given number of replicas
+func (r *Reporter) Scale(req xfer.Request, resource, namespace, id string) xfer.Response {
+	replicas, err := strconv.Atoi(req.Args[ReplicasArg])
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.ResponseError(r.client.Scale(resource, namespace, id, replicas))
+}
+
+// captureDeployment only accepts deployments; the rollout controls don't
+// apply to other resources.
+func (r *Reporter) captureDeployment(f func(xfer.Request, string, string) xfer.Response) func(xfer.Request) xfer.Response {
+	return r.CaptureResource(func(req xfer.Request, resource, namespace, id string) xfer.Response {
+		if resource != "deployment" {
+			return xfer.ResponseErrorf("Not a deployment: %s", req.NodeID)
+		}
+		return f(req, namespace, id)
+	})
+}
+
+// captureDeploymentJob is captureDeployment, for jobs.
+func (r *Reporter) captureDeploymentJob(f func(context.Context, xfer.Request, controls.ProgressFunc, string, string) xfer.Response) controls.JobFunc {
+	return func(ctx context.Context, req xfer.Request, progress controls.ProgressFunc) xfer.Response {
+		return r.captureDeployment(func(req xfer.Request, namespace, id string) xfer.Response {
+			return f(ctx, req, progress, namespace, id)
+		})(req)
+	}
+}
+
+// RestartDeployment is the control to restart all pods of a deployment,
+// by rolling it out again, as a job which lasts until the rollout is done
+func (r *Reporter) RestartDeployment(ctx context.Context, req xfer.Request, progress controls.ProgressFunc, namespace, id string) xfer.Response {
+	if err := r.client.RestartDeployment(namespace, id); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return r.waitForRollout(ctx, progress, namespace, id)
+}
+
+// PauseDeployment is the control to pause the rollout of a deployment
+func (r *Reporter) PauseDeployment(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.PauseDeployment(namespace, id))
+}
+
+// ResumeDeployment is the control to resume the rollout of a deployment
+func (r *Reporter) ResumeDeployment(req xfer.Request, namespace, id string) xfer.Response {
+	return xfer.ResponseError(r.client.ResumeDeployment(namespace, id))
+}
+
+// RollbackDeployment is the control to roll a deployment back to a previous
+// revision, as a job which lasts until the rollout is done
+func (r *Reporter) RollbackDeployment(ctx context.Context, req xfer.Request, progress controls.ProgressFunc, namespace, id string) xfer.Response {
+	revision, err := strconv.ParseInt(req.Args[RevisionArg], 10, 64)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	if err := r.client.RollbackDeployment(namespace, id, revision); err != nil {
+		return xfer.ResponseError(err)
+	}
+	return r.waitForRollout(ctx, progress, namespace, id)
+}
+
+// waitForRollout waits for a deployment's rollout to complete, reporting the
+// fraction of its replicas which have been updated. Cancelling the job only
+// stops the wait; the rollout carries on, and can be paused with
+// PauseDeployment.
+func (r *Reporter) waitForRollout(ctx context.Context, progress controls.ProgressFunc, namespace, id string) xfer.Response {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for {
+		updated, desired, done, err := r.client.RolloutStatus(namespace, id)
+		if err != nil {
+			return xfer.ResponseError(err)
+		}
+		if done {
+			return xfer.Response{Value: fmt.Sprintf("Rolled out %s/%s", namespace, id)}
+		}
+		if desired > 0 {
+			progress(100*updated/desired, fmt.Sprintf("%d of %d replicas updated", updated, desired))
+		}
+		select {
+		case <-ctx.Done():
+			return xfer.ResponseErrorf("Stopped waiting for the rollout of %s/%s, which carries on", namespace, id)
+		case <-ticker.C:
+		}
+	}
+}
+
 func (r *Reporter) registerControls() {
-	controls.Register(GetLogs, r.CapturePod(r.GetLogs))
+	controls.RegisterWithArgs(GetLogs, logsArgs, r.CapturePod(r.GetLogs))
+	controls.RegisterWithArgs(ExecPod, execArgs, r.CapturePod(r.ExecPod))
 	controls.Register(DeletePod, r.CapturePod(r.deletePod))
 	controls.Register(ScaleUp, r.CaptureResource(r.ScaleUp))
 	controls.Register(ScaleDown, r.CaptureResource(r.ScaleDown))
+	controls.RegisterWithArgs(Scale, scaleArgs, r.CaptureResource(r.Scale))
+	controls.RegisterJob(RestartDeployment, nil, r.captureDeploymentJob(r.RestartDeployment))
+	controls.Register(PauseDeployment, r.captureDeployment(r.PauseDeployment))
+	controls.Register(ResumeDeployment, r.captureDeployment(r.ResumeDeployment))
+	controls.RegisterJob(RollbackDeployment, rollbackArgs, r.captureDeploymentJob(r.RollbackDeployment))
 }
 
 func (r *Reporter) deregisterControls() {
 	controls.Rm(GetLogs)
+	controls.Rm(ExecPod)
 	controls.Rm(DeletePod)
 	controls.Rm(ScaleUp)
 	controls.Rm(ScaleDown)
+	controls.Rm(Scale)
+	controls.Rm(RestartDeployment)
+	controls.Rm(PauseDeployment)
+	controls.Rm(ResumeDeployment)
+	controls.Rm(RollbackDeployment)
 }
@@ -16,6 +16,10 @@ const (
 	AvailableReplicas   = "kubernetes_available_replicas"
 	UnavailableReplicas = "kubernetes_unavailable_replicas"
 	Strategy            = "kubernetes_strategy"
+	Paused              = "kubernetes_paused"
+	RevisionPrefix      = "kubernetes_revision_"
+
+	revisionAnnotation = "deployment.kubernetes.io/revision"
 )
 
 // Deployment represents a Kubernetes deployment
@@ -46,6 +50,12 @@ func (d *deployment) Selector() labels.Selector {
 }
 
 func (d *deployment) GetNode(probeID string) report.Node {
+	controls := []string{ScaleUp, ScaleDown, Scale, RestartDeployment, RollbackDeployment}
+	if d.Spec.Paused {
+		controls = append(controls, ResumeDeployment)
+	} else {
+		controls = append(controls, PauseDeployment)
+	}
 	return d.MetaNode(report.MakeDeploymentNodeID(d.UID())).WithLatests(map[string]string{
 		ObservedGeneration:    fmt.Sprint(d.Status.ObservedGeneration),
 		DesiredReplicas:       fmt.Sprint(d.Spec.Replicas),
@@ -54,6 +64,7 @@ func (d *deployment) GetNode(probeID string) report.Node {
 		AvailableReplicas:     fmt.Sprint(d.Status.AvailableReplicas),
 		UnavailableReplicas:   fmt.Sprint(d.Status.UnavailableReplicas),
 		Strategy:              string(d.Spec.Strategy.Type),
+		Paused:                fmt.Sprint(d.Spec.Paused),
 		report.ControlProbeID: probeID,
-	}).WithControls(ScaleUp, ScaleDown)
+	}).WithControls(controls...)
 }
@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+)
+
+const endpointsResyncPeriod = time.Minute
+
+// WatchEndpoints watches the endpoints of a service, and calls f with their
+// ready addresses, as "ip:port", whenever they change. The port is a name or
+// number, and may be empty if the service has only one. Call stop to stop
+// watching.
+func WatchEndpoints(addr, namespace, service, port string, f func([]string)) (stop func(), err error) {
+	config, err := clientConfig(addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := unversioned.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	quit := make(chan struct{})
+	lw := cache.NewListWatchFromClient(c, "endpoints", namespace, fields.OneTermEqualSelector("metadata.name", service))
+	store := NewEventStore(func(e Event, o interface{}) {
+		endpoints, ok := o.(*api.Endpoints)
+		if !ok || e == DELETE {
+			f([]string{})
+			return
+		}
+		addrs := EndpointsAddresses(endpoints, port)
+		if len(addrs) == 0 {
+			log.Warnf("Kubernetes service %s/%s has no ready endpoints on port %q", namespace, service, port)
+		}
+		f(addrs)
+	}, cache.MetaNamespaceKeyFunc)
+	runReflectorUntil(cache.NewReflector(lw, &api.Endpoints{}, store, endpointsResyncPeriod), endpointsResyncPeriod, quit)
+	return func() { close(quit) }, nil
+}
+
+// EndpointsAddresses returns the ready addresses of endpoints, as "ip:port",
+// for the port with the given name or number, or the only port if it's
+// empty.
+func EndpointsAddresses(endpoints *api.Endpoints, port string) []string {
+	result := []string{}
+	for _, subset := range endpoints.Subsets {
+		number, ok := subsetPort(subset.Ports, port)
+		if !ok {
+			continue
+		}
+		for _, addr := range subset.Addresses {
+			result = append(result, net.JoinHostPort(addr.IP, number))
+		}
+	}
+	return result
+}
+
+func subsetPort(ports []api.EndpointPort, port string) (string, bool) {
+	for _, p := range ports {
+		number := strconv.Itoa(p.Port)
+		if (port == "" && len(ports) == 1) || port == p.Name || port == number {
+			return number, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,40 @@
+package kubernetes_test
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"github.com/weaveworks/scope/probe/kubernetes"
+)
+
+func TestEndpointsAddresses(t *testing.T) {
+	endpoints := &api.Endpoints{
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses:         []api.EndpointAddress{{IP: "10.32.0.1"}, {IP: "10.32.0.2"}},
+				NotReadyAddresses: []api.EndpointAddress{{IP: "10.32.0.3"}},
+				Ports:             []api.EndpointPort{{Name: "app", Port: 4040}, {Name: "metrics", Port: 9090}},
+			},
+		},
+	}
+	for _, c := range []struct {
+		port string
+		want []string
+	}{
+		{"app", []string{"10.32.0.1:4040", "10.32.0.2:4040"}},
+		{"9090", []string{"10.32.0.1:9090", "10.32.0.2:9090"}},
+		{"", []string{}}, // ambiguous with more than one port
+		{"missing", []string{}},
+	} {
+		if have := kubernetes.EndpointsAddresses(endpoints, c.port); !reflect.DeepEqual(c.want, have) {
+			t.Errorf("%q: want %v, have %v", c.port, c.want, have)
+		}
+	}
+
+	endpoints.Subsets[0].Ports = endpoints.Subsets[0].Ports[:1]
+	if have, want := kubernetes.EndpointsAddresses(endpoints, ""), []string{"10.32.0.1:4040", "10.32.0.2:4040"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,126 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/kubernetes/pkg/client/restclient"
+)
+
+// The API server's websocket exec protocol prefixes every message with the
+// channel it belongs to.
+const (
+	execProtocol = "channel.k8s.io"
+
+	stdinChannel  = 0
+	stdoutChannel = 1
+	stderrChannel = 2
+	errorChannel  = 3
+)
+
+// Exec runs command in a container of a pod, with a TTY. Reads from the
+// returned stream are the command's output; writes are its input.
+func (c *client) Exec(namespaceID, podID, container string, command []string) (io.ReadWriteCloser, error) {
+	req := c.client.RESTClient.Get().
+		Namespace(namespaceID).
+		Name(podID).
+		Resource("pods").
+		SubResource("exec").
+		Param("container", container).
+		Param("stdin", "true").
+		Param("stdout", "true").
+		Param("tty", "true")
+	for _, arg := range command {
+		req = req.Param("command", arg)
+	}
+	url := req.URL()
+	if url.Scheme == "https" {
+		url.Scheme = "wss"
+	} else {
+		url.Scheme = "ws"
+	}
+
+	tlsConfig, err := restclient.TLSConfigFor(c.config)
+	if err != nil {
+		return nil, err
+	}
+	dialer := websocket.Dialer{
+		TLSClientConfig: tlsConfig,
+		Subprotocols:    []string{execProtocol},
+	}
+	header := http.Header{}
+	if c.config.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	} else if c.config.Username != "" {
+		r := http.Request{Header: header}
+		r.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	conn, _, err := dialer.Dial(url.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	return &execStream{conn: conn}, nil
+}
+
+// execStream adapts a websocket speaking the exec protocol to an
+// io.ReadWriteCloser.
+type execStream struct {
+	conn   *websocket.Conn
+	reader io.Reader
+
+	writeMtx sync.Mutex
+}
+
+func (s *execStream) Read(p []byte) (int, error) {
+	for {
+		if s.reader == nil {
+			_, msg, err := s.conn.ReadMessage()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if len(msg) == 0 {
+				continue
+			}
+			switch msg[0] {
+			case stdoutChannel, stderrChannel:
+				s.reader = bytes.NewReader(msg[1:])
+			case errorChannel:
+				if len(msg) > 1 {
+					return 0, fmt.Errorf("%s", msg[1:])
+				}
+				continue
+			default:
+				continue
+			}
+		}
+		n, err := s.reader.Read(p)
+		if err == io.EOF {
+			s.reader = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, nil
+	}
+}
+
+func (s *execStream) Write(p []byte) (int, error) {
+	s.writeMtx.Lock()
+	defer s.writeMtx.Unlock()
+	msg := append([]byte{stdinChannel}, p...)
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *execStream) Close() error {
+	return s.conn.Close()
+}
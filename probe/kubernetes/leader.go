@@ -0,0 +1,158 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/client/unversioned"
+
+	"github.com/weaveworks/scope/probe/election"
+)
+
+const (
+	// LeaderAnnotation is the annotation on the lock's Endpoints object
+	// with who holds it.
+	LeaderAnnotation = "scope.weave.works/leader"
+
+	serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+type leaderRecord struct {
+	Holder    string    `json:"holder"`
+	RenewTime time.Time `json:"renewTime"`
+}
+
+// leaderLock is an election.Lock kept in an annotation on an Endpoints
+// object, as Kubernetes components do. Updates of the object are
+// conditional on its resource version, so only one probe can take the lock
+// at a time. Probes' clocks may not agree, so a lock runs out a lease after
+// the probe last saw it change, rather than after its renew time.
+type leaderLock struct {
+	endpoints unversioned.EndpointsInterface
+	name      string
+
+	observed     leaderRecord
+	observedTime time.Time
+}
+
+// NewLeaderLock makes an election.Lock for probes kept in the Endpoints
+// object named by lock, as [namespace/]name. The namespace defaults to the
+// probe's own, if it's running in a pod, or "default" if not.
+func NewLeaderLock(addr, lock string) (election.Lock, error) {
+	namespace, name := "", lock
+	if i := strings.Index(lock, "/"); i >= 0 {
+		namespace, name = lock[:i], lock[i+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid leader lock %q", lock)
+	}
+	if namespace == "" {
+		namespace = api.NamespaceDefault
+		if buf, err := ioutil.ReadFile(serviceAccountNamespace); err == nil {
+			namespace = strings.TrimSpace(string(buf))
+		}
+	}
+
+	config, err := clientConfig(addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := unversioned.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &leaderLock{endpoints: c.Endpoints(namespace), name: name}, nil
+}
+
+func (l *leaderLock) TryAcquire(holder string, lease time.Duration) (string, error) {
+	record := leaderRecord{Holder: holder, RenewTime: time.Now()}
+	endpoints, err := l.endpoints.Get(l.name)
+	if errors.IsNotFound(err) {
+		endpoints = &api.Endpoints{ObjectMeta: api.ObjectMeta{Name: l.name}}
+		if err := setRecord(endpoints, record); err != nil {
+			return "", err
+		}
+		if _, err := l.endpoints.Create(endpoints); errors.IsAlreadyExists(err) {
+			// Someone else got there first; we'll see who next time.
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		return l.observe(record), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	current, err := getRecord(endpoints)
+	if err != nil {
+		return "", err
+	}
+	if current.Holder != l.observed.Holder || !current.RenewTime.Equal(l.observed.RenewTime) {
+		l.observe(current)
+	}
+	if current.Holder != "" && current.Holder != holder && time.Since(l.observedTime) < lease {
+		return current.Holder, nil
+	}
+
+	if err := setRecord(endpoints, record); err != nil {
+		return "", err
+	}
+	if _, err := l.endpoints.Update(endpoints); errors.IsConflict(err) {
+		// Someone else got there first; we'll see who next time.
+		return current.Holder, nil
+	} else if err != nil {
+		return "", err
+	}
+	return l.observe(record), nil
+}
+
+func (l *leaderLock) Release(holder string) error {
+	endpoints, err := l.endpoints.Get(l.name)
+	if err != nil {
+		return err
+	}
+	current, err := getRecord(endpoints)
+	if err != nil {
+		return err
+	}
+	if current.Holder != holder {
+		return nil
+	}
+	if err := setRecord(endpoints, leaderRecord{RenewTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err = l.endpoints.Update(endpoints)
+	return err
+}
+
+func (l *leaderLock) observe(record leaderRecord) string {
+	l.observed, l.observedTime = record, time.Now()
+	return record.Holder
+}
+
+func getRecord(endpoints *api.Endpoints) (leaderRecord, error) {
+	var record leaderRecord
+	if buf, ok := endpoints.Annotations[LeaderAnnotation]; ok {
+		if err := json.Unmarshal([]byte(buf), &record); err != nil {
+			return record, fmt.Errorf("invalid %s annotation: %v", LeaderAnnotation, err)
+		}
+	}
+	return record, nil
+}
+
+func setRecord(endpoints *api.Endpoints, record leaderRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if endpoints.Annotations == nil {
+		endpoints.Annotations = map[string]string{}
+	}
+	endpoints.Annotations[LeaderAnnotation] = string(buf)
+	return nil
+}
@@ -25,6 +25,7 @@ type Meta interface {
 	Namespace() string
 	Created() string
 	Labels() map[string]string
+	Annotations() map[string]string
 	MetaNode(id string) report.Node
 }
 
@@ -56,6 +57,10 @@ func (m meta) Labels() map[string]string {
 	return m.ObjectMeta.Labels
 }
 
+func (m meta) Annotations() map[string]string {
+	return m.ObjectMeta.Annotations
+}
+
 // MetaNode gets the node metadata
 func (m meta) MetaNode(id string) report.Node {
 	return report.MakeNodeWith(id, map[string]string{
@@ -63,5 +68,10 @@ func (m meta) MetaNode(id string) report.Node {
 		Name:      m.Name(),
 		Namespace: m.Namespace(),
 		Created:   m.Created(),
-	}).AddTable(LabelPrefix, m.Labels())
+	}).
+		WithParents(report.EmptySets.Add(
+			report.Namespace,
+			report.MakeStringSet(report.MakeNamespaceNodeID(m.Namespace())),
+		)).
+		AddTable(LabelPrefix, m.Labels())
 }
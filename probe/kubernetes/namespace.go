@@ -0,0 +1,15 @@
+package kubernetes
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// NamespaceNode makes a node for the namespace with the given name. We don't
+// watch namespaces themselves; they are implied by the objects in them.
+func NamespaceNode(name string) report.Node {
+	return report.MakeNodeWith(report.MakeNamespaceNodeID(name), map[string]string{
+		ID:        name,
+		Name:      name,
+		Namespace: name,
+	})
+}
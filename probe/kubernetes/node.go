@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// These constants are keys used in node metadata
+const (
+	Unschedulable     = "kubernetes_unschedulable"
+	KernelVersion     = "kubernetes_kernel_version"
+	KubeletVersion    = "kubernetes_kubelet_version"
+	Taints            = "kubernetes_taints"
+	ConditionPrefix   = "kubernetes_condition_"
+	CapacityPrefix    = "kubernetes_capacity_"
+	AllocatablePrefix = "kubernetes_allocatable_"
+
+	// taintsAnnotation is where alpha versions of kubernetes keep node taints.
+	taintsAnnotation = "scheduler.alpha.kubernetes.io/taints"
+)
+
+// Node represents a Kubernetes node
+type Node interface {
+	Name() string
+	AddParent(topology, id string)
+	GetNode() report.Node
+}
+
+type node struct {
+	*api.Node
+	parents report.Sets
+}
+
+// NewNode creates a new Node
+func NewNode(n *api.Node) Node {
+	return &node{Node: n, parents: report.MakeSets()}
+}
+
+func (n *node) Name() string {
+	return n.ObjectMeta.Name
+}
+
+func (n *node) AddParent(topology, id string) {
+	n.parents = n.parents.Add(topology, report.MakeStringSet(id))
+}
+
+type taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Effect string `json:"effect"`
+}
+
+// taints returns the node taints, as "key=value:effect".
+func (n *node) taints() []string {
+	result := []string{}
+	var taints []taint
+	if err := json.Unmarshal([]byte(n.ObjectMeta.Annotations[taintsAnnotation]), &taints); err != nil {
+		return result
+	}
+	for _, t := range taints {
+		result = append(result, fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect))
+	}
+	return result
+}
+
+func resources(list api.ResourceList) map[string]string {
+	result := map[string]string{}
+	for name, quantity := range list {
+		result[string(name)] = quantity.String()
+	}
+	return result
+}
+
+func (n *node) GetNode() report.Node {
+	conditions := map[string]string{}
+	for _, condition := range n.Status.Conditions {
+		conditions[string(condition.Type)] = string(condition.Status)
+	}
+	return report.MakeNodeWith(report.MakeKubernetesNodeNodeID(n.Name()), map[string]string{
+		ID:             n.Name(),
+		Name:           n.Name(),
+		Created:        n.ObjectMeta.CreationTimestamp.Format(time.RFC822),
+		Unschedulable:  fmt.Sprint(n.Spec.Unschedulable),
+		KernelVersion:  n.Status.NodeInfo.KernelVersion,
+		KubeletVersion: n.Status.NodeInfo.KubeletVersion,
+	}).
+		WithSets(report.EmptySets.Add(Taints, report.MakeStringSet(n.taints()...))).
+		WithParents(n.parents).
+		AddTable(LabelPrefix, n.ObjectMeta.Labels).
+		AddTable(ConditionPrefix, conditions).
+		AddTable(CapacityPrefix, resources(n.Status.Capacity)).
+		AddTable(AllocatablePrefix, resources(n.Status.Allocatable))
+}
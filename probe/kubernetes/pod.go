@@ -17,6 +17,7 @@ type Pod interface {
 	Meta
 	AddParent(topology, id string)
 	NodeName() string
+	ContainerNames() []string
 	GetNode(probeID string) report.Node
 }
 
@@ -56,6 +57,14 @@ func (p *pod) NodeName() string {
 	return p.Spec.NodeName
 }
 
+func (p *pod) ContainerNames() []string {
+	names := []string{}
+	for _, c := range p.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
 func (p *pod) GetNode(probeID string) report.Node {
 	return p.MetaNode(report.MakePodNodeID(p.UID())).WithLatests(map[string]string{
 		State: p.State(),
@@ -63,5 +72,5 @@ func (p *pod) GetNode(probeID string) report.Node {
 		report.ControlProbeID: probeID,
 	}).
 		WithParents(p.parents).
-		WithControls(GetLogs, DeletePod)
+		WithControls(GetLogs, ExecPod, DeletePod)
 }
@@ -50,5 +50,5 @@ func (r *replicationController) GetNode(probeID string) report.Node {
 		DesiredReplicas:       fmt.Sprint(r.Spec.Replicas),
 		FullyLabeledReplicas:  fmt.Sprint(r.Status.FullyLabeledReplicas),
 		report.ControlProbeID: probeID,
-	}).WithParents(r.parents).WithControls(ScaleUp, ScaleDown)
+	}).WithParents(r.parents).WithControls(ScaleUp, ScaleDown, Scale)
 }
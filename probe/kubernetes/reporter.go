@@ -12,6 +12,7 @@ import (
 	"github.com/weaveworks/scope/probe"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/election"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -35,12 +36,14 @@ var (
 	}
 
 	ServiceMetadataTemplates = report.MetadataTemplates{
-		ID:         {ID: ID, Label: "ID", From: report.FromLatest, Priority: 1},
-		Namespace:  {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
-		Created:    {ID: Created, Label: "Created", From: report.FromLatest, Priority: 3},
-		PublicIP:   {ID: PublicIP, Label: "Public IP", From: report.FromLatest, Priority: 4},
-		IP:         {ID: IP, Label: "Internal IP", From: report.FromLatest, Priority: 5},
-		report.Pod: {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 6},
+		ID:               {ID: ID, Label: "ID", From: report.FromLatest, Priority: 1},
+		Namespace:        {ID: Namespace, Label: "Namespace", From: report.FromLatest, Priority: 2},
+		Created:          {ID: Created, Label: "Created", From: report.FromLatest, Priority: 3},
+		PublicIP:         {ID: PublicIP, Label: "Public IP", From: report.FromLatest, Priority: 4},
+		IP:               {ID: IP, Label: "Internal IP", From: report.FromLatest, Priority: 5},
+		report.Pod:       {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 6},
+		ServicePorts:     {ID: ServicePorts, Label: "Ports", From: report.FromSets, Priority: 7},
+		ServiceEndpoints: {ID: ServiceEndpoints, Label: "Endpoints", From: report.FromSets, Priority: 8},
 	}
 
 	DeploymentMetadataTemplates = report.MetadataTemplates{
@@ -51,6 +54,7 @@ var (
 		DesiredReplicas:    {ID: DesiredReplicas, Label: "Desired Replicas", From: report.FromLatest, Datatype: "number", Priority: 5},
 		report.Pod:         {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 6},
 		Strategy:           {ID: Strategy, Label: "Strategy", From: report.FromLatest, Priority: 7},
+		Paused:             {ID: Paused, Label: "Paused", From: report.FromLatest, Priority: 8},
 	}
 
 	ReplicaSetMetadataTemplates = report.MetadataTemplates{
@@ -62,10 +66,44 @@ var (
 		report.Pod:         {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 6},
 	}
 
+	KubernetesNodeMetadataTemplates = report.MetadataTemplates{
+		ID:             {ID: ID, Label: "ID", From: report.FromLatest, Priority: 1},
+		Created:        {ID: Created, Label: "Created", From: report.FromLatest, Priority: 2},
+		report.Pod:     {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 3},
+		Unschedulable:  {ID: Unschedulable, Label: "Unschedulable", From: report.FromLatest, Priority: 4},
+		Taints:         {ID: Taints, Label: "Taints", From: report.FromSets, Priority: 5},
+		KubeletVersion: {ID: KubeletVersion, Label: "Kubelet Version", From: report.FromLatest, Priority: 6},
+		KernelVersion:  {ID: KernelVersion, Label: "Kernel Version", From: report.FromLatest, Priority: 7},
+	}
+
+	NamespaceMetadataTemplates = report.MetadataTemplates{
+		ID:         {ID: ID, Label: "ID", From: report.FromLatest, Priority: 1},
+		report.Pod: {ID: report.Pod, Label: "# Pods", From: report.FromCounters, Datatype: "number", Priority: 2},
+	}
+
+	// NamespaceMetricTemplates are rolled up from the containers in each
+	// namespace when rendering.
+	NamespaceMetricTemplates = report.MetricTemplates{
+		docker.CPUTotalUsage: {ID: docker.CPUTotalUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		docker.MemoryUsage:   {ID: docker.MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+	}
+
 	TableTemplates = report.TableTemplates{
 		LabelPrefix: {ID: LabelPrefix, Label: "Kubernetes Labels", Prefix: LabelPrefix},
 	}
 
+	DeploymentTableTemplates = report.TableTemplates{
+		LabelPrefix:    {ID: LabelPrefix, Label: "Kubernetes Labels", Prefix: LabelPrefix},
+		RevisionPrefix: {ID: RevisionPrefix, Label: "Revisions", Prefix: RevisionPrefix},
+	}
+
+	KubernetesNodeTableTemplates = report.TableTemplates{
+		LabelPrefix:       {ID: LabelPrefix, Label: "Kubernetes Labels", Prefix: LabelPrefix},
+		ConditionPrefix:   {ID: ConditionPrefix, Label: "Conditions", Prefix: ConditionPrefix},
+		CapacityPrefix:    {ID: CapacityPrefix, Label: "Capacity", Prefix: CapacityPrefix},
+		AllocatablePrefix: {ID: AllocatablePrefix, Label: "Allocatable", Prefix: AllocatablePrefix},
+	}
+
 	ScalingControls = []report.Control{
 		{
 			ID:    ScaleDown,
@@ -79,6 +117,85 @@ var (
 			Icon:  "fa-plus",
 			Rank:  1,
 		},
+		{
+			ID:    Scale,
+			Human: "Scale",
+			Icon:  "fa-sliders",
+			Rank:  2,
+			Args:  scaleArgs,
+		},
+	}
+
+	RolloutControls = []report.Control{
+		{
+			ID:    RestartDeployment,
+			Human: "Restart",
+			Icon:  "fa-repeat",
+			Rank:  3,
+		},
+		{
+			ID:    PauseDeployment,
+			Human: "Pause rollout",
+			Icon:  "fa-pause",
+			Rank:  4,
+		},
+		{
+			ID:    ResumeDeployment,
+			Human: "Resume rollout",
+			Icon:  "fa-play",
+			Rank:  4,
+		},
+		{
+			ID:    RollbackDeployment,
+			Human: "Roll back",
+			Icon:  "fa-undo",
+			Rank:  5,
+			Args:  rollbackArgs,
+		},
+	}
+
+	PodControls = []report.Control{
+		{
+			ID:    GetLogs,
+			Human: "Get logs",
+			Icon:  "fa-desktop",
+			Rank:  0,
+			Args:  logsArgs,
+		},
+		{
+			ID:    DeletePod,
+			Human: "Delete",
+			Icon:  "fa-trash-o",
+			Rank:  1,
+		},
+		{
+			ID:    ExecPod,
+			Human: "Exec shell",
+			Icon:  "fa-terminal",
+			Rank:  2,
+			Args:  execArgs,
+		},
+	}
+
+	minReplicas = 0
+	scaleArgs   = report.ControlArgs{
+		{Name: ReplicasArg, Human: "Replicas", Type: report.ControlArgInt, Required: true, Min: &minReplicas},
+	}
+
+	minTail  = 0
+	logsArgs = report.ControlArgs{
+		{Name: ContainerArg, Human: "Container", Type: report.ControlArgString},
+		{Name: FollowArg, Human: "Follow", Type: report.ControlArgBool, Default: "true"},
+		{Name: PreviousArg, Human: "Previous instance", Type: report.ControlArgBool, Default: "false"},
+		{Name: TailArg, Human: "Lines", Type: report.ControlArgInt, Min: &minTail},
+	}
+	execArgs = report.ControlArgs{
+		{Name: ContainerArg, Human: "Container", Type: report.ControlArgString},
+	}
+
+	minRevision  = 0
+	rollbackArgs = report.ControlArgs{
+		{Name: RevisionArg, Human: "Revision (0 for previous)", Type: report.ControlArgInt, Default: "0", Min: &minRevision},
 	}
 )
 
@@ -87,16 +204,22 @@ type Reporter struct {
 	client  Client
 	pipes   controls.PipeClient
 	probeID string
+	hostID  string
 	probe   *probe.Probe
+	leader  election.Leader
 }
 
-// NewReporter makes a new Reporter
-func NewReporter(client Client, pipes controls.PipeClient, probeID string, probe *probe.Probe) *Reporter {
+// NewReporter makes a new Reporter. Every probe reports the pods on its own
+// node; only the leader reports the cluster-wide services, deployments,
+// replica sets and nodes.
+func NewReporter(client Client, pipes controls.PipeClient, probeID string, hostID string, probe *probe.Probe, leader election.Leader) *Reporter {
 	reporter := &Reporter{
 		client:  client,
 		pipes:   pipes,
 		probeID: probeID,
+		hostID:  hostID,
 		probe:   probe,
+		leader:  leader,
 	}
 	reporter.registerControls()
 	client.WatchPods(reporter.podEvent)
@@ -188,17 +311,66 @@ func (r *Reporter) Report() (report.Report, error) {
 	if err != nil {
 		return result, err
 	}
-	podTopology, err := r.podTopology(services, replicaSets)
+	thisNodeName, err := GetNodeName(r)
+	if err != nil {
+		return result, err
+	}
+	podTopology, err := r.podTopology(services, replicaSets, thisNodeName)
+	if err != nil {
+		return result, err
+	}
+	isLeader := r.leader.IsLeader()
+	nodeTopology, err := r.nodeTopology(thisNodeName, isLeader)
 	if err != nil {
 		return result, err
 	}
 	result.Pod = result.Pod.Merge(podTopology)
-	result.Service = result.Service.Merge(serviceTopology)
-	result.Deployment = result.Deployment.Merge(deploymentTopology)
-	result.ReplicaSet = result.ReplicaSet.Merge(replicaSetTopology)
+	result.KubernetesNode = result.KubernetesNode.Merge(nodeTopology)
+	if isLeader {
+		result.Service = result.Service.Merge(serviceTopology)
+		result.Deployment = result.Deployment.Merge(revisionHistory(deploymentTopology, deployments, replicaSets))
+		result.ReplicaSet = result.ReplicaSet.Merge(replicaSetTopology)
+	}
+	result.Namespace = result.Namespace.Merge(namespaceTopology(result.Pod, result.Service, result.Deployment, result.ReplicaSet))
 	return result, nil
 }
 
+// nodeTopology has all the nodes, or just the one we are on if all is false.
+func (r *Reporter) nodeTopology(thisNodeName string, all bool) (report.Topology, error) {
+	result := report.MakeTopology().
+		WithMetadataTemplates(KubernetesNodeMetadataTemplates).
+		WithTableTemplates(KubernetesNodeTableTemplates)
+	err := r.client.WalkNodes(func(n *api.Node) error {
+		node := NewNode(n)
+		// We can only tell which host a node is for the node we are on;
+		// the probes on the other nodes link up theirs.
+		if node.Name() == thisNodeName {
+			node.AddParent(report.Host, report.MakeHostNodeID(r.hostID))
+		} else if !all {
+			return nil
+		}
+		result = result.AddNode(node.GetNode())
+		return nil
+	})
+	return result, err
+}
+
+// namespaceTopology makes a node for every namespace referenced by the
+// nodes in the given topologies.
+func namespaceTopology(topologies ...report.Topology) report.Topology {
+	result := report.MakeTopology().
+		WithMetadataTemplates(NamespaceMetadataTemplates).
+		WithMetricTemplates(NamespaceMetricTemplates)
+	for _, t := range topologies {
+		for _, n := range t.Nodes {
+			if namespace, ok := n.Latest.Lookup(Namespace); ok {
+				result = result.AddNode(NamespaceNode(namespace))
+			}
+		}
+	}
+	return result
+}
+
 func (r *Reporter) serviceTopology() (report.Topology, []Service, error) {
 	var (
 		result = report.MakeTopology().
@@ -218,10 +390,11 @@ func (r *Reporter) deploymentTopology(probeID string) (report.Topology, []Deploy
 	var (
 		result = report.MakeTopology().
 			WithMetadataTemplates(DeploymentMetadataTemplates).
-			WithTableTemplates(TableTemplates)
+			WithTableTemplates(DeploymentTableTemplates)
 		deployments = []Deployment{}
 	)
 	result.Controls.AddControls(ScalingControls)
+	result.Controls.AddControls(RolloutControls)
 
 	err := r.client.WalkDeployments(func(d Deployment) error {
 		result = result.AddNode(d.GetNode(probeID))
@@ -231,6 +404,36 @@ func (r *Reporter) deploymentTopology(probeID string) (report.Topology, []Deploy
 	return result, deployments, err
 }
 
+// revisionHistory adds a table of the revisions each deployment has rolled
+// out, taken from its replica sets, to the deployment's node.
+func revisionHistory(topology report.Topology, deployments []Deployment, replicaSets []ReplicaSet) report.Topology {
+	for _, d := range deployments {
+		nodeID := report.MakeDeploymentNodeID(d.UID())
+		node, ok := topology.Nodes[nodeID]
+		if !ok {
+			continue
+		}
+		current := d.Annotations()[revisionAnnotation]
+		selector := d.Selector()
+		revisions := map[string]string{}
+		for _, rs := range replicaSets {
+			revision, ok := rs.Annotations()[revisionAnnotation]
+			if !ok || rs.Namespace() != d.Namespace() || !selector.Matches(labels.Set(rs.Labels())) {
+				continue
+			}
+			if revision == current {
+				revisions[revision] = rs.Name() + " (current)"
+			} else {
+				revisions[revision] = rs.Name()
+			}
+		}
+		if len(revisions) > 0 {
+			topology.Nodes[nodeID] = node.AddTable(RevisionPrefix, revisions)
+		}
+	}
+	return topology
+}
+
 func (r *Reporter) replicaSetTopology(probeID string, deployments []Deployment) (report.Topology, []ReplicaSet, error) {
 	var (
 		result = report.MakeTopology().
@@ -307,25 +510,14 @@ func match(selector labels.Selector, topology, id string) func(labelledChild) {
 	}
 }
 
-func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet) (report.Topology, error) {
+func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet, thisNodeName string) (report.Topology, error) {
 	var (
 		pods = report.MakeTopology().
 			WithMetadataTemplates(PodMetadataTemplates).
 			WithTableTemplates(TableTemplates)
 		selectors = []func(labelledChild){}
 	)
-	pods.Controls.AddControl(report.Control{
-		ID:    GetLogs,
-		Human: "Get logs",
-		Icon:  "fa-desktop",
-		Rank:  0,
-	})
-	pods.Controls.AddControl(report.Control{
-		ID:    DeletePod,
-		Human: "Delete",
-		Icon:  "fa-trash-o",
-		Rank:  1,
-	})
+	pods.Controls.AddControls(PodControls)
 	for _, service := range services {
 		selectors = append(selectors, match(
 			service.Selector(),
@@ -341,17 +533,14 @@ func (r *Reporter) podTopology(services []Service, replicaSets []ReplicaSet) (re
 		))
 	}
 
-	thisNodeName, err := GetNodeName(r)
-	if err != nil {
-		return pods, err
-	}
-	err = r.client.WalkPods(func(p Pod) error {
+	err := r.client.WalkPods(func(p Pod) error {
 		if p.NodeName() != thisNodeName {
 			return nil
 		}
 		for _, selector := range selectors {
 			selector(p)
 		}
+		p.AddParent(report.KubernetesNode, report.MakeKubernetesNodeNodeID(p.NodeName()))
 		pods = pods.AddNode(p.GetNode(r.probeID))
 		return nil
 	})
@@ -6,15 +6,20 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/extensions"
 	"k8s.io/kubernetes/pkg/types"
 
 	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/election"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test"
 	"github.com/weaveworks/scope/test/reflect"
 )
 
@@ -44,7 +49,8 @@ var (
 			},
 		},
 		Spec: api.PodSpec{
-			NodeName: nodeName,
+			NodeName:   nodeName,
+			Containers: []api.Container{{Name: "pong"}, {Name: "sidecar"}},
 		},
 	}
 	apiPod2 = api.Pod{
@@ -95,9 +101,31 @@ var (
 			},
 		},
 	}
+	apiEndpoints1 = api.Endpoints{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "pongservice",
+			Namespace: "ping",
+		},
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.32.0.7"}, {IP: "10.32.0.8"}},
+				Ports:     []api.EndpointPort{{Protocol: "TCP", Port: 6380}},
+			},
+		},
+	}
+	apiNode1 = api.Node{
+		ObjectMeta: api.ObjectMeta{
+			Name:        nodeName,
+			Labels:      map[string]string{"zone": "a"},
+			Annotations: map[string]string{"scheduler.alpha.kubernetes.io/taints": `[{"key":"dedicated","value":"db","effect":"NoSchedule"}]`},
+		},
+		Status: api.NodeStatus{
+			Conditions: []api.NodeCondition{{Type: api.NodeReady, Status: api.ConditionTrue}},
+		},
+	}
 	pod1     = kubernetes.NewPod(&apiPod1)
 	pod2     = kubernetes.NewPod(&apiPod2)
-	service1 = kubernetes.NewService(&apiService1)
+	service1 = kubernetes.NewService(&apiService1, &apiEndpoints1)
 )
 
 func newMockClient() *mockClient {
@@ -109,9 +137,13 @@ func newMockClient() *mockClient {
 }
 
 type mockClient struct {
-	pods     []kubernetes.Pod
-	services []kubernetes.Service
-	logs     map[string]io.ReadCloser
+	pods        []kubernetes.Pod
+	services    []kubernetes.Service
+	deployments []kubernetes.Deployment
+	replicaSets []kubernetes.ReplicaSet
+	logs        map[string]io.ReadCloser
+	logOptions  api.PodLogOptions
+	calls       []string
 }
 
 func (c *mockClient) Stop() {}
@@ -132,19 +164,30 @@ func (c *mockClient) WalkServices(f func(kubernetes.Service) error) error {
 	return nil
 }
 func (c *mockClient) WalkDeployments(f func(kubernetes.Deployment) error) error {
+	for _, deployment := range c.deployments {
+		if err := f(deployment); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (c *mockClient) WalkReplicaSets(f func(kubernetes.ReplicaSet) error) error {
+	for _, replicaSet := range c.replicaSets {
+		if err := f(replicaSet); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (c *mockClient) WalkReplicationControllers(f func(kubernetes.ReplicationController) error) error {
 	return nil
 }
 func (*mockClient) WalkNodes(f func(*api.Node) error) error {
-	return nil
+	return f(&apiNode1)
 }
 func (*mockClient) WatchPods(func(kubernetes.Event, kubernetes.Pod)) {}
-func (c *mockClient) GetLogs(namespaceID, podName string) (io.ReadCloser, error) {
+func (c *mockClient) GetLogs(namespaceID, podName string, opts api.PodLogOptions) (io.ReadCloser, error) {
+	c.logOptions = opts
 	r, ok := c.logs[namespaceID+";"+podName]
 	if !ok {
 		return nil, fmt.Errorf("Not found")
@@ -160,6 +203,31 @@ func (c *mockClient) ScaleUp(resource, namespaceID, id string) error {
 func (c *mockClient) ScaleDown(resource, namespaceID, id string) error {
 	return nil
 }
+func (c *mockClient) Scale(resource, namespaceID, id string, replicas int) error {
+	return nil
+}
+func (c *mockClient) Exec(namespaceID, podID, container string, command []string) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("exec %s/%s %s", namespaceID, podID, container)
+}
+func (c *mockClient) RestartDeployment(namespaceID, id string) error {
+	c.calls = append(c.calls, fmt.Sprintf("restart %s/%s", namespaceID, id))
+	return nil
+}
+func (c *mockClient) PauseDeployment(namespaceID, id string) error {
+	c.calls = append(c.calls, fmt.Sprintf("pause %s/%s", namespaceID, id))
+	return nil
+}
+func (c *mockClient) ResumeDeployment(namespaceID, id string) error {
+	c.calls = append(c.calls, fmt.Sprintf("resume %s/%s", namespaceID, id))
+	return nil
+}
+func (c *mockClient) RollbackDeployment(namespaceID, id string, revision int64) error {
+	c.calls = append(c.calls, fmt.Sprintf("rollback %s/%s %d", namespaceID, id, revision))
+	return nil
+}
+func (c *mockClient) RolloutStatus(namespaceID, id string) (int, int, bool, error) {
+	return 1, 1, true, nil
+}
 
 type mockPipeClient map[string]xfer.Pipe
 
@@ -184,7 +252,9 @@ func TestReporter(t *testing.T) {
 	pod1ID := report.MakePodNodeID(pod1UID)
 	pod2ID := report.MakePodNodeID(pod2UID)
 	serviceID := report.MakeServiceNodeID(serviceUID)
-	rpt, _ := kubernetes.NewReporter(newMockClient(), nil, "", nil).Report()
+	kubernetesNodeID := report.MakeKubernetesNodeNodeID(nodeName)
+	namespaceID := report.MakeNamespaceNodeID("ping")
+	rpt, _ := kubernetes.NewReporter(newMockClient(), nil, "", "host1", nil, election.Always).Report()
 
 	// Reporter should have added the following pods
 	for _, pod := range []struct {
@@ -214,6 +284,14 @@ func TestReporter(t *testing.T) {
 			t.Errorf("Expected pod %s to have parent service %q, got %q", pod.id, pod.parentService, parents)
 		}
 
+		if parents, ok := node.Parents.Lookup(report.KubernetesNode); !ok || !parents.Contains(kubernetesNodeID) {
+			t.Errorf("Expected pod %s to have parent node %q, got %q", pod.id, kubernetesNodeID, parents)
+		}
+
+		if parents, ok := node.Parents.Lookup(report.Namespace); !ok || !parents.Contains(namespaceID) {
+			t.Errorf("Expected pod %s to have parent namespace %q, got %q", pod.id, namespaceID, parents)
+		}
+
 		for k, want := range pod.latest {
 			if have, ok := node.Latest.Lookup(k); !ok || have != want {
 				t.Errorf("Expected pod %s latest %q: %q, got %q", pod.id, k, want, have)
@@ -238,6 +316,89 @@ func TestReporter(t *testing.T) {
 				t.Errorf("Expected service %s latest %q: %q, got %q", serviceID, k, want, have)
 			}
 		}
+
+		for k, want := range map[string]report.StringSet{
+			kubernetes.ServicePorts:     report.MakeStringSet("6379/TCP"),
+			kubernetes.ServiceEndpoints: report.MakeStringSet("6379->10.32.0.7:6380", "6379->10.32.0.8:6380"),
+		} {
+			if have, ok := node.Sets.Lookup(k); !ok || !reflect.DeepEqual(want, have) {
+				t.Errorf("Expected service %s set %q: %v, got %v", serviceID, k, want, have)
+			}
+		}
+	}
+}
+
+func TestReporterNodes(t *testing.T) {
+	oldGetNodeName := kubernetes.GetNodeName
+	defer func() { kubernetes.GetNodeName = oldGetNodeName }()
+	kubernetes.GetNodeName = func(*kubernetes.Reporter) (string, error) {
+		return nodeName, nil
+	}
+
+	rpt, _ := kubernetes.NewReporter(newMockClient(), nil, "", "host1", nil, election.Always).Report()
+
+	// Reporter should have added the node, linked to this host
+	{
+		id := report.MakeKubernetesNodeNodeID(nodeName)
+		node, ok := rpt.KubernetesNode.Nodes[id]
+		if !ok {
+			t.Fatalf("Expected report to have node %q, but not found", id)
+		}
+		if parents, ok := node.Parents.Lookup(report.Host); !ok || !parents.Contains(report.MakeHostNodeID("host1")) {
+			t.Errorf("Expected node %s to have parent host, got %q", id, parents)
+		}
+		for k, want := range map[string]string{
+			kubernetes.Name:                      nodeName,
+			kubernetes.ConditionPrefix + "Ready": "True",
+			kubernetes.LabelPrefix + "zone":      "a",
+		} {
+			if have, ok := node.Latest.Lookup(k); !ok || have != want {
+				t.Errorf("Expected node %s latest %q: %q, got %q", id, k, want, have)
+			}
+		}
+		want := report.MakeStringSet("dedicated=db:NoSchedule")
+		if have, ok := node.Sets.Lookup(kubernetes.Taints); !ok || !reflect.DeepEqual(want, have) {
+			t.Errorf("Expected node %s taints %v, got %v", id, want, have)
+		}
+	}
+
+	// Reporter should have added the namespace
+	if _, ok := rpt.Namespace.Nodes[report.MakeNamespaceNodeID("ping")]; !ok {
+		t.Errorf("Expected report to have namespace %q, but not found", "ping")
+	}
+}
+
+type follower struct{}
+
+func (follower) IsLeader() bool { return false }
+
+func TestReporterFollower(t *testing.T) {
+	oldGetNodeName := kubernetes.GetNodeName
+	defer func() { kubernetes.GetNodeName = oldGetNodeName }()
+	kubernetes.GetNodeName = func(*kubernetes.Reporter) (string, error) {
+		return nodeName, nil
+	}
+
+	// Probes which aren't the leader only report their own node and pods
+	rpt, err := kubernetes.NewReporter(newMockClient(), nil, "", "host1", nil, follower{}).Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int{
+		report.Pod:            2,
+		report.KubernetesNode: 1,
+		report.Service:        0,
+		report.Deployment:     0,
+		report.ReplicaSet:     0,
+	} {
+		topology, _ := rpt.Topology(name)
+		if have := len(topology.Nodes); have != want {
+			t.Errorf("Expected %d %s nodes, got %d", want, name, have)
+		}
+	}
+	node := rpt.Pod.Nodes[report.MakePodNodeID(pod1UID)]
+	if parents, ok := node.Parents.Lookup(report.Service); !ok || !parents.Contains(report.MakeServiceNodeID(serviceUID)) {
+		t.Errorf("Expected pod to still have parent service, got %q", parents)
 	}
 }
 
@@ -247,7 +408,7 @@ func TestTagger(t *testing.T) {
 		docker.LabelPrefix + "io.kubernetes.pod.uid": "123456",
 	}))
 
-	rpt, err := kubernetes.NewReporter(newMockClient(), nil, "", nil).Tag(rpt)
+	rpt, err := kubernetes.NewReporter(newMockClient(), nil, "", "", nil, election.Always).Tag(rpt)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -275,7 +436,7 @@ func TestReporterGetLogs(t *testing.T) {
 
 	client := newMockClient()
 	pipes := mockPipeClient{}
-	reporter := kubernetes.NewReporter(client, pipes, "", nil)
+	reporter := kubernetes.NewReporter(client, pipes, "", "", nil, election.Always)
 
 	// Should error on invalid IDs
 	{
@@ -343,3 +504,141 @@ func TestReporterGetLogs(t *testing.T) {
 		t.Errorf("Expected pipe to close the underlying log stream")
 	}
 }
+
+func TestReporterGetLogsOptions(t *testing.T) {
+	client := newMockClient()
+	pipes := mockPipeClient{}
+	reporter := kubernetes.NewReporter(client, pipes, "", "", nil, election.Always)
+	defer reporter.Stop()
+	client.logs["ping;pong-a"] = ioutil.NopCloser(strings.NewReader(""))
+
+	for _, tc := range []struct {
+		args map[string]string
+		want api.PodLogOptions
+	}{
+		{
+			args: map[string]string{},
+			want: api.PodLogOptions{Container: "pong", Follow: true},
+		},
+		{
+			args: map[string]string{kubernetes.ContainerArg: "sidecar", kubernetes.FollowArg: "false", kubernetes.PreviousArg: "true"},
+			want: api.PodLogOptions{Container: "sidecar", Previous: true},
+		},
+	} {
+		resp := controls.HandleControlRequest(xfer.Request{
+			AppID:   "appID",
+			NodeID:  report.MakePodNodeID(pod1UID),
+			Control: kubernetes.GetLogs,
+			Args:    tc.args,
+		})
+		if resp.Error != "" {
+			t.Fatal(resp.Error)
+		}
+		if !reflect.DeepEqual(tc.want, client.logOptions) {
+			t.Errorf("Expected log options %+v, got %+v", tc.want, client.logOptions)
+		}
+		pipes[resp.Pipe].Close()
+	}
+
+	// Exec should default to the first container too
+	resp := controls.HandleControlRequest(xfer.Request{
+		AppID:   "appID",
+		NodeID:  report.MakePodNodeID(pod1UID),
+		Control: kubernetes.ExecPod,
+	})
+	if want := "exec ping/pong-a pong"; resp.Error != want {
+		t.Errorf("Expected %q, got %q", want, resp.Error)
+	}
+}
+
+func TestReporterDeployments(t *testing.T) {
+	oldGetNodeName := kubernetes.GetNodeName
+	defer func() { kubernetes.GetNodeName = oldGetNodeName }()
+	kubernetes.GetNodeName = func(*kubernetes.Reporter) (string, error) {
+		return nodeName, nil
+	}
+
+	selector := &unversioned.LabelSelector{MatchLabels: map[string]string{"ponger": "true"}}
+	replicaSet := func(name, revision string) kubernetes.ReplicaSet {
+		return kubernetes.NewReplicaSet(&extensions.ReplicaSet{
+			ObjectMeta: api.ObjectMeta{
+				Name:        name,
+				UID:         types.UID(name),
+				Namespace:   "ping",
+				Labels:      map[string]string{"ponger": "true"},
+				Annotations: map[string]string{"deployment.kubernetes.io/revision": revision},
+			},
+			Spec: extensions.ReplicaSetSpec{Selector: selector},
+		})
+	}
+	client := newMockClient()
+	client.deployments = []kubernetes.Deployment{kubernetes.NewDeployment(&extensions.Deployment{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "pong",
+			UID:         types.UID("deployment1"),
+			Namespace:   "ping",
+			Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"},
+		},
+		Spec: extensions.DeploymentSpec{Selector: selector},
+	})}
+	client.replicaSets = []kubernetes.ReplicaSet{replicaSet("pong-1", "1"), replicaSet("pong-2", "2")}
+	reporter := kubernetes.NewReporter(client, nil, "", "host1", nil, election.Always)
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploymentID := report.MakeDeploymentNodeID("deployment1")
+	node, ok := rpt.Deployment.Nodes[deploymentID]
+	if !ok {
+		t.Fatalf("Expected report to have deployment %q, but not found", deploymentID)
+	}
+	for k, want := range map[string]string{
+		kubernetes.RevisionPrefix + "1": "pong-1",
+		kubernetes.RevisionPrefix + "2": "pong-2 (current)",
+	} {
+		if have, ok := node.Latest.Lookup(k); !ok || have != want {
+			t.Errorf("Expected deployment latest %q: %q, got %q", k, want, have)
+		}
+	}
+	if !node.Controls.Controls.Contains(kubernetes.PauseDeployment) || node.Controls.Controls.Contains(kubernetes.ResumeDeployment) {
+		t.Errorf("Expected an unpaused deployment to be pausable, got %v", node.Controls.Controls)
+	}
+
+	for _, req := range []xfer.Request{
+		{NodeID: deploymentID, Control: kubernetes.RestartDeployment},
+		{NodeID: deploymentID, Control: kubernetes.PauseDeployment},
+		{NodeID: deploymentID, Control: kubernetes.ResumeDeployment},
+		{NodeID: deploymentID, Control: kubernetes.RollbackDeployment},
+		{NodeID: deploymentID, Control: kubernetes.RollbackDeployment, Args: map[string]string{kubernetes.RevisionArg: "1"}},
+	} {
+		resp := controls.HandleControlRequest(req)
+		if resp.Error != "" {
+			t.Errorf("%s: %s", req.Control, resp.Error)
+		}
+		// Rollouts are jobs, which last until they're done
+		if resp.Job != "" {
+			test.Poll(t, time.Second, xfer.JobSucceeded, func() interface{} {
+				status := controls.HandleControlRequest(xfer.Request{
+					Control: controls.JobStatus,
+					Args:    map[string]string{controls.JobArg: resp.Job},
+				})
+				return status.Value.(xfer.Job).State
+			})
+		}
+	}
+	want := []string{"restart ping/pong", "pause ping/pong", "resume ping/pong", "rollback ping/pong 0", "rollback ping/pong 1"}
+	if !reflect.DeepEqual(want, client.calls) {
+		t.Errorf("Expected calls %v, got %v", want, client.calls)
+	}
+
+	// Rollout controls only apply to deployments
+	resp := controls.HandleControlRequest(xfer.Request{
+		NodeID:  report.MakeReplicaSetNodeID("pong-1"),
+		Control: kubernetes.PauseDeployment,
+	})
+	if resp.Error == "" {
+		t.Errorf("Expected error pausing a replica set")
+	}
+}
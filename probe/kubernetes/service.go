@@ -1,6 +1,10 @@
 package kubernetes
 
 import (
+	"fmt"
+	"net"
+	"strings"
+
 	"github.com/weaveworks/scope/report"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/labels"
@@ -8,7 +12,9 @@ import (
 
 // These constants are keys used in node metadata
 const (
-	PublicIP = "kubernetes_public_ip"
+	PublicIP         = "kubernetes_public_ip"
+	ServicePorts     = "kubernetes_service_ports"
+	ServiceEndpoints = "kubernetes_service_endpoints"
 )
 
 // Service represents a Kubernetes service
@@ -21,11 +27,13 @@ type Service interface {
 type service struct {
 	*api.Service
 	Meta
+	endpoints *api.Endpoints
 }
 
-// NewService creates a new Service
-func NewService(s *api.Service) Service {
-	return &service{Service: s, Meta: meta{s.ObjectMeta}}
+// NewService creates a new Service. endpoints may be nil, if the endpoints
+// for this service are not (yet) known.
+func NewService(s *api.Service, endpoints *api.Endpoints) Service {
+	return &service{Service: s, Meta: meta{s.ObjectMeta}, endpoints: endpoints}
 }
 
 func (s *service) Selector() labels.Selector {
@@ -35,10 +43,61 @@ func (s *service) Selector() labels.Selector {
 	return labels.SelectorFromSet(labels.Set(s.Spec.Selector))
 }
 
+// ports returns the service ports, as "port/protocol".
+func (s *service) ports() []string {
+	result := []string{}
+	for _, port := range s.Spec.Ports {
+		result = append(result, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+	}
+	return result
+}
+
+// backends returns the addresses backing each service port, as
+// "port->ip:targetPort". Endpoint ports are matched to service ports by name,
+// which is how kubernetes resolves named target ports.
+func (s *service) backends() []string {
+	result := []string{}
+	if s.endpoints == nil {
+		return result
+	}
+	for _, port := range s.Spec.Ports {
+		for _, subset := range s.endpoints.Subsets {
+			for _, endpointPort := range subset.Ports {
+				if endpointPort.Name != port.Name {
+					continue
+				}
+				for _, address := range subset.Addresses {
+					result = append(result, fmt.Sprintf("%d->%s:%d", port.Port, address.IP, endpointPort.Port))
+				}
+			}
+		}
+	}
+	return result
+}
+
 func (s *service) GetNode() report.Node {
 	latest := map[string]string{IP: s.Spec.ClusterIP}
 	if s.Spec.LoadBalancerIP != "" {
 		latest[PublicIP] = s.Spec.LoadBalancerIP
 	}
-	return s.MetaNode(report.MakeServiceNodeID(s.UID())).WithLatests(latest)
+	return s.MetaNode(report.MakeServiceNodeID(s.UID())).
+		WithLatests(latest).
+		WithSets(report.EmptySets.
+			Add(ServicePorts, report.MakeStringSet(s.ports()...)).
+			Add(ServiceEndpoints, report.MakeStringSet(s.backends()...)),
+		)
+}
+
+// ParseServiceBackend parses a "port->ip:targetPort" entry from the
+// ServiceEndpoints set, as produced by the kubernetes reporter.
+func ParseServiceBackend(backend string) (port, ip, targetPort string, ok bool) {
+	fields := strings.SplitN(backend, "->", 2)
+	if len(fields) != 2 {
+		return "", "", "", false
+	}
+	ip, targetPort, err := net.SplitHostPort(fields[1])
+	if err != nil {
+		return "", "", "", false
+	}
+	return fields[0], ip, targetPort, true
 }
@@ -0,0 +1,153 @@
+package overhead
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/weaveworks/scope/common/fs"
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/probe"
+	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Metrics. Reporter durations are keyed by
+// ReporterDurationPrefix plus the reporter's name.
+const (
+	CPUUsage               = "probe_cpu_usage_percent"
+	MemoryUsage            = "probe_memory_usage_bytes"
+	Goroutines             = "probe_goroutines"
+	ReportBytes            = "probe_report_bytes"
+	PublishLatency         = "probe_publish_latency_ms"
+	ReporterDurationPrefix = "probe_reporter_ms_"
+)
+
+// Exposed for testing.
+const (
+	ProcSelfStatm = "/proc/self/statm"
+)
+
+// Exposed for testing.
+var (
+	MetricTemplates = report.MetricTemplates{
+		CPUUsage:       {ID: CPUUsage, Label: "Probe CPU", Format: report.PercentFormat, Priority: 21},
+		MemoryUsage:    {ID: MemoryUsage, Label: "Probe Memory", Format: report.FilesizeFormat, Priority: 22},
+		Goroutines:     {ID: Goroutines, Label: "Probe Goroutines", Format: report.DefaultFormat, Priority: 23},
+		ReportBytes:    {ID: ReportBytes, Label: "Report Size", Format: report.FilesizeFormat, Priority: 24},
+		PublishLatency: {ID: PublishLatency, Label: "Publish Latency (ms)", Format: report.DefaultFormat, Priority: 25},
+	}
+)
+
+// GetCPUTime returns how much CPU time the probe has used. Exposed for
+// testing.
+var GetCPUTime = func() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
+
+// GetRSS returns the resident set size of the probe, in bytes. Exposed for
+// testing.
+var GetRSS = func() (uint64, error) {
+	buf, err := fs.ReadFile(ProcSelfStatm)
+	if err != nil {
+		return 0, err
+	}
+	fields := bytes.Fields(buf)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid format: %s", string(buf))
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+// Reporter reports on the probe's own overhead: its resource usage, how long
+// its reporters take, and the size and latency of its reports. The metrics
+// go on the probe's host node.
+type Reporter struct {
+	hostID string
+	health func() []probe.ReporterHealth
+
+	mtx         sync.Mutex
+	lastCPUTime time.Duration
+	lastSample  time.Time
+}
+
+// NewReporter makes a new Reporter, which gets the health of the probe's
+// reporters from health.
+func NewReporter(hostID string, health func() []probe.ReporterHealth) *Reporter {
+	return &Reporter{
+		hostID: hostID,
+		health: health,
+	}
+}
+
+// Name of this reporter, for metrics gathering
+func (*Reporter) Name() string { return "Overhead" }
+
+// Report implements Reporter.
+func (r *Reporter) Report() (report.Report, error) {
+	var (
+		rpt       = report.MakeReport()
+		now       = mtime.Now()
+		metrics   = report.Metrics{}
+		templates = report.MetricTemplates{}
+	)
+
+	if cpuTime, err := GetCPUTime(); err == nil {
+		r.mtx.Lock()
+		if !r.lastSample.IsZero() && now.After(r.lastSample) {
+			percent := 100 * float64(cpuTime-r.lastCPUTime) / float64(now.Sub(r.lastSample))
+			metrics[CPUUsage] = report.MakeMetric().Add(now, percent).WithMax(100 * float64(runtime.NumCPU()))
+		}
+		r.lastCPUTime, r.lastSample = cpuTime, now
+		r.mtx.Unlock()
+	}
+	if rss, err := GetRSS(); err == nil {
+		metrics[MemoryUsage] = report.MakeMetric().Add(now, float64(rss))
+	}
+	metrics[Goroutines] = report.MakeMetric().Add(now, float64(runtime.NumGoroutine()))
+
+	stats := appclient.GetStats()
+	if stats.ReportBytes > 0 {
+		metrics[ReportBytes] = report.MakeMetric().Add(now, float64(stats.ReportBytes))
+	}
+	if stats.PublishLatency > 0 {
+		metrics[PublishLatency] = report.MakeMetric().Add(now, milliseconds(stats.PublishLatency))
+	}
+
+	for i, h := range r.health() {
+		if h.LastRun.IsZero() {
+			continue
+		}
+		id := ReporterDurationPrefix + h.Name
+		metrics[id] = report.MakeMetric().Add(now, milliseconds(h.Duration))
+		templates[id] = report.MetricTemplate{
+			ID:       id,
+			Label:    h.Name + " Reporter (ms)",
+			Format:   report.DefaultFormat,
+			Priority: 31 + float64(i),
+		}
+	}
+
+	rpt.Host = rpt.Host.
+		WithMetricTemplates(MetricTemplates).
+		WithMetricTemplates(templates)
+	rpt.Host.AddNode(report.MakeNode(report.MakeHostNodeID(r.hostID)).WithMetrics(metrics))
+	return rpt, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,70 @@
+package overhead_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/probe"
+	"github.com/weaveworks/scope/probe/overhead"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestReporter(t *testing.T) {
+	var (
+		oldGetCPUTime = overhead.GetCPUTime
+		oldGetRSS     = overhead.GetRSS
+		cpuTime       = time.Second
+		now           = time.Now()
+	)
+	defer func() {
+		overhead.GetCPUTime = oldGetCPUTime
+		overhead.GetRSS = oldGetRSS
+	}()
+	overhead.GetCPUTime = func() (time.Duration, error) { return cpuTime, nil }
+	overhead.GetRSS = func() (uint64, error) { return 64 << 20, nil }
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	r := overhead.NewReporter("hostid", func() []probe.ReporterHealth {
+		return []probe.ReporterHealth{
+			{Name: "Docker", LastRun: now, Duration: 250 * time.Millisecond},
+			{Name: "Plugins"},
+		}
+	})
+	nodeID := report.MakeHostNodeID("hostid")
+
+	rpt, err := r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rpt.Host.Nodes[nodeID]
+	if _, ok := node.Metrics[overhead.CPUUsage]; ok {
+		t.Error("Expected no CPU usage from a single sample")
+	}
+	for key, want := range map[string]float64{
+		overhead.MemoryUsage:                       64 << 20,
+		overhead.ReporterDurationPrefix + "Docker": 250,
+	} {
+		if metric, ok := node.Metrics[key]; !ok || metric.LastSample().Value != want {
+			t.Errorf("Expected %s %v, got %v", key, want, metric)
+		}
+	}
+	if _, ok := node.Metrics[overhead.ReporterDurationPrefix+"Plugins"]; ok {
+		t.Error("Expected no duration for a reporter which hasn't run")
+	}
+	if _, ok := rpt.Host.MetricTemplates[overhead.ReporterDurationPrefix+"Docker"]; !ok {
+		t.Error("Expected a template for the Docker reporter's duration")
+	}
+
+	// Half a second of CPU in two seconds
+	cpuTime += 500 * time.Millisecond
+	mtime.NowForce(now.Add(2 * time.Second))
+	rpt, err = r.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric, ok := rpt.Host.Nodes[nodeID].Metrics[overhead.CPUUsage]; !ok || metric.LastSample().Value != 25 {
+		t.Errorf("Expected 25%% CPU usage, got %v", metric)
+	}
+}
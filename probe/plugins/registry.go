@@ -40,6 +40,7 @@ type Registry struct {
 	apiVersion        string
 	handshakeMetadata map[string]string
 	pluginsBySocket   map[string]*Plugin
+	allowed           map[string]bool
 	lock              sync.RWMutex
 	context           context.Context
 	cancel            context.CancelFunc
@@ -93,6 +94,9 @@ func (r *Registry) scan() error {
 	plugins := map[string]*Plugin{}
 	// add (or keep) plugins which were found
 	for _, path := range sockets {
+		if !r.isAllowed(pluginID(path)) {
+			continue
+		}
 		if plugin, ok := r.pluginsBySocket[path]; ok {
 			plugins[path] = plugin
 			continue
@@ -118,6 +122,28 @@ func (r *Registry) scan() error {
 	return nil
 }
 
+// SetAllowed restricts the registry to the plugins with the given IDs; nil
+// allows all plugins. Plugins which are no longer allowed are removed
+// straight away.
+func (r *Registry) SetAllowed(ids []string) error {
+	r.lock.Lock()
+	if ids == nil {
+		r.allowed = nil
+	} else {
+		r.allowed = map[string]bool{}
+		for _, id := range ids {
+			r.allowed[id] = true
+		}
+	}
+	r.lock.Unlock()
+	return r.scan()
+}
+
+// isAllowed must be called with the lock held.
+func (r *Registry) isAllowed(id string) bool {
+	return r.allowed == nil || r.allowed[id]
+}
+
 // sockets recursively finds all unix sockets under the path provided
 func (r *Registry) sockets(path string) ([]string, error) {
 	var (
@@ -178,16 +204,25 @@ func (r *Registry) Name() string { return "plugins" }
 
 // Report implements the Reporter interface
 func (r *Registry) Report() (report.Report, error) {
+	return r.ReportContext(context.Background())
+}
+
+// ReportContext implements the ContextReporter interface. Plugins not yet
+// asked for their report when ctx is done are skipped.
+func (r *Registry) ReportContext(ctx context.Context) (report.Report, error) {
 	rpt := report.MakeReport()
 	// All plugins are assumed to (and must) implement reporter
 	r.ForEach(func(plugin *Plugin) {
+		if ctx.Err() != nil {
+			return
+		}
 		pluginReport, err := plugin.Report()
 		if err != nil {
 			log.Errorf("plugins: %s: /report error: %v", plugin.socket, err)
 		}
 		rpt = rpt.Merge(pluginReport)
 	})
-	return rpt, nil
+	return rpt, ctx.Err()
 }
 
 // Close shuts down the registry. It can still be used after this, but will be
@@ -222,7 +257,7 @@ func NewPlugin(ctx context.Context, socket string, client *http.Client, expected
 		params.Add(k, v)
 	}
 
-	id := strings.TrimSuffix(filepath.Base(socket), filepath.Ext(socket))
+	id := pluginID(socket)
 
 	ctx, cancel := context.WithCancel(ctx)
 	return &Plugin{
@@ -236,6 +271,11 @@ func NewPlugin(ctx context.Context, socket string, client *http.Client, expected
 	}
 }
 
+// Plugins are identified by the name of their socket, without extension.
+func pluginID(socket string) string {
+	return strings.TrimSuffix(filepath.Base(socket), filepath.Ext(socket))
+}
+
 // Report gets the latest report from the plugin
 func (p *Plugin) Report() (result report.Report, err error) {
 	result = report.MakeReport()
@@ -292,6 +292,41 @@ func TestRegistryRemovesPlugins(t *testing.T) {
 	checkLoadedPluginIDs(t, r.ForEach, []string{})
 }
 
+func TestRegistryOnlyLoadsAllowedPlugins(t *testing.T) {
+	setup(
+		t,
+		mockPlugin{
+			t:       t,
+			Name:    "testPlugin",
+			Handler: stringHandler(http.StatusOK, `{"Plugins":[{"id":"testPlugin","label":"testPlugin","interfaces":["reporter"]}]}`),
+		}.file(),
+		mockPlugin{
+			t:       t,
+			Name:    "otherPlugin",
+			Handler: stringHandler(http.StatusOK, `{"Plugins":[{"id":"otherPlugin","label":"otherPlugin","interfaces":["reporter"]}]}`),
+		}.file(),
+	)
+	defer restore(t)
+
+	root := "/plugins"
+	r, err := NewRegistry(root, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	checkLoadedPluginIDs(t, r.ForEach, []string{"otherPlugin", "testPlugin"})
+
+	if err := r.SetAllowed([]string{"testPlugin"}); err != nil {
+		t.Fatal(err)
+	}
+	checkLoadedPluginIDs(t, r.ForEach, []string{"testPlugin"})
+
+	if err := r.SetAllowed(nil); err != nil {
+		t.Fatal(err)
+	}
+	checkLoadedPluginIDs(t, r.ForEach, []string{"otherPlugin", "testPlugin"})
+}
+
 func TestRegistryUpdatesPluginsWhenTheyChange(t *testing.T) {
 	resp := `{"Plugins":[{"id":"testPlugin","label":"testPlugin","interfaces":["reporter"]}]}`
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,11 +1,15 @@
 package probe
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/armon/go-metrics"
+	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/probe/appclient"
 	"github.com/weaveworks/scope/report"
@@ -13,19 +17,28 @@ import (
 
 const (
 	reportBufferSize = 16
+
+	// Reporters which fail, or miss their deadline, contribute their last
+	// good report for at most this many of their intervals.
+	staleIntervals = 5
 )
 
 // Probe sits there, generating and publishing reports.
 type Probe struct {
-	spyInterval, publishInterval time.Duration
-	publisher                    *appclient.ReportPublisher
+	publisher *appclient.ReportPublisher
 
-	tickers   []Ticker
-	reporters []Reporter
-	taggers   []Tagger
+	// Reporters, taggers, tickers, intervals and schedules can all be
+	// changed while the probe is running.
+	mtx                          sync.Mutex
+	spyInterval, publishInterval time.Duration
+	tickers                      []Ticker
+	reporters                    []*scheduledReporter
+	taggers, finalTaggers        []Tagger
+	schedules                    map[string]Schedule
 
-	quit chan struct{}
-	done sync.WaitGroup
+	quit                   chan struct{}
+	done                   sync.WaitGroup
+	spyReset, publishReset chan struct{}
 
 	spiedReports    chan report.Report
 	shortcutReports chan report.Report
@@ -56,6 +69,46 @@ type reporterFunc struct {
 func (r reporterFunc) Name() string                   { return r.name }
 func (r reporterFunc) Report() (report.Report, error) { return r.f() }
 
+// ContextReporter is a Reporter which stops when its context is cancelled,
+// i.e. when it misses its deadline. Reporters which don't implement it are
+// left to finish in the background, and aren't run again until they do.
+type ContextReporter interface {
+	Reporter
+	ReportContext(ctx context.Context) (report.Report, error)
+}
+
+// Schedule says how often a reporter runs, and how long it may take. The
+// interval is rounded up to a multiple of the spy interval. Zero values
+// mean the spy interval for Interval, and the reporter's interval for
+// Timeout.
+type Schedule struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// ReporterHealth is how a reporter fared the last time it ran.
+type ReporterHealth struct {
+	Name     string
+	LastRun  time.Time
+	Duration time.Duration
+	Error    string
+
+	// Stale is set when the reporter's last run failed or missed its
+	// deadline, so the probe is using an older report from it.
+	Stale bool
+}
+
+func (h ReporterHealth) String() string {
+	switch {
+	case h.LastRun.IsZero():
+		return "not run yet"
+	case h.Stale:
+		return fmt.Sprintf("stale: %s", h.Error)
+	default:
+		return fmt.Sprintf("ok, took %v", h.Duration)
+	}
+}
+
 // Ticker is something which will be invoked every spyDuration.
 // It's useful for things that should be updated on that interval.
 // For example, cached shared state between Taggers and Reporters.
@@ -72,8 +125,11 @@ func New(
 	result := &Probe{
 		spyInterval:     spyInterval,
 		publishInterval: publishInterval,
+		schedules:       map[string]Schedule{},
 		publisher:       appclient.NewReportPublisher(publisher),
 		quit:            make(chan struct{}),
+		spyReset:        make(chan struct{}, 1),
+		publishReset:    make(chan struct{}, 1),
 		spiedReports:    make(chan report.Report, reportBufferSize),
 		shortcutReports: make(chan report.Report, reportBufferSize),
 	}
@@ -82,19 +138,169 @@ func New(
 
 // AddTagger adds a new Tagger to the Probe
 func (p *Probe) AddTagger(ts ...Tagger) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
 	p.taggers = append(p.taggers, ts...)
 }
 
+// AddFinalTagger adds Taggers which run after all the others, whenever they
+// were added, e.g. to redact the report before it is published.
+func (p *Probe) AddFinalTagger(ts ...Tagger) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.finalTaggers = append(p.finalTaggers, ts...)
+}
+
 // AddReporter adds a new Reported to the Probe
 func (p *Probe) AddReporter(rs ...Reporter) {
-	p.reporters = append(p.reporters, rs...)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for _, r := range rs {
+		p.reporters = append(p.reporters, &scheduledReporter{Reporter: r})
+	}
 }
 
 // AddTicker adds a new Ticker to the Probe
 func (p *Probe) AddTicker(ts ...Ticker) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
 	p.tickers = append(p.tickers, ts...)
 }
 
+// RemoveTagger removes Taggers previously added to the Probe.
+func (p *Probe) RemoveTagger(ts ...Tagger) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.taggers = removeTaggers(p.taggers, ts)
+	p.finalTaggers = removeTaggers(p.finalTaggers, ts)
+}
+
+func removeTaggers(taggers, rms []Tagger) []Tagger {
+	result := []Tagger{}
+outer:
+	for _, t := range taggers {
+		for _, rm := range rms {
+			if same(t, rm) {
+				continue outer
+			}
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// RemoveReporter removes Reporters previously added to the Probe.
+func (p *Probe) RemoveReporter(rs ...Reporter) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	reporters := []*scheduledReporter{}
+outer:
+	for _, r := range p.reporters {
+		for _, rm := range rs {
+			if same(r.Reporter, rm) {
+				continue outer
+			}
+		}
+		reporters = append(reporters, r)
+	}
+	p.reporters = reporters
+}
+
+// RemoveTicker removes Tickers previously added to the Probe.
+func (p *Probe) RemoveTicker(ts ...Ticker) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	tickers := []Ticker{}
+outer:
+	for _, t := range p.tickers {
+		for _, rm := range ts {
+			if same(t, rm) {
+				continue outer
+			}
+		}
+		tickers = append(tickers, t)
+	}
+	p.tickers = tickers
+}
+
+// same says if a and b are the same reporter, tagger or ticker. Ones which
+// can't be compared, such as those made with ReporterFunc, never are.
+func same(a, b interface{}) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	return ta == tb && ta.Comparable() && a == b
+}
+
+// SetIntervals changes how often the probe spies and publishes.
+func (p *Probe) SetIntervals(spyInterval, publishInterval time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if spyInterval != p.spyInterval {
+		p.spyInterval = spyInterval
+		reset(p.spyReset)
+	}
+	if publishInterval != p.publishInterval {
+		p.publishInterval = publishInterval
+		reset(p.publishReset)
+	}
+}
+
+// Intervals returns how often the probe spies and publishes.
+func (p *Probe) Intervals() (spyInterval, publishInterval time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.spyInterval, p.publishInterval
+}
+
+// SetSchedules changes how often reporters run, and how long they may take,
+// by reporter name. Reporters not in schedules run every spy interval.
+func (p *Probe) SetSchedules(schedules map[string]Schedule) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.schedules = map[string]Schedule{}
+	for name, schedule := range schedules {
+		p.schedules[name] = schedule
+	}
+}
+
+// ReporterHealth returns how each reporter fared the last time it ran,
+// sorted by name.
+func (p *Probe) ReporterHealth() []ReporterHealth {
+	p.mtx.Lock()
+	reporters := p.reporters
+	p.mtx.Unlock()
+	result := make([]ReporterHealth, 0, len(reporters))
+	for _, r := range reporters {
+		result = append(result, r.healthNow())
+	}
+	sort.Sort(byName(result))
+	return result
+}
+
+type byName []ReporterHealth
+
+func (h byName) Len() int           { return len(h) }
+func (h byName) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h byName) Less(i, j int) bool { return h[i].Name < h[j].Name }
+
+// schedule must be called with the lock held.
+func (p *Probe) schedule(name string) Schedule {
+	s := p.schedules[name]
+	if s.Interval < p.spyInterval {
+		s.Interval = p.spyInterval
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = s.Interval
+	}
+	return s
+}
+
+func reset(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
 // Start starts the probe
 func (p *Probe) Start() {
 	p.done.Add(2)
@@ -117,11 +323,17 @@ func (p *Probe) Publish(rpt report.Report) {
 
 func (p *Probe) spyLoop() {
 	defer p.done.Done()
-	spyTick := time.Tick(p.spyInterval)
+	spyInterval, _ := p.Intervals()
+	spyTick := time.NewTicker(spyInterval)
+	defer func() { spyTick.Stop() }()
 
 	for {
 		select {
-		case <-spyTick:
+		case <-p.spyReset:
+			spyTick.Stop()
+			spyInterval, _ = p.Intervals()
+			spyTick = time.NewTicker(spyInterval)
+		case <-spyTick.C:
 			t := time.Now()
 			p.tick()
 			rpt := p.report()
@@ -135,7 +347,10 @@ func (p *Probe) spyLoop() {
 }
 
 func (p *Probe) tick() {
-	for _, ticker := range p.tickers {
+	p.mtx.Lock()
+	tickers := p.tickers
+	p.mtx.Unlock()
+	for _, ticker := range tickers {
 		t := time.Now()
 		err := ticker.Tick()
 		metrics.MeasureSince([]string{ticker.Name(), "ticker"}, t)
@@ -146,20 +361,24 @@ func (p *Probe) tick() {
 }
 
 func (p *Probe) report() report.Report {
-	reports := make(chan report.Report, len(p.reporters))
-	for _, rep := range p.reporters {
-		go func(rep Reporter) {
-			t := time.Now()
-			timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v reporter took longer than %v", rep.Name(), p.spyInterval) })
-			newReport, err := rep.Report()
-			timer.Stop()
-			metrics.MeasureSince([]string{rep.Name(), "reporter"}, t)
-			if err != nil {
-				log.Errorf("error generating report: %v", err)
-				newReport = report.MakeReport() // empty is OK to merge
-			}
-			reports <- newReport
-		}(rep)
+	p.mtx.Lock()
+	reporters := p.reporters
+	schedules := make([]Schedule, len(reporters))
+	spies := make([]int, len(reporters))
+	for i, r := range reporters {
+		schedules[i] = p.schedule(r.Name())
+		spies[i] = 1
+		if p.spyInterval > 0 {
+			spies[i] = int((schedules[i].Interval + p.spyInterval - 1) / p.spyInterval)
+		}
+	}
+	p.mtx.Unlock()
+
+	reports := make(chan report.Report, len(reporters))
+	for i, r := range reporters {
+		go func(r *scheduledReporter, s Schedule, spies int) {
+			reports <- r.report(s, spies)
+		}(r, schedules[i], spies[i])
 	}
 
 	result := report.MakeReport()
@@ -169,11 +388,120 @@ func (p *Probe) report() report.Report {
 	return result
 }
 
+// scheduledReporter runs a reporter every few spies, with a deadline, and
+// keeps its last good report for the spies in between and for when it
+// fails.
+type scheduledReporter struct {
+	Reporter
+
+	mtx      sync.Mutex
+	running  bool
+	skip     int
+	last     report.Report
+	lastGood time.Time
+	health   ReporterHealth
+	interval time.Duration
+}
+
+// report runs the reporter, if it is due, and returns its latest report.
+func (r *scheduledReporter) report(s Schedule, spies int) report.Report {
+	r.mtx.Lock()
+	r.interval = s.Interval
+	if r.running || r.skip > 0 {
+		r.skip--
+		defer r.mtx.Unlock()
+		return r.current()
+	}
+	r.running = true
+	r.skip = spies - 1
+	r.mtx.Unlock()
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if s.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), s.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.Now()
+		var (
+			rpt report.Report
+			err error
+		)
+		if cr, ok := r.Reporter.(ContextReporter); ok {
+			rpt, err = cr.ReportContext(ctx)
+		} else {
+			rpt, err = r.Report()
+		}
+		metrics.MeasureSince([]string{r.Name(), "reporter"}, t)
+		r.finish(t, rpt, err)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warningf("%v reporter took longer than %v, using its last good report", r.Name(), s.Timeout)
+		r.mtx.Lock()
+		if r.running {
+			r.health.Error = fmt.Sprintf("took longer than %v", s.Timeout)
+		}
+		r.mtx.Unlock()
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.current()
+}
+
+func (r *scheduledReporter) finish(t time.Time, rpt report.Report, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.running = false
+	r.health.LastRun = t
+	r.health.Duration = time.Since(t)
+	if err != nil {
+		log.Errorf("error generating report: %v", err)
+		r.health.Error = err.Error()
+		return
+	}
+	r.last, r.lastGood = rpt, time.Now()
+	r.health.Error = ""
+}
+
+// current returns the last good report, unless it is too stale to use. It
+// must be called with the lock held.
+func (r *scheduledReporter) current() report.Report {
+	if r.lastGood.IsZero() || (r.interval > 0 && time.Since(r.lastGood) > staleIntervals*r.interval) {
+		return report.MakeReport() // empty is OK to merge
+	}
+	return r.last
+}
+
+func (r *scheduledReporter) healthNow() ReporterHealth {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	h := r.health
+	h.Name = r.Name()
+	h.Stale = h.Error != ""
+	return h
+}
+
 func (p *Probe) tag(r report.Report) report.Report {
+	p.mtx.Lock()
+	taggers := append(append([]Tagger{}, p.taggers...), p.finalTaggers...)
+	spyInterval := p.spyInterval
+	p.mtx.Unlock()
+
 	var err error
-	for _, tagger := range p.taggers {
+	for _, tagger := range taggers {
 		t := time.Now()
-		timer := time.AfterFunc(p.spyInterval, func() { log.Warningf("%v tagger took longer than %v", tagger.Name(), p.spyInterval) })
+		timer := time.AfterFunc(spyInterval, func() { log.Warningf("%v tagger took longer than %v", tagger.Name(), spyInterval) })
 		r, err = tagger.Tag(r)
 		timer.Stop()
 		metrics.MeasureSince([]string{tagger.Name(), "tagger"}, t)
@@ -195,6 +523,13 @@ ForLoop:
 		}
 	}
 
+	// Periodic reports cover consecutive publish intervals, so that their
+	// windows add up if they are merged on the way to the app. Shortcut
+	// reports overlap them, so have no window.
+	if !rpt.Shortcut {
+		_, rpt.Window = p.Intervals()
+	}
+
 	if err := p.publisher.Publish(rpt); err != nil {
 		log.Infof("publish: %v", err)
 	}
@@ -202,11 +537,17 @@ ForLoop:
 
 func (p *Probe) publishLoop() {
 	defer p.done.Done()
-	pubTick := time.Tick(p.publishInterval)
+	_, publishInterval := p.Intervals()
+	pubTick := time.NewTicker(publishInterval)
+	defer func() { pubTick.Stop() }()
 
 	for {
 		select {
-		case <-pubTick:
+		case <-p.publishReset:
+			pubTick.Stop()
+			_, publishInterval = p.Intervals()
+			pubTick = time.NewTicker(publishInterval)
+		case <-pubTick.C:
 			p.drainAndPublish(report.MakeReport(), p.spiedReports)
 
 		case rpt := <-p.shortcutReports:
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/ugorji/go/codec"
+	"golang.org/x/net/context"
+
 	"github.com/weaveworks/scope/common/mtime"
 	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
@@ -89,9 +91,13 @@ func TestProbe(t *testing.T) {
 	want.Service.Controls = nil
 	want.Deployment.Controls = nil
 	want.ReplicaSet.Controls = nil
+	want.KubernetesNode.Controls = nil
+	want.Namespace.Controls = nil
+	want.SystemdService.Controls = nil
 	want.Host.Controls = nil
 	want.Overlay.Controls = nil
 	want.Endpoint.AddNode(node)
+	want.Window = 100 * time.Millisecond
 
 	pub := mockPublisher{make(chan report.Report, 10)}
 
@@ -104,3 +110,127 @@ func TestProbe(t *testing.T) {
 		return <-pub.have
 	})
 }
+
+func TestReconfigure(t *testing.T) {
+	p := New(time.Second, time.Second, nil)
+
+	a, b := report.MakeReport(), report.MakeReport()
+	a.Host.AddNode(report.MakeNode("a"))
+	b.Host.AddNode(report.MakeNode("b"))
+	ra, rb := &mockReporter{a}, &mockReporter{b}
+	p.AddReporter(ra, rb, ReporterFunc("func", func() (report.Report, error) {
+		return report.MakeReport(), nil
+	}))
+	p.RemoveReporter(ra)
+
+	rpt := p.report()
+	if _, ok := rpt.Host.Nodes["a"]; ok || len(rpt.Host.Nodes) != 1 {
+		t.Errorf("Expected only b, got %v", rpt.Host.Nodes)
+	}
+
+	p.SetIntervals(2*time.Second, 5*time.Second)
+	if spy, publish := p.Intervals(); spy != 2*time.Second || publish != 5*time.Second {
+		t.Errorf("Unexpected intervals: %v, %v", spy, publish)
+	}
+}
+
+type countingReporter struct {
+	name string
+	runs chan struct{}
+}
+
+func (c countingReporter) Name() string { return c.name }
+
+func (c countingReporter) Report() (report.Report, error) {
+	c.runs <- struct{}{}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode(c.name))
+	return rpt, nil
+}
+
+func TestReporterSchedules(t *testing.T) {
+	p := New(time.Second, time.Second, nil)
+	every, third := countingReporter{"every", make(chan struct{}, 10)}, countingReporter{"third", make(chan struct{}, 10)}
+	p.AddReporter(every, third)
+	p.SetSchedules(map[string]Schedule{"third": {Interval: 2500 * time.Millisecond}})
+
+	for i := 0; i < 6; i++ {
+		rpt := p.report()
+		// Reporters which aren't due contribute their last report
+		if len(rpt.Host.Nodes) != 2 {
+			t.Errorf("Expected both reporters' nodes, got %v", rpt.Host.Nodes)
+		}
+	}
+	if len(every.runs) != 6 || len(third.runs) != 2 {
+		t.Errorf("Expected 6 and 2 runs, got %d and %d", len(every.runs), len(third.runs))
+	}
+}
+
+type blockingReporter struct {
+	block chan struct{}
+}
+
+func (blockingReporter) Name() string { return "Blocking" }
+
+func (b blockingReporter) Report() (report.Report, error) {
+	return b.ReportContext(context.Background())
+}
+
+func (b blockingReporter) ReportContext(ctx context.Context) (report.Report, error) {
+	select {
+	case <-b.block:
+	case <-ctx.Done():
+		return report.MakeReport(), ctx.Err()
+	}
+	rpt := report.MakeReport()
+	rpt.Host.AddNode(report.MakeNode("blocking"))
+	return rpt, nil
+}
+
+// waitForRun waits for the probe's only reporter to finish a run started
+// after t, as reporters which miss their deadline finish in the background.
+func waitForRun(t *testing.T, p *Probe, after time.Time) ReporterHealth {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if h := p.ReporterHealth(); len(h) == 1 && h[0].LastRun.After(after) {
+			return h[0]
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timeout waiting for reporter")
+	return ReporterHealth{}
+}
+
+func TestReporterDeadline(t *testing.T) {
+	p := New(time.Second, time.Second, nil)
+	b := blockingReporter{make(chan struct{}, 1)}
+	p.AddReporter(b)
+	p.SetSchedules(map[string]Schedule{"Blocking": {Timeout: 10 * time.Millisecond}})
+
+	// Misses its deadline without a good report; there's nothing to use
+	start := time.Now()
+	if rpt := p.report(); len(rpt.Host.Nodes) != 0 {
+		t.Errorf("Expected an empty report, got %v", rpt.Host.Nodes)
+	}
+	if h := waitForRun(t, p, start); !h.Stale {
+		t.Errorf("Expected a stale reporter, got %+v", h)
+	}
+
+	b.block <- struct{}{}
+	start = time.Now()
+	if rpt := p.report(); len(rpt.Host.Nodes) != 1 {
+		t.Errorf("Expected the blocking node, got %v", rpt.Host.Nodes)
+	}
+	if h := waitForRun(t, p, start); h.Stale {
+		t.Errorf("Expected a healthy reporter, got %+v", h)
+	}
+
+	// Misses its deadline again; the last good report is used
+	start = time.Now()
+	if rpt := p.report(); len(rpt.Host.Nodes) != 1 {
+		t.Errorf("Expected the blocking node, got %v", rpt.Host.Nodes)
+	}
+	if h := waitForRun(t, p, start); !h.Stale || h.String() != "stale: context deadline exceeded" {
+		t.Errorf("Expected a stale reporter, got %+v", h)
+	}
+}
@@ -0,0 +1,369 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/fs"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the process integration.
+const (
+	SignalProcess    = "process_signal"
+	TerminateProcess = "process_terminate"
+	KillProcess      = "process_kill"
+	ReniceProcess    = "process_renice"
+	InspectProcess   = "process_inspect"
+
+	// SignalArg is the argument to SignalProcess.
+	SignalArg = "signal"
+	// NicenessArg is the argument to ReniceProcess.
+	NicenessArg = "niceness"
+)
+
+var (
+	signals = map[string]syscall.Signal{
+		"HUP":  syscall.SIGHUP,
+		"INT":  syscall.SIGINT,
+		"QUIT": syscall.SIGQUIT,
+		"KILL": syscall.SIGKILL,
+		"USR1": syscall.SIGUSR1,
+		"USR2": syscall.SIGUSR2,
+		"TERM": syscall.SIGTERM,
+		"CONT": syscall.SIGCONT,
+		"STOP": syscall.SIGSTOP,
+	}
+
+	minNiceness = -20
+	maxNiceness = 19
+
+	signalArgs = report.ControlArgs{
+		{Name: SignalArg, Human: "Signal", Type: report.ControlArgEnum, Options: signalNames(), Default: "TERM"},
+	}
+	reniceArgs = report.ControlArgs{
+		{Name: NicenessArg, Human: "Niceness", Type: report.ControlArgInt, Required: true, Min: &minNiceness, Max: &maxNiceness},
+	}
+
+	// Controls are the controls on each process node.
+	Controls = []report.Control{
+		{ID: TerminateProcess, Human: "Terminate", Icon: "fa-stop", Rank: 0},
+		{ID: KillProcess, Human: "Kill", Icon: "fa-times", Rank: 1},
+		{ID: SignalProcess, Human: "Send signal", Icon: "fa-bolt", Rank: 2, Args: signalArgs},
+		{ID: ReniceProcess, Human: "Renice", Icon: "fa-sort-amount-desc", Rank: 3, Args: reniceArgs},
+		{ID: InspectProcess, Human: "Inspect", Icon: "fa-search", Rank: 4},
+	}
+)
+
+func signalNames() []string {
+	names := []string{}
+	for name := range signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Reporter) registerControls() {
+	controls.Register(TerminateProcess, r.capturePID(r.signal(syscall.SIGTERM)))
+	controls.Register(KillProcess, r.capturePID(r.signal(syscall.SIGKILL)))
+	controls.RegisterWithArgs(SignalProcess, signalArgs, r.capturePID(r.signalProcess))
+	controls.RegisterWithArgs(ReniceProcess, reniceArgs, r.capturePID(r.reniceProcess))
+	controls.Register(InspectProcess, r.capturePID(r.inspectProcess))
+}
+
+func (r *Reporter) deregisterControls() {
+	for _, control := range Controls {
+		controls.Rm(control.ID)
+	}
+}
+
+// capturePID parses the PID out of the request's node ID, only accepting
+// processes on this host.
+func (r *Reporter) capturePID(f func(xfer.Request, int) xfer.Response) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		scope, pidStr, ok := report.ParseNodeID(req.NodeID)
+		if !ok || scope != r.scope {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid <= 0 {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		return f(req, pid)
+	}
+}
+
+func (r *Reporter) signal(sig syscall.Signal) func(xfer.Request, int) xfer.Response {
+	return func(req xfer.Request, pid int) xfer.Response {
+		return xfer.ResponseError(syscall.Kill(pid, sig))
+	}
+}
+
+func (r *Reporter) signalProcess(req xfer.Request, pid int) xfer.Response {
+	sig, ok := signals[req.Args[SignalArg]]
+	if !ok {
+		return xfer.ResponseErrorf("Unknown signal: %s", req.Args[SignalArg])
+	}
+	return r.signal(sig)(req, pid)
+}
+
+func (r *Reporter) reniceProcess(req xfer.Request, pid int) xfer.Response {
+	niceness, err := strconv.Atoi(req.Args[NicenessArg])
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.ResponseError(syscall.Setpriority(syscall.PRIO_PROCESS, pid, niceness))
+}
+
+// inspectProcess opens a pipe on which the user can interactively view the
+// process' status, environment, open files and sockets.
+func (r *Reporter) inspectProcess(req xfer.Request, pid int) xfer.Response {
+	id, pipe, err := controls.NewPipe(r.pipes, req)
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	local, _ := pipe.Ends()
+	r.mtx.Lock()
+	inspector := Inspector{ProcRoot: r.procRoot, PID: pid, Redact: r.redact}
+	r.mtx.Unlock()
+	go func() {
+		if err := inspector.Serve(local); err != nil && err != io.EOF {
+			log.Errorf("Error inspecting process %d: %v", pid, err)
+		}
+		pipe.Close()
+	}()
+	return xfer.Response{
+		Pipe: id,
+	}
+}
+
+// Inspector serves an interactive, line-based view of a process from /proc.
+// If Redact is set, the environment is passed through it, one variable at a
+// time, so it is redacted just like reports are.
+type Inspector struct {
+	ProcRoot string
+	PID      int
+	Redact   func(key, value string) string
+}
+
+var inspectorCommands = []struct {
+	name, help string
+}{
+	{"status", "show /proc/PID/status"},
+	{"env", "show the environment"},
+	{"fds", "list open file descriptors"},
+	{"sockets", "list open sockets"},
+	{"stack", "show the kernel stack"},
+	{"quit", "close this view"},
+}
+
+// Serve reads commands from rw, one per line, and writes their output back,
+// until the user quits or rw is closed. rw is usually a terminal in the
+// browser, which sends keystrokes as they're typed, so Serve echoes them,
+// handles backspace, and takes "\r", "\n" or "\r\n" to end a line.
+func (i Inspector) Serve(rw io.ReadWriter) error {
+	if err := i.write(rw, i.Run("status")); err != nil {
+		return err
+	}
+	var (
+		r      = bufio.NewReader(rw)
+		line   []byte
+		lastCR bool
+	)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		wasCR := lastCR
+		lastCR = b == '\r'
+		var echo []byte
+		switch {
+		case b == '\n' && wasCR:
+			continue
+		case b == '\r' || b == '\n':
+			if _, err := io.WriteString(rw, "\r\n"); err != nil {
+				return err
+			}
+			command := strings.TrimSpace(string(line))
+			line = line[:0]
+			if command == "quit" || command == "exit" {
+				return nil
+			}
+			if err := i.write(rw, i.Run(command)); err != nil {
+				return err
+			}
+			continue
+		case b == '\b' || b == 0x7f:
+			if len(line) == 0 {
+				continue
+			}
+			_, size := utf8.DecodeLastRune(line)
+			line = line[:len(line)-size]
+			echo = []byte("\b \b")
+		case b < ' ':
+			// Ignore other control characters
+			continue
+		default:
+			line = append(line, b)
+			echo = []byte{b}
+		}
+		if _, err := rw.Write(echo); err != nil {
+			return err
+		}
+	}
+}
+
+func (i Inspector) write(w io.Writer, output string) error {
+	if output == "" {
+		_, err := io.WriteString(w, "> ")
+		return err
+	}
+	output = strings.Replace(strings.TrimRight(output, "\n"), "\n", "\r\n", -1)
+	_, err := fmt.Fprintf(w, "%s\r\n> ", output)
+	return err
+}
+
+// Run runs a single inspector command, returning its output.
+func (i Inspector) Run(command string) string {
+	var (
+		output string
+		err    error
+	)
+	switch command {
+	case "":
+		return ""
+	case "status":
+		output, err = i.readFile("status")
+	case "env":
+		output, err = i.env()
+	case "stack":
+		output, err = i.readFile("stack")
+	case "fds":
+		output, err = i.fds(false)
+	case "sockets":
+		output, err = i.sockets()
+	default:
+		lines := []string{fmt.Sprintf("Unknown command %q. Commands:", command)}
+		for _, c := range inspectorCommands {
+			lines = append(lines, fmt.Sprintf("  %-8s %s", c.name, c.help))
+		}
+		return strings.Join(lines, "\n")
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return output
+}
+
+func (i Inspector) path(elem ...string) string {
+	return path.Join(append([]string{i.ProcRoot, strconv.Itoa(i.PID)}, elem...)...)
+}
+
+func (i Inspector) readFile(name string) (string, error) {
+	contents, err := fs.ReadFile(i.path(name))
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// env lists the process' environment, one variable per line.
+func (i Inspector) env() (string, error) {
+	contents, err := i.readFile("environ")
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(contents, "\x00") {
+		if line == "" {
+			continue
+		}
+		if i.Redact != nil {
+			key, value := line, ""
+			if eq := strings.Index(line, "="); eq >= 0 {
+				key, value = line[:eq], line[eq+1:]
+			}
+			line = key + "=" + i.Redact(key, value)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// fds lists the process' open file descriptors and what they point to,
+// optionally only those which are sockets.
+func (i Inspector) fds(socketsOnly bool) (string, error) {
+	names, err := fs.ReadDirNames(i.path("fd"))
+	if err != nil {
+		return "", err
+	}
+	sort.Sort(byNumber(names))
+	lines := []string{}
+	for _, name := range names {
+		target, err := os.Readlink(i.path("fd", name))
+		if err != nil {
+			continue
+		}
+		if socketsOnly && !strings.HasPrefix(target, "socket:") {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s -> %s", name, target))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// sockets lists the process' open sockets, along with their entries from
+// /proc/PID/net/{tcp,udp}{,6}.
+func (i Inspector) sockets() (string, error) {
+	fds, err := i.fds(true)
+	if err != nil || fds == "" {
+		return fds, err
+	}
+	inodes := map[string]struct{}{}
+	for _, line := range strings.Split(fds, "\n") {
+		inode := strings.TrimSuffix(strings.TrimPrefix(line[strings.Index(line, "socket:"):], "socket:["), "]")
+		inodes[inode] = struct{}{}
+	}
+
+	lines := []string{fds, ""}
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		contents, err := fs.ReadFile(i.path("net", proto))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+			if _, ok := inodes[fields[9]]; ok {
+				lines = append(lines, fmt.Sprintf("%-4s local=%s remote=%s state=%s inode=%s", proto, fields[1], fields[2], fields[3], fields[9]))
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type byNumber []string
+
+func (b byNumber) Len() int      { return len(b) }
+func (b byNumber) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byNumber) Less(i, j int) bool {
+	x, _ := strconv.Atoi(b[i])
+	y, _ := strconv.Atoi(b[j])
+	return x < y
+}
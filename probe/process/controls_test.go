@@ -0,0 +1,181 @@
+package process_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+func TestInspector(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "process-inspector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+
+	dir := filepath.Join(procRoot, "42")
+	for _, d := range []string{dir, filepath.Join(dir, "fd"), filepath.Join(dir, "net")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, contents := range map[string]string{
+		"status":  "Name:\tsleep\nState:\tS (sleeping)\n",
+		"environ": "HOME=/root\x00PATH=/bin\x00",
+		"net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 123 1 0000000000000000 100 0 0 10 0\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for fd, target := range map[string]string{
+		"0":  "/dev/null",
+		"10": "socket:[123]",
+		"2":  "pipe:[456]",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inspector := process.Inspector{ProcRoot: procRoot, PID: 42}
+	for _, tc := range []struct {
+		command string
+		want    []string
+	}{
+		{"status", []string{"Name:\tsleep"}},
+		{"env", []string{"HOME=/root\nPATH=/bin"}},
+		{"fds", []string{"0 -> /dev/null\n2 -> pipe:[456]\n10 -> socket:[123]"}},
+		{"sockets", []string{"10 -> socket:[123]", "tcp  local=0100007F:1F90 remote=00000000:0000 state=0A inode=123"}},
+		{"stack", []string{"Error:"}},
+		{"frobnicate", []string{"Unknown command", "sockets"}},
+	} {
+		have := inspector.Run(tc.command)
+		for _, want := range tc.want {
+			if !strings.Contains(have, want) {
+				t.Errorf("%s: expected %q in %q", tc.command, want, have)
+			}
+		}
+		if tc.command == "sockets" && strings.Contains(have, "pipe:") {
+			t.Errorf("sockets: unexpected non-socket fd in %q", have)
+		}
+	}
+
+	// The environment is redacted variable by variable
+	inspector.Redact = func(key, value string) string {
+		if key == "HOME" {
+			return "<redacted>"
+		}
+		return value
+	}
+	if want, have := "HOME=<redacted>\nPATH=/bin", inspector.Run("env"); want != have {
+		t.Errorf("env: want %q, have %q", want, have)
+	}
+}
+
+func TestInspectorServe(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "process-inspector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procRoot)
+	dir := filepath.Join(procRoot, "42")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "environ"), []byte("HOME=/root\x00PATH=/bin\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pipe := xfer.NewPipe()
+	defer pipe.Close()
+	local, remote := pipe.Ends()
+	served := make(chan error, 1)
+	go func() { served <- process.Inspector{ProcRoot: procRoot, PID: 42}.Serve(local) }()
+	output := make(chan string, 1)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, remote)
+		output <- buf.String()
+	}()
+
+	// Keystrokes as a browser terminal sends them: Enter is "\r", sometimes
+	// "\r\n", and backspace is DEL.
+	for _, keys := range []string{"e", "nx", "\x7f", "v", "\r", "\r\n", "fo", "o\n", "quit\r"} {
+		if _, err := remote.Write([]byte(keys)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Inspector didn't quit")
+	}
+	pipe.Close()
+
+	have := <-output
+	for _, want := range []string{
+		"> enx\b \bv\r\nHOME=/root\r\nPATH=/bin\r\n> ",
+		"> \r\n> foo\r\nUnknown command \"foo\"",
+		"> quit\r\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("Expected %q in %q", want, have)
+		}
+	}
+}
+
+func TestSignalControls(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	reporter := process.NewReporter(&mockWalker{}, "host", "probe", "/proc", nil, nil)
+	defer reporter.Stop()
+
+	nodeID := report.MakeProcessNodeID("host", strconv.Itoa(cmd.Process.Pid))
+	for _, req := range []xfer.Request{
+		{Control: process.SignalProcess, NodeID: report.MakeProcessNodeID("otherhost", "1")},
+		{Control: process.SignalProcess, NodeID: report.MakeProcessNodeID("host", "foo")},
+		{Control: process.SignalProcess, NodeID: nodeID, Args: map[string]string{process.SignalArg: "BOGUS"}},
+		{Control: process.ReniceProcess, NodeID: nodeID, Args: map[string]string{process.NicenessArg: "42"}},
+	} {
+		if res := controls.HandleControlRequest(req); res.Error == "" {
+			t.Errorf("%v: expected error", req)
+		}
+	}
+
+	res := controls.HandleControlRequest(xfer.Request{
+		Control: process.SignalProcess,
+		NodeID:  nodeID,
+		Args:    map[string]string{process.SignalArg: "KILL"},
+	})
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("process was not killed")
+	}
+}
@@ -2,8 +2,10 @@ package process
 
 import (
 	"strconv"
+	"sync"
 
 	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -37,25 +39,50 @@ var (
 
 // Reporter generates Reports containing the Process topology.
 type Reporter struct {
-	scope   string
-	walker  Walker
-	jiffies Jiffies
+	scope    string
+	probeID  string
+	procRoot string
+	walker   Walker
+	jiffies  Jiffies
+	pipes    controls.PipeClient
+
+	mtx    sync.Mutex
+	redact func(key, value string) string
 }
 
 // Jiffies is the type for the function used to fetch the elapsed jiffies.
 type Jiffies func() (uint64, float64, error)
 
-// NewReporter makes a new Reporter.
-func NewReporter(walker Walker, scope string, jiffies Jiffies) *Reporter {
-	return &Reporter{
-		scope:   scope,
-		walker:  walker,
-		jiffies: jiffies,
+// NewReporter makes a new Reporter. procRoot is where the process controls
+// inspect processes from.
+func NewReporter(walker Walker, scope, probeID, procRoot string, jiffies Jiffies, pipes controls.PipeClient) *Reporter {
+	r := &Reporter{
+		scope:    scope,
+		probeID:  probeID,
+		procRoot: procRoot,
+		walker:   walker,
+		jiffies:  jiffies,
+		pipes:    pipes,
 	}
+	r.registerControls()
+	return r
+}
+
+// SetRedact sets how the process inspector redacts environment variables,
+// by name and value.
+func (r *Reporter) SetRedact(f func(key, value string) string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.redact = f
+}
+
+// Stop stops the reporter.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
 }
 
 // Name of this reporter, for metrics gathering
-func (Reporter) Name() string { return "Process" }
+func (*Reporter) Name() string { return "Process" }
 
 // Report implements Reporter.
 func (r *Reporter) Report() (report.Report, error) {
@@ -72,7 +99,12 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 	t := report.MakeTopology().
 		WithMetadataTemplates(MetadataTemplates).
 		WithMetricTemplates(MetricTemplates)
+	t.Controls.AddControls(Controls)
 	now := mtime.Now()
+	controlIDs := []string{}
+	for _, control := range Controls {
+		controlIDs = append(controlIDs, control.ID)
+	}
 	deltaTotal, maxCPU, err := r.jiffies()
 	if err != nil {
 		return t, err
@@ -81,12 +113,13 @@ func (r *Reporter) processTopology() (report.Topology, error) {
 	err = r.walker.Walk(func(p, prev Process) {
 		pidstr := strconv.Itoa(p.PID)
 		nodeID := report.MakeProcessNodeID(r.scope, pidstr)
-		node := report.MakeNode(nodeID)
+		node := report.MakeNode(nodeID).WithControls(controlIDs...)
 		for _, tuple := range []struct{ key, value string }{
 			{PID, pidstr},
 			{Name, p.Name},
 			{Cmdline, p.Cmdline},
 			{Threads, strconv.Itoa(p.Threads)},
+			{report.ControlProbeID, r.probeID},
 		} {
 			if tuple.value != "" {
 				node = node.WithLatests(map[string]string{tuple.key: tuple.value})
@@ -0,0 +1,320 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/weaveworks/scope/report"
+)
+
+// RedactedFields is the key of the set, on each node, of the fields which
+// have been redacted.
+const RedactedFields = "redacted_fields"
+
+// Mask replaces redacted values.
+const Mask = "<redacted>"
+
+// Default rules, used when Rules.Defaults is set. Key patterns must match
+// the whole key; value patterns redact their first group, or the whole match
+// if they have none.
+var (
+	DefaultKeys = []string{
+		`(?i).*(passw(or)?d|passwd|secret|token|api_?key|access_?key|private_?key|credential|authorization).*`,
+	}
+	DefaultValues = []string{
+		`(?i)(?:passw(?:or)?d|passwd|secret|token|api[_-]?key|access[_-]?key)[=: ]+(\S+)`,
+		`[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s]+:([^@/\s]+)@`,
+	}
+)
+
+// Secret-looking tokens are runs of at least tokenMinLen token characters,
+// with upper and lower case letters and digits, and at least tokenMinEntropy
+// bits of entropy per character. This catches API keys and the like, but not
+// hex or lower case identifiers, such as container IDs and UUIDs.
+const (
+	tokenMinLen     = 20
+	tokenMinEntropy = 3.5
+)
+
+var tokenCandidates = regexp.MustCompile(`[A-Za-z0-9+_-]{20,}`)
+
+// Rules say what to redact from reports. The zero value redacts nothing.
+type Rules struct {
+	// Defaults adds DefaultKeys and DefaultValues to Keys and Values.
+	Defaults bool
+
+	// Keys are regular expressions matching the whole of the keys whose
+	// values are redacted entirely, e.g. "docker_env_DB_PASSWORD".
+	Keys []string
+
+	// Values are regular expressions matching the parts of values to
+	// redact. If they have a group, only that is redacted.
+	Values []string
+
+	// Tokens redacts anything which looks like a secret token.
+	Tokens bool
+
+	// Topologies has allow and deny lists by topology name, e.g.
+	// "container".
+	Topologies map[string]TopologyRules
+}
+
+// TopologyRules are regular expressions matching the whole of keys in a
+// topology which are never redacted (Allow), or always redacted (Deny).
+// Allow takes precedence.
+type TopologyRules struct {
+	Allow []string
+	Deny  []string
+}
+
+type compiledRules struct {
+	keys, values []*regexp.Regexp
+	tokens       bool
+	allow, deny  map[string][]*regexp.Regexp
+}
+
+func (c *compiledRules) empty() bool {
+	return len(c.keys) == 0 && len(c.values) == 0 && !c.tokens && len(c.deny) == 0
+}
+
+func compile(patterns []string, anchor bool) ([]*regexp.Regexp, error) {
+	result := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		if anchor {
+			pattern = "^(?:" + pattern + ")$"
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+func (rules Rules) compile() (*compiledRules, error) {
+	keys, values := rules.Keys, rules.Values
+	if rules.Defaults {
+		keys = append(append([]string{}, DefaultKeys...), keys...)
+		values = append(append([]string{}, DefaultValues...), values...)
+	}
+	var (
+		c = &compiledRules{
+			tokens: rules.Tokens,
+			allow:  map[string][]*regexp.Regexp{},
+			deny:   map[string][]*regexp.Regexp{},
+		}
+		err error
+	)
+	if c.keys, err = compile(keys, true); err != nil {
+		return nil, err
+	}
+	if c.values, err = compile(values, false); err != nil {
+		return nil, err
+	}
+	for name, t := range rules.Topologies {
+		if _, ok := report.MakeReport().Topology(name); !ok {
+			return nil, fmt.Errorf("unknown topology %q", name)
+		}
+		if c.allow[name], err = compile(t.Allow, true); err != nil {
+			return nil, err
+		}
+		if c.deny[name], err = compile(t.Deny, true); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Validate checks the rules can be used.
+func (rules Rules) Validate() error {
+	_, err := rules.compile()
+	return err
+}
+
+// Redactor is a Tagger which redacts sensitive data from reports before they
+// are published, recording which fields it redacted on each node.
+type Redactor struct {
+	mtx   sync.RWMutex
+	rules *compiledRules
+}
+
+// NewRedactor makes a new Redactor.
+func NewRedactor(rules Rules) (*Redactor, error) {
+	r := &Redactor{}
+	if err := r.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRules changes what the Redactor redacts. If the rules are invalid, the
+// old ones stay in place.
+func (r *Redactor) SetRules(rules Rules) error {
+	c, err := rules.compile()
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.rules = c
+	return nil
+}
+
+// Name of this tagger, for metrics gathering
+func (*Redactor) Name() string { return "Redactor" }
+
+// Tag implements Tagger.
+func (r *Redactor) Tag(rpt report.Report) (report.Report, error) {
+	r.mtx.RLock()
+	rules := r.rules
+	r.mtx.RUnlock()
+	if rules.empty() {
+		return rpt, nil
+	}
+
+	redacted := 0
+	for name, t := range map[string]*report.Topology{
+		report.Endpoint:       &(rpt.Endpoint),
+		report.Process:        &(rpt.Process),
+		report.Container:      &(rpt.Container),
+		report.ContainerImage: &(rpt.ContainerImage),
+		report.Pod:            &(rpt.Pod),
+		report.Service:        &(rpt.Service),
+		report.Deployment:     &(rpt.Deployment),
+		report.ReplicaSet:     &(rpt.ReplicaSet),
+		report.KubernetesNode: &(rpt.KubernetesNode),
+		report.Namespace:      &(rpt.Namespace),
+		report.SystemdService: &(rpt.SystemdService),
+		report.Host:           &(rpt.Host),
+		report.Overlay:        &(rpt.Overlay),
+	} {
+		nodes := report.Nodes{}
+		for id, node := range t.Nodes {
+			node, fields := rules.redactNode(name, node)
+			redacted += len(fields)
+			nodes[id] = node
+		}
+		t.Nodes = nodes
+	}
+	if redacted > 0 {
+		metrics.IncrCounter([]string{"redactor", "fields"}, float32(redacted))
+	}
+	return rpt, nil
+}
+
+// Redact returns value with anything sensitive redacted, as it would be if
+// it were under key in a node of the given topology.
+func (r *Redactor) Redact(topology, key, value string) string {
+	r.mtx.RLock()
+	rules := r.rules
+	r.mtx.RUnlock()
+	redacted, _ := rules.redact(topology, key, value)
+	return redacted
+}
+
+func (c *compiledRules) redactNode(topology string, node report.Node) (report.Node, []string) {
+	fields := []string{}
+	latest := node.Latest
+	node.Latest.ForEach(func(key, value string) {
+		redacted, ok := c.redact(topology, key, value)
+		if !ok {
+			return
+		}
+		_, ts, _ := node.Latest.LookupEntry(key)
+		latest = latest.Set(key, ts, redacted)
+		fields = append(fields, key)
+	})
+	if len(fields) == 0 {
+		return node, fields
+	}
+	sort.Strings(fields)
+	node.Latest = latest
+	return node.WithSet(RedactedFields, report.MakeStringSet(fields...)), fields
+}
+
+// redact returns the redacted value, and whether anything was redacted.
+func (c *compiledRules) redact(topology, key, value string) (string, bool) {
+	if matchAny(c.allow[topology], key) || value == Mask {
+		return value, false
+	}
+	if matchAny(c.deny[topology], key) || matchAny(c.keys, key) {
+		return Mask, value != ""
+	}
+	result := value
+	for _, re := range c.values {
+		result = replaceMatches(re, result)
+	}
+	if c.tokens {
+		result = tokenCandidates.ReplaceAllStringFunc(result, func(s string) string {
+			if looksSecret(s) {
+				return Mask
+			}
+			return s
+		})
+	}
+	return result, result != value
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceMatches masks the first group of each match of re in s, or the
+// whole match if re has no groups.
+func replaceMatches(re *regexp.Regexp, s string) string {
+	var (
+		result []string
+		last   int
+	)
+	for _, match := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := match[0], match[1]
+		if len(match) >= 4 {
+			if match[2] < 0 {
+				continue
+			}
+			start, end = match[2], match[3]
+		}
+		result = append(result, s[last:start], Mask)
+		last = end
+	}
+	if result == nil {
+		return s
+	}
+	return strings.Join(append(result, s[last:]), "")
+}
+
+func looksSecret(s string) bool {
+	if len(s) < tokenMinLen {
+		return false
+	}
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, c := range s {
+		upper = upper || unicode.IsUpper(c)
+		lower = lower || unicode.IsLower(c)
+		digit = digit || unicode.IsDigit(c)
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= tokenMinEntropy
+}
@@ -0,0 +1,190 @@
+package redact_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/probe/redact"
+	"github.com/weaveworks/scope/report"
+	"github.com/weaveworks/scope/test/reflect"
+)
+
+const (
+	containerID = "4b5a2bb4c2e9e7a3a2e5c1d0f7e6b1a0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4"
+	awsSecret   = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+)
+
+func makeReport() report.Report {
+	rpt := report.MakeReport()
+	rpt.Container.AddNode(report.MakeNodeWith("c1", map[string]string{
+		"docker_container_id":     containerID,
+		"docker_env_PATH":         "/usr/local/sbin:/usr/local/bin",
+		"docker_env_DB_PASSWORD":  "hunter2",
+		"docker_env_DATABASE_URL": "postgres://scope:hunter2@db:5432/scope",
+		"docker_env_AWS_SECRET":   awsSecret,
+		"docker_env_AWS_SECRETS":  "",
+		"docker_label_owner":      "ops",
+	}))
+	rpt.Process.AddNode(report.MakeNodeWith("p1", map[string]string{
+		"cmdline": "mysqld --user=mysql --password=hunter2 --datadir=/var/lib/mysql",
+	}))
+	rpt.Host.AddNode(report.MakeNodeWith("h1", map[string]string{
+		"host_name": "host1",
+	}))
+	return rpt
+}
+
+func lookup(t *testing.T, n report.Node, key string) string {
+	value, ok := n.Latest.Lookup(key)
+	if !ok {
+		t.Fatalf("%s missing from %s", key, n.ID)
+	}
+	return value
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := redact.NewRedactor(redact.Rules{Defaults: true, Tokens: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpt, err := r.Tag(makeReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := rpt.Container.Nodes["c1"]
+	for key, want := range map[string]string{
+		"docker_container_id":     containerID,
+		"docker_env_PATH":         "/usr/local/sbin:/usr/local/bin",
+		"docker_env_DB_PASSWORD":  redact.Mask,
+		"docker_env_DATABASE_URL": "postgres://scope:" + redact.Mask + "@db:5432/scope",
+		"docker_env_AWS_SECRET":   redact.Mask,
+		"docker_env_AWS_SECRETS":  "",
+		"docker_label_owner":      "ops",
+	} {
+		if have := lookup(t, container, key); want != have {
+			t.Errorf("%s: want %q, have %q", key, want, have)
+		}
+	}
+	want := report.MakeStringSet("docker_env_AWS_SECRET", "docker_env_DATABASE_URL", "docker_env_DB_PASSWORD")
+	if have, _ := container.Sets.Lookup(redact.RedactedFields); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	process := rpt.Process.Nodes["p1"]
+	if want, have := "mysqld --user=mysql --password="+redact.Mask+" --datadir=/var/lib/mysql", lookup(t, process, "cmdline"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// Nothing redacted, so nothing recorded
+	if _, ok := rpt.Host.Nodes["h1"].Sets.Lookup(redact.RedactedFields); ok {
+		t.Error("Expected no redacted fields on host")
+	}
+}
+
+func TestRedactorTokens(t *testing.T) {
+	for value, want := range map[string]string{
+		"--key=Xk9fQ2mZpL7vR4tW8yB3nC6d --region=eu-west-1": "--key=" + redact.Mask + " --region=eu-west-1",
+		"docker run weaveworks/scope:1.0 --no-app":          "docker run weaveworks/scope:1.0 --no-app",
+		"uuid=1b4e28ba-2fa1-11d2-883f-0016d3cca427":         "uuid=1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+		"id=" + containerID:                                 "id=" + containerID,
+		"name=ThisIsAVeryLongButBoringName":                 "name=ThisIsAVeryLongButBoringName",
+	} {
+		r, err := redact.NewRedactor(redact.Rules{Tokens: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rpt := report.MakeReport()
+		rpt.Process.AddNode(report.MakeNodeWith("p1", map[string]string{"cmdline": value}))
+		rpt, _ = r.Tag(rpt)
+		if have := lookup(t, rpt.Process.Nodes["p1"], "cmdline"); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestRedactorTopologies(t *testing.T) {
+	r, err := redact.NewRedactor(redact.Rules{
+		Defaults: true,
+		Values:   []string{`--user=(\w+)`},
+		Topologies: map[string]redact.TopologyRules{
+			report.Container: {
+				Allow: []string{"docker_env_DB_PASSWORD"},
+				Deny:  []string{"docker_label_.*"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpt, err := r.Tag(makeReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := rpt.Container.Nodes["c1"]
+	for key, want := range map[string]string{
+		"docker_env_DB_PASSWORD": "hunter2",
+		"docker_env_AWS_SECRET":  redact.Mask,
+		"docker_label_owner":     redact.Mask,
+	} {
+		if have := lookup(t, container, key); want != have {
+			t.Errorf("%s: want %q, have %q", key, want, have)
+		}
+	}
+	if want, have := "mysqld --user="+redact.Mask+" --password="+redact.Mask+" --datadir=/var/lib/mysql", lookup(t, rpt.Process.Nodes["p1"], "cmdline"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// Without any rules, nothing changes
+	mtime.NowForce(time.Now())
+	defer mtime.NowReset()
+	if err := r.SetRules(redact.Rules{}); err != nil {
+		t.Fatal(err)
+	}
+	want := makeReport()
+	if have, _ := r.Tag(makeReport()); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestRedactorRedact(t *testing.T) {
+	r, err := redact.NewRedactor(redact.Rules{
+		Defaults: true,
+		Topologies: map[string]redact.TopologyRules{
+			report.Process: {Allow: []string{"TOKEN_FILE"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		topology, key, value, want string
+	}{
+		{report.Process, "DB_PASSWORD", "hunter2", redact.Mask},
+		{report.Process, "DATABASE_URL", "postgres://scope:hunter2@db/scope", "postgres://scope:" + redact.Mask + "@db/scope"},
+		{report.Process, "TOKEN_FILE", "/run/secrets/token", "/run/secrets/token"},
+		{report.Container, "TOKEN_FILE", "/run/secrets/token", redact.Mask},
+		{report.Process, "HOME", "/root", "/root"},
+	} {
+		if have := r.Redact(tc.topology, tc.key, tc.value); tc.want != have {
+			t.Errorf("%s %s: want %q, have %q", tc.topology, tc.key, tc.want, have)
+		}
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	for _, rules := range []redact.Rules{
+		{Keys: []string{"("}},
+		{Values: []string{"["}},
+		{Topologies: map[string]redact.TopologyRules{"containers": {}}},
+		{Topologies: map[string]redact.TopologyRules{report.Container: {Deny: []string{"*"}}}},
+	} {
+		if err := rules.Validate(); err == nil {
+			t.Errorf("Expected error validating %v", rules)
+		}
+	}
+	if err := (redact.Rules{Defaults: true, Tokens: true}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
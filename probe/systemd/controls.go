@@ -0,0 +1,51 @@
+package systemd
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/report"
+)
+
+// Control IDs used by the systemd integration.
+const (
+	StartService   = "systemd_start"
+	StopService    = "systemd_stop"
+	RestartService = "systemd_restart"
+)
+
+// Controls is the list of controls offered on systemd services.
+var Controls = []report.Control{
+	{ID: StartService, Human: "Start", Icon: "fa-play", Rank: 1},
+	{ID: RestartService, Human: "Restart", Icon: "fa-repeat", Rank: 2},
+	{ID: StopService, Human: "Stop", Icon: "fa-stop", Rank: 3},
+}
+
+func (r *Reporter) registerControls() {
+	controls.Register(StartService, r.captureUnit("Starting", r.source.Start))
+	controls.Register(StopService, r.captureUnit("Stopping", r.source.Stop))
+	controls.Register(RestartService, r.captureUnit("Restarting", r.source.Restart))
+}
+
+func (*Reporter) deregisterControls() {
+	controls.Rm(StartService)
+	controls.Rm(StopService)
+	controls.Rm(RestartService)
+}
+
+// captureUnit checks the request is for a unit on this host which we have
+// reported, and calls f with the unit's name.
+func (r *Reporter) captureUnit(verb string, f func(string) error) func(xfer.Request) xfer.Response {
+	return func(req xfer.Request) xfer.Response {
+		hostID, unit, ok := report.ParseNodeID(req.NodeID)
+		if !ok || hostID != r.hostID {
+			return xfer.ResponseErrorf("Invalid ID: %s", req.NodeID)
+		}
+		if !r.hasUnit(unit) {
+			return xfer.ResponseErrorf("Not found: %s", unit)
+		}
+		log.Infof("%s systemd service %s", verb, unit)
+		return xfer.ResponseError(f(unit))
+	}
+}
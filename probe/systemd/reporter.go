@@ -0,0 +1,185 @@
+package systemd
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/report"
+)
+
+// Keys for use in Node.Latest.
+const (
+	UnitName    = "systemd_unit"
+	Description = "systemd_description"
+	LoadState   = "systemd_load_state"
+	ActiveState = "systemd_active_state"
+	SubState    = "systemd_sub_state"
+	MainPID     = "systemd_main_pid"
+	Restarts    = "systemd_restarts"
+	CPUUsage    = "systemd_cpu_usage_percent"
+	MemoryUsage = "systemd_memory_usage_bytes"
+)
+
+// Exposed for testing.
+var (
+	MetadataTemplates = report.MetadataTemplates{
+		Description: {ID: Description, Label: "Description", From: report.FromLatest, Priority: 1},
+		ActiveState: {ID: ActiveState, Label: "State", From: report.FromLatest, Priority: 2},
+		SubState:    {ID: SubState, Label: "Sub-State", From: report.FromLatest, Priority: 3},
+		Restarts:    {ID: Restarts, Label: "Restarts", From: report.FromLatest, Datatype: "number", Priority: 4},
+		MainPID:     {ID: MainPID, Label: "Main PID", From: report.FromLatest, Datatype: "number", Priority: 5},
+		LoadState:   {ID: LoadState, Label: "Load State", From: report.FromLatest, Priority: 6},
+	}
+
+	MetricTemplates = report.MetricTemplates{
+		CPUUsage:    {ID: CPUUsage, Label: "CPU", Format: report.PercentFormat, Priority: 1},
+		MemoryUsage: {ID: MemoryUsage, Label: "Memory", Format: report.FilesizeFormat, Priority: 2},
+	}
+)
+
+// Reporter generates Reports containing the systemd service topology for
+// this host, and tags processes with the service they belong to.
+type Reporter struct {
+	source  Source
+	hostID  string
+	probeID string
+
+	mtx   sync.Mutex
+	units map[string]Unit      // by name, as of the last report
+	pids  map[int]string       // unit name by pid
+	cpu   map[string]cpuSample // previous CPU usage by unit name
+}
+
+type cpuSample struct {
+	usage uint64
+	at    time.Time
+}
+
+// NewReporter makes a new Reporter, reading units from source.
+func NewReporter(source Source, hostID, probeID string) *Reporter {
+	r := &Reporter{
+		source:  source,
+		hostID:  hostID,
+		probeID: probeID,
+		units:   map[string]Unit{},
+		pids:    map[int]string{},
+		cpu:     map[string]cpuSample{},
+	}
+	r.registerControls()
+	return r
+}
+
+// Name of this reporter/tagger, for metrics gathering
+func (*Reporter) Name() string { return "Systemd" }
+
+// Stop stops the reporter.
+func (r *Reporter) Stop() {
+	r.deregisterControls()
+}
+
+// Report implements Reporter.
+func (r *Reporter) Report() (report.Report, error) {
+	rep := report.MakeReport()
+	units, err := r.source.Units()
+	if err != nil {
+		return rep, err
+	}
+
+	rep.SystemdService = rep.SystemdService.
+		WithMetadataTemplates(MetadataTemplates).
+		WithMetricTemplates(MetricTemplates)
+	rep.SystemdService.Controls.AddControls(Controls)
+
+	var (
+		now     = mtime.Now()
+		byName  = map[string]Unit{}
+		pids    = map[int]string{}
+		samples = map[string]cpuSample{}
+	)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, unit := range units {
+		byName[unit.Name] = unit
+		for _, pid := range unit.PIDs {
+			pids[pid] = unit.Name
+		}
+		samples[unit.Name] = cpuSample{usage: unit.CPUUsage, at: now}
+		rep.SystemdService.AddNode(r.unitNode(unit, now))
+	}
+	r.units, r.pids, r.cpu = byName, pids, samples
+	return rep, nil
+}
+
+func (r *Reporter) unitNode(unit Unit, now time.Time) report.Node {
+	latests := map[string]string{
+		report.ControlProbeID: r.probeID,
+		UnitName:              unit.Name,
+		LoadState:             unit.LoadState,
+		ActiveState:           unit.ActiveState,
+		SubState:              unit.SubState,
+		Restarts:              strconv.Itoa(unit.Restarts),
+	}
+	if unit.Description != "" {
+		latests[Description] = unit.Description
+	}
+	if unit.MainPID > 0 {
+		latests[MainPID] = strconv.Itoa(unit.MainPID)
+	}
+
+	metrics := report.Metrics{
+		MemoryUsage: report.MakeMetric().Add(now, float64(unit.MemoryUsage)),
+	}
+	if prev, ok := r.cpu[unit.Name]; ok && now.After(prev.at) && unit.CPUUsage >= prev.usage {
+		elapsed := now.Sub(prev.at)
+		percent := 100 * float64(unit.CPUUsage-prev.usage) / float64(elapsed.Nanoseconds())
+		metrics[CPUUsage] = report.MakeMetric().Add(now, percent)
+	}
+
+	var controls []string
+	if unit.ActiveState == "active" {
+		controls = []string{RestartService, StopService}
+	} else {
+		controls = []string{StartService}
+	}
+
+	return report.MakeNodeWith(report.MakeSystemdServiceNodeID(r.hostID, unit.Name), latests).
+		WithMetrics(metrics).
+		WithControls(controls...)
+}
+
+// Tag implements Tagger, adding the service each process belongs to, as of
+// the last report.
+func (r *Reporter) Tag(rpt report.Report) (report.Report, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for nodeID, node := range rpt.Process.Nodes {
+		pidStr, ok := node.Latest.Lookup(process.PID)
+		if !ok {
+			continue
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+		unit, ok := r.pids[pid]
+		if !ok {
+			continue
+		}
+		rpt.Process.AddNode(report.MakeNodeWith(nodeID, map[string]string{
+			UnitName: unit,
+		}).WithParents(report.EmptySets.
+			Add(report.SystemdService, report.MakeStringSet(report.MakeSystemdServiceNodeID(r.hostID, unit))),
+		))
+	}
+	return rpt, nil
+}
+
+func (r *Reporter) hasUnit(name string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.units[name]
+	return ok
+}
@@ -0,0 +1,180 @@
+package systemd_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/scope/common/mtime"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/controls"
+	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/systemd"
+	"github.com/weaveworks/scope/report"
+)
+
+type mockSource struct {
+	units []systemd.Unit
+	calls []string
+}
+
+func (m *mockSource) Units() ([]systemd.Unit, error) { return m.units, nil }
+
+func (m *mockSource) Start(unit string) error   { return m.call("start", unit) }
+func (m *mockSource) Stop(unit string) error    { return m.call("stop", unit) }
+func (m *mockSource) Restart(unit string) error { return m.call("restart", unit) }
+
+func (m *mockSource) call(verb, unit string) error {
+	m.calls = append(m.calls, verb+" "+unit)
+	return nil
+}
+
+const (
+	hostID  = "host1"
+	probeID = "probe1"
+)
+
+var (
+	nginxNodeID  = report.MakeSystemdServiceNodeID(hostID, "nginx.service")
+	backupNodeID = report.MakeSystemdServiceNodeID(hostID, "backup.service")
+)
+
+func newMockSource() *mockSource {
+	return &mockSource{units: []systemd.Unit{
+		{
+			Name:        "nginx.service",
+			Description: "A high performance web server",
+			LoadState:   "loaded",
+			ActiveState: "active",
+			SubState:    "running",
+			Restarts:    2,
+			MainPID:     1234,
+			PIDs:        []int{1234, 1235},
+			MemoryUsage: 4096,
+			CPUUsage:    1000000000,
+		},
+		{
+			Name:        "backup.service",
+			LoadState:   "loaded",
+			ActiveState: "inactive",
+			SubState:    "dead",
+		},
+	}}
+}
+
+func TestReporter(t *testing.T) {
+	start := time.Now()
+	mtime.NowForce(start)
+	defer mtime.NowReset()
+
+	source := newMockSource()
+	reporter := systemd.NewReporter(source, hostID, probeID)
+	defer reporter.Stop()
+
+	rpt, err := reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.SystemdService.Nodes) != 2 {
+		t.Fatalf("Expected 2 services, got %v", rpt.SystemdService.Nodes)
+	}
+
+	nginx := rpt.SystemdService.Nodes[nginxNodeID]
+	for key, want := range map[string]string{
+		report.ControlProbeID: probeID,
+		systemd.UnitName:      "nginx.service",
+		systemd.Description:   "A high performance web server",
+		systemd.ActiveState:   "active",
+		systemd.SubState:      "running",
+		systemd.Restarts:      "2",
+		systemd.MainPID:       "1234",
+	} {
+		if have, ok := nginx.Latest.Lookup(key); !ok || have != want {
+			t.Errorf("Expected %s %q, got %q", key, want, have)
+		}
+	}
+	if have, want := nginx.Controls.Controls, report.MakeStringSet(systemd.RestartService, systemd.StopService); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected controls %v, got %v", want, have)
+	}
+	if have, want := rpt.SystemdService.Nodes[backupNodeID].Controls.Controls, report.MakeStringSet(systemd.StartService); !reflect.DeepEqual(want, have) {
+		t.Errorf("Expected controls %v, got %v", want, have)
+	}
+	if memory, ok := nginx.Metrics[systemd.MemoryUsage]; !ok || memory.LastSample().Value != 4096 {
+		t.Errorf("Expected memory usage, got %v", nginx.Metrics)
+	}
+	if _, ok := nginx.Metrics[systemd.CPUUsage]; ok {
+		t.Errorf("Expected no CPU usage on the first report, got %v", nginx.Metrics)
+	}
+
+	// Half a second of CPU time over two seconds is 25%
+	source.units[0].CPUUsage += 500000000
+	mtime.NowForce(start.Add(2 * time.Second))
+	rpt, err = reporter.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu, ok := rpt.SystemdService.Nodes[nginxNodeID].Metrics[systemd.CPUUsage]
+	if !ok || cpu.LastSample().Value != 25 {
+		t.Errorf("Expected CPU usage of 25%%, got %v", rpt.SystemdService.Nodes[nginxNodeID].Metrics)
+	}
+}
+
+func TestTagger(t *testing.T) {
+	reporter := systemd.NewReporter(newMockSource(), hostID, probeID)
+	defer reporter.Stop()
+	if _, err := reporter.Report(); err != nil {
+		t.Fatal(err)
+	}
+
+	rpt := report.MakeReport()
+	for _, pid := range []string{"1235", "99"} {
+		rpt.Process.AddNode(report.MakeNodeWith(report.MakeProcessNodeID(hostID, pid), map[string]string{
+			process.PID: pid,
+		}))
+	}
+	rpt, err := reporter.Tag(rpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := rpt.Process.Nodes[report.MakeProcessNodeID(hostID, "1235")]
+	if have, ok := tagged.Parents.Lookup(report.SystemdService); !ok || !reflect.DeepEqual(report.MakeStringSet(nginxNodeID), have) {
+		t.Errorf("Expected parent %s, got %v", nginxNodeID, tagged.Parents)
+	}
+	if unit, _ := tagged.Latest.Lookup(systemd.UnitName); unit != "nginx.service" {
+		t.Errorf("Expected unit nginx.service, got %q", unit)
+	}
+	untagged := rpt.Process.Nodes[report.MakeProcessNodeID(hostID, "99")]
+	if _, ok := untagged.Parents.Lookup(report.SystemdService); ok {
+		t.Errorf("Expected no parent, got %v", untagged.Parents)
+	}
+}
+
+func TestControls(t *testing.T) {
+	source := newMockSource()
+	reporter := systemd.NewReporter(source, hostID, probeID)
+	defer reporter.Stop()
+	if _, err := reporter.Report(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		control, nodeID, err string
+	}{
+		{systemd.StopService, nginxNodeID, ""},
+		{systemd.RestartService, nginxNodeID, ""},
+		{systemd.StartService, backupNodeID, ""},
+		{systemd.StartService, report.MakeSystemdServiceNodeID("host2", "backup.service"), "Invalid ID: " + report.MakeSystemdServiceNodeID("host2", "backup.service")},
+		{systemd.StartService, report.MakeSystemdServiceNodeID(hostID, "ssh.service"), "Not found: ssh.service"},
+	} {
+		response := controls.HandleControlRequest(xfer.Request{Control: tc.control, NodeID: tc.nodeID})
+		if want := (xfer.Response{Error: tc.err}); !reflect.DeepEqual(want, response) {
+			t.Errorf("%s %s: expected %v, got %v", tc.control, tc.nodeID, want, response)
+		}
+	}
+
+	want := []string{"stop nginx.service", "restart nginx.service", "start backup.service"}
+	if !reflect.DeepEqual(want, source.calls) {
+		t.Errorf("Expected %v, got %v", want, source.calls)
+	}
+}
@@ -0,0 +1,194 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/weaveworks/scope/common/fs"
+)
+
+// Unit is a systemd service unit, with its cgroup's resource usage.
+type Unit struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Restarts    int
+	MainPID     int
+	PIDs        []int
+	MemoryUsage uint64 // bytes
+	CPUUsage    uint64 // total CPU time, in nanoseconds
+}
+
+// Source lists and manages systemd service units.
+type Source interface {
+	Units() ([]Unit, error)
+	Start(unit string) error
+	Stop(unit string) error
+	Restart(unit string) error
+}
+
+var showProperties = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "NRestarts", "MainPID", "ControlGroup"}
+
+type systemctlSource struct {
+	cgroupRoot string
+}
+
+// NewSystemctlSource makes a Source which asks systemctl about the units,
+// and reads their resource usage from the cgroup filesystem mounted at
+// cgroupRoot.
+func NewSystemctlSource(cgroupRoot string) Source {
+	return systemctlSource{cgroupRoot: cgroupRoot}
+}
+
+func systemctl(args ...string) ([]byte, error) {
+	output, err := exec.Command("systemctl", append([]string{"--no-pager"}, args...)...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return nil, fmt.Errorf("systemctl %s: %s", strings.Join(args, " "), bytes.TrimSpace(exitErr.Stderr))
+	}
+	return output, err
+}
+
+func (s systemctlSource) Units() ([]Unit, error) {
+	output, err := systemctl("list-units", "--type=service", "--all", "--no-legend", "--plain")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(strings.TrimLeft(line, "● *"))
+		if len(fields) > 0 && strings.HasSuffix(fields[0], ".service") {
+			names = append(names, fields[0])
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	output, err = systemctl(append([]string{"show", "--property=" + strings.Join(showProperties, ",")}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	units, cgroups := parseShow(output)
+	for i := range units {
+		if cgroups[i] != "" {
+			readCgroup(s.cgroupRoot, cgroups[i], &units[i])
+		}
+	}
+	return units, nil
+}
+
+func (systemctlSource) Start(unit string) error {
+	_, err := systemctl("start", unit)
+	return err
+}
+
+func (systemctlSource) Stop(unit string) error {
+	_, err := systemctl("stop", unit)
+	return err
+}
+
+func (systemctlSource) Restart(unit string) error {
+	_, err := systemctl("restart", unit)
+	return err
+}
+
+// parseShow parses the output of systemctl show for several units: blocks of
+// key=value lines, separated by blank lines. It returns the units, and the
+// path of each one's control group.
+func parseShow(output []byte) ([]Unit, []string) {
+	var (
+		units   = []Unit{}
+		cgroups = []string{}
+		unit    Unit
+		cgroup  string
+	)
+	flush := func() {
+		if unit.Name != "" {
+			units = append(units, unit)
+			cgroups = append(cgroups, cgroup)
+		}
+		unit, cgroup = Unit{}, ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Id":
+			unit.Name = kv[1]
+		case "Description":
+			unit.Description = kv[1]
+		case "LoadState":
+			unit.LoadState = kv[1]
+		case "ActiveState":
+			unit.ActiveState = kv[1]
+		case "SubState":
+			unit.SubState = kv[1]
+		case "NRestarts":
+			unit.Restarts, _ = strconv.Atoi(kv[1])
+		case "MainPID":
+			unit.MainPID, _ = strconv.Atoi(kv[1])
+		case "ControlGroup":
+			cgroup = kv[1]
+		}
+	}
+	flush()
+	return units, cgroups
+}
+
+// readCgroup fills in the unit's PIDs and resource usage from its control
+// group, for either the unified (v2) or legacy (v1) hierarchies. Missing
+// files (e.g. with accounting disabled) are ignored.
+func readCgroup(root, cgroup string, unit *Unit) {
+	var pidsFile, memoryFile, cpuFile string
+	if _, err := fs.ReadFile(filepath.Join(root, "cgroup.controllers")); err == nil {
+		dir := filepath.Join(root, cgroup)
+		pidsFile = filepath.Join(dir, "cgroup.procs")
+		memoryFile = filepath.Join(dir, "memory.current")
+		cpuFile = filepath.Join(dir, "cpu.stat")
+	} else {
+		pidsFile = filepath.Join(root, "systemd", cgroup, "cgroup.procs")
+		memoryFile = filepath.Join(root, "memory", cgroup, "memory.usage_in_bytes")
+		cpuFile = filepath.Join(root, "cpuacct", cgroup, "cpuacct.usage")
+	}
+
+	if contents, err := fs.ReadFile(pidsFile); err == nil {
+		for _, line := range strings.Fields(string(contents)) {
+			if pid, err := strconv.Atoi(line); err == nil {
+				unit.PIDs = append(unit.PIDs, pid)
+			}
+		}
+	}
+	if contents, err := fs.ReadFile(memoryFile); err == nil {
+		unit.MemoryUsage, _ = strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+	}
+	if contents, err := fs.ReadFile(cpuFile); err == nil {
+		text := strings.TrimSpace(string(contents))
+		if filepath.Base(cpuFile) == "cpuacct.usage" {
+			unit.CPUUsage, _ = strconv.ParseUint(text, 10, 64)
+			return
+		}
+		// cpu.stat has "usage_usec N" amongst others
+		for _, line := range strings.Split(text, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "usage_usec" {
+				usec, _ := strconv.ParseUint(fields[1], 10, 64)
+				unit.CPUUsage = usec * 1000
+			}
+		}
+	}
+}
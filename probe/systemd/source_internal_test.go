@@ -0,0 +1,92 @@
+package systemd
+
+import (
+	"reflect"
+	"testing"
+
+	fs_hook "github.com/weaveworks/scope/common/fs"
+	"github.com/weaveworks/scope/test"
+	"github.com/weaveworks/scope/test/fs"
+)
+
+const showOutput = `Id=nginx.service
+Description=A high performance web server
+LoadState=loaded
+ActiveState=active
+SubState=running
+NRestarts=2
+MainPID=1234
+ControlGroup=/system.slice/nginx.service
+
+Id=backup.service
+Description=Nightly backup
+LoadState=loaded
+ActiveState=inactive
+SubState=dead
+NRestarts=0
+MainPID=0
+ControlGroup=
+`
+
+func TestParseShow(t *testing.T) {
+	units, cgroups := parseShow([]byte(showOutput))
+	want := []Unit{
+		{Name: "nginx.service", Description: "A high performance web server", LoadState: "loaded", ActiveState: "active", SubState: "running", Restarts: 2, MainPID: 1234},
+		{Name: "backup.service", Description: "Nightly backup", LoadState: "loaded", ActiveState: "inactive", SubState: "dead"},
+	}
+	if !reflect.DeepEqual(want, units) {
+		t.Errorf("diff: %s", test.Diff(want, units))
+	}
+	if wantCgroups := []string{"/system.slice/nginx.service", ""}; !reflect.DeepEqual(wantCgroups, cgroups) {
+		t.Errorf("diff: %s", test.Diff(wantCgroups, cgroups))
+	}
+}
+
+func TestReadCgroup(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fs   fs.Entry
+	}{
+		{
+			name: "unified",
+			fs: fs.Dir("",
+				fs.Dir("cgroup",
+					fs.File{FName: "cgroup.controllers", FContents: "cpu memory pids"},
+					fs.Dir("system.slice",
+						fs.Dir("nginx.service",
+							fs.File{FName: "cgroup.procs", FContents: "1234\n1235\n"},
+							fs.File{FName: "memory.current", FContents: "4096\n"},
+							fs.File{FName: "cpu.stat", FContents: "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n"},
+						),
+					),
+				),
+			),
+		},
+		{
+			name: "legacy",
+			fs: fs.Dir("",
+				fs.Dir("cgroup",
+					fs.Dir("systemd", fs.Dir("system.slice", fs.Dir("nginx.service",
+						fs.File{FName: "cgroup.procs", FContents: "1234\n1235\n"},
+					))),
+					fs.Dir("memory", fs.Dir("system.slice", fs.Dir("nginx.service",
+						fs.File{FName: "memory.usage_in_bytes", FContents: "4096\n"},
+					))),
+					fs.Dir("cpuacct", fs.Dir("system.slice", fs.Dir("nginx.service",
+						fs.File{FName: "cpuacct.usage", FContents: "1500000\n"},
+					))),
+				),
+			),
+		},
+	} {
+		fs_hook.Mock(tc.fs)
+		var unit Unit
+		readCgroup("/cgroup", "/system.slice/nginx.service", &unit)
+		fs_hook.Restore()
+
+		want := Unit{PIDs: []int{1234, 1235}, MemoryUsage: 4096, CPUUsage: 1500000}
+		if !reflect.DeepEqual(want, unit) {
+			t.Errorf("%s: diff: %s", tc.name, test.Diff(want, unit))
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
@@ -18,13 +21,22 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaveworks/go-checkpoint"
 	"github.com/weaveworks/weave/common"
+	"golang.org/x/net/context"
 
 	"github.com/weaveworks/scope/app"
 	"github.com/weaveworks/scope/app/multitenant"
 	"github.com/weaveworks/scope/common/middleware"
 	"github.com/weaveworks/scope/common/network"
 	"github.com/weaveworks/scope/common/weave"
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/config"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/render"
+)
+
+const (
+	auditLogCapacity        = 10000
+	probeConfigPushInterval = 30 * time.Second
 )
 
 var (
@@ -37,10 +49,13 @@ var (
 
 func init() {
 	prometheus.MustRegister(requestDuration)
+	prometheus.MustRegister(render.RenderDuration)
+	prometheus.MustRegister(render.RenderCacheRequests)
+	prometheus.MustRegister(render.RenderNodes)
 }
 
 // Router creates the mux for all the various app components.
-func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter app.PipeRouter) http.Handler {
+func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter app.PipeRouter, auditLog app.AuditLog, recorder *app.PipeRecorder, policy app.ControlPolicy, userIDer app.UserIDer, probeConfigs *app.ProbeConfigs) http.Handler {
 	router := mux.NewRouter().SkipClean(true)
 
 	// We pull in the http.DefaultServeMux to get the pprof routes
@@ -49,8 +64,15 @@ func router(collector app.Collector, controlRouter app.ControlRouter, pipeRouter
 
 	app.RegisterReportPostHandler(collector, router)
 	app.RegisterControlRoutes(router, controlRouter)
+	app.RegisterBulkControlRoutes(router, collector, controlRouter)
 	app.RegisterPipeRoutes(router, pipeRouter)
+	app.RegisterProbeStreamRoute(router, collector, controlRouter, pipeRouter)
 	app.RegisterTopologyRoutes(router, collector)
+	app.RegisterProbeRoutes(router, collector, probeConfigs, policy)
+	app.RegisterAuditRoutes(router, auditLog, policy, userIDer)
+	if recorder != nil {
+		app.RegisterRecordingRoutes(router, recorder, policy)
+	}
 
 	router.PathPrefix("/").Handler(http.FileServer(FS(false)))
 
@@ -167,6 +189,53 @@ func appMain(flags appFlags) {
 		return
 	}
 
+	policy := app.ControlPolicy{}
+	if flags.controlPolicy != "" {
+		if policy, err = app.ReadControlPolicy(flags.controlPolicy); err != nil {
+			log.Fatalf("Error reading control policy: %v", err)
+			return
+		}
+	}
+	policy.ReadOnly = policy.ReadOnly || flags.readOnly
+
+	auditLog := app.NewMemoryAuditLog(auditLogCapacity)
+	if flags.auditLog != "" {
+		if auditLog, err = app.NewFileAuditLog(flags.auditLog); err != nil {
+			log.Fatalf("Error opening audit log: %v", err)
+			return
+		}
+	}
+	var recorder *app.PipeRecorder
+	if flags.recordDir != "" {
+		if recorder, err = app.NewPipeRecorder(flags.recordDir, flags.recordMaxAge, flags.recordMaxBytes, app.UserIDer(userIDer), collector); err != nil {
+			log.Fatalf("Error creating pipe recorder: %v", err)
+			return
+		}
+		defer recorder.Stop()
+		controlRouter = recorder.ControlRouter(controlRouter)
+		pipeRouter = recorder.PipeRouter(pipeRouter)
+	}
+	controlRouter = app.NewPolicyControlRouter(controlRouter, policy, app.UserIDer(userIDer), auditLog, collector)
+	pipeRouter = app.NewPolicyPipeRouter(pipeRouter, policy, app.UserIDer(userIDer), auditLog)
+
+	probeConfigs := app.NewProbeConfigs(collector, controlRouter, app.UserIDer(userIDer))
+	if flags.probeConfig != "" {
+		if flags.userIDHeader != "" {
+			log.Fatal("--app.probe.config can't be used with --app.userid.header")
+			return
+		}
+		if err := loadProbeConfig(probeConfigs, flags.probeConfig); err != nil {
+			log.Fatalf("Error loading probe config: %v", err)
+			return
+		}
+	}
+	// Requests from the background loop can't identify a user, so it only
+	// runs in single-tenant apps.
+	if flags.userIDHeader == "" {
+		probeConfigs.Loop(probeConfigPushInterval)
+		defer probeConfigs.Stop()
+	}
+
 	defer log.Info("app exiting")
 	rand.Seed(time.Now().UnixNano())
 	app.UniqueID = strconv.FormatInt(rand.Int63(), 16)
@@ -201,18 +270,91 @@ func appMain(flags appFlags) {
 		}
 	}
 
-	handler := router(collector, controlRouter, pipeRouter)
+	handler := router(collector, controlRouter, pipeRouter, auditLog, recorder, policy, app.UserIDer(userIDer), probeConfigs)
+	tlsConfig, err := appTLSConfig(flags)
+	if err != nil {
+		log.Fatalf("Error setting up TLS: %v", err)
+	}
+	if flags.tlsClientCA != "" {
+		handler = app.AuthenticateProbes.Wrap(handler)
+	}
 	if flags.logHTTP {
 		handler = middleware.Logging.Wrap(handler)
 	}
+	server := &http.Server{Addr: flags.listen, Handler: handler}
 	go func() {
 		log.Infof("listening on %s", flags.listen)
-		log.Info(http.ListenAndServe(flags.listen, handler))
+		if tlsConfig == nil {
+			log.Info(server.ListenAndServe())
+			return
+		}
+		listener, err := net.Listen("tcp", flags.listen)
+		if err != nil {
+			log.Fatalf("Error listening on %s: %v", flags.listen, err)
+		}
+		log.Info(server.Serve(xfer.NewTLSListener(listener, tlsConfig)))
 	}()
 
 	common.SignalHandlerLoop()
 }
 
+// appTLSConfig returns a function making the TLS config for each of the app
+// server's connections, or nil to serve HTTP. Certificates and client CAs are
+// reloaded when they change, so they can be rotated without restarting.
+func appTLSConfig(flags appFlags) (func() (*tls.Config, error), error) {
+	if flags.tlsCert == "" {
+		if flags.tlsClientCA != "" {
+			return nil, fmt.Errorf("-app.tls.client-ca needs -app.tls.cert")
+		}
+		return nil, nil
+	}
+	cert, err := xfer.NewCertReloader(flags.tlsCert, flags.tlsKey)
+	if err != nil {
+		return nil, err
+	}
+	if flags.tlsClientCA == "" {
+		return func() (*tls.Config, error) {
+			return &tls.Config{GetCertificate: cert.GetCertificate}, nil
+		}, nil
+	}
+
+	// The UI doesn't have client certificates, so they are only verified if
+	// given; app.AuthenticateProbes requires them from probes.
+	cas, err := xfer.NewCAReloader(flags.tlsClientCA)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*tls.Config, error) {
+		pool, err := cas.Pool()
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			GetCertificate: cert.GetCertificate,
+			ClientAuth:     tls.VerifyClientCertIfGiven,
+			ClientCAs:      pool,
+		}, nil
+	}, nil
+}
+
+// loadProbeConfig sets the config to push to probes from a file.
+func loadProbeConfig(probeConfigs *app.ProbeConfigs, path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	remote, err := config.ParseRemote(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	desired, err := probeConfigs.Set(context.Background(), remote)
+	if err != nil {
+		return err
+	}
+	log.Infof("Pushing probe config version %s from %s", desired.Version, path)
+	return nil
+}
+
 func newWeavePublisher(dockerEndpoint, weaveAddr, weaveHostname, containerName string) (*app.WeavePublisher, error) {
 	dockerClient, err := docker.NewDockerClientStub(dockerEndpoint)
 	if err != nil {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/probe"
+	"github.com/weaveworks/scope/probe/config"
+)
+
+// A component is the reporters, taggers and tickers started for one optional
+// part of the probe, e.g. the Docker integration.
+type component struct {
+	reporters []probe.Reporter
+	taggers   []probe.Tagger
+	tickers   []probe.Ticker
+	stop      func()
+}
+
+// A componentSpec says how to start a component, and which part of the
+// config it depends on. start returns a nil component if it is disabled.
+type componentSpec struct {
+	name   string
+	config func(config.Config) interface{}
+	start  func(config.Config) (*component, error)
+}
+
+// components keeps the optional parts of a running probe in line with its
+// config. When the part of the config a component depends on changes, the
+// component is stopped and removed from the probe, and a new one started.
+// The rest of the probe, including its connections to apps, is untouched.
+type components struct {
+	probe   *probe.Probe
+	specs   []componentSpec
+	configs map[string]interface{}
+	running map[string]*component
+}
+
+func newComponents(p *probe.Probe, specs []componentSpec) *components {
+	return &components{
+		probe:   p,
+		specs:   specs,
+		configs: map[string]interface{}{},
+		running: map[string]*component{},
+	}
+}
+
+func (cs *components) apply(cfg config.Config) {
+	for _, spec := range cs.specs {
+		c := spec.config(cfg)
+		if prev, ok := cs.configs[spec.name]; ok && reflect.DeepEqual(prev, c) {
+			continue
+		}
+		cs.configs[spec.name] = c
+
+		// Stop the old component first; they tend to register global state,
+		// such as controls.
+		if old, ok := cs.running[spec.name]; ok {
+			log.Infof("%s: stopping for reconfiguration", spec.name)
+			cs.remove(old)
+			delete(cs.running, spec.name)
+		}
+		next, err := spec.start(cfg)
+		if err != nil {
+			log.Errorf("%s: %v", spec.name, err)
+			continue
+		}
+		if next == nil {
+			continue
+		}
+		cs.probe.AddTicker(next.tickers...)
+		cs.probe.AddTagger(next.taggers...)
+		cs.probe.AddReporter(next.reporters...)
+		cs.running[spec.name] = next
+	}
+}
+
+func (cs *components) remove(c *component) {
+	cs.probe.RemoveReporter(c.reporters...)
+	cs.probe.RemoveTagger(c.taggers...)
+	cs.probe.RemoveTicker(c.tickers...)
+	if c.stop != nil {
+		c.stop()
+	}
+}
+
+func (cs *components) stop() {
+	for name, c := range cs.running {
+		cs.remove(c)
+		delete(cs.running, name)
+	}
+}
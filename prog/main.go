@@ -56,6 +56,7 @@ type flags struct {
 }
 
 type probeFlags struct {
+	configFile      string
 	token           string
 	httpListen      string
 	publishInterval time.Duration
@@ -69,13 +70,30 @@ type probeFlags struct {
 	logLevel        string
 	resolver        string
 
+	queueLength int
+	queueBytes  int
+	queueDir    string
+	stream      bool
+
+	redact       bool
+	redactTokens bool
+
+	tlsCert string
+	tlsKey  string
+	tlsCA   string
+
 	dockerEnabled  bool
 	dockerInterval time.Duration
 	dockerBridge   string
 
-	kubernetesEnabled  bool
-	kubernetesAPI      string
-	kubernetesInterval time.Duration
+	kubernetesEnabled        bool
+	kubernetesAPI            string
+	kubernetesInterval       time.Duration
+	kubernetesLeaderElection bool
+	kubernetesLeaderLock     string
+
+	systemdEnabled    bool
+	systemdCgroupRoot string
 
 	weaveAddr     string
 	weaveHostname string
@@ -97,6 +115,17 @@ type appFlags struct {
 	controlRouterURL string
 	pipeRouterURL    string
 	userIDHeader     string
+	controlPolicy    string
+	readOnly         bool
+	auditLog         string
+	recordDir        string
+	recordMaxAge     time.Duration
+	recordMaxBytes   int64
+	probeConfig      string
+
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
 
 	awsCreateTables bool
 	consulInf       string
@@ -123,10 +152,20 @@ func main() {
 	flag.Bool("app-only", false, "Only run the app")
 
 	// Probe flags
+	flag.StringVar(&flags.probe.configFile, "probe.config", "", "YAML or JSON config file, overriding the other probe flags; reloaded on SIGHUP or when it changes")
 	flag.StringVar(&flags.probe.token, "service-token", "", "Token to use to authenticate with scope.weave.works")
 	flag.StringVar(&flags.probe.token, "probe.token", "", "Token to use to authenticate with scope.weave.works")
 	flag.StringVar(&flags.probe.httpListen, "probe.http.listen", "", "listen address for HTTP profiling and instrumentation server")
 	flag.DurationVar(&flags.probe.publishInterval, "probe.publish.interval", 3*time.Second, "publish (output) interval")
+	flag.IntVar(&flags.probe.queueLength, "probe.publish.queue.length", 20, "number of reports to queue while an app is unreachable, before merging the oldest")
+	flag.IntVar(&flags.probe.queueBytes, "probe.publish.queue.bytes", 50*1024*1024, "size of reports to queue while an app is unreachable, before dropping the oldest")
+	flag.StringVar(&flags.probe.queueDir, "probe.publish.queue.dir", "", "directory to keep queued reports in across restarts (default: keep them in memory)")
+	flag.BoolVar(&flags.probe.stream, "probe.publish.stream", false, "send reports, controls and pipes to each app over a single connection")
+	flag.BoolVar(&flags.probe.redact, "probe.redact", true, "redact passwords, tokens and the like from reports (set rules in -probe.config)")
+	flag.BoolVar(&flags.probe.redactTokens, "probe.redact.tokens", true, "also redact anything that looks like a secret token")
+	flag.StringVar(&flags.probe.tlsCert, "probe.tls.cert", "", "client certificate to present to apps over HTTPS, for mutual TLS; its common name is used as the probe ID")
+	flag.StringVar(&flags.probe.tlsKey, "probe.tls.key", "", "key for -probe.tls.cert")
+	flag.StringVar(&flags.probe.tlsCA, "probe.tls.ca", "", "CA certificates to verify apps against (default: public CAs)")
 	flag.DurationVar(&flags.probe.spyInterval, "probe.spy.interval", time.Second, "spy (scan) interval")
 	flag.BoolVar(&flags.probe.spyProcs, "probe.processes", true, "report processes (needs root)")
 	flag.StringVar(&flags.probe.procRoot, "probe.proc.root", "/proc", "location of the proc filesystem")
@@ -139,9 +178,13 @@ func main() {
 	flag.BoolVar(&flags.probe.dockerEnabled, "probe.docker", false, "collect Docker-related attributes for processes")
 	flag.DurationVar(&flags.probe.dockerInterval, "probe.docker.interval", 10*time.Second, "how often to update Docker attributes")
 	flag.StringVar(&flags.probe.dockerBridge, "probe.docker.bridge", "docker0", "the docker bridge name")
-	flag.BoolVar(&flags.probe.kubernetesEnabled, "probe.kubernetes", false, "collect kubernetes-related attributes for containers, should only be enabled on the master node")
+	flag.BoolVar(&flags.probe.kubernetesEnabled, "probe.kubernetes", false, "collect kubernetes-related attributes for containers")
 	flag.StringVar(&flags.probe.kubernetesAPI, "probe.kubernetes.api", "", "Address of kubernetes master api")
 	flag.DurationVar(&flags.probe.kubernetesInterval, "probe.kubernetes.interval", 10*time.Second, "how often to do a full resync of the kubernetes data")
+	flag.BoolVar(&flags.probe.kubernetesLeaderElection, "probe.kubernetes.leader-election", false, "elect one probe to report cluster-wide kubernetes topologies; probes need permission to write the lock (if disabled, only enable -probe.kubernetes on one probe)")
+	flag.StringVar(&flags.probe.kubernetesLeaderLock, "probe.kubernetes.leader-election.lock", "weave-scope-probe-leader", "Endpoints object, as [namespace/]name, probes use to elect a leader; the namespace defaults to the probe's own")
+	flag.BoolVar(&flags.probe.systemdEnabled, "probe.systemd", false, "collect systemd services, and the processes belonging to them")
+	flag.StringVar(&flags.probe.systemdCgroupRoot, "probe.systemd.cgroup.root", "/sys/fs/cgroup", "location of the cgroup filesystem")
 	flag.StringVar(&flags.probe.weaveAddr, "probe.weave.addr", "127.0.0.1:6784", "IP address & port of the Weave router")
 	flag.StringVar(&flags.probe.weaveHostname, "probe.weave.hostname", app.DefaultHostname, "Hostname to lookup in WeaveDNS")
 
@@ -161,6 +204,16 @@ func main() {
 	flag.StringVar(&flags.app.controlRouterURL, "app.control.router", "local", "Control router to use (local or sqs)")
 	flag.StringVar(&flags.app.pipeRouterURL, "app.pipe.router", "local", "Pipe router to use (local)")
 	flag.StringVar(&flags.app.userIDHeader, "app.userid.header", "", "HTTP header to use as userid")
+	flag.StringVar(&flags.app.controlPolicy, "app.control.policy", "", "JSON file of rules deciding who may invoke which controls")
+	flag.BoolVar(&flags.app.readOnly, "app.control.readonly", false, "Deny all controls and pipes")
+	flag.StringVar(&flags.app.auditLog, "app.audit.log", "", "File to append the control audit log to (default: keep recent entries in memory)")
+	flag.StringVar(&flags.app.recordDir, "app.pipe.record.dir", "", "Directory to record pipe (terminal) sessions to (default: don't record)")
+	flag.DurationVar(&flags.app.recordMaxAge, "app.pipe.record.maxage", 30*24*time.Hour, "Delete pipe recordings older than this (0 for no limit)")
+	flag.Int64Var(&flags.app.recordMaxBytes, "app.pipe.record.maxbytes", 10<<30, "Delete the oldest pipe recordings when they take more than this (0 for no limit)")
+	flag.StringVar(&flags.app.probeConfig, "app.probe.config", "", "YAML or JSON file of config to push to probes (default: none, until set with PUT /api/probes/config)")
+	flag.StringVar(&flags.app.tlsCert, "app.tls.cert", "", "certificate to serve HTTPS with; reloaded when it changes (default: serve HTTP)")
+	flag.StringVar(&flags.app.tlsKey, "app.tls.key", "", "key for -app.tls.cert")
+	flag.StringVar(&flags.app.tlsClientCA, "app.tls.client-ca", "", "CA certificates to verify probes' client certificates against; probes must then present one (default: don't authenticate probes)")
 
 	flag.BoolVar(&flags.app.awsCreateTables, "app.aws.create.tables", false, "Create the tables in DynamoDB")
 	flag.StringVar(&flags.app.consulInf, "app.consul.inf", "", "The interface who's address I should advertise myself under in consul")
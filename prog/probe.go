@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math/rand"
@@ -24,20 +25,26 @@ import (
 	"github.com/weaveworks/scope/common/xfer"
 	"github.com/weaveworks/scope/probe"
 	"github.com/weaveworks/scope/probe/appclient"
+	"github.com/weaveworks/scope/probe/config"
 	"github.com/weaveworks/scope/probe/controls"
 	"github.com/weaveworks/scope/probe/docker"
+	"github.com/weaveworks/scope/probe/election"
 	"github.com/weaveworks/scope/probe/endpoint"
 	"github.com/weaveworks/scope/probe/endpoint/procspy"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/overhead"
 	"github.com/weaveworks/scope/probe/overlay"
 	"github.com/weaveworks/scope/probe/plugins"
 	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/redact"
+	"github.com/weaveworks/scope/probe/systemd"
 	"github.com/weaveworks/scope/report"
 )
 
 const (
 	versionCheckPeriod = 6 * time.Hour
+	configPollInterval = 10 * time.Second
 )
 
 var pluginAPIVersion = "1"
@@ -63,10 +70,77 @@ func check(flags map[string]string) {
 	checkpoint.CheckInterval(&params, versionCheckPeriod, handleResponse)
 }
 
+func (f probeFlags) config() config.Config {
+	return config.Config{
+		Token:           f.token,
+		HTTPListen:      f.httpListen,
+		SpyInterval:     config.Duration(f.spyInterval),
+		PublishInterval: config.Duration(f.publishInterval),
+		Processes:       f.spyProcs,
+		ProcRoot:        f.procRoot,
+		Conntrack:       f.useConntrack,
+		Insecure:        f.insecure,
+		Resolver:        f.resolver,
+		Stream:          f.stream,
+		Log: config.LogConfig{
+			Level:  f.logLevel,
+			Prefix: f.logPrefix,
+		},
+		Queue: config.QueueConfig{
+			Length: f.queueLength,
+			Bytes:  f.queueBytes,
+			Dir:    f.queueDir,
+		},
+		TLS: config.TLSConfig{
+			Cert: f.tlsCert,
+			Key:  f.tlsKey,
+			CA:   f.tlsCA,
+		},
+		Redact: config.RedactConfig{
+			Enabled: f.redact,
+			Tokens:  f.redactTokens,
+		},
+		Plugins: config.PluginsConfig{
+			Enabled: true,
+			Root:    f.pluginsRoot,
+		},
+		Docker: config.DockerConfig{
+			Enabled:  f.dockerEnabled,
+			Interval: config.Duration(f.dockerInterval),
+			Bridge:   f.dockerBridge,
+		},
+		Kubernetes: config.KubernetesConfig{
+			Enabled:        f.kubernetesEnabled,
+			API:            f.kubernetesAPI,
+			Interval:       config.Duration(f.kubernetesInterval),
+			LeaderElection: f.kubernetesLeaderElection,
+			LeaderLock:     f.kubernetesLeaderLock,
+		},
+		Systemd: config.SystemdConfig{
+			Enabled:    f.systemdEnabled,
+			CgroupRoot: f.systemdCgroupRoot,
+		},
+		Weave: config.WeaveConfig{
+			Addr:     f.weaveAddr,
+			Hostname: f.weaveHostname,
+		},
+	}
+}
+
 // Main runs the probe
 func probeMain(flags probeFlags) {
-	setLogLevel(flags.logLevel)
-	setLogFormatter(flags.logPrefix)
+	cfg := flags.config()
+	if flags.configFile != "" {
+		var err error
+		if cfg, err = config.Load(flags.configFile, flags.config()); err != nil {
+			log.Fatalf("Error loading %s: %v", flags.configFile, err)
+		}
+	} else if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	setLogLevel(cfg.Log.Level)
+	setLogFormatter(cfg.Log.Prefix)
 
 	// Setup in memory metrics sink
 	inm := metrics.NewInmemSink(time.Minute, 2*time.Minute)
@@ -76,7 +150,7 @@ func probeMain(flags probeFlags) {
 
 	defer log.Info("probe exiting")
 
-	if flags.spyProcs && os.Getegid() != 0 {
+	if cfg.Processes && os.Getegid() != 0 {
 		log.Warn("--probe.process=true, but that requires root to find everything")
 	}
 
@@ -85,11 +159,24 @@ func probeMain(flags probeFlags) {
 		probeID  = strconv.FormatInt(rand.Int63(), 16)
 		hostName = hostname.Get()
 		hostID   = hostName // TODO(pb): we should sanitize the hostname
+
+		clientCert *xfer.CertReloader
 	)
+	if cfg.TLS.Cert != "" {
+		var err error
+		if clientCert, err = xfer.NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key); err != nil {
+			log.Fatalf("Error loading client certificate: %v", err)
+		}
+		// Apps only accept reports, controls and pipes from probes with
+		// the ID in their certificate.
+		if probeID, err = clientCert.Identity(); err != nil {
+			log.Fatalf("Error loading client certificate: %v", err)
+		}
+	}
 	log.Infof("probe starting, version %s, ID %s", version, probeID)
 	log.Infof("command line: %v", os.Args)
 	checkpointFlags := map[string]string{}
-	if flags.kubernetesEnabled {
+	if cfg.Kubernetes.Enabled {
 		checkpointFlags["kubernetes_enabled"] = "true"
 	}
 	go check(checkpointFlags)
@@ -101,11 +188,24 @@ func probeMain(flags probeFlags) {
 	log.Infof("publishing to: %s", strings.Join(targets, ", "))
 
 	probeConfig := appclient.ProbeConfig{
-		Token:    flags.token,
+		Token:    cfg.Token,
 		ProbeID:  probeID,
-		Insecure: flags.insecure,
+		Insecure: cfg.Insecure,
+
+		QueueLength: cfg.Queue.Length,
+		QueueBytes:  cfg.Queue.Bytes,
+		QueueDir:    cfg.Queue.Dir,
+
+		Stream: cfg.Stream,
+
+		ClientCert: clientCert,
+		CAFile:     cfg.TLS.CA,
 	}
 	clients := appclient.NewMultiAppClient(func(hostname, endpoint string) (appclient.AppClient, error) {
+		// Apps doing mutual TLS serve HTTPS on the usual port.
+		if clientCert != nil && !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
 		return appclient.NewAppClient(
 			probeConfig, hostname, endpoint,
 			xfer.ControlHandlerFunc(controls.HandleControlRequest),
@@ -113,102 +213,244 @@ func probeMain(flags probeFlags) {
 	})
 	defer clients.Stop()
 
-	dnsLookupFn := net.LookupIP
-	if flags.resolver != "" {
-		dnsLookupFn = appclient.LookupUsing(flags.resolver)
+	resolverConfig := appclient.ResolverConfig{
+		Targets: targets,
+		Lookup:  net.LookupIP,
+		WatchEndpoints: func(namespace, service, port string, f func([]string)) (func(), error) {
+			return kubernetes.WatchEndpoints(cfg.Kubernetes.API, namespace, service, port, f)
+		},
+		Set: clients.Set,
+	}
+	if cfg.Resolver != "" {
+		resolverConfig.Lookup = appclient.LookupUsing(cfg.Resolver)
+		resolverConfig.LookupSRV = appclient.LookupSRVUsing(cfg.Resolver)
 	}
-	resolver := appclient.NewResolver(targets, dnsLookupFn, clients.Set)
+	resolver := appclient.NewResolver(resolverConfig)
 	defer resolver.Stop()
 
-	processCache := process.NewCachingWalker(process.NewWalker(flags.procRoot))
+	processCache := process.NewCachingWalker(process.NewWalker(cfg.ProcRoot))
 	scanner := procspy.NewConnectionScanner(processCache)
 
-	endpointReporter := endpoint.NewReporter(hostID, hostName, flags.spyProcs, flags.useConntrack, scanner)
+	endpointReporter := endpoint.NewReporter(hostID, hostName, cfg.Processes, cfg.Conntrack, scanner)
 	defer endpointReporter.Stop()
 
-	p := probe.New(flags.spyInterval, flags.publishInterval, clients)
+	p := probe.New(time.Duration(cfg.SpyInterval), time.Duration(cfg.PublishInterval), clients)
 	p.AddTicker(processCache)
 	hostReporter := host.NewReporter(hostID, hostName, probeID, version, clients)
 	defer hostReporter.Stop()
+	hostReporter.SetReporterHealth(func() map[string]string {
+		result := map[string]string{}
+		for _, h := range p.ReporterHealth() {
+			result[h.Name] = h.String()
+		}
+		return result
+	})
+	processReporter := process.NewReporter(processCache, hostID, probeID, cfg.ProcRoot, process.GetDeltaTotalJiffies, clients)
+	defer processReporter.Stop()
 	p.AddReporter(
 		endpointReporter,
 		hostReporter,
-		process.NewReporter(processCache, hostID, process.GetDeltaTotalJiffies),
+		processReporter,
+		overhead.NewReporter(hostID, p.ReporterHealth),
 	)
 	p.AddTagger(probe.NewTopologyTagger(), host.NewTagger(hostID))
 
-	if flags.dockerEnabled {
-		// Don't add the bridge in Kubernetes since container IPs are global and
-		// shouldn't be scoped
-		if !flags.kubernetesEnabled {
-			if err := report.AddLocalBridge(flags.dockerBridge); err != nil {
-				log.Errorf("Docker: problem with bridge %s: %v", flags.dockerBridge, err)
-			}
-		}
-		if registry, err := docker.NewRegistry(flags.dockerInterval, clients, true, hostID); err == nil {
-			defer registry.Stop()
-			p.AddTagger(docker.NewTagger(registry, processCache))
-			p.AddReporter(docker.NewReporter(registry, hostID, probeID, p))
-		} else {
-			log.Errorf("Docker: failed to start registry: %v", err)
-		}
+	// Redact after all the other taggers, so nothing sensitive is added
+	// after redaction.
+	redactor, err := redact.NewRedactor(cfg.Redact.Rules())
+	if err != nil {
+		log.Fatalf("Error setting up redaction: %v", err)
 	}
+	p.AddFinalTagger(redactor)
+	processReporter.SetRedact(func(key, value string) string {
+		return redactor.Redact(report.Process, key, value)
+	})
 
-	if flags.kubernetesEnabled {
-		if client, err := kubernetes.NewClient(flags.kubernetesAPI, flags.kubernetesInterval); err == nil {
-			defer client.Stop()
-			reporter := kubernetes.NewReporter(client, clients, probeID, p)
-			defer reporter.Stop()
-			p.AddReporter(reporter)
-			p.AddTagger(reporter)
-		} else {
-			log.Errorf("Kubernetes: failed to start client: %v", err)
-			log.Errorf("Kubernetes: make sure to run Scope inside a POD with a service account or provide a valid kubernetes.api url")
-		}
-	}
+	// The optional parts of the probe can be reconfigured while it runs.
+	components := newComponents(p, []componentSpec{
+		{
+			name:   "Docker",
+			config: func(c config.Config) interface{} { return []interface{}{c.Docker, c.Kubernetes.Enabled} },
+			start: func(c config.Config) (*component, error) {
+				if !c.Docker.Enabled {
+					return nil, nil
+				}
+				// Don't add the bridge in Kubernetes since container IPs are global and
+				// shouldn't be scoped
+				if !c.Kubernetes.Enabled {
+					if err := report.AddLocalBridge(c.Docker.Bridge); err != nil {
+						log.Errorf("Docker: problem with bridge %s: %v", c.Docker.Bridge, err)
+					}
+				}
+				registry, err := docker.NewRegistry(time.Duration(c.Docker.Interval), clients, true, hostID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to start registry: %v", err)
+				}
+				return &component{
+					taggers:   []probe.Tagger{docker.NewTagger(registry, processCache)},
+					reporters: []probe.Reporter{docker.NewReporter(registry, hostID, probeID, p)},
+					stop:      registry.Stop,
+				}, nil
+			},
+		},
+		{
+			name:   "Kubernetes",
+			config: func(c config.Config) interface{} { return c.Kubernetes },
+			start: func(c config.Config) (*component, error) {
+				if !c.Kubernetes.Enabled {
+					return nil, nil
+				}
+				client, err := kubernetes.NewClient(c.Kubernetes.API, time.Duration(c.Kubernetes.Interval))
+				if err != nil {
+					log.Errorf("Kubernetes: make sure to run Scope inside a POD with a service account or provide a valid kubernetes.api url")
+					return nil, fmt.Errorf("failed to start client: %v", err)
+				}
+				leader, stopElection := election.Always, func() {}
+				if c.Kubernetes.LeaderElection {
+					lock, err := kubernetes.NewLeaderLock(c.Kubernetes.API, c.Kubernetes.LeaderLock)
+					if err != nil {
+						client.Stop()
+						return nil, fmt.Errorf("failed to start leader election: %v", err)
+					}
+					elector := election.NewElector(lock, probeID, election.DefaultLease)
+					leader, stopElection = elector, elector.Stop
+				}
+				reporter := kubernetes.NewReporter(client, clients, probeID, hostID, p, leader)
+				return &component{
+					reporters: []probe.Reporter{reporter},
+					taggers:   []probe.Tagger{reporter},
+					stop: func() {
+						stopElection()
+						reporter.Stop()
+						client.Stop()
+					},
+				}, nil
+			},
+		},
+		{
+			name:   "Systemd",
+			config: func(c config.Config) interface{} { return c.Systemd },
+			start: func(c config.Config) (*component, error) {
+				if !c.Systemd.Enabled {
+					return nil, nil
+				}
+				reporter := systemd.NewReporter(systemd.NewSystemctlSource(c.Systemd.CgroupRoot), hostID, probeID)
+				return &component{
+					reporters: []probe.Reporter{reporter},
+					taggers:   []probe.Tagger{reporter},
+					stop:      reporter.Stop,
+				}, nil
+			},
+		},
+		{
+			name:   "Weave",
+			config: func(c config.Config) interface{} { return []interface{}{c.Weave, c.Docker.Bridge} },
+			start: func(c config.Config) (*component, error) {
+				if c.Weave.Addr == "" {
+					return nil, nil
+				}
+				client := weave.NewClient(sanitize.URL("http://", 6784, "")(c.Weave.Addr))
+				weave := overlay.NewWeave(hostID, client)
+				result := &component{
+					taggers:   []probe.Tagger{weave},
+					reporters: []probe.Reporter{weave},
+					stop:      weave.Stop,
+				}
 
-	if flags.weaveAddr != "" {
-		client := weave.NewClient(sanitize.URL("http://", 6784, "")(flags.weaveAddr))
-		weave := overlay.NewWeave(hostID, client)
-		defer weave.Stop()
-		p.AddTagger(weave)
-		p.AddReporter(weave)
+				dockerBridgeIP, err := network.GetFirstAddressOf(c.Docker.Bridge)
+				if err != nil {
+					log.Println("Error getting docker bridge ip:", err)
+				} else {
+					weaveDNSLookup := appclient.LookupUsing(dockerBridgeIP + ":53")
+					weaveResolver := appclient.NewResolver(appclient.ResolverConfig{
+						Targets: []string{c.Weave.Hostname},
+						Lookup:  weaveDNSLookup,
+						Set:     clients.Set,
+					})
+					result.stop = func() {
+						weaveResolver.Stop()
+						weave.Stop()
+					}
+				}
+				return result, nil
+			},
+		},
+		{
+			name:   "Plugins",
+			config: func(c config.Config) interface{} { return c.Plugins },
+			start: func(c config.Config) (*component, error) {
+				if !c.Plugins.Enabled {
+					return nil, nil
+				}
+				pluginRegistry, err := plugins.NewRegistry(
+					c.Plugins.Root,
+					pluginAPIVersion,
+					map[string]string{
+						"probe_id":    probeID,
+						"api_version": pluginAPIVersion,
+					},
+				)
+				if err != nil {
+					return nil, fmt.Errorf("problem loading: %v", err)
+				}
+				if c.Plugins.Allow != nil {
+					if err := pluginRegistry.SetAllowed(c.Plugins.Allow); err != nil {
+						log.Warnf("Plugins: problem loading: %v", err)
+					}
+				}
+				return &component{
+					reporters: []probe.Reporter{pluginRegistry},
+					stop:      pluginRegistry.Close,
+				}, nil
+			},
+		},
+	})
+	defer components.stop()
 
-		dockerBridgeIP, err := network.GetFirstAddressOf(flags.dockerBridge)
+	// Apps can push config to the probe, on top of its own. The probe reports
+	// back what it is using in its host node.
+	remote := newRemoteConfig(cfg, func(c config.Config, version string) {
+		setLogLevel(c.Log.Level)
+		p.SetIntervals(time.Duration(c.SpyInterval), time.Duration(c.PublishInterval))
+		schedules := map[string]probe.Schedule{}
+		for name, s := range c.Schedules {
+			schedules[name] = probe.Schedule{Interval: time.Duration(s.Interval), Timeout: time.Duration(s.Timeout)}
+		}
+		p.SetSchedules(schedules)
+		if err := redactor.SetRules(c.Redact.Rules()); err != nil {
+			log.Errorf("Error setting redaction rules: %v", err)
+		}
+		components.apply(c)
+		buf, err := json.Marshal(config.Effective(c))
 		if err != nil {
-			log.Println("Error getting docker bridge ip:", err)
-		} else {
-			weaveDNSLookup := appclient.LookupUsing(dockerBridgeIP + ":53")
-			weaveResolver := appclient.NewResolver([]string{flags.weaveHostname}, weaveDNSLookup, clients.Set)
-			defer weaveResolver.Stop()
+			log.Errorf("Error encoding config: %v", err)
 		}
-	}
-
-	pluginRegistry, err := plugins.NewRegistry(
-		flags.pluginsRoot,
-		pluginAPIVersion,
-		map[string]string{
-			"probe_id":    probeID,
-			"api_version": pluginAPIVersion,
-		},
-	)
-	if err != nil {
-		log.Errorf("plugins: problem loading: %v", err)
-	} else {
-		defer pluginRegistry.Close()
-		p.AddReporter(pluginRegistry)
-	}
+		hostReporter.SetProbeConfig(version, string(buf))
+	})
+	defer remote.stop()
+	remote.setLocal(cfg)
 
-	if flags.httpListen != "" {
+	if cfg.HTTPListen != "" {
 		go func() {
-			log.Infof("Profiling data being exported to %s", flags.httpListen)
-			log.Infof("go tool pprof http://%s/debug/pprof/{profile,heap,block}", flags.httpListen)
-			log.Infof("Profiling endpoint %s terminated: %v", flags.httpListen, http.ListenAndServe(flags.httpListen, nil))
+			log.Infof("Profiling data being exported to %s", cfg.HTTPListen)
+			log.Infof("go tool pprof http://%s/debug/pprof/{profile,heap,block}", cfg.HTTPListen)
+			log.Infof("Profiling endpoint %s terminated: %v", cfg.HTTPListen, http.ListenAndServe(cfg.HTTPListen, nil))
 		}()
 	}
 
 	p.Start()
 	defer p.Stop()
 
+	if flags.configFile != "" {
+		watcher := config.NewWatcher(flags.configFile, flags.config(), cfg, configPollInterval, func(next config.Config) {
+			log.Infof("Applying new config from %s", flags.configFile)
+			if changed := cfg.NeedsRestart(next); len(changed) > 0 {
+				log.Warnf("Changes to %s need a probe restart to take effect", strings.Join(changed, ", "))
+			}
+			remote.setLocal(next)
+		})
+		defer watcher.Stop()
+	}
+
 	common.SignalHandlerLoop()
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/weaveworks/scope/common/xfer"
+	"github.com/weaveworks/scope/probe/config"
+	"github.com/weaveworks/scope/probe/controls"
+)
+
+// remoteConfig combines the probe's own config, from flags or a config file,
+// with the config pushed to it by apps, and applies the result whenever
+// either changes.
+type remoteConfig struct {
+	mtx     sync.Mutex
+	local   config.Config
+	remote  config.Remote
+	version string
+	apply   func(cfg config.Config, version string)
+}
+
+func newRemoteConfig(local config.Config, apply func(config.Config, string)) *remoteConfig {
+	rc := &remoteConfig{
+		local: local,
+		apply: apply,
+	}
+	controls.Register(config.RemoteControl, rc.handleControl)
+	return rc
+}
+
+func (rc *remoteConfig) stop() {
+	controls.Rm(config.RemoteControl)
+}
+
+// setLocal is called when the probe's own config changes.
+func (rc *remoteConfig) setLocal(local config.Config) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	rc.local = local
+	effective := rc.remote.Apply(local)
+	if err := effective.Validate(); err != nil {
+		log.Warnf("Config from apps (version %s) is invalid with the new local config, dropping it: %v", rc.version, err)
+		rc.remote, rc.version = config.Remote{}, ""
+		effective = local
+	}
+	rc.apply(effective, rc.version)
+}
+
+func (rc *remoteConfig) handleControl(req xfer.Request) xfer.Response {
+	remote, err := config.ParseRemote([]byte(req.Args[config.RemoteConfigArg]))
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	version := req.Args[config.RemoteVersionArg]
+	if version == "" {
+		version = remote.Version()
+	}
+
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	effective := remote.Apply(rc.local)
+	if err := effective.Validate(); err != nil {
+		return xfer.ResponseError(err)
+	}
+	if version != rc.version {
+		log.Infof("Applying config version %s from app", version)
+	}
+	rc.remote, rc.version = remote, version
+	rc.apply(effective, version)
+
+	buf, err := json.Marshal(config.Effective(effective))
+	if err != nil {
+		return xfer.ResponseError(err)
+	}
+	return xfer.Response{Value: string(buf)}
+}
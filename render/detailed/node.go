@@ -1,6 +1,7 @@
 package detailed
 
 import (
+	"fmt"
 	"sort"
 
 	"github.com/ugorji/go/codec"
@@ -41,12 +42,13 @@ func (*ControlInstance) UnmarshalJSON(b []byte) error {
 }
 
 type wiredControlInstance struct {
-	ProbeID string `json:"probeId"`
-	NodeID  string `json:"nodeId"`
-	ID      string `json:"id"`
-	Human   string `json:"human"`
-	Icon    string `json:"icon"`
-	Rank    int    `json:"rank"`
+	ProbeID string             `json:"probeId"`
+	NodeID  string             `json:"nodeId"`
+	ID      string             `json:"id"`
+	Human   string             `json:"human"`
+	Icon    string             `json:"icon"`
+	Rank    int                `json:"rank"`
+	Args    report.ControlArgs `json:"args,omitempty"`
 }
 
 // CodecEncodeSelf marshals this ControlInstance. It takes the basic Metric
@@ -59,6 +61,7 @@ func (c *ControlInstance) CodecEncodeSelf(encoder *codec.Encoder) {
 		Human:   c.Control.Human,
 		Icon:    c.Control.Icon,
 		Rank:    c.Control.Rank,
+		Args:    c.Control.Args,
 	})
 }
 
@@ -74,6 +77,7 @@ func (c *ControlInstance) CodecDecodeSelf(decoder *codec.Decoder) {
 			Human: in.Human,
 			Icon:  in.Icon,
 			Rank:  in.Rank,
+			Args:  in.Args,
 		},
 	}
 }
@@ -101,18 +105,38 @@ func controlsFor(topology report.Topology, nodeID string) []ControlInstance {
 		return result
 	}
 
+	probes, _ := node.Sets.Lookup(report.ControlProbeIDs)
 	for _, id := range node.Controls.Controls {
-		if control, ok := topology.Controls[id]; ok {
-			probeID, ok := node.Latest.Lookup(report.ControlProbeID)
+		control, ok := topology.Controls[id]
+		if !ok {
+			continue
+		}
+		// Nodes on many hosts have their controls offered for each
+		for _, probe := range probes {
+			hostID, probeID, ok := report.ParseControlProbe(probe)
 			if !ok {
 				continue
 			}
+			onHost := control
+			onHost.Human = fmt.Sprintf("%s on %s", control.Human, hostID)
 			result = append(result, ControlInstance{
 				ProbeID: probeID,
 				NodeID:  nodeID,
-				Control: control,
+				Control: onHost,
 			})
 		}
+		if len(probes) > 0 {
+			continue
+		}
+		probeID, ok := node.Latest.Lookup(report.ControlProbeID)
+		if !ok {
+			continue
+		}
+		result = append(result, ControlInstance{
+			ProbeID: probeID,
+			NodeID:  nodeID,
+			Control: control,
+		})
 	}
 	return result
 }
@@ -425,3 +425,25 @@ func TestMakeDetailedPodNode(t *testing.T) {
 		t.Errorf("%s", test.Diff(want, have))
 	}
 }
+
+func TestMakeDetailedImageNodeControls(t *testing.T) {
+	rpt := report.MakeReport()
+	rpt.ContainerImage.Controls.AddControl(report.Control{ID: docker.PullImage, Human: "Pull latest"})
+	imageNodeID := report.MakeContainerImageNodeID("baz")
+	node := report.MakeNode(imageNodeID).WithTopology(report.ContainerImage).
+		WithSet(report.ControlProbeIDs, report.MakeStringSet(
+			report.MakeControlProbe("host1", "probe1"),
+			report.MakeControlProbe("host2", "probe2"),
+		)).WithControls(docker.PullImage)
+	rpt.ContainerImage.AddNode(node)
+
+	// Images are on many hosts, so their controls are offered for each
+	have := detailed.MakeNode("containers-by-image", rpt, rpt.ContainerImage.Nodes, node).Controls
+	want := []detailed.ControlInstance{
+		{ProbeID: "probe1", NodeID: imageNodeID, Control: report.Control{ID: docker.PullImage, Human: "Pull latest on host1"}},
+		{ProbeID: "probe2", NodeID: imageNodeID, Control: report.Control{ID: docker.PullImage, Human: "Pull latest on host2"}},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("%s", test.Diff(want, have))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
+	"github.com/weaveworks/scope/probe/systemd"
 	"github.com/weaveworks/scope/report"
 )
 
@@ -28,7 +29,10 @@ func Parents(r report.Report, n report.Node) (result []Parent) {
 		report.ReplicaSet:     {r.ReplicaSet, replicaSetParent},
 		report.Deployment:     {r.Deployment, deploymentParent},
 		report.Service:        {r.Service, serviceParent},
+		report.KubernetesNode: {r.KubernetesNode, kubernetesNodeParent},
+		report.Namespace:      {r.Namespace, namespaceParent},
 		report.ContainerImage: {r.ContainerImage, containerImageParent},
+		report.SystemdService: {r.SystemdService, systemdServiceParent},
 		report.Host:           {r.Host, hostParent},
 	}
 	topologyIDs := []string{}
@@ -65,10 +69,12 @@ func containerParent(n report.Node) Parent {
 }
 
 var (
-	podParent        = kubernetesParent("pods")
-	replicaSetParent = kubernetesParent("replica-sets")
-	deploymentParent = kubernetesParent("deployments")
-	serviceParent    = kubernetesParent("services")
+	podParent            = kubernetesParent("pods")
+	replicaSetParent     = kubernetesParent("replica-sets")
+	deploymentParent     = kubernetesParent("deployments")
+	serviceParent        = kubernetesParent("services")
+	kubernetesNodeParent = kubernetesParent("kubernetes-nodes")
+	namespaceParent      = kubernetesParent("namespaces")
 )
 
 func kubernetesParent(topology string) func(report.Node) Parent {
@@ -91,6 +97,15 @@ func containerImageParent(n report.Node) Parent {
 	}
 }
 
+func systemdServiceParent(n report.Node) Parent {
+	unit, _ := n.Latest.Lookup(systemd.UnitName)
+	return Parent{
+		ID:         n.ID,
+		Label:      unit,
+		TopologyID: "systemd-services",
+	}
+}
+
 func hostParent(n report.Node) Parent {
 	hostName, _ := n.Latest.Lookup(host.HostName)
 	return Parent{
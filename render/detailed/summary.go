@@ -9,6 +9,7 @@ import (
 	"github.com/weaveworks/scope/probe/host"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/probe/process"
+	"github.com/weaveworks/scope/probe/systemd"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/report"
 )
@@ -80,6 +81,9 @@ func MakeNodeSummary(r report.Report, n report.Node) (NodeSummary, bool) {
 		report.Service:        serviceNodeSummary,
 		report.Deployment:     deploymentNodeSummary,
 		report.ReplicaSet:     replicaSetNodeSummary,
+		report.KubernetesNode: kubernetesNodeNodeSummary,
+		report.Namespace:      namespaceNodeSummary,
+		report.SystemdService: systemdServiceNodeSummary,
 		report.Host:           hostNodeSummary,
 	}
 	if renderer, ok := renderers[n.Topology]; ok {
@@ -304,6 +308,53 @@ func replicaSetNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool)
 	return base, true
 }
 
+func kubernetesNodeNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(kubernetes.Name)
+	base.Rank, _ = n.Latest.Lookup(kubernetes.ID)
+
+	if p, ok := n.Counters.Lookup(report.Pod); ok {
+		if p == 1 {
+			base.LabelMinor = fmt.Sprintf("%d pod", p)
+		} else {
+			base.LabelMinor = fmt.Sprintf("%d pods", p)
+		}
+	}
+
+	return base, true
+}
+
+func namespaceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(kubernetes.Name)
+	base.Rank, _ = n.Latest.Lookup(kubernetes.ID)
+	base.Stack = true
+
+	if p, ok := n.Counters.Lookup(report.Pod); ok {
+		if p == 1 {
+			base.LabelMinor = fmt.Sprintf("%d pod", p)
+		} else {
+			base.LabelMinor = fmt.Sprintf("%d pods", p)
+		}
+	}
+
+	return base, true
+}
+
+func systemdServiceNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
+	base.Label, _ = n.Latest.Lookup(systemd.UnitName)
+	base.Rank = base.Label
+	base.LabelMinor = report.ExtractHostID(n)
+
+	if p, ok := n.Counters.Lookup(report.Process); ok {
+		if p == 1 {
+			base.LabelMinor = fmt.Sprintf("%s (%d process)", base.LabelMinor, p)
+		} else {
+			base.LabelMinor = fmt.Sprintf("%s (%d processes)", base.LabelMinor, p)
+		}
+	}
+
+	return base, true
+}
+
 func hostNodeSummary(base NodeSummary, n report.Node) (NodeSummary, bool) {
 	var (
 		hostname, _ = n.Latest.Lookup(host.HostName)
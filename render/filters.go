@@ -166,7 +166,7 @@ func FilterUnconnected(r Renderer) Renderer {
 func Noop(_ report.Node) bool { return true }
 
 // FilterNoop does nothing.
-func FilterNoop(r Renderer) Renderer { return r }
+var FilterNoop = MakeDecorator("noop", func(r Renderer) Renderer { return r })
 
 // IsRunning checks if the node is a running docker container
 func IsRunning(n report.Node) bool {
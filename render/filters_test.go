@@ -16,7 +16,7 @@ func TestFilterRender(t *testing.T) {
 		"baz": report.MakeNode("baz"),
 	}}
 	have := report.MakeIDList()
-	for id := range renderer.Render(report.MakeReport(), render.FilterUnconnected) {
+	for id := range renderer.Render(report.MakeReport(), render.MakeDecorator("unconnected", render.FilterUnconnected)) {
 		have = have.Add(id)
 	}
 	want := report.MakeIDList("foo", "bar")
@@ -27,14 +27,14 @@ func TestFilterRender(t *testing.T) {
 
 func TestFilterRender2(t *testing.T) {
 	// Test adjacencies are removed for filtered nodes.
-	filter := func(renderer render.Renderer) render.Renderer {
+	filter := render.MakeDecorator("", func(renderer render.Renderer) render.Renderer {
 		return &render.Filter{
 			FilterFunc: func(node report.Node) bool {
 				return node.ID != "bar"
 			},
 			Renderer: renderer,
 		}
-	}
+	})
 	renderer := mockRenderer{Nodes: report.Nodes{
 		"foo": report.MakeNode("foo").WithAdjacent("bar"),
 		"bar": report.MakeNode("bar").WithAdjacent("foo"),
@@ -57,14 +57,14 @@ func TestFilterUnconnectedPseudoNodes(t *testing.T) {
 			"baz": report.MakeNode("baz").WithTopology(render.Pseudo),
 		}
 		renderer := mockRenderer{Nodes: nodes}
-		filter := func(renderer render.Renderer) render.Renderer {
+		filter := render.MakeDecorator("", func(renderer render.Renderer) render.Renderer {
 			return &render.Filter{
 				FilterFunc: func(node report.Node) bool {
 					return true
 				},
 				Renderer: renderer,
 			}
-		}
+		})
 		want := nodes
 		have := renderer.Render(report.MakeReport(), filter)
 		if !reflect.DeepEqual(want, have) {
@@ -72,14 +72,14 @@ func TestFilterUnconnectedPseudoNodes(t *testing.T) {
 		}
 	}
 	{
-		filter := func(renderer render.Renderer) render.Renderer {
+		filter := render.MakeDecorator("", func(renderer render.Renderer) render.Renderer {
 			return &render.Filter{
 				FilterFunc: func(node report.Node) bool {
 					return node.ID != "bar"
 				},
 				Renderer: renderer,
 			}
-		}
+		})
 		renderer := mockRenderer{Nodes: report.Nodes{
 			"foo": report.MakeNode("foo").WithAdjacent("bar"),
 			"bar": report.MakeNode("bar").WithAdjacent("baz"),
@@ -91,14 +91,14 @@ func TestFilterUnconnectedPseudoNodes(t *testing.T) {
 		}
 	}
 	{
-		filter := func(renderer render.Renderer) render.Renderer {
+		filter := render.MakeDecorator("", func(renderer render.Renderer) render.Renderer {
 			return &render.Filter{
 				FilterFunc: func(node report.Node) bool {
 					return node.ID != "bar"
 				},
 				Renderer: renderer,
 			}
-		}
+		})
 		renderer := mockRenderer{Nodes: report.Nodes{
 			"foo": report.MakeNode("foo"),
 			"bar": report.MakeNode("bar").WithAdjacent("foo"),
@@ -118,7 +118,7 @@ func TestFilterUnconnectedSelf(t *testing.T) {
 			"foo": report.MakeNode("foo").WithAdjacent("foo"),
 		}
 		renderer := mockRenderer{Nodes: nodes}
-		have := renderer.Render(report.MakeReport(), render.FilterUnconnected)
+		have := renderer.Render(report.MakeReport(), render.MakeDecorator("unconnected", render.FilterUnconnected))
 		if len(have) > 0 {
 			t.Error("expected node only connected to self to be removed")
 		}
@@ -0,0 +1,99 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// Dependencies returns the nodes which the node with the given id
+// transitively connects to, following edges forwards, mapped to the number
+// of hops they are away. A depth of zero or less means unlimited.
+func Dependencies(nodes report.Nodes, id string, depth int) map[string]int {
+	return walk(nodes, id, depth, func(n report.Node) report.IDList {
+		return n.Adjacency
+	})
+}
+
+// Dependents returns the nodes which transitively connect to the node with
+// the given id, following edges backwards, mapped to the number of hops
+// they are away. A depth of zero or less means unlimited.
+func Dependents(nodes report.Nodes, id string, depth int) map[string]int {
+	incoming := incomingAdjacency(nodes)
+	return walk(nodes, id, depth, func(n report.Node) report.IDList {
+		return incoming[n.ID]
+	})
+}
+
+// ShortestPath returns the IDs of the nodes on a shortest path from from to
+// to, inclusive, following edges forwards, the way connections go.
+func ShortestPath(nodes report.Nodes, from, to string) ([]string, bool) {
+	if _, ok := nodes[from]; !ok {
+		return nil, false
+	}
+	if _, ok := nodes[to]; !ok {
+		return nil, false
+	}
+	previous := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 && queue[0] != to {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range nodes[current].Adjacency {
+			if _, seen := previous[next]; seen {
+				continue
+			}
+			if _, ok := nodes[next]; !ok {
+				continue
+			}
+			previous[next] = current
+			queue = append(queue, next)
+		}
+	}
+	if _, ok := previous[to]; !ok {
+		return nil, false
+	}
+
+	path := []string{}
+	for id := to; id != ""; id = previous[id] {
+		path = append([]string{id}, path...)
+	}
+	return path, true
+}
+
+// walk does a breadth-first traversal from id, using next to find the
+// neighbours of each node. The starting node is not included in the result.
+func walk(nodes report.Nodes, id string, depth int, next func(report.Node) report.IDList) map[string]int {
+	result := map[string]int{}
+	start, ok := nodes[id]
+	if !ok {
+		return result
+	}
+	frontier := []report.Node{start}
+	for hops := 1; len(frontier) > 0 && (depth <= 0 || hops <= depth); hops++ {
+		nextFrontier := []report.Node{}
+		for _, n := range frontier {
+			for _, neighbourID := range next(n) {
+				if _, seen := result[neighbourID]; seen || neighbourID == id {
+					continue
+				}
+				neighbour, ok := nodes[neighbourID]
+				if !ok {
+					continue
+				}
+				result[neighbourID] = hops
+				nextFrontier = append(nextFrontier, neighbour)
+			}
+		}
+		frontier = nextFrontier
+	}
+	return result
+}
+
+func incomingAdjacency(nodes report.Nodes) map[string]report.IDList {
+	result := map[string]report.IDList{}
+	for id, n := range nodes {
+		for _, dstID := range n.Adjacency {
+			result[dstID] = result[dstID].Add(id)
+		}
+	}
+	return result
+}
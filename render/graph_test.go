@@ -0,0 +1,74 @@
+package render_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/scope/render"
+	"github.com/weaveworks/scope/report"
+)
+
+// a -> b -> c -> d, and e -> c
+var graph = report.Nodes{
+	"a": report.MakeNode("a").WithAdjacent("b"),
+	"b": report.MakeNode("b").WithAdjacent("c"),
+	"c": report.MakeNode("c").WithAdjacent("d"),
+	"d": report.MakeNode("d"),
+	"e": report.MakeNode("e").WithAdjacent("c", "missing"),
+	"f": report.MakeNode("f"),
+}
+
+func TestDependencies(t *testing.T) {
+	for _, c := range []struct {
+		id    string
+		depth int
+		want  map[string]int
+	}{
+		{"a", 0, map[string]int{"b": 1, "c": 2, "d": 3}},
+		{"a", 2, map[string]int{"b": 1, "c": 2}},
+		{"e", 0, map[string]int{"c": 1, "d": 2}},
+		{"d", 0, map[string]int{}},
+		{"missing", 0, map[string]int{}},
+	} {
+		if have := render.Dependencies(graph, c.id, c.depth); !reflect.DeepEqual(c.want, have) {
+			t.Errorf("%s/%d: want %v, have %v", c.id, c.depth, c.want, have)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	for _, c := range []struct {
+		id    string
+		depth int
+		want  map[string]int
+	}{
+		{"d", 0, map[string]int{"c": 1, "b": 2, "e": 2, "a": 3}},
+		{"d", 1, map[string]int{"c": 1}},
+		{"a", 0, map[string]int{}},
+	} {
+		if have := render.Dependents(graph, c.id, c.depth); !reflect.DeepEqual(c.want, have) {
+			t.Errorf("%s/%d: want %v, have %v", c.id, c.depth, c.want, have)
+		}
+	}
+}
+
+func TestShortestPath(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		want     []string
+		ok       bool
+	}{
+		{"a", "d", []string{"a", "b", "c", "d"}, true},
+		{"e", "d", []string{"e", "c", "d"}, true},
+		{"d", "a", nil, false},
+		{"a", "e", nil, false}, // both talk to c, but not to each other
+		{"a", "a", []string{"a"}, true},
+		{"a", "f", nil, false},
+		{"a", "missing", nil, false},
+	} {
+		have, ok := render.ShortestPath(graph, c.from, c.to)
+		if ok != c.ok || !reflect.DeepEqual(c.want, have) {
+			t.Errorf("%s->%s: want %v (%v), have %v (%v)", c.from, c.to, c.want, c.ok, have, ok)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package render
 import (
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/bluele/gcache"
 
@@ -13,7 +14,8 @@ var renderCache = gcache.New(100).LRU().Build()
 
 type memoise struct {
 	Renderer
-	id string
+	id    string
+	stage string
 }
 
 // Memoise wraps the renderer in a loving embrace of caching
@@ -21,21 +23,31 @@ func Memoise(r Renderer) Renderer {
 	return &memoise{
 		Renderer: r,
 		id:       fmt.Sprintf("%x", rand.Int63()),
+		stage:    stageName(r),
 	}
 }
 
 // Render produces a set of Nodes given a Report.
 // Ideally, it just retrieves it from the cache, otherwise it calls through to
-// `r` and stores the result.
+// `r` and stores the result. Renders with a Decorator are cached by the
+// Decorator's ID; renders with a Decorator without an ID are not cached.
 func (m *memoise) Render(rpt report.Report, dct Decorator) report.Nodes {
 	key := fmt.Sprintf("%s-%s", rpt.ID, m.id)
-	if dct == nil {
+	cacheable := true
+	if dct != nil {
+		key = fmt.Sprintf("%s-%s", key, dct.ID())
+		cacheable = dct.ID() != ""
+	}
+	if cacheable {
 		if result, err := renderCache.Get(key); err == nil {
+			profile.hit(m.stage)
 			return result.(report.Nodes)
 		}
 	}
+	start := time.Now()
 	output := m.Renderer.Render(rpt, dct)
-	if dct == nil {
+	profile.miss(m.stage, time.Since(start), len(output))
+	if cacheable {
 		renderCache.Set(key, output)
 	}
 	return output
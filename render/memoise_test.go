@@ -58,3 +58,51 @@ func TestMemoise(t *testing.T) {
 		t.Errorf("Expected renderer to have been called again after cache reset")
 	}
 }
+
+func TestMemoiseDecorated(t *testing.T) {
+	calls := 0
+	r := renderFunc(func(rpt report.Report) report.Nodes {
+		calls++
+		return report.Nodes{rpt.ID: report.MakeNode(rpt.ID)}
+	})
+	m := render.Memoise(r)
+	rpt := report.MakeReport()
+
+	identified := render.MakeDecorator("foo", render.FilterNoop.Decorate)
+	m.Render(rpt, identified)
+	m.Render(rpt, render.MakeDecorator("foo", render.FilterNoop.Decorate))
+	if calls != 1 {
+		t.Errorf("Expected decorators with the same ID to share a cache entry, got %d calls", calls)
+	}
+
+	m.Render(rpt, render.MakeDecorator("bar", render.FilterNoop.Decorate))
+	if calls != 2 {
+		t.Errorf("Expected decorators with different IDs to be cached separately, got %d calls", calls)
+	}
+
+	anonymous := render.MakeDecorator("", render.FilterNoop.Decorate)
+	m.Render(rpt, anonymous)
+	m.Render(rpt, anonymous)
+	if calls != 4 {
+		t.Errorf("Expected decorators without an ID not to be cached, got %d calls", calls)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	render.ResetProfile()
+	m := render.MakeMap(render.MapEndpoint2IP, render.SelectEndpoint)
+	rpt := report.MakeReport()
+	m.Render(rpt, nil)
+	m.Render(rpt, nil)
+
+	for _, stage := range render.Profile() {
+		if stage.Stage != "map(MapEndpoint2IP)" {
+			continue
+		}
+		if stage.CacheHits != 1 || stage.CacheMisses != 1 || stage.CacheHitRate != 0.5 {
+			t.Errorf("Unexpected profile: %+v", stage)
+		}
+		return
+	}
+	t.Errorf("Expected map stage in profile, got: %+v", render.Profile())
+}
@@ -1,7 +1,9 @@
 package render
 
 import (
+	"net"
 	"strings"
+	"time"
 
 	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/kubernetes"
@@ -78,6 +80,38 @@ var ReplicaSetRenderer = ConditionalRenderer(renderKubernetesTopologies,
 	),
 )
 
+// KubernetesNodeRenderer is a Renderer which produces a renderable kubernetes
+// nodes graph by merging the pods graph and the kubernetes nodes topology.
+var KubernetesNodeRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	ApplyDecorators(
+		MakeReduce(
+			MakeMap(
+				Map2KubernetesNode,
+				PodRenderer,
+			),
+			SelectKubernetesNode,
+		),
+	),
+)
+
+// NamespaceRenderer is a Renderer which produces a renderable kubernetes
+// namespaces graph by merging the pods graph and the namespaces topology.
+// Edges between namespaces are the traffic between the pods in them.
+var NamespaceRenderer = ConditionalRenderer(renderKubernetesTopologies,
+	ApplyDecorators(
+		MakeMap(
+			MapRollUpMetrics(docker.CPUTotalUsage, docker.MemoryUsage),
+			MakeReduce(
+				MakeMap(
+					Map2Namespace,
+					PodRenderer,
+				),
+				SelectNamespace,
+			),
+		),
+	),
+)
+
 // MapContainer2Pod maps container Nodes to pod
 // Nodes.
 //
@@ -125,9 +159,11 @@ func MapContainer2Pod(n report.Node, _ report.Networks) report.Nodes {
 
 // The various ways of grouping pods
 var (
-	Map2Service    = Map2Parent(report.Service)
-	Map2Deployment = Map2Parent(report.Deployment)
-	Map2ReplicaSet = Map2Parent(report.ReplicaSet)
+	Map2Service        = Map2Parent(report.Service)
+	Map2Deployment     = Map2Parent(report.Deployment)
+	Map2ReplicaSet     = Map2Parent(report.ReplicaSet)
+	Map2KubernetesNode = Map2Parent(report.KubernetesNode)
+	Map2Namespace      = Map2Parent(report.Namespace)
 )
 
 // Map2Parent maps Nodes to some parent grouping.
@@ -155,3 +191,175 @@ func Map2Parent(topology string) func(n report.Node, _ report.Networks) report.N
 		return result
 	}
 }
+
+// MapRollUpMetrics returns a MapFunc which sets the given metrics on a node
+// to the sum of the latest values of those metrics on its container
+// children.
+func MapRollUpMetrics(keys ...string) MapFunc {
+	return func(n report.Node, _ report.Networks) report.Nodes {
+		if n.Topology == Pseudo {
+			return report.Nodes{n.ID: n}
+		}
+
+		var (
+			found     = map[string]bool{}
+			sums      = map[string]float64{}
+			maxes     = map[string]float64{}
+			timestamp time.Time
+		)
+		n.Children.ForEach(func(child report.Node) {
+			if child.Topology != report.Container {
+				return
+			}
+			for _, key := range keys {
+				metric, ok := child.Metrics.Lookup(key)
+				if !ok {
+					continue
+				}
+				sample := metric.LastSample()
+				if sample == nil {
+					continue
+				}
+				found[key] = true
+				sums[key] += sample.Value
+				maxes[key] += metric.Max
+				if sample.Timestamp.After(timestamp) {
+					timestamp = sample.Timestamp
+				}
+			}
+		})
+
+		output := n.Copy()
+		for key := range found {
+			output.Metrics[key] = report.MakeMetric().Add(timestamp, sums[key]).WithMax(maxes[key])
+		}
+		return report.Nodes{n.ID: output}
+	}
+}
+
+// ResolveClusterIPs returns a Renderer which rewrites connections addressed
+// to a kubernetes Service ClusterIP:port onto the endpoints backing that
+// service, as published by the kubernetes reporter. Connections only join up
+// through the conntrack NAT mapper if it happens to catch the DNAT, which
+// short-lived and iptables-mode kube-proxy flows often escape.
+func ResolveClusterIPs(r Renderer) Renderer {
+	return clusterIPRenderer{r}
+}
+
+type clusterIPRenderer struct {
+	Renderer
+}
+
+// Render implements Renderer
+func (r clusterIPRenderer) Render(rpt report.Report, dct Decorator) report.Nodes {
+	endpoints := r.Renderer.Render(rpt, dct)
+	backends := serviceBackends(rpt)
+	if len(backends) == 0 {
+		return endpoints
+	}
+
+	// Index the endpoints by address and port, ignoring their scope, as the
+	// backing endpoints may or may not be scoped by the host they are on.
+	byAddress := map[string][]string{}
+	for id := range endpoints {
+		if _, addr, port, ok := report.ParseEndpointNodeID(id); ok {
+			key := net.JoinHostPort(addr, port)
+			byAddress[key] = append(byAddress[key], id)
+		}
+	}
+
+	output := report.Nodes{}
+	resolved := map[string]struct{}{}
+	for id, n := range endpoints {
+		adjacency := report.MakeIDList()
+		rewritten := map[string][]string{}
+		for _, dstID := range n.Adjacency {
+			_, addr, port, ok := report.ParseEndpointNodeID(dstID)
+			if !ok {
+				adjacency = adjacency.Add(dstID)
+				continue
+			}
+			var backingIDs []string
+			for _, backend := range backends[net.JoinHostPort(addr, port)] {
+				backingIDs = append(backingIDs, byAddress[backend]...)
+			}
+			if len(backingIDs) == 0 {
+				adjacency = adjacency.Add(dstID)
+				continue
+			}
+			adjacency = adjacency.Add(backingIDs...)
+			rewritten[dstID] = backingIDs
+			resolved[dstID] = struct{}{}
+		}
+		n.Adjacency = adjacency
+		if len(rewritten) > 0 {
+			n.Edges = rewriteEdges(n.Edges, rewritten)
+		}
+		output[id] = n
+	}
+
+	// The ClusterIP endpoints themselves are not real, and nothing points at
+	// them anymore.
+	for id := range resolved {
+		delete(output, id)
+	}
+	return output
+}
+
+// rewriteEdges moves the metadata of edges to ClusterIPs onto the edges to
+// the endpoints backing them. We can't tell which backend each packet went
+// to, so the counts are split evenly between them, keeping the totals right.
+func rewriteEdges(edges report.EdgeMetadatas, rewritten map[string][]string) report.EdgeMetadatas {
+	result := report.EmptyEdgeMetadatas
+	edges.ForEach(func(dstID string, md report.EdgeMetadata) {
+		backingIDs, ok := rewritten[dstID]
+		if !ok {
+			result = result.Add(dstID, md)
+			return
+		}
+		for i, backingID := range backingIDs {
+			result = result.Add(backingID, report.EdgeMetadata{
+				EgressPacketCount:  splitCount(md.EgressPacketCount, i, len(backingIDs)),
+				IngressPacketCount: splitCount(md.IngressPacketCount, i, len(backingIDs)),
+				EgressByteCount:    splitCount(md.EgressByteCount, i, len(backingIDs)),
+				IngressByteCount:   splitCount(md.IngressByteCount, i, len(backingIDs)),
+			})
+		}
+	})
+	return result
+}
+
+// splitCount returns the i'th of n shares of count, the first shares taking
+// any remainder.
+func splitCount(count *uint64, i, n int) *uint64 {
+	if count == nil {
+		return nil
+	}
+	share := *count / uint64(n)
+	if uint64(i) < *count%uint64(n) {
+		share++
+	}
+	return &share
+}
+
+// serviceBackends maps each "clusterIP:port" to the "ip:targetPort"
+// addresses backing it.
+func serviceBackends(rpt report.Report) map[string][]string {
+	result := map[string][]string{}
+	for _, n := range rpt.Service.Nodes {
+		clusterIP, ok := n.Latest.Lookup(kubernetes.IP)
+		if !ok || net.ParseIP(clusterIP) == nil {
+			continue
+		}
+		backends, _ := n.Sets.Lookup(kubernetes.ServiceEndpoints)
+		for _, backend := range backends {
+			port, ip, targetPort, ok := kubernetes.ParseServiceBackend(backend)
+			if !ok {
+				continue
+			}
+			key := net.JoinHostPort(clusterIP, port)
+			result[key] = append(result[key], net.JoinHostPort(ip, targetPort))
+		}
+	}
+	return result
+}
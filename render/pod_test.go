@@ -2,10 +2,13 @@ package render_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/weaveworks/scope/probe/docker"
 	"github.com/weaveworks/scope/probe/kubernetes"
 	"github.com/weaveworks/scope/render"
 	"github.com/weaveworks/scope/render/expected"
+	"github.com/weaveworks/scope/report"
 	"github.com/weaveworks/scope/test"
 	"github.com/weaveworks/scope/test/fixture"
 	"github.com/weaveworks/scope/test/reflect"
@@ -19,9 +22,9 @@ func TestPodRenderer(t *testing.T) {
 	}
 }
 
-func filterNonKubeSystem(renderer render.Renderer) render.Renderer {
+var filterNonKubeSystem = render.MakeDecorator("non-kube-system", func(renderer render.Renderer) render.Renderer {
 	return render.MakeFilter(render.Complement(render.IsNamespace("kube-system")), renderer)
-}
+})
 
 func TestPodFilterRenderer(t *testing.T) {
 	// tag on containers or pod namespace in the topology and ensure
@@ -61,3 +64,75 @@ func TestPodServiceFilterRenderer(t *testing.T) {
 		t.Error(test.Diff(want, have))
 	}
 }
+
+func TestResolveClusterIPs(t *testing.T) {
+	var (
+		clientID    = report.MakeEndpointNodeID("client.host", "10.32.0.1", "54321")
+		clusterIPID = report.MakeEndpointNodeID("", "10.0.1.1", "6379")
+		backendID   = report.MakeEndpointNodeID("server.host", "10.32.0.7", "6380")
+		backend2ID  = report.MakeEndpointNodeID("server.host", "10.32.0.8", "6380")
+		otherID     = report.MakeEndpointNodeID("", "10.0.1.1", "80")
+	)
+	input := report.MakeReport()
+	count := uint64(3)
+	input.Endpoint.AddNode(report.MakeNode(clientID).WithAdjacent(clusterIPID, otherID).
+		WithEdge(clusterIPID, report.EdgeMetadata{EgressPacketCount: &count}))
+	input.Endpoint.AddNode(report.MakeNode(clusterIPID))
+	input.Endpoint.AddNode(report.MakeNode(otherID))
+	input.Endpoint.AddNode(report.MakeNode(backendID))
+	input.Endpoint.AddNode(report.MakeNode(backend2ID))
+	input.Service.AddNode(report.MakeNodeWith(fixture.ServiceNodeID, map[string]string{
+		kubernetes.IP: "10.0.1.1",
+	}).WithSets(report.EmptySets.
+		Add(kubernetes.ServiceEndpoints, report.MakeStringSet("6379->10.32.0.7:6380", "6379->10.32.0.8:6380")),
+	))
+
+	have := render.ResolveClusterIPs(render.SelectEndpoint).Render(input, nil)
+	if _, ok := have[clusterIPID]; ok {
+		t.Errorf("Expected ClusterIP endpoint %q to be removed", clusterIPID)
+	}
+	want := report.MakeIDList(backendID, backend2ID, otherID)
+	if adjacency := have[clientID].Adjacency; !reflect.DeepEqual(want, adjacency) {
+		t.Error(test.Diff(want, adjacency))
+	}
+	if _, ok := have[clientID].Edges.Lookup(clusterIPID); ok {
+		t.Errorf("Expected edge to ClusterIP endpoint %q to be removed", clusterIPID)
+	}
+
+	// The packets are split between the backends, not counted twice
+	total := uint64(0)
+	for _, id := range []string{backendID, backend2ID} {
+		md, ok := have[clientID].Edges.Lookup(id)
+		if !ok || md.EgressPacketCount == nil || *md.EgressPacketCount == 0 {
+			t.Errorf("Expected edge metadata to be carried over to %q, got %v", id, md)
+			continue
+		}
+		total += *md.EgressPacketCount
+	}
+	if total != count {
+		t.Errorf("Expected %d packets in total, got %d", count, total)
+	}
+}
+
+func TestMapRollUpMetrics(t *testing.T) {
+	var (
+		t1         = time.Unix(10, 0)
+		t2         = time.Unix(20, 0)
+		container1 = report.MakeNode("container1").WithTopology(report.Container).
+				WithMetric(docker.MemoryUsage, report.MakeMetric().Add(t1, 10).WithMax(100))
+		container2 = report.MakeNode("container2").WithTopology(report.Container).
+				WithMetric(docker.MemoryUsage, report.MakeMetric().Add(t2, 20).WithMax(100))
+		namespace = report.MakeNode(report.MakeNamespaceNodeID("ping")).WithTopology(report.Namespace).
+				WithChildren(report.MakeNodeSet(container1, container2))
+	)
+
+	have := render.MapRollUpMetrics(docker.MemoryUsage, docker.CPUTotalUsage)(namespace, nil)
+	metrics := have[namespace.ID].Metrics
+	if _, ok := metrics.Lookup(docker.CPUTotalUsage); ok {
+		t.Errorf("Expected no CPU metric to be rolled up")
+	}
+	want := report.MakeMetric().Add(t2, 30).WithMax(200)
+	if metric, ok := metrics.Lookup(docker.MemoryUsage); !ok || !reflect.DeepEqual(want, metric) {
+		t.Error(test.Diff(want, metric))
+	}
+}
@@ -0,0 +1,167 @@
+package render
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exported prometheus metrics for the render pipeline. They are labelled by
+// stage; see StageProfile.
+var (
+	RenderDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: "scope",
+		Subsystem: "render",
+		Name:      "stage_duration_nanoseconds",
+		Help:      "Time spent rendering each stage, including its inputs, on cache misses.",
+		MaxAge:    10 * time.Second, // like statsd
+	}, []string{"stage"})
+	RenderCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "scope",
+		Subsystem: "render",
+		Name:      "cache_requests_total",
+		Help:      "Render cache lookups for each stage, by result (hit or miss).",
+	}, []string{"stage", "result"})
+	RenderNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "scope",
+		Subsystem: "render",
+		Name:      "stage_nodes",
+		Help:      "Number of nodes output by the last render of each stage.",
+	}, []string{"stage"})
+)
+
+// StageProfile holds the profiling statistics for a render stage. A stage is
+// a memoised renderer; stages are named after their type and function, so
+// all renderers built the same way are profiled together.
+type StageProfile struct {
+	Stage         string        `json:"stage"`
+	CacheHits     int           `json:"cache_hits"`
+	CacheMisses   int           `json:"cache_misses"`
+	CacheHitRate  float64       `json:"cache_hit_rate"`
+	TotalDuration time.Duration `json:"total_duration"`
+	LastDuration  time.Duration `json:"last_duration"`
+	LastNodes     int           `json:"last_nodes"`
+}
+
+type profiler struct {
+	sync.Mutex
+	stages map[string]*StageProfile
+}
+
+var profile = &profiler{stages: map[string]*StageProfile{}}
+
+func (p *profiler) stage(name string) *StageProfile {
+	s, ok := p.stages[name]
+	if !ok {
+		s = &StageProfile{Stage: name}
+		p.stages[name] = s
+	}
+	return s
+}
+
+func (p *profiler) hit(name string) {
+	p.Lock()
+	defer p.Unlock()
+	p.stage(name).CacheHits++
+	RenderCacheRequests.WithLabelValues(name, "hit").Inc()
+}
+
+func (p *profiler) miss(name string, duration time.Duration, nodes int) {
+	p.Lock()
+	defer p.Unlock()
+	s := p.stage(name)
+	s.CacheMisses++
+	s.TotalDuration += duration
+	s.LastDuration = duration
+	s.LastNodes = nodes
+	RenderCacheRequests.WithLabelValues(name, "miss").Inc()
+	RenderDuration.WithLabelValues(name).Observe(float64(duration))
+	RenderNodes.WithLabelValues(name).Set(float64(nodes))
+}
+
+// Profile returns the profiling statistics for each render stage, slowest
+// (by total duration) first.
+func Profile() []StageProfile {
+	profile.Lock()
+	defer profile.Unlock()
+	result := []StageProfile{}
+	for _, s := range profile.stages {
+		stage := *s
+		if total := stage.CacheHits + stage.CacheMisses; total > 0 {
+			stage.CacheHitRate = float64(stage.CacheHits) / float64(total)
+		}
+		result = append(result, stage)
+	}
+	sort.Sort(profilesByDuration(result))
+	return result
+}
+
+// ResetProfile clears the render profiling statistics.
+func ResetProfile() {
+	profile.Lock()
+	defer profile.Unlock()
+	profile.stages = map[string]*StageProfile{}
+}
+
+type profilesByDuration []StageProfile
+
+func (p profilesByDuration) Len() int      { return len(p) }
+func (p profilesByDuration) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p profilesByDuration) Less(i, j int) bool {
+	if p[i].TotalDuration != p[j].TotalDuration {
+		return p[i].TotalDuration > p[j].TotalDuration
+	}
+	return p[i].Stage < p[j].Stage
+}
+
+// stageName names a renderer for profiling, e.g. "map(MapProcess2Container)".
+func stageName(r Renderer) string {
+	switch r := r.(type) {
+	case *Map:
+		return fmt.Sprintf("map(%s)", funcName(r.MapFunc))
+	case *Filter:
+		return fmt.Sprintf("filter(%s)", funcName(r.FilterFunc))
+	case *Reduce:
+		inputs := []string{}
+		for _, input := range *r {
+			inputs = append(inputs, inputName(input))
+		}
+		return fmt.Sprintf("reduce(%s)", strings.Join(inputs, ", "))
+	case conditionalRenderer:
+		return fmt.Sprintf("conditional(%s)", inputName(r.Renderer))
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+func inputName(r Renderer) string {
+	switch r := r.(type) {
+	case *memoise:
+		return r.stage
+	case TopologySelector:
+		return string(r)
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+// funcName returns the unqualified name of a function, e.g. "MapEndpoint2IP".
+// Anonymous functions are named after their enclosing function.
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -1,6 +1,8 @@
 package render
 
 import (
+	"strings"
+
 	"github.com/weaveworks/scope/report"
 )
 
@@ -117,16 +119,45 @@ func (m *Map) Stats(_ report.Report, _ Decorator) Stats {
 }
 
 // Decorator transforms one renderer to another. e.g. Filters.
-type Decorator func(Renderer) Renderer
+//
+// Decorators which transform renderers in the same way must have the same
+// ID, as renders are cached by decorator ID. Renders using a decorator with
+// an empty ID are never cached.
+type Decorator interface {
+	Decorate(Renderer) Renderer
+	ID() string
+}
 
-// ComposeDecorators composes decorators into one.
+type decorator struct {
+	id string
+	f  func(Renderer) Renderer
+}
+
+// MakeDecorator makes a Decorator with the given cache identity.
+func MakeDecorator(id string, f func(Renderer) Renderer) Decorator {
+	return decorator{id, f}
+}
+
+func (d decorator) Decorate(r Renderer) Renderer { return d.f(r) }
+func (d decorator) ID() string                   { return d.id }
+
+// ComposeDecorators composes decorators into one. The composed decorator is
+// only cacheable if all its components are.
 func ComposeDecorators(decorators ...Decorator) Decorator {
-	return func(r Renderer) Renderer {
+	ids := []string{}
+	for _, d := range decorators {
+		if d.ID() == "" {
+			ids = nil
+			break
+		}
+		ids = append(ids, d.ID())
+	}
+	return MakeDecorator(strings.Join(ids, "+"), func(r Renderer) Renderer {
 		for _, decorator := range decorators {
-			r = decorator(r)
+			r = decorator.Decorate(r)
 		}
 		return r
-	}
+	})
 }
 
 type applyDecorator struct {
@@ -135,13 +166,13 @@ type applyDecorator struct {
 
 func (ad applyDecorator) Render(rpt report.Report, dct Decorator) report.Nodes {
 	if dct != nil {
-		return dct(ad.Renderer).Render(rpt, nil)
+		return dct.Decorate(ad.Renderer).Render(rpt, nil)
 	}
 	return ad.Renderer.Render(rpt, nil)
 }
 func (ad applyDecorator) Stats(rpt report.Report, dct Decorator) Stats {
 	if dct != nil {
-		return dct(ad.Renderer).Stats(rpt, nil)
+		return dct.Decorate(ad.Renderer).Stats(rpt, nil)
 	}
 	return Stats{}
 }
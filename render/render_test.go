@@ -15,7 +15,7 @@ type mockRenderer struct {
 
 func (m mockRenderer) Render(rpt report.Report, d render.Decorator) report.Nodes {
 	if d != nil {
-		return d(mockRenderer{m.Nodes}).Render(rpt, nil)
+		return d.Decorate(mockRenderer{m.Nodes}).Render(rpt, nil)
 	}
 	return m.Nodes
 }
@@ -31,4 +31,7 @@ var (
 	SelectService        = TopologySelector(report.Service)
 	SelectDeployment     = TopologySelector(report.Deployment)
 	SelectReplicaSet     = TopologySelector(report.ReplicaSet)
+	SelectKubernetesNode = TopologySelector(report.KubernetesNode)
+	SelectNamespace      = TopologySelector(report.Namespace)
+	SelectSystemdService = TopologySelector(report.SystemdService)
 )
@@ -0,0 +1,22 @@
+package render
+
+import (
+	"github.com/weaveworks/scope/report"
+)
+
+// SystemdServiceRenderer is a Renderer which produces a renderable systemd
+// service graph by merging the process graph and the systemd service
+// topology.
+var SystemdServiceRenderer = ApplyDecorators(
+	MakeReduce(
+		MakeMap(
+			Map2SystemdService,
+			ProcessRenderer,
+		),
+		SelectSystemdService,
+	),
+)
+
+// Map2SystemdService maps process Nodes to the systemd service they belong
+// to.
+var Map2SystemdService = Map2Parent(report.SystemdService)
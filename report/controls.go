@@ -1,6 +1,8 @@
 package report
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/ugorji/go/codec"
@@ -13,10 +15,96 @@ type Controls map[string]Control
 
 // A Control basically describes an RPC
 type Control struct {
-	ID    string `json:"id"`
-	Human string `json:"human"`
-	Icon  string `json:"icon"` // from https://fortawesome.github.io/Font-Awesome/cheatsheet/ please
-	Rank  int    `json:"rank"`
+	ID    string      `json:"id"`
+	Human string      `json:"human"`
+	Icon  string      `json:"icon"` // from https://fortawesome.github.io/Font-Awesome/cheatsheet/ please
+	Rank  int         `json:"rank"`
+	Args  ControlArgs `json:"args,omitempty"`
+}
+
+// Types of control arguments
+const (
+	ControlArgString = "string"
+	ControlArgInt    = "int"
+	ControlArgEnum   = "enum"
+	ControlArgBool   = "bool"
+)
+
+// ControlArg describes an argument a Control takes. Argument values are
+// always sent as strings; the type says how they will be parsed.
+type ControlArg struct {
+	Name     string   `json:"name"`
+	Human    string   `json:"human"`
+	Type     string   `json:"type"`
+	Default  string   `json:"default,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Options  []string `json:"options,omitempty"` // for enums
+	Min      *int     `json:"min,omitempty"`     // for ints
+	Max      *int     `json:"max,omitempty"`     // for ints
+}
+
+// ControlArgs is the argument schema of a Control.
+type ControlArgs []ControlArg
+
+// Validate checks the given arguments against the schema, and returns them
+// with defaults filled in for any that are missing.
+func (cas ControlArgs) Validate(args map[string]string) (map[string]string, error) {
+	known := map[string]struct{}{}
+	result := map[string]string{}
+	for _, ca := range cas {
+		known[ca.Name] = struct{}{}
+		value, ok := args[ca.Name]
+		if !ok {
+			if ca.Required {
+				return nil, fmt.Errorf("missing argument %q", ca.Name)
+			}
+			if ca.Default == "" {
+				continue
+			}
+			value = ca.Default
+		}
+		if err := ca.validate(value); err != nil {
+			return nil, err
+		}
+		result[ca.Name] = value
+	}
+	for name := range args {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+	}
+	return result, nil
+}
+
+func (ca ControlArg) validate(value string) error {
+	switch ca.Type {
+	case ControlArgString:
+	case ControlArgInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("argument %q must be an integer, got %q", ca.Name, value)
+		}
+		if ca.Min != nil && i < *ca.Min {
+			return fmt.Errorf("argument %q must be at least %d, got %d", ca.Name, *ca.Min, i)
+		}
+		if ca.Max != nil && i > *ca.Max {
+			return fmt.Errorf("argument %q must be at most %d, got %d", ca.Name, *ca.Max, i)
+		}
+	case ControlArgBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("argument %q must be a boolean, got %q", ca.Name, value)
+		}
+	case ControlArgEnum:
+		for _, option := range ca.Options {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("argument %q must be one of %v, got %q", ca.Name, ca.Options, value)
+	default:
+		return fmt.Errorf("argument %q has unknown type %q", ca.Name, ca.Type)
+	}
+	return nil
 }
 
 // Merge merges other with cs, returning a fresh Controls.
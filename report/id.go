@@ -96,6 +96,12 @@ func MakeProcessNodeID(hostID, pid string) string {
 	return hostID + ScopeDelim + pid
 }
 
+// MakeSystemdServiceNodeID produces a systemd service node ID from its
+// composite parts.
+func MakeSystemdServiceNodeID(hostID, unit string) string {
+	return hostID + ScopeDelim + unit
+}
+
 var (
 	// MakeHostNodeID produces a host node ID from its composite parts.
 	MakeHostNodeID = makeSingleComponentID("host")
@@ -138,6 +144,18 @@ var (
 
 	// ParseReplicaSetNodeID parses a replica set node ID
 	ParseReplicaSetNodeID = parseSingleComponentID("replica_set")
+
+	// MakeKubernetesNodeNodeID produces a kubernetes node node ID from its composite parts.
+	MakeKubernetesNodeNodeID = makeSingleComponentID("kubernetes_node")
+
+	// ParseKubernetesNodeNodeID parses a kubernetes node node ID
+	ParseKubernetesNodeNodeID = parseSingleComponentID("kubernetes_node")
+
+	// MakeNamespaceNodeID produces a namespace node ID from its composite parts.
+	MakeNamespaceNodeID = makeSingleComponentID("namespace")
+
+	// ParseNamespaceNodeID parses a namespace node ID
+	ParseNamespaceNodeID = parseSingleComponentID("namespace")
 )
 
 // makeSingleComponentID makes a single-component node id encoder
@@ -194,6 +212,17 @@ func ParseAddressNodeID(addressNodeID string) (hostID, address string, ok bool)
 	return fields[0], fields[1], true
 }
 
+// MakeControlProbe produces an entry of a node's ControlProbeIDs set.
+func MakeControlProbe(hostID, probeID string) string {
+	return hostID + ScopeDelim + probeID
+}
+
+// ParseControlProbe produces the host ID and probe ID from an entry of a
+// node's ControlProbeIDs set.
+func ParseControlProbe(entry string) (hostID, probeID string, ok bool) {
+	return ParseNodeID(entry)
+}
+
 // ExtractHostID extracts the host id from Node
 func ExtractHostID(m Node) string {
 	hostNodeID, _ := m.Latest.Lookup(HostNodeID)
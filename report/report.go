@@ -18,7 +18,10 @@ const (
 	Service        = "service"
 	Deployment     = "deployment"
 	ReplicaSet     = "replica_set"
+	KubernetesNode = "kubernetes_node"
+	Namespace      = "namespace"
 	ContainerImage = "container_image"
+	SystemdService = "systemd_service"
 	Host           = "host"
 	Overlay        = "overlay"
 
@@ -70,11 +73,26 @@ type Report struct {
 	// present.
 	ReplicaSet Topology
 
+	// KubernetesNode nodes represent all Kubernetes nodes in the cluster.
+	// Metadata includes things like conditions, capacity and taints. Edges
+	// are not present.
+	KubernetesNode Topology
+
+	// Namespace nodes represent all Kubernetes namespaces with objects in
+	// them. Metadata includes things like the namespace name. Edges are not
+	// present.
+	Namespace Topology
+
 	// ContainerImages nodes represent all Docker containers images on
 	// hosts running probes. Metadata includes things like image id, name etc.
 	// Edges are not present.
 	ContainerImage Topology
 
+	// SystemdService nodes represent all systemd service units on hosts
+	// running probes. Metadata includes things like their state and restart
+	// count. Edges are not present.
+	SystemdService Topology
+
 	// Host nodes are physical hosts that run probes. Metadata includes things
 	// like operating system, load, etc. The information is scraped by the
 	// probes with each published report. Edges are not present.
@@ -100,6 +118,13 @@ type Report struct {
 	// bypassing the usual spy interval, publish interval and app ws interval.
 	Shortcut bool
 
+	// Delay is how long the probe held the report back before publishing
+	// it, e.g. while the app was unreachable. Apps count the report as that
+	// much older than when it arrived, so replayed reports don't bring back
+	// things which have since gone away. Like Shortcut, it isn't copied or
+	// merged.
+	Delay time.Duration
+
 	Plugins xfer.PluginSpecs
 
 	// ID a random identifier for this report, used when caching
@@ -126,6 +151,10 @@ func MakeReport() Report {
 			WithShape(Hexagon).
 			WithLabel("image", "images"),
 
+		SystemdService: MakeTopology().
+			WithShape(Square).
+			WithLabel("service", "services"),
+
 		Host: MakeTopology().
 			WithShape(Circle).
 			WithLabel("host", "hosts"),
@@ -146,6 +175,14 @@ func MakeReport() Report {
 			WithShape(Heptagon).
 			WithLabel("replica set", "replica sets"),
 
+		KubernetesNode: MakeTopology().
+			WithShape(Circle).
+			WithLabel("node", "nodes"),
+
+		Namespace: MakeTopology().
+			WithShape(Heptagon).
+			WithLabel("namespace", "namespaces"),
+
 		Overlay: MakeTopology(),
 
 		Sampling: Sampling{},
@@ -162,11 +199,14 @@ func (r Report) Copy() Report {
 		Process:        r.Process.Copy(),
 		Container:      r.Container.Copy(),
 		ContainerImage: r.ContainerImage.Copy(),
+		SystemdService: r.SystemdService.Copy(),
 		Host:           r.Host.Copy(),
 		Pod:            r.Pod.Copy(),
 		Service:        r.Service.Copy(),
 		Deployment:     r.Deployment.Copy(),
 		ReplicaSet:     r.ReplicaSet.Copy(),
+		KubernetesNode: r.KubernetesNode.Copy(),
+		Namespace:      r.Namespace.Copy(),
 		Overlay:        r.Overlay.Copy(),
 		Sampling:       r.Sampling,
 		Window:         r.Window,
@@ -183,11 +223,14 @@ func (r Report) Merge(other Report) Report {
 	cp.Process = r.Process.Merge(other.Process)
 	cp.Container = r.Container.Merge(other.Container)
 	cp.ContainerImage = r.ContainerImage.Merge(other.ContainerImage)
+	cp.SystemdService = r.SystemdService.Merge(other.SystemdService)
 	cp.Host = r.Host.Merge(other.Host)
 	cp.Pod = r.Pod.Merge(other.Pod)
 	cp.Service = r.Service.Merge(other.Service)
 	cp.Deployment = r.Deployment.Merge(other.Deployment)
 	cp.ReplicaSet = r.ReplicaSet.Merge(other.ReplicaSet)
+	cp.KubernetesNode = r.KubernetesNode.Merge(other.KubernetesNode)
+	cp.Namespace = r.Namespace.Merge(other.Namespace)
 	cp.Overlay = r.Overlay.Merge(other.Overlay)
 	cp.Sampling = r.Sampling.Merge(other.Sampling)
 	cp.Window += other.Window
@@ -206,6 +249,9 @@ func (r Report) Topologies() []Topology {
 		r.Service,
 		r.Deployment,
 		r.ReplicaSet,
+		r.KubernetesNode,
+		r.Namespace,
+		r.SystemdService,
 		r.Host,
 		r.Overlay,
 	}
@@ -222,6 +268,9 @@ func (r Report) Topology(name string) (Topology, bool) {
 		Service:        r.Service,
 		Deployment:     r.Deployment,
 		ReplicaSet:     r.ReplicaSet,
+		KubernetesNode: r.KubernetesNode,
+		Namespace:      r.Namespace,
+		SystemdService: r.SystemdService,
 		Host:           r.Host,
 		Overlay:        r.Overlay,
 	}[name]
@@ -279,4 +328,8 @@ const (
 	HostNodeID = "host_node_id"
 	// ControlProbeID is the random ID of the probe which controls the specific node.
 	ControlProbeID = "control_probe_id"
+	// ControlProbeIDs is a set of the probes which control a node that is on
+	// many hosts under the same ID, such as a container image, made with
+	// MakeControlProbe. The node's controls are offered for each host.
+	ControlProbeIDs = "control_probe_ids"
 )